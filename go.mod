@@ -9,6 +9,7 @@ require (
 	github.com/ryboe/q v1.0.19
 	github.com/stretchr/testify v1.8.2
 	github.com/tarantool/go-tarantool v1.10.0
+	golang.org/x/text v0.14.0
 	gopkg.in/vmihailenco/msgpack.v2 v2.9.2
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,350 @@
+package tarantella
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// The instance may follow a master as a replica: the data is fetched on bootstrap and rows
+// of IPROTO_SUBSCRIBE are applied and logged with their LSNs. Requests of clients are refused,
+// so the instance is a read-only mirror
+
+// serverVersion is IPROTO_SERVER_VERSION of the instance
+const serverVersion = versionMajor<<16 | versionMinor<<8 | versionPatch
+
+// upstream statuses like box.info.replication[id].upstream.status
+const (
+	upstreamConnect      = "connect"
+	upstreamFollow       = "follow"
+	upstreamDisconnected = "disconnected"
+	upstreamStopped      = "stopped"
+)
+
+type (
+	// applier follows the master
+	applier struct {
+		inst     *Instance
+		addr     string
+		user     string
+		password string
+		anon     bool // the instance isn't registered in _cluster of the master
+		cancel   context.CancelFunc
+		done     chan struct{}
+
+		mu       sync.Mutex
+		status   string
+		message  string    // the last error
+		masterID uint64    // replica id of the master
+		received time.Time // when the last row or heartbeat was received
+		lag      float64   // between writing of the last row by the master and its receiving
+	}
+)
+
+// newApplier makes the applier of [user:password@]host:port
+func newApplier(inst *Instance, uri string, anon bool) *applier {
+	a := &applier{inst: inst, addr: uri, anon: anon, status: upstreamConnect}
+	if i := strings.LastIndex(uri, "@"); i >= 0 {
+		a.addr = uri[i+1:]
+		a.user, a.password, _ = strings.Cut(uri[:i], ":")
+	}
+	return a
+}
+
+// connect connects to the master and authenticates
+func (a *applier) connect(ctx context.Context) (net.Conn, error) {
+	d := &net.Dialer{Timeout: handshakeTimeout}
+	c, err := d.DialContext(ctx, "tcp", a.addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to connect to master %s", a.addr)
+	}
+	greeting, err := handshake(c, a.user, a.password)
+	if err != nil {
+		c.Close() //nolint: errcheck
+		return nil, errors.Wrapf(err, "master %s", a.addr)
+	}
+	log.Info().Str("master", a.addr).Str("greeting", greeting).Msg("Connected to the master")
+	return c, nil
+}
+
+// bootstrap loads the data of the master into the storage, it returns the vclock of the data.
+// An anonymous replica gets a snapshot by IPROTO_FETCH_SNAPSHOT, a registered one joins the master
+// getting the snapshot and rows written till the registration
+func (a *applier) bootstrap(ctx context.Context) (Vclock, error) {
+	c, err := a.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close() //nolint: errcheck
+	r := bufio.NewReaderSize(c, connBufferSize)
+
+	// each stage ends with IPROTO_OK: the read view, the snapshot, the final join
+	requestType, body, stages := IPROTO_JOIN, map[any]any{IPROTO_INSTANCE_UUID: a.inst.UUID}, 3
+	if a.anon {
+		requestType, body, stages = IPROTO_FETCH_SNAPSHOT, map[any]any{}, 2
+	}
+	body[IPROTO_SERVER_VERSION] = uint64(serverVersion)
+	if err := a.send(c, requestType, body); err != nil {
+		return nil, err
+	}
+
+	var vclock Vclock
+	var count int
+	for stage := 0; stage < stages; {
+		row, err := a.read(c, r)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to bootstrap from master")
+		}
+		switch {
+		case row.Type == IPROTO_OK:
+			if stage == 0 {
+				if vclock, err = rowVclock(row); err != nil {
+					return nil, err
+				}
+			}
+			stage++
+		case row.isDML():
+			// rows of the snapshot have no LSNs, rows of the final join move the vclock
+			row.snapshot = row.LSN == 0
+			if err := a.inst.storage.Apply(row); err != nil {
+				return nil, errors.Wrap(err, "unable to apply row of master")
+			}
+			vclock.Follow(row.ReplicaID, row.LSN)
+			count++
+		case row.LSN != 0:
+			vclock.Follow(row.ReplicaID, row.LSN)
+		}
+	}
+	log.Info().Str("master", a.addr).Int("rows", count).Stringer("vclock", vclock).Msg("Bootstrapped from the master")
+	return vclock, nil
+}
+
+// start starts following the master in background
+func (a *applier) start(ctx context.Context) {
+	ctx, a.cancel = context.WithCancel(ctx)
+	a.done = make(chan struct{})
+	go func() {
+		defer close(a.done)
+		a.run(ctx)
+	}()
+}
+
+// stop stops following and waits till the row being applied is done
+func (a *applier) stop() {
+	if a.cancel != nil {
+		a.cancel()
+		<-a.done
+		a.cancel = nil
+	}
+}
+
+// run follows the master till the context is done, it reconnects after errors
+func (a *applier) run(ctx context.Context) {
+	for {
+		err := a.subscribe(ctx)
+		if ctx.Err() != nil {
+			a.setStatus(upstreamStopped, nil)
+			return
+		}
+		a.setStatus(upstreamDisconnected, err)
+		log.Error().Err(err).Str("master", a.addr).Msg("Replication is broken, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			a.setStatus(upstreamStopped, nil)
+			return
+		case <-time.After(a.inst.replicationTimeout()):
+		}
+	}
+}
+
+// subscribe applies rows of the master till an error, the master is acknowledged
+// by the vclock of the instance after each transaction and heartbeat
+func (a *applier) subscribe(ctx context.Context) error {
+	a.setStatus(upstreamConnect, nil)
+	c, err := a.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint: errcheck
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		c.Close() //nolint: errcheck
+	}()
+	r := bufio.NewReaderSize(c, connBufferSize)
+
+	vclock := a.inst.Vclock()
+	err = a.send(c, IPROTO_SUBSCRIBE, map[any]any{
+		IPROTO_INSTANCE_UUID:   a.inst.UUID,
+		IPROTO_REPLICASET_UUID: a.inst.storage.replicasetUUID(),
+		IPROTO_VCLOCK:          vclock.toMap(),
+		IPROTO_SERVER_VERSION:  uint64(serverVersion),
+		IPROTO_REPLICA_ANON:    a.anon,
+		IPROTO_ID_FILTER:       []any{},
+	})
+	if err != nil {
+		return err
+	}
+	row, err := a.read(c, r)
+	if err != nil {
+		return errors.Wrap(err, "unable to subscribe")
+	}
+	a.mu.Lock()
+	a.masterID = row.ReplicaID
+	a.mu.Unlock()
+	a.setStatus(upstreamFollow, nil)
+	log.Info().Str("master", a.addr).Uint64("master-id", row.ReplicaID).Stringer("vclock", vclock).
+		Msg("Subscribed to the master")
+
+	var (
+		tx      []*Row
+		pending synchroTx // transactions of synchronous spaces are applied when they are confirmed
+	)
+	for {
+		row, err := a.read(c, r)
+		if err != nil {
+			return err
+		}
+		switch {
+		case row.Type == IPROTO_OK:
+			// heartbeat
+			if err := a.ack(c); err != nil {
+				return err
+			}
+			continue
+		case row.Type == IPROTO_RAFT:
+			a.mu.Lock()
+			masterID := a.masterID
+			a.mu.Unlock()
+			a.inst.raft.observeMessage(masterID, row.Body)
+			a.inst.broadcastElection()
+			continue
+		case row.LSN == 0:
+			continue // other service rows are not logged
+		}
+		tx = append(tx, row)
+		if !row.isCommit() {
+			continue
+		}
+		if row.LSN > a.inst.Vclock()[row.ReplicaID] && !pending.add(tx) {
+			if err := a.applySynchro(row, &pending); err != nil {
+				return err
+			}
+			if err := a.inst.storage.applyTx(tx); err != nil {
+				return errors.Wrapf(err, "unable to apply row {%d: %d}", row.ReplicaID, row.LSN)
+			}
+		}
+		tx = nil
+		if r.Buffered() == 0 {
+			if err := a.ack(c); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// applySynchro applies transactions confirmed by RAFT_CONFIRM, RAFT_PROMOTE or RAFT_DEMOTE row
+func (a *applier) applySynchro(row *Row, pending *synchroTx) error {
+	switch row.Type {
+	case IPROTO_RAFT_CONFIRM, IPROTO_RAFT_ROLLBACK:
+	case IPROTO_RAFT_PROMOTE, IPROTO_RAFT_DEMOTE:
+		defer a.inst.broadcastElection()
+		a.inst.raft.observe(row)
+	default:
+		return nil
+	}
+	for _, tx := range pending.resolve(row) {
+		if err := a.inst.storage.applyTx(tx); err != nil {
+			last := tx[len(tx)-1]
+			return errors.Wrapf(err, "unable to apply row {%d: %d}", last.ReplicaID, last.LSN)
+		}
+	}
+	return nil
+}
+
+// send sends the request to the master
+func (a *applier) send(c net.Conn, requestType uint64, body map[any]any) error {
+	req := &Package{}
+	req.SetHeader(IPROTO_REQUEST_TYPE, requestType)
+	req.SetHeader(IPROTO_SYNC, uint64(0))
+	for k, v := range body {
+		req.SetBody(k, v)
+	}
+	err := req.writeTo(c, false)
+	req.release()
+	return errors.Wrap(err, "unable to send request to master")
+}
+
+// ack sends the vclock of the instance to the master
+func (a *applier) ack(c net.Conn) error {
+	return a.send(c, IPROTO_OK, map[any]any{IPROTO_VCLOCK: a.inst.Vclock().toMap()})
+}
+
+// read reads the next row, an error response of the master is returned as *BoxError.
+// The master is considered dead if there are no heartbeats for 4 replication timeouts
+func (a *applier) read(c net.Conn, r *bufio.Reader) (*Row, error) {
+	c.SetReadDeadline(time.Now().Add(4 * a.inst.replicationTimeout())) //nolint: errcheck
+	pack, err := readPackage(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read from master")
+	}
+	row, err := decodeRow(&mpDecoder{buf: pack.rawData})
+	pack.release()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode row of master")
+	}
+	if row.Type&IPROTO_TYPE_ERROR != 0 {
+		message, _ := row.Body[IPROTO_ERROR_24].(string)
+		return nil, NewBoxError(uint32(row.Type&^IPROTO_TYPE_ERROR), "%s", message)
+	}
+
+	a.mu.Lock()
+	a.received = time.Now()
+	if row.Timestamp > 0 {
+		a.lag = float64(a.received.UnixNano())/1e9 - row.Timestamp
+	}
+	a.mu.Unlock()
+	return row, nil
+}
+
+// rowVclock returns IPROTO_VCLOCK of the response
+func rowVclock(row *Row) (Vclock, error) {
+	r := &bodyReader{m: row.Body, part: "packet body"}
+	vclock := r.vclock(IPROTO_VCLOCK, true)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return vclock, nil
+}
+
+func (a *applier) setStatus(status string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status = status
+	if err != nil {
+		a.message = err.Error()
+	}
+}
+
+// upstream describes the applier like box.info.replication[id].upstream
+func (a *applier) upstream() (uint64, map[any]any) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info := map[any]any{"status": a.status, "peer": a.addr, "lag": a.lag}
+	if !a.received.IsZero() {
+		info["idle"] = time.Since(a.received).Seconds()
+	}
+	if a.message != "" {
+		info["message"] = a.message
+	}
+	return a.masterID, info
+}
@@ -0,0 +1,96 @@
+package tarantella
+
+import "encoding/binary"
+
+// bitset indexes keep unsigned or string fields as sets of bits, bit i of a string is bit i%8 of its byte i/8;
+// entries are sorted by the primary key and iterators check each of them
+
+// bitsOf returns bytes of the bitset value, trailing zero bytes are trimmed
+func bitsOf(v any) ([]byte, bool) {
+	var bits []byte
+	switch vv := v.(type) {
+	case string:
+		bits = []byte(vv)
+	default:
+		if !fieldTypeMatches("unsigned", v) {
+			return nil, false
+		}
+		kind, i, u, _ := normalizeNumber(v)
+		if kind == numberInt {
+			u = uint64(i)
+		}
+		bits = binary.LittleEndian.AppendUint64(nil, u)
+	}
+	for len(bits) > 0 && bits[len(bits)-1] == 0 {
+		bits = bits[:len(bits)-1]
+	}
+	return bits, true
+}
+
+// matchBits checks the value against the key by the iterator
+func matchBits(iterator uint64, value, key []byte) bool {
+	if iterator == ITER_EQ {
+		return string(value) == string(key)
+	}
+	for i, k := range key {
+		var v byte
+		if i < len(value) {
+			v = value[i]
+		}
+		switch iterator {
+		case ITER_BITS_ALL_SET:
+			if v&k != k {
+				return false
+			}
+		case ITER_BITS_ANY_SET:
+			if v&k != 0 {
+				return true
+			}
+		case ITER_BITS_ALL_NOT_SET:
+			if v&k != 0 {
+				return false
+			}
+		}
+	}
+	return iterator != ITER_BITS_ANY_SET
+}
+
+// selectBits selects tuples by the bitset iterator, the key is an unsigned or a string
+func (idx *Index) selectBits(iterator uint64, key []any, offset, limit uint64) ([]any, error) {
+	switch iterator {
+	case ITER_ALL, ITER_EQ, ITER_BITS_ALL_SET, ITER_BITS_ANY_SET, ITER_BITS_ALL_NOT_SET:
+	default:
+		return nil, idx.unsupported("requested iterator type")
+	}
+	if len(key) > 1 {
+		return nil, ErrKeyPartCount(1, len(key))
+	}
+
+	var bits []byte
+	if len(key) == 0 {
+		iterator = ITER_ALL
+	} else {
+		var ok bool
+		if bits, ok = bitsOf(key[0]); !ok {
+			return nil, ErrKeyPartType(0, idx.Parts[0].Type)
+		}
+	}
+
+	data := []any{}
+	skipped := uint64(0)
+	for _, t := range idx.tuples {
+		if uint64(len(data)) >= limit {
+			break
+		}
+		value, _ := bitsOf(idx.Parts[0].value(t))
+		if iterator != ITER_ALL && !matchBits(iterator, value, bits) {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		data = append(data, t)
+	}
+	return data, nil
+}
@@ -0,0 +1,45 @@
+package tarantella
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitset(t *testing.T) {
+	inst, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	s := inst.storage
+
+	sp, err := s.createSpace("flags", map[any]any{}, []any{},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}},
+		[]any{1, "bits", "bitset", map[any]any{"unique": false}, []any{[]any{1, "unsigned"}}},
+	)
+	require.NoError(t, err)
+	for id, bits := range []uint64{0b0011, 0b0101, 0b1000, 0b0001} {
+		_, err = s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{uint64(id + 1), bits}})
+		require.NoError(t, err)
+	}
+	ids := func(iterator uint64, key ...any) []any {
+		data, err := s.Select(&SelectRequest{SpaceID: sp.ID, IndexID: 1, Iterator: iterator, Key: key, Limit: 10})
+		require.NoError(t, err)
+		var ids []any
+		for _, t := range data {
+			ids = append(ids, t.([]any)[0])
+		}
+		return ids
+	}
+
+	require.Equal(t, []any{uint64(1), uint64(2), uint64(4)}, ids(ITER_BITS_ALL_SET, uint64(0b0001)))
+	require.Equal(t, []any{uint64(1), uint64(2), uint64(3)}, ids(ITER_BITS_ANY_SET, uint64(0b1110)))
+	require.Equal(t, []any{uint64(3), uint64(4)}, ids(ITER_BITS_ALL_NOT_SET, uint64(0b0110)))
+	require.Equal(t, []any{uint64(2)}, ids(ITER_EQ, uint64(0b0101)))
+	require.Len(t, ids(ITER_ALL), 4)
+
+	_, err = s.Select(&SelectRequest{SpaceID: sp.ID, IndexID: 1, Iterator: ITER_GT, Key: []any{uint64(1)}, Limit: 1})
+	require.Equal(t, ER_UNSUPPORTED_INDEX_FEATURE, err.(*BoxError).Code)
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{sp.ID, uint64(2), "unique_bits", "bitset",
+		map[any]any{"unique": true}, []any{[]any{uint64(1), "unsigned"}}}})
+	require.Equal(t, ER_MODIFY_INDEX, err.(*BoxError).Code)
+}
@@ -0,0 +1,150 @@
+package tarantella
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// see https://www.tarantool.io/en/doc/latest/dev_guide/internals/box_protocol/#error-responses
+
+type (
+	// BoxError is an error which is sent to the client as an error response.
+	// Handlers and stored functions return it to fail the request without closing the connection
+	BoxError struct {
+		Type    string         // error class like ClientError, CustomError
+		Code    uint32         // ER_XXX from errcode.h
+		Message string         // human readable message, IPROTO_ERROR_24
+		File    string         // source file where error was created
+		Line    uint64         // source line where error was created
+		Errno   uint64         // saved errno, if any
+		Fields  map[string]any // additional fields of the error (custom_type for example)
+		Prev    *BoxError      // the cause of the error, next in the stack
+	}
+)
+
+const (
+	boxErrorClient = "ClientError"
+	boxErrorCustom = "CustomError"
+	boxErrorSystem = "SystemError"
+)
+
+// NewBoxError creates a ClientError with code and formatted message
+func NewBoxError(code uint32, format string, args ...any) *BoxError {
+	e := &BoxError{
+		Type:    boxErrorClient,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+	e.File, e.Line = caller(2)
+	return e
+}
+
+// NewCustomError creates an error like box.error.new({type = customType, reason = ...}) does
+func NewCustomError(customType, format string, args ...any) *BoxError {
+	e := &BoxError{
+		Type:    boxErrorCustom,
+		Message: fmt.Sprintf(format, args...),
+		Fields:  map[string]any{"custom_type": customType},
+	}
+	e.File, e.Line = caller(2)
+	return e
+}
+
+// newSystemError creates a SystemError, errno is taken from the cause if any
+func newSystemError(cause error, format string, args ...any) *BoxError {
+	e := &BoxError{
+		Type:    boxErrorSystem,
+		Code:    ER_SYSTEM,
+		Message: fmt.Sprintf(format, args...),
+	}
+	e.File, e.Line = caller(2)
+
+	var errno syscall.Errno
+	if errors.As(cause, &errno) {
+		e.Errno = uint64(errno)
+		e.Message += ": " + errno.Error()
+	}
+	return e
+}
+
+// caller returns file and line of the function skip frames above
+func caller(skip int) (string, uint64) {
+	_, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return "", 0
+	}
+	return filepath.Base(file), uint64(line)
+}
+
+// Error implements error interface
+func (e *BoxError) Error() string {
+	return e.Message
+}
+
+// WithPrev sets the cause of the error and returns the error itself
+func (e *BoxError) WithPrev(prev *BoxError) *BoxError {
+	e.Prev = prev
+	return e
+}
+
+// WithErrno sets errno of the error and returns the error itself
+func (e *BoxError) WithErrno(errno uint64) *BoxError {
+	e.Errno = errno
+	return e
+}
+
+// WithField sets an additional field of the error and returns the error itself
+func (e *BoxError) WithField(k string, v any) *BoxError {
+	if e.Fields == nil {
+		e.Fields = make(map[string]any)
+	}
+	e.Fields[k] = v
+	return e
+}
+
+// AsBoxError extracts BoxError from the error chain
+func AsBoxError(err error) (*BoxError, bool) {
+	var be *BoxError
+	if errors.As(err, &be) {
+		return be, true
+	}
+	return nil, false
+}
+
+// MpError returns MP_ERROR representation of the error stack
+func (e *BoxError) MpError() map[any]any {
+	stack := []any{}
+	for cur := e; cur != nil; cur = cur.Prev {
+		details := map[any]any{
+			MP_ERROR_TYPE:    cur.Type,
+			MP_ERROR_FILE:    cur.File,
+			MP_ERROR_LINE:    cur.Line,
+			MP_ERROR_MESSAGE: cur.Message,
+			MP_ERROR_ERRNO:   cur.Errno,
+			MP_ERROR_CODE:    uint64(cur.Code),
+		}
+		if len(cur.Fields) > 0 {
+			fields := make(map[any]any, len(cur.Fields))
+			for k, v := range cur.Fields {
+				fields[k] = v
+			}
+			details[MP_ERROR_FIELDS] = fields
+		}
+		stack = append(stack, details)
+	}
+	return map[any]any{MP_ERROR_STACK: stack}
+}
+
+// SetError turns the package into error response for the error
+func (pack *Package) SetError(e *BoxError, errorExtension bool) {
+	pack.SetHeader(IPROTO_REQUEST_TYPE, IPROTO_TYPE_ERROR|uint64(e.Code))
+	pack.resetBody()
+	pack.SetBody(IPROTO_ERROR_24, e.Message)
+	if errorExtension {
+		pack.SetBody(IPROTO_ERROR, e.MpError())
+	}
+}
@@ -0,0 +1,579 @@
+package tarantella
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// catalog of the storage is kept in _space and _index, see Storage
+
+// prepareCatalog checks the change of _space, _index, sequences, collations, functions or constraints and prepares the modification of the catalog
+func (s *Storage) prepareCatalog(ch *change) error {
+	switch ch.space.ID {
+	case BOX_SPACE_ID:
+		return s.prepareSpace(ch)
+	case BOX_INDEX_ID:
+		return s.prepareIndex(ch)
+	case BOX_SEQUENCE_ID, BOX_SEQUENCE_DATA_ID, BOX_SPACE_SEQUENCE_ID:
+		return s.prepareSequence(ch)
+	case BOX_COLLATION_ID:
+		return s.prepareCollation(ch)
+	case BOX_FUNC_ID:
+		return s.prepareFunction(ch)
+	case BOX_FK_CONSTRAINT_ID:
+		return s.prepareFkConstraint(ch)
+	case BOX_CK_CONSTRAINT_ID:
+		return s.prepareCkConstraint(ch)
+	}
+	return nil
+}
+
+func (s *Storage) prepareSpace(ch *change) error {
+	if ch.new == nil {
+		sp := s.spaces[tupleUint(ch.old, 0)]
+		if sp == nil {
+			return nil
+		}
+		if len(sp.Indexes) > 0 {
+			return ClientError(ER_DROP_SPACE, sp.Name, "the space has indexes")
+		}
+		if err := s.dependentConstraints(sp); err != nil {
+			return err
+		}
+		ch.catalog = func() {
+			delete(s.spaces, sp.ID)
+			delete(s.names, sp.Name)
+			s.dropTriggers(sp.ID)
+		}
+		ch.uncatalog = func() { s.installSpace(sp) }
+		return nil
+	}
+
+	sp, err := spaceFromTuple(ch.new)
+	if err != nil {
+		return err
+	}
+	old := s.spaces[sp.ID]
+	if other, ok := s.names[sp.Name]; ok && other != old {
+		return ErrSpaceExists(sp.Name)
+	}
+	if old != nil && old.Len() > 0 && old.Engine != sp.Engine {
+		return ClientError(ER_ALTER_SPACE, sp.Name, "can not change space engine")
+	}
+	if old != nil {
+		// the new format has to fit indexes and the data
+		sp.Indexes = old.Indexes
+		defer func() { sp.Indexes = nil }()
+		for _, idx := range old.Indexes {
+			if err := sp.checkIndexParts(idx); err != nil {
+				return err
+			}
+		}
+		for _, t := range old.Tuples() {
+			if err := sp.checkTuple(t); err != nil {
+				return err
+			}
+		}
+	}
+	ch.catalog = func() {
+		if old != nil {
+			// the definition is changed, data and indexes stay
+			sp.Indexes = old.Indexes
+			for _, idx := range sp.Indexes {
+				idx.space = sp
+			}
+		}
+		s.installSpace(sp)
+	}
+	ch.uncatalog = func() {
+		if old == nil {
+			delete(s.spaces, sp.ID)
+			delete(s.names, sp.Name)
+			return
+		}
+		old.Indexes = sp.Indexes
+		for _, idx := range old.Indexes {
+			idx.space = old
+		}
+		s.installSpace(old)
+	}
+	return nil
+}
+
+func (s *Storage) prepareIndex(ch *change) error {
+	tuple := ch.new
+	if tuple == nil {
+		tuple = ch.old
+	}
+	sp, ok := s.spaces[tupleUint(tuple, 0)]
+	if !ok {
+		return ErrNoSuchSpace(tupleUint(tuple, 0))
+	}
+
+	if ch.new == nil {
+		id := tupleUint(ch.old, 1)
+		if id == 0 && len(sp.Indexes) > 1 {
+			return ClientError(ER_DROP_PRIMARY_KEY, sp.Name)
+		}
+		if err := s.referencedIndex(sp, id); err != nil {
+			return err
+		}
+		dropped, err := sp.index(id)
+		if err != nil {
+			return nil
+		}
+		ch.catalog = func() { sp.dropIndex(id) }
+		ch.uncatalog = func() { sp.installIndex(dropped) }
+		return nil
+	}
+
+	idx, err := indexFromTuple(ch.new, sp)
+	if err != nil {
+		return err
+	}
+	if err := s.resolveCollations(idx); err != nil {
+		return err
+	}
+	if id, ok := idx.Opts["func"].(uint64); ok {
+		// the function is checked unless it's recovered later
+		if fn, _ := s.spaces[BOX_FUNC_ID].get(0, []any{id}); fn != nil {
+			if deterministic, _ := tupleField(fn, 11).(bool); !deterministic {
+				return ClientError(ER_WRONG_INDEX_OPTIONS, "referenced function doesn't satisfy functional index function constraints")
+			}
+		}
+		idx.keyFunc = s.keyFunction(idx, id)
+	}
+	if other, ok := sp.IndexByName(idx.Name); ok && other.ID != idx.ID {
+		return ErrIndexExistsInSpace(idx.Name, sp.Name)
+	}
+	if idx.ID != 0 && sp.primary() == nil {
+		return ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, "can not add a secondary key before primary")
+	}
+	if err := sp.checkIndexParts(idx); err != nil {
+		return err
+	}
+
+	// check the index may be built on the existing data
+	if err := idx.build(sp); err != nil {
+		return err
+	}
+	prev, _ := sp.index(idx.ID)
+	ch.catalog = func() {
+		// the change may touch the space itself, so build the index again
+		idx.build(sp) //nolint: errcheck
+		sp.installIndex(idx)
+	}
+	ch.uncatalog = func() {
+		if prev == nil {
+			sp.dropIndex(idx.ID)
+			return
+		}
+		sp.installIndex(prev)
+	}
+	return nil
+}
+
+// build fills the index with tuples of the space, the index is not installed
+func (idx *Index) build(sp *Space) error {
+	idx.space = sp
+	idx.tuples, idx.entries = nil, nil
+	idx.cmp = idx.comparisonParts(sp.primary())
+	for _, t := range sp.Tuples() {
+		if _, err := idx.keys(t); err != nil {
+			return err
+		}
+		if idx.Unique {
+			if dup, _ := idx.find(t, false); dup != nil {
+				return ErrTupleFound(idx.Name, sp.Name, dup, t)
+			}
+		}
+		idx.insert(t)
+	}
+	return nil
+}
+
+// spaceFromTuple parses _space tuple [id, owner, name, engine, field_count, flags, format]
+func spaceFromTuple(t []any) (*Space, error) {
+	if len(t) < 7 {
+		return nil, ErrFieldMissing(len(t) + 1)
+	}
+	sp := &Space{
+		ID:         tupleUint(t, 0),
+		Owner:      tupleUint(t, 1),
+		FieldCount: tupleUint(t, 4),
+	}
+	var ok bool
+	if sp.Name, ok = t[2].(string); !ok {
+		return nil, ErrFieldType(3, "string", mpTypeName(t[2]))
+	}
+	if sp.Engine, ok = t[3].(string); !ok {
+		return nil, ErrFieldType(4, "string", mpTypeName(t[3]))
+	}
+	if sp.Flags, ok = t[5].(map[any]any); !ok {
+		return nil, ErrFieldType(6, "map", mpTypeName(t[5]))
+	}
+	format, ok := t[6].([]any)
+	if !ok {
+		return nil, ErrFieldType(7, "array", mpTypeName(t[6]))
+	}
+
+	switch sp.Engine {
+	case engineMemtx, engineVinyl, engineSysview, engineBlackhole, engineService:
+	default:
+		return nil, ClientError(ER_CREATE_SPACE, sp.Name, fmt.Sprintf("engine '%s' does not exist", sp.Engine))
+	}
+
+	for i, f := range format {
+		m, ok := f.(map[any]any)
+		if !ok {
+			return nil, ClientError(ER_WRONG_SPACE_FORMAT, i+1, "expected a map")
+		}
+		fd := FieldDef{Type: "any"}
+		fd.Name, _ = m["name"].(string)
+		if typ, ok := m["type"].(string); ok {
+			fd.Type = typ
+		}
+		fd.IsNullable, _ = m["is_nullable"].(bool)
+		fd.Collation, _ = m["collation"].(uint64)
+		if fd.Name == "" {
+			return nil, ClientError(ER_WRONG_SPACE_FORMAT, i+1, "field name is missing")
+		}
+		for _, prev := range sp.Format {
+			if prev.Name == fd.Name {
+				return nil, ClientError(ER_SPACE_FIELD_IS_DUPLICATE, fd.Name)
+			}
+		}
+		sp.Format = append(sp.Format, fd)
+	}
+	return sp, nil
+}
+
+// indexFromTuple parses _index tuple [space_id, iid, name, type, opts, parts],
+// parts are either [[field, type], ...] or [{field = , type = , is_nullable = }, ...]
+func indexFromTuple(t []any, sp *Space) (*Index, error) {
+	if len(t) < 6 {
+		return nil, ErrFieldMissing(len(t) + 1)
+	}
+	idx := &Index{
+		ID:     tupleUint(t, 1),
+		Unique: true,
+	}
+	var ok bool
+	if idx.Name, ok = t[2].(string); !ok {
+		return nil, ErrFieldType(3, "string", mpTypeName(t[2]))
+	}
+	typ, ok := t[3].(string)
+	if !ok {
+		return nil, ErrFieldType(4, "string", mpTypeName(t[3]))
+	}
+	idx.Type = strings.ToUpper(typ)
+	if idx.Opts, ok = t[4].(map[any]any); !ok {
+		return nil, ErrFieldType(5, "map", mpTypeName(t[4]))
+	}
+	if unique, ok := idx.Opts["unique"].(bool); ok {
+		idx.Unique = unique
+	}
+	if idx.ID == 0 {
+		idx.Unique = true
+	}
+
+	switch idx.Type {
+	case "TREE":
+	case "HASH":
+		if !idx.Unique {
+			return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, "HASH index must be unique")
+		}
+	case "RTREE", "BITSET":
+		if idx.Unique {
+			return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, idx.Type+" index can not be unique")
+		}
+	default:
+		return nil, ClientError(ER_INDEX_TYPE, idx.Name, sp.Name)
+	}
+	if sp.Engine == engineVinyl && idx.Type != "TREE" {
+		return nil, ClientError(ER_INDEX_TYPE, idx.Name, sp.Name)
+	}
+	if err := checkIndexOpts(idx.Opts); err != nil {
+		return nil, err
+	}
+
+	parts, ok := t[5].([]any)
+	if !ok {
+		return nil, ErrFieldType(6, "array", mpTypeName(t[5]))
+	}
+	if len(parts) == 0 {
+		return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, "part count must be positive")
+	}
+	for i, p := range parts {
+		part, err := indexPart(p, sp)
+		if err != nil {
+			return nil, ClientError(ER_WRONG_INDEX_PARTS, i+1, err.Error())
+		}
+		if part.IsNullable && idx.ID == 0 {
+			return nil, ClientError(ER_NULLABLE_PRIMARY, sp.Name)
+		}
+		if multikeyAt(part.path) >= 0 {
+			idx.multikey = true
+		}
+		idx.Parts = append(idx.Parts, part)
+	}
+
+	switch {
+	case idx.multikey && idx.ID == 0:
+		return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, "primary key cannot be multikey")
+	case idx.multikey && idx.Type != "TREE":
+		return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, idx.Type+" index cannot be multikey")
+	case idx.Opts["func"] != nil && idx.ID == 0:
+		return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, "primary key can not use a function")
+	case idx.Opts["func"] != nil && !idx.ordered():
+		return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, idx.Type+" index can not use a function")
+	case !idx.ordered() && len(idx.Parts) != 1:
+		return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, idx.Type+" index key can not be multipart")
+	case idx.Type == "RTREE" && canonicalFieldType(idx.Parts[0].Type) != "array":
+		return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, "RTREE index field type must be ARRAY")
+	case idx.Type == "BITSET" && canonicalFieldType(idx.Parts[0].Type) != "unsigned" &&
+		canonicalFieldType(idx.Parts[0].Type) != "string":
+		return nil, ClientError(ER_MODIFY_INDEX, idx.Name, sp.Name, "BITSET index field type must be NUM or STR")
+	}
+	if idx.Type == "RTREE" {
+		if err := idx.checkRtreeOpts(); err != nil {
+			return nil, err
+		}
+	}
+	if idx.Opts["func"] != nil {
+		for _, p := range idx.Parts {
+			if p.Path != "" {
+				return nil, ClientError(ER_FUNC_INDEX_PARTS, "key path is not supported")
+			}
+		}
+	}
+	return idx, nil
+}
+
+// checkIndexOpts checks options of LSM trees, vinyl uses them and memtx accepts them like tarantool does
+func checkIndexOpts(opts map[any]any) error {
+	number := func(key string) (float64, bool) {
+		f, ok := coordinate(opts[key])
+		return f, ok
+	}
+	if fpr, ok := number("bloom_fpr"); ok && (fpr <= 0 || fpr > 1) {
+		return ClientError(ER_WRONG_INDEX_OPTIONS, "bloom_fpr must be greater than 0 and less than or equal to 1")
+	}
+	page, hasPage := number("page_size")
+	rng, hasRange := number("range_size")
+	if hasPage && (page <= 0 || (hasRange && rng > 0 && page > rng)) {
+		return ClientError(ER_WRONG_INDEX_OPTIONS, "page_size must be greater than 0 and less than or equal to range_size")
+	}
+	if hasRange && rng <= 0 {
+		return ClientError(ER_WRONG_INDEX_OPTIONS, "range_size must be greater than 0")
+	}
+	if runs, ok := number("run_count_per_level"); ok && runs <= 0 {
+		return ClientError(ER_WRONG_INDEX_OPTIONS, "run_count_per_level must be greater than 0")
+	}
+	if ratio, ok := number("run_size_ratio"); ok && ratio <= 1 {
+		return ClientError(ER_WRONG_INDEX_OPTIONS, "run_size_ratio must be greater than 1")
+	}
+	return nil
+}
+
+func indexPart(p any, sp *Space) (IndexPart, error) {
+	part := IndexPart{}
+	switch pp := p.(type) {
+	case []any:
+		if len(pp) < 2 {
+			return part, fmt.Errorf("expected [field, type]")
+		}
+		part.Field = tupleUint(pp, 0)
+		part.Type, _ = pp[1].(string)
+	case map[any]any:
+		switch f := pp["field"].(type) {
+		case uint64:
+			part.Field = f
+		case string:
+			// box.schema.index.create takes paths like data.user.id
+			no, path, ok := sp.fieldPath(f)
+			if !ok {
+				return part, fmt.Errorf("field '%s' was not found", f)
+			}
+			part.Field, part.Path = no, path
+		default:
+			return part, fmt.Errorf("field is missing")
+		}
+		if path, ok := pp["path"].(string); ok {
+			part.Path = path
+		}
+		part.Type, _ = pp["type"].(string)
+		part.IsNullable, _ = pp["is_nullable"].(bool)
+		var ok bool
+		if part.Collation, ok = pp["collation"].(uint64); !ok && part.Path == "" && part.Field < uint64(len(sp.Format)) {
+			// like box.schema.index.create, the collation of the format is taken
+			part.Collation = sp.Format[part.Field].Collation
+		}
+	default:
+		return part, fmt.Errorf("expected a map or an array")
+	}
+	if part.Type == "" {
+		part.Type = "unsigned"
+	}
+	if part.Path != "" {
+		var err error
+		if part.path, err = parsePath(part.Path); err != nil {
+			return part, err
+		}
+	}
+	return part, nil
+}
+
+// createSpace creates the memtx space with the next free id like box.schema.create_space does,
+// indexes are _index tuples [iid, name, type, opts, parts] without the space id, `sequence = true` in opts
+// of the primary key attaches the sequence <name>_seq to its first part
+func (s *Storage) createSpace(name string, flags map[any]any, format []any, indexes ...[]any) (*Space, error) {
+	insert := func(spaceID uint64, tuple []any) error {
+		_, err := s.Execute(&InsertRequest{Replace: true, SpaceID: spaceID, Tuple: normalizeTuples([]any{tuple})[0]})
+		return err
+	}
+	// like box.schema.space.create, the engine is given by options
+	engine := engineMemtx
+	if e, ok := flags["engine"].(string); ok {
+		engine = e
+		rest := make(map[any]any, len(flags))
+		for k, v := range flags {
+			if k != "engine" {
+				rest[k] = v
+			}
+		}
+		flags = rest
+	}
+	id, err := s.insertSpace(name, engine, flags, format)
+	if err != nil {
+		return nil, err
+	}
+	sequence := false
+	for _, idx := range indexes {
+		if opts, ok := tupleField(idx, 3).(map[any]any); ok && opts["sequence"] != nil {
+			sequence, _ = opts["sequence"].(bool)
+			idx = append([]any{}, idx...)
+			idx[3] = make(map[any]any, len(opts))
+			for k, v := range opts {
+				if k != "sequence" {
+					idx[3].(map[any]any)[k] = v
+				}
+			}
+		}
+		if opts, ok := tupleField(idx, 3).(map[any]any); ok {
+			if name, ok := opts["func"].(string); ok {
+				// like box.schema.index.create, the function is given by name
+				fn, err := s.functionID(name)
+				if err != nil {
+					return nil, err
+				}
+				idx = append([]any{}, idx...)
+				idx[3] = make(map[any]any, len(opts))
+				for k, v := range opts {
+					idx[3].(map[any]any)[k] = v
+				}
+				idx[3].(map[any]any)["func"] = fn
+			}
+		}
+		if err := insert(BOX_INDEX_ID, append([]any{id}, idx...)); err != nil {
+			return nil, err
+		}
+		if opts, ok := tupleField(idx, 3).(map[any]any); ok && opts["func"] != nil {
+			if err := insert(BOX_FUNC_INDEX_ID, []any{id, idx[0], opts["func"]}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sp, _ := s.Space(id)
+	if sequence {
+		seq, err := s.CreateSequence(name+"_seq", nil)
+		if err != nil {
+			return nil, err
+		}
+		field := sp.primary().Parts[0].Field
+		if err := insert(BOX_SPACE_SEQUENCE_ID, []any{id, seq.ID, true, field, ""}); err != nil {
+			return nil, err
+		}
+	}
+	return sp, nil
+}
+
+// insertSpace takes the next free id and inserts the space into _space by one transaction, so concurrent
+// calls can't take the same id
+func (s *Storage) insertSpace(name, engine string, flags map[any]any, format []any) (uint64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	id := BOX_SYSTEM_ID_MAX
+	for spaceID := range s.spaces {
+		if spaceID > id {
+			id = spaceID
+		}
+	}
+	id++
+	err := s.commit(nil, []any{
+		&InsertRequest{Replace: true, SpaceID: BOX_SCHEMA_ID, Tuple: normalizeTuples([]any{[]any{"max_id", id}})[0]},
+		&InsertRequest{SpaceID: BOX_SPACE_ID, Tuple: normalizeTuples([]any{[]any{id, 1, name, engine, 0, flags, format}})[0]},
+	}, 0)
+	return id, err
+}
+
+// createFunction inserts the function into _func like box.schema.func.create, opts are is_deterministic,
+// is_sandboxed, is_multikey, language and if_not_exists
+func (s *Storage) createFunction(name string, opts map[any]any) error {
+	if _, err := s.functionID(name); err == nil {
+		if exists, _ := opts["if_not_exists"].(bool); exists {
+			return nil
+		}
+		return ClientError(ER_FUNCTION_EXISTS, name)
+	}
+	s.mu.RLock()
+	var id uint64
+	for _, t := range s.spaces[BOX_FUNC_ID].Tuples() {
+		if tupleUint(t, 0) > id {
+			id = tupleUint(t, 0)
+		}
+	}
+	s.mu.RUnlock()
+
+	language, ok := opts["language"].(string)
+	if !ok {
+		language = "LUA"
+	}
+	deterministic, _ := opts["is_deterministic"].(bool)
+	sandboxed, _ := opts["is_sandboxed"].(bool)
+	multikey, _ := opts["is_multikey"].(bool)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	_, err := s.Execute(&InsertRequest{SpaceID: BOX_FUNC_ID, Tuple: []any{id + 1, uint64(1), name, uint64(0),
+		strings.ToUpper(language), "", "function", []any{}, "any", "none", "none", deterministic, sandboxed, true,
+		[]any{"LUA"}, map[any]any{"is_multikey": multikey}, "", now, now}})
+	return err
+}
+
+// functionID returns id of the function by name
+func (s *Storage) functionID(name string) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sp, ok := s.spaces[BOX_FUNC_ID]; ok {
+		if t, _ := sp.get(2, []any{name}); t != nil {
+			return tupleUint(t, 0), nil
+		}
+	}
+	return 0, ClientError(ER_NO_SUCH_FUNCTION, name)
+}
+
+// prepareFunction checks the change of _func, a function of indexes can't be dropped
+func (s *Storage) prepareFunction(ch *change) error {
+	if ch.new != nil {
+		return nil
+	}
+	id := tupleUint(ch.old, 0)
+	for _, sp := range s.spaces {
+		for _, idx := range sp.Indexes {
+			if fn, _ := idx.Opts["func"].(uint64); fn == id && idx.keyFunc != nil {
+				return ClientError(ER_DROP_FUNCTION, id, "function has references")
+			}
+		}
+	}
+	return nil
+}
@@ -1,17 +1,17 @@
 package tarantella
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"net"
-	"os"
-	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
-	"github.com/tarantool/go-tarantool"
-	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -21,20 +21,40 @@ const (
 
 	IPROTO_SALT_SIZE     = 32  //nolint
 	IPROTO_GREETING_SIZE = 128 //nolint
+
+	connBufferSize = 64 * 1024
 )
 
 type (
 	clientConnection struct {
 		ctx      context.Context
 		c        net.Conn
-		username string // from IPROTO_AUTH
-		baseDir  string
+		inst     *Instance
+		username string  // from IPROTO_AUTH
+		session  uint64  // id of the session for stored functions
+		mirror   *mirror // not nil in differential testing mode
+		r        *bufio.Reader
+		w        *bufio.Writer
+		writeMu  sync.Mutex // responses and events are written by different goroutines
+		watchers watchers
+		streams  map[uint64]*Txn // transactions of streams by IPROTO_STREAM_ID
+
+		errorExtension bool // client negotiated IPROTO_FEATURE_ERROR_EXTENSION
 	}
 )
 
-var errUnanswerable = errors.New("unanswerable")
+var (
+	errUnanswerable = errors.New("unanswerable")
+	// errConnectionDone ends the connection quietly, e.g. when a replica unsubscribes
+	errConnectionDone = errors.New("connection is done")
+)
+
+// versionString returns the version like box.info.version
+func versionString() string {
+	return fmt.Sprintf("%d.%d.%d-0-tarantella", versionMajor, versionMinor, versionPatch)
+}
 
-func processClient(ctx context.Context, conn net.Conn, baseDir string) error {
+func processClient(ctx context.Context, conn net.Conn, inst *Instance) error {
 	// uncomment this block, if you want to stop propositioning panic
 	// 	defer func() {
 	// 	if r := recover(); r != nil {
@@ -50,34 +70,50 @@ func processClient(ctx context.Context, conn net.Conn, baseDir string) error {
 	clc := &clientConnection{
 		ctx:     ctx,
 		c:       conn,
-		baseDir: baseDir,
+		inst:    inst,
+		session: inst.sessions.Add(1),
 	}
+	defer inst.queue.releaseSession(clc.session)
+
+	if inst.cfg.DiffWith != "" {
+		m, err := newMirror(inst.cfg)
+		if err != nil {
+			log.Error().Err(err).Msg("Differential testing is disabled for the connection")
+		} else {
+			clc.mirror = m
+			defer m.close()
+		}
+	}
+
 	return clc.loop()
 }
 
 func (clc *clientConnection) loop() error {
 	log.Info().Any("local", clc.c.LocalAddr()).
 		Any("remote", clc.c.RemoteAddr()).
-		Str("base-dir", clc.baseDir).
 		Msg("Processing connection")
 
+	ctx, cancel := context.WithCancel(clc.ctx)
+	defer cancel()
+	defer clc.rollbackStreams()
+	clc.ctx = ctx
 	go func() {
-		<-clc.ctx.Done()
+		<-ctx.Done()
 		log.Info().Msg("Closing client socket")
 		clc.c.Close() //nolint: errcheck
 	}()
 
-	// dc := &tio.DeadlineIO{To: timeout, Conn: clc.c}
-	// r := bufio.NewReaderSize(dc, 128*1024)
-	// w := bufio.NewWriterSize(dc, 128*1024)
+	r := bufio.NewReaderSize(clc.c, connBufferSize)
+	w := bufio.NewWriterSize(clc.c, connBufferSize)
+	clc.r, clc.w = r, w
 
-	_, err := clc.c.Write(createGreeting())
+	_, err := clc.c.Write(createGreeting(clc.inst.UUID))
 	if err != nil {
 		return errors.Wrap(err, "unable to send greeting")
 	}
 
 	for {
-		req, err := clc.readRequest(clc.c)
+		req, err := readPackage(r)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to parse incoming request")
 			return errors.Wrap(err, "failed to parse incoming request")
@@ -86,193 +122,313 @@ func (clc *clientConnection) loop() error {
 		if errors.Is(err, errUnanswerable) {
 			continue
 		}
+		if errors.Is(err, errConnectionDone) {
+			return nil
+		}
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to prepare response")
 			return errors.Wrap(err, "failed to prepare response")
 		}
 
-		err = clc.writeResponse(res, clc.c)
+		clc.writeMu.Lock()
+		err = clc.writeResponse(res, w)
+		// pipelined requests are answered by one write
+		if err == nil && r.Buffered() == 0 {
+			err = w.Flush()
+		}
+		clc.writeMu.Unlock()
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to send response")
 		}
 
+		// the mirror is authenticated by itself, it uses raw data, so packages are released by GC
+		if clc.mirror != nil {
+			if req.HeaderRequestType() != IPROTO_AUTH {
+				clc.mirror.enqueue(req, res)
+			}
+			continue
+		}
+		req.release()
+		res.release()
 	}
 }
 
-// sinkDir returns the directory for data files in form baseDir + <username>
-func (clc *clientConnection) sinkDir() string {
-	d := filepath.Join(clc.baseDir, clc.username)
-	os.MkdirAll(d, 0o755) //nolint: errcheck
-	return d
-}
-
-// sinkDir returns the directory for data files in form baseDir + <username>
-func (clc *clientConnection) spaceFile(spaceID uint64) string {
-	return filepath.Join(clc.sinkDir(), fmt.Sprintf("%d.yaml", spaceID))
-}
-
 // prepareResponse can returns nil, errUnanswerable if request
 // doesn't require a response like IPROTO_WATCH request
 func (clc *clientConnection) prepareResponse(req *Package) (*Package, error) {
-	res := &Package{}
+	h, err := DecodeHeader(req)
 
-	requestType := req.HeaderRequestType()
+	// describing the request costs allocations, so do it only if it is logged
+	if e := log.Debug(); e.Enabled() {
+		e.Str("request-type", RequestTypeDescr(h.Type)).Msg("Incoming request")
+	}
 
-	requestTypeDescription := RequestTypeDescr(requestType)
+	// each response has to have sync, indeed, as a stub we will be pretend to be good boy
+	res := NewResponse(h)
 
-	log.Debug().Str("request-type", requestTypeDescription).Msg("Incoming request")
+	var out *Package
+	if err == nil {
+		out, err = clc.dispatch(h, req, res)
+	}
+	if be, ok := AsBoxError(err); ok {
+		if e := log.Debug(); e.Enabled() {
+			e.Str("request-type", RequestTypeDescr(h.Type)).
+				Uint32("code", be.Code).Str("error", be.Message).
+				Msg("Request failed")
+		}
+		res.SetError(be, clc.errorExtension)
+		return res, nil
+	}
+	return out, err
+}
 
-	// each response has to have this field
-	res.SetHeader(IPROTO_SYNC, req.HeaderSync())
-	// indeed, as a stub we will be pretend to be good boy
-	res.SetHeader(IPROTO_REQUEST_TYPE, IPROTO_OK)
+// dispatch decodes the request and calls its handler. Handlers return *BoxError to send
+// error response, any other error closes the connection
+func (clc *clientConnection) dispatch(h RequestHeader, req, res *Package) (*Package, error) {
+	typed, err := DecodeRequest(req, h.Type)
+	if err != nil {
+		return nil, err
+	}
 
-	switch requestType {
-	case IPROTO_ID:
-		res.SetBody(IPROTO_VERSION, 4)
-		res.SetBody(IPROTO_FEATURES, req.BodyFeatures())
-	case IPROTO_AUTH:
-		clc.username = req.BodyUsername()
+	switch r := typed.(type) {
+	case *IDRequest:
+		clc.errorExtension = hasFeature(r.Features, IPROTO_FEATURE_ERROR_EXTENSION)
+		res.SetID(4, serverFeatures, "")
+	case *AuthRequest:
+		clc.username = r.Username
 		if clc.username == "" {
 			clc.username = "_incognito_"
 		}
-	case IPROTO_PING:
-		res.SetHeader(IPROTO_SCHEMA_VERSION, schemaVersion)
-	case IPROTO_EXECUTE:
-		res.SetHeader(IPROTO_SCHEMA_VERSION, schemaVersion)
-		return clc.processExecute(req, res)
-	case IPROTO_WATCH:
+	case *PingRequest:
+		res.SetSchemaVersion(schemaVersion)
+	case *ExecuteRequest:
+		if r.Prepare {
+			return nil, clc.unimplemented(h.Type)
+		}
+		return nil, clc.processExecute(r)
+	case *WatchRequest:
+		clc.watch(r)
 		return nil, errUnanswerable
-	case IPROTO_SELECT:
-		return clc.processSelect(req, res)
-	case IPROTO_INSERT:
-		return clc.processInsert(req, res)
+	case *BeginRequest, *CommitRequest, *RollbackRequest:
+		return res, clc.processStream(h, r)
+	case *SelectRequest:
+		var (
+			data     []any
+			position []byte
+		)
+		if tx, ok := clc.streams[h.StreamID]; ok {
+			data, position, err = tx.SelectPage(r)
+		} else {
+			data, position, err = clc.inst.storage.SelectPage(r)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.SetSchemaVersion(schemaVersion)
+		res.SetData(data)
+		if position != nil {
+			res.SetPosition(position)
+		}
+	case *InsertRequest, *UpdateRequest, *DeleteRequest, *UpsertRequest:
+		var tuple []any
+		if tx, ok := clc.streams[h.StreamID]; ok {
+			tuple, err = tx.Execute(r)
+		} else {
+			tuple, err = clc.inst.Execute(clc.ctx, r)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.SetSchemaVersion(schemaVersion)
+		res.SetData(dmlResult(h.Type, tuple))
+	case *CallRequest:
+		if clc.inst.isBlocking(r.FunctionName) {
+			// only the request waits for the function, the connection serves others meanwhile
+			go clc.respondLater(res, func() (*Package, error) { return clc.processCall(r, res) }, clc.errorExtension)
+			return nil, errUnanswerable
+		}
+		return clc.processCall(r, res)
+	case *JoinRequest:
+		return nil, clc.replicate(func() error { return clc.join(h, r) })
+	case *FetchSnapshotRequest:
+		return nil, clc.replicate(func() error { return clc.fetchSnapshot(h, r) })
+	case *RegisterRequest:
+		return nil, clc.replicate(func() error { return clc.register(h, r) })
+	case *SubscribeRequest:
+		return nil, clc.replicate(func() error { return clc.subscribe(h, r) })
+	case *VoteRequest:
+		res.SetBody(IPROTO_BALLOT, clc.inst.ballot())
+	case *PromoteRequest:
+		if r.Demote {
+			return res, clc.inst.Demote(clc.ctx)
+		}
+		return res, clc.inst.Promote(clc.ctx, r.Term)
 	default:
-		log.Warn().Str("request-type", requestTypeDescription).Msg("Unimplemented or unknown request type")
-		res.SetHeader(IPROTO_REQUEST_TYPE, IPROTO_TYPE_ERROR|tarantool.ErrUnknownRequestType)
+		return nil, clc.unimplemented(h.Type)
 	}
 	return res, nil
 }
 
-func (clc *clientConnection) processExecute(req, res *Package) (*Package, error) {
-	sqlText := req.BodySQLText()
-	log.Info().Str("sql-text", sqlText).Msg("SQL execute")
+// processStream begins, commits or rolls back the transaction of the stream
+func (clc *clientConnection) processStream(h RequestHeader, req any) error {
+	if h.StreamID == 0 {
+		return ClientError(ER_UNABLE_TO_PROCESS_OUT_OF_STREAM, strings.TrimPrefix(iproto_type[h.Type], "IPROTO_"))
+	}
+	tx, active := clc.streams[h.StreamID]
+	switch r := req.(type) {
+	case *BeginRequest:
+		if active {
+			return ClientError(ER_ACTIVE_TRANSACTION)
+		}
+		if clc.streams == nil {
+			clc.streams = make(map[uint64]*Txn)
+		}
+		clc.streams[h.StreamID] = clc.inst.storage.Begin(time.Duration(r.Timeout * float64(time.Second)))
+	case *CommitRequest:
+		if active {
+			delete(clc.streams, h.StreamID)
+			return clc.inst.Commit(clc.ctx, tx)
+		}
+	case *RollbackRequest:
+		if active {
+			delete(clc.streams, h.StreamID)
+			tx.Rollback()
+		}
+	}
+	return nil
+}
+
+// rollbackStreams rolls back transactions of the closed connection
+func (clc *clientConnection) rollbackStreams() {
+	for _, tx := range clc.streams {
+		tx.Rollback()
+	}
+}
 
-	res.SetBody(IPROTO_DATA, dummyExecute1["data"])
-	res.SetBody(IPROTO_METADATA, dummyExecute1["metadata"])
+func (clc *clientConnection) unimplemented(requestType uint64) error {
+	log.Warn().Str("request-type", RequestTypeDescr(requestType)).Msg("Unimplemented or unknown request type")
+	return ErrUnknownRequestType(requestType)
+}
 
-	return res, nil
+// hasFeature checks if the feature is in the list of IPROTO_FEATURES
+// serverFeatures are IPROTO_FEATURES supported by the server
+var serverFeatures = []uint64{
+	IPROTO_FEATURE_STREAMS, IPROTO_FEATURE_TRANSACTIONS, IPROTO_FEATURE_ERROR_EXTENSION,
+	IPROTO_FEATURE_WATCHERS, IPROTO_FEATURE_PAGINATION,
 }
 
-func (clc *clientConnection) processInsert(req, res *Package) (*Package, error) {
-	res.SetHeader(IPROTO_SCHEMA_VERSION, schemaVersion)
+func hasFeature(features []uint64, feature uint64) bool {
+	for _, f := range features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
 
-	spaceFile := clc.spaceFile(req.BodySpaceID())
+// processExecute fails: SQL isn't run, so a statement must not be reported as executed
+func (clc *clientConnection) processExecute(r *ExecuteRequest) error {
+	log.Info().Str("sql-text", r.SQLText).Uint64("stmt-id", r.StmtID).Msg("SQL execute")
+	return ErrUnsupported("tarantella", "SQL")
+}
 
-	log.Debug().Str("tgt-file", spaceFile).Msg("Writing INSERT event")
+// dmlResult returns IPROTO_DATA of DML response: the affected tuple, UPSERT returns nothing
+func dmlResult(requestType uint64, tuple []any) []any {
+	if tuple == nil || requestType == IPROTO_UPSERT {
+		return []any{}
+	}
+	return []any{tuple}
+}
 
-	// append to the space file
-	f, err := os.OpenFile(spaceFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+func (clc *clientConnection) processCall(r *CallRequest, res *Package) (*Package, error) {
+	ctx := &CallContext{Context: clc.ctx, Instance: clc.inst, Session: clc.session}
+	ret, err := clc.inst.call(ctx, r.FunctionName, r.Args)
 	if err != nil {
-		log.Error().Err(err).
-			Str("user", clc.username).Str("file", spaceFile).
-			Msg("Unable to open file for write")
-		res.SetBody(IPROTO_ERROR_24, fmt.Sprintf("TARANTELLA: unable to open file %s while trying to save insert data", spaceFile))
-		return res, nil
-	}
-	defer f.Close() //nolint: errcheck
-	if _, e := f.WriteString("---\n"); e != nil {
-		log.Error().Err(e).Msg("Unable to save request into file")
+		return nil, err
 	}
-	enc := yaml.NewEncoder(f)
-	if e := enc.Encode(req.Info()); e != nil {
-		log.Error().Err(e).Msg("Unable to save request into file")
+	if r.Call16 {
+		// CALL_16 returns tuples only, scalars are wrapped
+		for i, v := range ret {
+			if _, ok := v.([]any); !ok {
+				ret[i] = []any{v}
+			}
+		}
 	}
-	enc.Close() //nolint: errcheck
-
+	res.SetData(ret)
 	return res, nil
 }
 
-func (clc *clientConnection) processSelect(req, res *Package) (*Package, error) {
-	res.SetHeader(IPROTO_SCHEMA_VERSION, schemaVersion)
-
-	spaceID := req.BodySpaceID()
-
-	log.Debug().Uint64("space-id", spaceID).Msg("IPROTO_SELECT(0x1) on space")
-
-	spaceFile := clc.spaceFile(req.BodySpaceID())
-	if f, e := os.Open(spaceFile); e == nil {
-		defer f.Close() //nolint: errcheck
-		dec := yaml.NewDecoder(f)
-
-		body := []any{}
-		for {
-			ri := new(RequestInfo)
-			err := dec.Decode(ri)
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			if err != nil {
-				log.Warn().Err(err).Str("space-file", spaceFile).Msg("Unable to decode spaceFile")
-				res.SetBody(IPROTO_ERROR_24, fmt.Sprintf("TARANTELLA: unable to decode file for space %d", spaceID))
-				return res, nil
-			}
-			body = append(body, ri.B["⚡IPROTO_TUPLE(0x21)"])
+// respondLater writes the response of the parked request when it's prepared
+func (clc *clientConnection) respondLater(res *Package, prepare func() (*Package, error), errorExtension bool) {
+	out, err := prepare()
+	if be, ok := AsBoxError(err); ok {
+		res.SetError(be, errorExtension)
+		out, err = res, nil
+	}
+	if err != nil {
+		if clc.ctx.Err() == nil {
+			log.Error().Err(err).Msg("Failed to prepare response")
 		}
-		res.SetBody(IPROTO_DATA, body)
-		return res, nil
+		res.release()
+		return
 	}
 
-	switch spaceID {
-	case BOX_VSPACE_ID:
-		// here we ignore all other passed flags!
-		res.SetBody(IPROTO_DATA, dummySpaces)
-	case BOX_VINDEX_ID:
-		// here we ignore all other passed flags!
-		res.SetBody(IPROTO_DATA, dummyIndexes)
-
-	default:
-		log.Warn().Uint64("space-id", spaceID).Msg("IPROTO_SELECT(0x1) on space unsupported")
-		res.SetBody(IPROTO_ERROR_24, fmt.Sprintf("TARANTELLA: space with id %d is not exist or not served", spaceID))
+	clc.writeMu.Lock()
+	err = out.writeTo(clc.w, errorExtension)
+	if err == nil {
+		err = clc.w.Flush()
 	}
-	return res, nil
+	clc.writeMu.Unlock()
+	if err != nil && clc.ctx.Err() == nil {
+		log.Error().Err(err).Msg("Failed to send response")
+	}
+	out.release()
 }
 
 func (clc *clientConnection) writeResponse(res *Package, w io.Writer) error {
-	if e := res.Encode(); e != nil {
-		return errors.Wrap(e, "unable to encode response")
-	}
-	bb := res.ToBytes()
-
-	if _, e := w.Write(bb); e != nil {
+	if e := res.writeTo(w, clc.errorExtension); e != nil {
 		return errors.Wrap(e, "unable to write response packet")
 	}
-
 	return nil
 }
 
-func (clc *clientConnection) readRequest(r io.Reader) (*Package, error) {
+// readPackage reads one package (request or response) from the stream into the pooled buffer,
+// call release when the raw data is not needed anymore
+func readPackage(r io.Reader) (*Package, error) {
 	req := &Package{}
 
-	var rawLen [5]byte
+	pb := getBuffer()
+	buf := (*pb)[:5]
 
-	if _, e := io.ReadFull(r, rawLen[:]); e != nil {
+	if _, e := io.ReadFull(r, buf); e != nil {
+		putBuffer(pb)
 		return nil, e
 	}
 
-	length, err := req.SetLen(rawLen)
+	length, err := packageLen(buf)
 	if err != nil {
+		putBuffer(pb)
 		return nil, err
 	}
 
-	rawData := make([]byte, length)
-	_, err = io.ReadFull(r, rawData)
+	if n := 5 + int(length); cap(buf) < n {
+		buf = append(buf, make([]byte, n-len(buf))...)
+	} else {
+		buf = buf[:n]
+	}
+	*pb = buf
+	req.pooled = pb
+
+	_, err = io.ReadFull(r, buf[5:])
 	if err != nil {
+		req.release()
 		return nil, errors.Wrap(err, "unable to read request package")
 	}
 
-	err = req.Decode(rawData)
+	req.rawLen = buf[:5]
+	err = req.Decode(buf[5:])
 	if err != nil {
+		req.release()
 		return nil, errors.Wrap(err, "unable to decode request package")
 	}
 
@@ -0,0 +1,186 @@
+package tarantella
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// collations are kept in _collation like in tarantool, index parts refer to them by id; ICU collations
+// are emulated by golang.org/x/text/collate, BINARY ones compare bytes
+
+// Collation is a collation with its definition from _collation
+type Collation struct {
+	ID     uint64
+	Name   string
+	Type   string // ICU or BINARY
+	Locale string
+	Opts   map[any]any
+
+	mu       sync.Mutex        // the collator is not safe for concurrent use
+	collator *collate.Collator // nil for BINARY
+}
+
+// collationLocales are locales of the predefined collations unicode_<name>_s1, _s2 and _s3 in the order of
+// upgrade.lua of tarantool, so their ids are the same
+var collationLocales = []struct{ name, locale string }{
+	{"af", "af"}, {"am", "am"}, {"ar", "ar"}, {"as", "as"}, {"az", "az"}, {"be", "be"}, {"bn", "bn"},
+	{"bs", "bs"}, {"bs_Cyrl", "bs_Cyrl"}, {"ca", "ca"}, {"cs", "cs"}, {"cy", "cy"}, {"da", "da"},
+	{"de__phonebook", "de_DE_u_co_phonebk"}, {"de_AT_phonebook", "de_AT_u_co_phonebk"}, {"dsb", "dsb"},
+	{"ee", "ee"}, {"eo", "eo"}, {"es", "es"}, {"es__traditional", "es_u_co_trad"}, {"et", "et"}, {"fa", "fa"},
+	{"fi", "fi"}, {"fi__phonebook", "fi_u_co_phonebk"}, {"fil", "fil"}, {"fo", "fo"}, {"fr_CA", "fr_CA"},
+	{"gu", "gu"}, {"ha", "ha"}, {"haw", "haw"}, {"he", "he"}, {"hi", "hi"}, {"hr", "hr"}, {"hu", "hu"},
+	{"hy", "hy"}, {"ig", "ig"}, {"is", "is"}, {"ja", "ja"}, {"kk", "kk"}, {"kl", "kl"}, {"km", "km"},
+	{"kn", "kn"}, {"ko", "ko"}, {"kok", "kok"}, {"ky", "ky"}, {"lkt", "lkt"}, {"ln", "ln"}, {"lo", "lo"},
+	{"lt", "lt"}, {"lv", "lv"}, {"mk", "mk"}, {"ml", "ml"}, {"mr", "mr"}, {"mt", "mt"}, {"nb", "nb"},
+	{"nn", "nn"}, {"nso", "nso"}, {"om", "om"}, {"or", "or"}, {"pa", "pa"}, {"pl", "pl"}, {"ro", "ro"},
+	{"sa", "sa"}, {"se", "se"}, {"si", "si"}, {"sk", "sk"}, {"sl", "sl"}, {"sq", "sq"}, {"sr", "sr"},
+	{"sr_Latn", "sr_Latn"}, {"sv", "sv"}, {"sv__reformed", "sv_u_co_reformed"}, {"ta", "ta"}, {"te", "te"},
+	{"th", "th"}, {"tn", "tn"}, {"to", "to"}, {"tr", "tr"}, {"ug_Cyrl", "ug"}, {"uk", "uk"}, {"ur", "ur"},
+	{"vi", "vi"}, {"vo", "vo"}, {"wae", "wae"}, {"wo", "wo"}, {"yi", "yi"}, {"yo", "yo"}, {"zh", "zh"},
+	{"zh__big5han", "zh_u_co_big5han"}, {"zh__gb2312han", "zh_u_co_gb2312han"}, {"zh__pinyin", "zh_u_co_pinyin"},
+	{"zh__stroke", "zh_u_co_stroke"}, {"zh__zhuyin", "zh_u_co_zhuyin"},
+}
+
+// builtinCollations returns _collation tuples of the predefined collations
+func builtinCollations() []any {
+	tuples := []any{
+		[]any{0, "none", 1, "BINARY", "", map[any]any{}},
+		[]any{1, "unicode", 1, "ICU", "", map[any]any{}},
+		[]any{2, "unicode_ci", 1, "ICU", "", map[any]any{"strength": "primary"}},
+		[]any{3, "binary", 1, "BINARY", "", map[any]any{}},
+	}
+	for i, l := range collationLocales {
+		for s, strength := range []string{"primary", "secondary", "tertiary"} {
+			tuples = append(tuples, []any{4 + i*3 + s, "unicode_" + l.name + "_s" + string(rune('1'+s)), 1, "ICU",
+				l.locale, map[any]any{"strength": strength}})
+		}
+	}
+	return tuples
+}
+
+// collationFromTuple parses _collation tuple [id, name, owner, type, locale, opts]
+func collationFromTuple(t []any) (*Collation, error) {
+	c := &Collation{ID: tupleUint(t, 0), Type: "ICU"}
+	c.Name, _ = tupleField(t, 1).(string)
+	if typ, ok := tupleField(t, 3).(string); ok {
+		c.Type = strings.ToUpper(typ)
+	}
+	c.Locale, _ = tupleField(t, 4).(string)
+	c.Opts, _ = tupleField(t, 5).(map[any]any)
+
+	switch c.Type {
+	case "BINARY":
+		return c, nil
+	case "ICU":
+	default:
+		return nil, ClientError(ER_CANT_CREATE_COLLATION, "unknown collation type")
+	}
+
+	tag := language.Und
+	if c.Locale != "" {
+		var err error
+		if tag, err = language.Parse(strings.ReplaceAll(c.Locale, "_", "-")); err != nil {
+			// ICU takes keywords which are not BCP 47 like gb2312han, the language itself is used then
+			base, _, _ := strings.Cut(c.Locale, "_")
+			if tag, err = language.Parse(base); err != nil {
+				return nil, ClientError(ER_CANT_CREATE_COLLATION, "ICU error: "+err.Error())
+			}
+		}
+	}
+	var opts []collate.Option
+	switch strength, _ := c.Opts["strength"].(string); strings.ToLower(strength) {
+	case "primary":
+		opts = append(opts, collate.Loose)
+	case "secondary":
+		opts = append(opts, collate.IgnoreCase, collate.IgnoreWidth)
+	case "", "tertiary", "quaternary", "identical":
+	default:
+		return nil, ClientError(ER_WRONG_COLLATION_OPTIONS, "unknown strength")
+	}
+	if numeric, _ := c.Opts["numeric_collation"].(string); strings.EqualFold(numeric, "on") {
+		opts = append(opts, collate.Numeric)
+	}
+	c.collator = collate.New(tag, opts...)
+	return c, nil
+}
+
+// compare compares strings by the collation
+func (c *Collation) compare(a, b string) int {
+	if c.collator == nil {
+		return strings.Compare(a, b)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.collator.CompareString(a, b)
+}
+
+// collation returns the collation by id
+func (s *Storage) collation(id uint64) (*Collation, bool) {
+	sp, ok := s.spaces[BOX_COLLATION_ID]
+	if !ok {
+		return nil, false
+	}
+	t, _ := sp.get(0, []any{id})
+	if t == nil {
+		return nil, false
+	}
+	c, err := collationFromTuple(t)
+	return c, err == nil
+}
+
+// CollationID returns id of the collation by name, it's used in index parts and the format
+func (s *Storage) CollationID(name string) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sp, ok := s.spaces[BOX_COLLATION_ID]; ok {
+		if t, _ := sp.get(1, []any{name}); t != nil {
+			return tupleUint(t, 0), nil
+		}
+	}
+	return 0, ClientError(ER_NO_SUCH_COLLATION, name)
+}
+
+// prepareCollation checks the change of _collation, a collation of indexes can't be dropped
+func (s *Storage) prepareCollation(ch *change) error {
+	if ch.new != nil {
+		_, err := collationFromTuple(ch.new)
+		return err
+	}
+	id := tupleUint(ch.old, 0)
+	for _, sp := range s.spaces {
+		for _, idx := range sp.Indexes {
+			for _, p := range idx.Parts {
+				if p.Collation == id {
+					return ClientError(ER_DROP_COLLATION, tupleField(ch.old, 1), "collation is referenced by index")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveCollations finds collations of the index parts
+func (s *Storage) resolveCollations(idx *Index) error {
+	for i := range idx.Parts {
+		p := &idx.Parts[i]
+		if p.Collation == 0 {
+			continue
+		}
+		switch canonicalFieldType(p.Type) {
+		case "string", "scalar", "any":
+		default:
+			return ClientError(ER_WRONG_INDEX_PARTS, i+1, "collation is reasonable only for string and scalar parts")
+		}
+		coll, ok := s.collation(p.Collation)
+		if !ok {
+			return ClientError(ER_WRONG_INDEX_PARTS, i+1, "collation was not found by ID")
+		}
+		if coll.collator != nil {
+			p.coll = coll
+		}
+	}
+	return nil
+}
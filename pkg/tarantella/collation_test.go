@@ -0,0 +1,71 @@
+package tarantella
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollation(t *testing.T) {
+	inst, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	s := inst.storage
+
+	ci, err := s.CollationID("unicode_ci")
+	require.NoError(t, err)
+	unicode, err := s.CollationID("unicode")
+	require.NoError(t, err)
+	data, err := s.Select(&SelectRequest{SpaceID: BOX_VCOLLATION_ID, IndexID: 1, Key: []any{"unicode_ci"}, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, []any{[]any{ci, "unicode_ci", uint64(1), "ICU", "", map[any]any{"strength": "primary"}}}, data)
+
+	// the collation of the format is taken by the index part
+	sp, err := s.createSpace("users", map[any]any{}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "email", "type": "string", "collation": ci},
+		map[any]any{"name": "name", "type": "string"},
+	},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}},
+		[]any{1, "email", "tree", map[any]any{"unique": true}, []any{map[any]any{"field": "email", "type": "string"}}},
+		[]any{2, "name", "tree", map[any]any{"unique": false}, []any{map[any]any{"field": uint64(2), "type": "string", "collation": unicode}}},
+	)
+	require.NoError(t, err)
+	for _, tuple := range [][]any{
+		{uint64(1), "Alice@Example.com", "bob"},
+		{uint64(2), "carol@example.com", "Alice"},
+		{uint64(3), "dave@example.com", "Élodie"},
+	} {
+		_, err = s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: tuple})
+		require.NoError(t, err)
+	}
+
+	data, err = s.Select(&SelectRequest{SpaceID: sp.ID, IndexID: 1, Key: []any{"ALICE@example.COM"}, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), data[0].([]any)[0])
+	_, err = s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{uint64(4), "alice@example.com", "eve"}})
+	require.Equal(t, ER_TUPLE_FOUND, err.(*BoxError).Code)
+
+	// unicode sorts letters regardless of case and diacritics unlike bytes
+	data, err = s.Select(&SelectRequest{SpaceID: sp.ID, IndexID: 2, Iterator: ITER_ALL, Limit: 10})
+	require.NoError(t, err)
+	var names []any
+	for _, t := range data {
+		names = append(names, t.([]any)[2])
+	}
+	require.Equal(t, []any{"Alice", "bob", "Élodie"}, names)
+
+	_, err = s.Execute(&DeleteRequest{SpaceID: BOX_COLLATION_ID, Key: []any{ci}})
+	require.Equal(t, ER_DROP_COLLATION, err.(*BoxError).Code)
+
+	// COLLATE of SQL isn't applied, the statement fails instead of ignoring it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rc := connectReplica(t, ctx, inst)
+	rc.send(IPROTO_EXECUTE, map[any]any{
+		IPROTO_SQL_TEXT: `SELECT * FROM "users" WHERE "name" = 'ALICE' COLLATE "unicode_ci"`, IPROTO_SQL_BIND: []any{},
+	})
+	h, _ := rc.read()
+	require.Equal(t, IPROTO_TYPE_ERROR|uint64(ER_UNSUPPORTED), h[IPROTO_REQUEST_TYPE])
+}
@@ -0,0 +1,222 @@
+package tarantella
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// mpClass is an order of value classes while comparing values of different types,
+// like in tarantool's tuple_compare.cc
+type mpClass int
+
+const (
+	mpClassNil mpClass = iota
+	mpClassBool
+	mpClassNumber
+	mpClassStr
+	mpClassBin
+	mpClassUUID
+	mpClassDatetime
+	mpClassInterval
+	mpClassArray
+	mpClassMap
+	mpClassExt
+)
+
+func classOf(v any) mpClass { //nolint: cyclop
+	switch v.(type) {
+	case nil:
+		return mpClassNil
+	case bool:
+		return mpClassBool
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, Decimal:
+		return mpClassNumber
+	case string:
+		return mpClassStr
+	case []byte:
+		return mpClassBin
+	case uuid.UUID:
+		return mpClassUUID
+	case Datetime:
+		return mpClassDatetime
+	case Interval:
+		return mpClassInterval
+	case []any:
+		return mpClassArray
+	case map[any]any, map[string]any:
+		return mpClassMap
+	default:
+		return mpClassExt
+	}
+}
+
+// CompareValues compares two field values the way tarantool scalar index does:
+// values of different classes are ordered by class, numbers of any type are compared by value
+func CompareValues(a, b any) int { //nolint: cyclop
+	ca, cb := classOf(a), classOf(b)
+	if ca != cb {
+		return cmpInt(int64(ca), int64(cb))
+	}
+
+	switch ca { //nolint: exhaustive
+	case mpClassNil:
+		return 0
+	case mpClassBool:
+		ab, bb := a.(bool), b.(bool)
+		switch {
+		case ab == bb:
+			return 0
+		case !ab:
+			return -1
+		default:
+			return 1
+		}
+	case mpClassNumber:
+		return compareNumbers(a, b)
+	case mpClassStr:
+		return strings.Compare(a.(string), b.(string))
+	case mpClassBin:
+		return bytes.Compare(a.([]byte), b.([]byte))
+	case mpClassUUID:
+		ua, ub := a.(uuid.UUID), b.(uuid.UUID)
+		return bytes.Compare(ua[:], ub[:])
+	case mpClassDatetime:
+		return a.(Datetime).Time.Compare(b.(Datetime).Time)
+	case mpClassArray:
+		aa, ba := a.([]any), b.([]any)
+		for i := 0; i < len(aa) && i < len(ba); i++ {
+			if c := CompareValues(aa[i], ba[i]); c != 0 {
+				return c
+			}
+		}
+		return cmpInt(int64(len(aa)), int64(len(ba)))
+	}
+
+	// intervals, maps and unknown extensions are not comparable in tarantool,
+	// let's compare them by their msgpack representation to have a stable order
+	ea, _ := mpMarshal(a)
+	eb, _ := mpMarshal(b)
+	return bytes.Compare(ea, eb)
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// numberKind splits numbers into kinds which have fast comparison
+type numberKind int
+
+const (
+	numberInt numberKind = iota
+	numberUint
+	numberFloat
+	numberDecimal
+)
+
+// normalizeNumber returns number as int64, uint64 (only for values > MaxInt64), float64 or Decimal
+func normalizeNumber(v any) (numberKind, int64, uint64, float64) {
+	switch n := v.(type) {
+	case int:
+		return numberInt, int64(n), 0, 0
+	case int8:
+		return numberInt, int64(n), 0, 0
+	case int16:
+		return numberInt, int64(n), 0, 0
+	case int32:
+		return numberInt, int64(n), 0, 0
+	case int64:
+		return numberInt, n, 0, 0
+	case uint:
+		return normalizeUint(uint64(n))
+	case uint8:
+		return numberInt, int64(n), 0, 0
+	case uint16:
+		return numberInt, int64(n), 0, 0
+	case uint32:
+		return numberInt, int64(n), 0, 0
+	case uint64:
+		return normalizeUint(n)
+	case float32:
+		return numberFloat, 0, 0, float64(n)
+	case float64:
+		return numberFloat, 0, 0, n
+	default:
+		return numberDecimal, 0, 0, 0
+	}
+}
+
+func normalizeUint(n uint64) (numberKind, int64, uint64, float64) {
+	if n > math.MaxInt64 {
+		return numberUint, 0, n, 0
+	}
+	return numberInt, int64(n), 0, 0
+}
+
+// compareNumbers compares integers, floats and decimals by value, NaN is less than any number
+func compareNumbers(a, b any) int {
+	ka, ia, ua, fa := normalizeNumber(a)
+	kb, ib, ub, fb := normalizeNumber(b)
+
+	switch {
+	case ka == numberInt && kb == numberInt:
+		return cmpInt(ia, ib)
+	case ka == numberUint && kb == numberUint:
+		switch {
+		case ua < ub:
+			return -1
+		case ua > ub:
+			return 1
+		default:
+			return 0
+		}
+	case ka == numberFloat && kb == numberFloat:
+		return compareFloats(fa, fb)
+	}
+
+	if ka == numberFloat && (math.IsNaN(fa) || math.IsInf(fa, 0)) {
+		return compareFloats(fa, 0)
+	}
+	if kb == numberFloat && (math.IsNaN(fb) || math.IsInf(fb, 0)) {
+		return compareFloats(0, fb)
+	}
+	return numberRat(a).Cmp(numberRat(b))
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a) || a < b:
+		return -1
+	case math.IsNaN(b) || a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// numberRat converts any finite number to the exact rational value
+func numberRat(v any) *big.Rat {
+	kind, i, u, f := normalizeNumber(v)
+	switch kind {
+	case numberInt:
+		return new(big.Rat).SetInt64(i)
+	case numberUint:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(u))
+	case numberFloat:
+		return new(big.Rat).SetFloat64(f)
+	default:
+		return v.(Decimal).Rat()
+	}
+}
@@ -0,0 +1,57 @@
+package tarantella
+
+import "time"
+
+type (
+	// Config describes how the emulator has to be launched
+	Config struct {
+		ListenOn string // host:port to listen on
+		DataDir  string // directory of logs and snapshots
+
+		WalMode            string        // none, write (default) or fsync
+		CheckpointInterval time.Duration // period of snapshots, 0 disables them
+		ReplicationTimeout time.Duration // period of heartbeats sent to replicas, 1s by default
+
+		// SynchroQuorumDelay is how long the emulated quorum of a synchronous transaction is collected,
+		// the transaction fails if it's not shorter than SynchroTimeout (5s by default)
+		SynchroQuorumDelay time.Duration
+		SynchroTimeout     time.Duration
+
+		// ReplicationSource is a master to follow as an anonymous replica: [user:password@]host:port.
+		// The instance is read-only then
+		ReplicationSource string
+
+		// Replicaset lists addresses of instances started by the process, they keep data
+		// in subdirectories of DataDir. ReplicasetLeader (the first one by default) is writable,
+		// the others are its registered read-only replicas
+		Replicaset       []string
+		ReplicasetLeader string
+
+		// VshardStorages lists addresses of vshard storages started by the process, they keep data
+		// in DataDir/storage-<number in the list>. The instance on ListenOn is the router then, its data
+		// is in DataDir/router. VshardBucketCount is 3000 by default
+		VshardStorages    []string
+		VshardBucketCount uint64
+
+		// QueueTubes lists tubes of the queue module created on start: name:driver, the driver is fifo,
+		// fifottl, utube or utubettl
+		QueueTubes []string
+
+		// Functions are stored functions registered before the data is recovered, functions of functional
+		// indexes have to be among them
+		Functions map[string]Function
+
+		// Clock tells the time to expiration tasks of expirationd, a FakeClock drives them in tests
+		Clock Clock
+
+		// DiffWith is an address of the reference Tarantool. If set, each incoming
+		// request is mirrored to it and responses are compared
+		DiffWith     string
+		DiffUser     string // username for the reference Tarantool
+		DiffPassword string // password for the reference Tarantool
+		DiffReport   string // file to append divergences into (YAML stream)
+
+		registered bool   // the replica joins the master instead of following it anonymously
+		vshardRole string // the instance is a vshard storage or router
+	}
+)
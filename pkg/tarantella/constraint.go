@@ -0,0 +1,379 @@
+package tarantella
+
+import "fmt"
+
+// foreign keys and check constraints are kept in _fk_constraint and _ck_constraint like SQL of tarantool keeps them,
+// they are checked by each write except rows of logs, snapshots and the master checked when they were written.
+// A foreign key is violated if a referencing tuple has no parent or a referenced parent is deleted or changed,
+// deferred foreign keys are checked when the transaction is committed. Expressions of check constraints are
+// a subset of SQL, see parseSQLExpr
+
+type (
+	// fkConstraint is a foreign key from _fk_constraint
+	fkConstraint struct {
+		name       string
+		child      uint64 // id of the referencing space
+		parent     uint64 // id of the referenced space
+		deferred   bool
+		childCols  []uint64
+		parentCols []uint64
+	}
+
+	// ckConstraint is a check constraint from _ck_constraint
+	ckConstraint struct {
+		name    string
+		space   uint64
+		code    string
+		enabled bool
+		expr    sqlExpr
+	}
+)
+
+// prepareFkConstraint checks the change of _fk_constraint [name, child_id, parent_id, is_deferred, match,
+// on_delete, on_update, child_cols, parent_cols]
+func (s *Storage) prepareFkConstraint(ch *change) error {
+	if ch.new == nil {
+		name, child := tupleField(ch.old, 0), tupleUint(ch.old, 1)
+		s.prepareFks(ch, func() []*fkConstraint { return s.withoutFk(name, child) })
+		return nil
+	}
+
+	fk := &fkConstraint{child: tupleUint(ch.new, 1), parent: tupleUint(ch.new, 2)}
+	fk.name, _ = tupleField(ch.new, 0).(string)
+	fk.deferred, _ = tupleField(ch.new, 3).(bool)
+	for _, action := range []any{tupleField(ch.new, 5), tupleField(ch.new, 6)} {
+		if action != "no_action" && action != "restrict" {
+			return ErrUnsupported("tarantella", fmt.Sprint("foreign key action ", action))
+		}
+	}
+	for i, cols := range []*[]uint64{&fk.childCols, &fk.parentCols} {
+		fields, _ := tupleField(ch.new, uint64(7+i)).([]any)
+		for _, f := range fields {
+			if !fieldTypeMatches("unsigned", f) {
+				return ClientError(ER_CREATE_FK_CONSTRAINT, fk.name, "field numbers must be unsigned")
+			}
+			_, i, _, _ := normalizeNumber(f)
+			*cols = append(*cols, uint64(i))
+		}
+	}
+
+	child, err := s.space(fk.child)
+	if err != nil {
+		return err
+	}
+	parent, err := s.space(fk.parent)
+	if err != nil {
+		return err
+	}
+	if len(fk.childCols) == 0 || len(fk.childCols) != len(fk.parentCols) {
+		return ClientError(ER_CREATE_FK_CONSTRAINT, fk.name, "number of referenced and referencing fields must be the same")
+	}
+	for i := range fk.childCols {
+		if fk.childCols[i] >= uint64(len(child.Format)) || fk.parentCols[i] >= uint64(len(parent.Format)) {
+			return ClientError(ER_CREATE_FK_CONSTRAINT, fk.name, "foreign key refers to nonexistent field")
+		}
+		childType, _, _ := child.fieldType(fk.childCols[i])
+		parentType, _, _ := parent.fieldType(fk.parentCols[i])
+		if canonicalFieldType(childType) != canonicalFieldType(parentType) {
+			return ClientError(ER_CREATE_FK_CONSTRAINT, fk.name, "field type mismatch")
+		}
+	}
+	if fk.parentIndex(parent) == nil {
+		return ClientError(ER_CREATE_FK_CONSTRAINT, fk.name, "referenced fields don't compose unique index")
+	}
+	if ch.old == nil && child.Len() > 0 && !s.replaying {
+		return ClientError(ER_CREATE_FK_CONSTRAINT, fk.name, "referencing space must be empty")
+	}
+	s.prepareFks(ch, func() []*fkConstraint { return append(s.withoutFk(fk.name, fk.child), fk) })
+	return nil
+}
+
+// prepareFks makes the change replace foreign keys by the modified ones
+func (s *Storage) prepareFks(ch *change, modified func() []*fkConstraint) {
+	var prev []*fkConstraint
+	ch.catalog = func() {
+		prev = s.fks
+		s.fks = modified()
+	}
+	ch.uncatalog = func() { s.fks = prev }
+}
+
+// withoutFk returns foreign keys except the one of the child space
+func (s *Storage) withoutFk(name any, child uint64) []*fkConstraint {
+	fks := make([]*fkConstraint, 0, len(s.fks))
+	for _, fk := range s.fks {
+		if fk.name != name || fk.child != child {
+			fks = append(fks, fk)
+		}
+	}
+	return fks
+}
+
+// prepareCkConstraint checks the change of _ck_constraint [space_id, name, is_deferred, language, code, is_enabled],
+// tuples of the space have to satisfy the new constraint
+func (s *Storage) prepareCkConstraint(ch *change) error {
+	if ch.new == nil {
+		id, name := tupleUint(ch.old, 0), tupleField(ch.old, 1)
+		s.prepareCks(ch, id, func() []*ckConstraint { return withoutCk(s.cks[id], name) })
+		return nil
+	}
+
+	ck := &ckConstraint{space: tupleUint(ch.new, 0), enabled: true}
+	ck.name, _ = tupleField(ch.new, 1).(string)
+	ck.code, _ = tupleField(ch.new, 4).(string)
+	if enabled, ok := tupleField(ch.new, 5).(bool); ok {
+		ck.enabled = enabled
+	}
+	sp, err := s.space(ck.space)
+	if err != nil {
+		return err
+	}
+	if deferred, _ := tupleField(ch.new, 2).(bool); deferred {
+		return ErrUnsupported("Tarantool", "deferred ck constraints")
+	}
+	if language, _ := tupleField(ch.new, 3).(string); language != "SQL" {
+		return ClientError(ER_FUNCTION_LANGUAGE, language, ck.name)
+	}
+	if ck.expr, err = parseSQLExpr(ck.code, sp); err != nil {
+		if be, ok := AsBoxError(err); ok {
+			return be
+		}
+		return ClientError(ER_CREATE_CK_CONSTRAINT, ck.name, err.Error())
+	}
+	if ck.enabled && !s.replaying {
+		for _, t := range sp.Tuples() {
+			if err := ck.check(sp, t); err != nil {
+				return err
+			}
+		}
+	}
+	s.prepareCks(ch, ck.space, func() []*ckConstraint { return append(withoutCk(s.cks[ck.space], ck.name), ck) })
+	return nil
+}
+
+// prepareCks makes the change replace check constraints of the space by the modified ones
+func (s *Storage) prepareCks(ch *change, id uint64, modified func() []*ckConstraint) {
+	var prev []*ckConstraint
+	ch.catalog = func() {
+		if s.cks == nil {
+			s.cks = make(map[uint64][]*ckConstraint)
+		}
+		prev = s.cks[id]
+		s.cks[id] = modified()
+	}
+	ch.uncatalog = func() { s.cks[id] = prev }
+}
+
+func withoutCk(cks []*ckConstraint, name any) []*ckConstraint {
+	rest := make([]*ckConstraint, 0, len(cks))
+	for _, ck := range cks {
+		if ck.name != name {
+			rest = append(rest, ck)
+		}
+	}
+	return rest
+}
+
+// check fails if the expression is false for the tuple, NULL satisfies the constraint like in SQL
+func (ck *ckConstraint) check(sp *Space, tuple []any) error {
+	if truth, known := sqlTruth(ck.expr(sp, tuple)); known && !truth {
+		return ClientError(ER_CK_CONSTRAINT_FAILED, ck.name, ck.code)
+	}
+	return nil
+}
+
+// checkConstraints checks the prepared change against constraints, deferred foreign keys are skipped
+// if they are checked by the commit
+func (s *Storage) checkConstraints(ch *change) error {
+	if s.replaying {
+		return nil
+	}
+	if ch.new != nil {
+		for _, ck := range s.cks[ch.space.ID] {
+			if !ck.enabled {
+				continue
+			}
+			if err := ck.check(ch.space, ch.new); err != nil {
+				return err
+			}
+		}
+	}
+	for _, fk := range s.fks {
+		if fk.deferred && s.deferFKs || !fk.violated(s, ch) {
+			continue
+		}
+		if fk.deferred {
+			return ClientError(ER_FOREIGN_KEY_CONSTRAINT)
+		}
+		return ClientError(ER_SQL_EXECUTE, "FOREIGN KEY constraint failed")
+	}
+	return nil
+}
+
+// checkDeferred checks deferred foreign keys after changes of the transaction are applied
+func (s *Storage) checkDeferred(changes []*change) error {
+	for _, fk := range s.fks {
+		if !fk.deferred {
+			continue
+		}
+		for _, ch := range changes {
+			if fk.unresolved(s, ch) {
+				return ClientError(ER_FOREIGN_KEY_CONSTRAINT)
+			}
+		}
+	}
+	return nil
+}
+
+// violated is true if the change isn't applied yet and breaks the foreign key
+func (fk *fkConstraint) violated(s *Storage, ch *change) bool {
+	if ch.space.ID == fk.child && ch.new != nil {
+		values := fieldValues(ch.new, fk.childCols)
+		switch {
+		case hasNull(values):
+		case ch.old != nil && equalValues(fieldValues(ch.old, fk.childCols), values):
+		case fk.parent == fk.child && equalValues(fieldValues(ch.new, fk.parentCols), values):
+			// the tuple refers to itself
+		default:
+			if !fk.parentExists(s, values) {
+				return true
+			}
+		}
+	}
+	if ch.space.ID == fk.parent && ch.old != nil {
+		values := fieldValues(ch.old, fk.parentCols)
+		if ch.new != nil && equalValues(fieldValues(ch.new, fk.parentCols), values) {
+			return false
+		}
+		return fk.referenced(s, values, ch.old)
+	}
+	return false
+}
+
+// unresolved is true if the applied change leaves a reference without the parent
+func (fk *fkConstraint) unresolved(s *Storage, ch *change) bool {
+	if ch.space.ID == fk.child && ch.new != nil {
+		if t, _ := ch.space.primary().find(ch.new, false); t != nil {
+			if values := fieldValues(t, fk.childCols); !hasNull(values) && !fk.parentExists(s, values) {
+				return true
+			}
+		}
+	}
+	if ch.space.ID == fk.parent && ch.old != nil {
+		values := fieldValues(ch.old, fk.parentCols)
+		return !fk.parentExists(s, values) && fk.referenced(s, values, nil)
+	}
+	return false
+}
+
+// parentIndex returns the unique index of the parent made of the referenced fields
+func (fk *fkConstraint) parentIndex(parent *Space) *Index {
+	for _, idx := range parent.Indexes {
+		if !idx.Unique || len(idx.Parts) != len(fk.parentCols) || !idx.simple() {
+			continue
+		}
+		found := 0
+		for _, p := range idx.Parts {
+			for _, col := range fk.parentCols {
+				if p.Field == col && p.Path == "" {
+					found++
+				}
+			}
+		}
+		if found == len(idx.Parts) {
+			return idx
+		}
+	}
+	return nil
+}
+
+// parentExists is true if the parent has the tuple with values of referenced fields
+func (fk *fkConstraint) parentExists(s *Storage, values []any) bool {
+	parent, ok := s.spaces[fk.parent]
+	if !ok {
+		return false
+	}
+	idx := fk.parentIndex(parent)
+	if idx == nil {
+		return false
+	}
+	key := make([]any, len(idx.Parts))
+	for i, p := range idx.Parts {
+		for j, col := range fk.parentCols {
+			if p.Field == col {
+				key[i] = values[j]
+			}
+		}
+	}
+	t, _ := parent.get(idx.ID, key)
+	return t != nil
+}
+
+// referenced is true if a tuple of the child refers to the values, the except tuple is skipped
+func (fk *fkConstraint) referenced(s *Storage, values []any, except []any) bool {
+	child, ok := s.spaces[fk.child]
+	if !ok {
+		return false
+	}
+	for _, t := range child.Tuples() {
+		if except != nil && fk.child == fk.parent && child.primary().compareKeys(t, except) == 0 {
+			continue
+		}
+		if equalValues(fieldValues(t, fk.childCols), values) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependentConstraints returns the error if constraints refer to the space
+func (s *Storage) dependentConstraints(sp *Space) error {
+	for _, fk := range s.fks {
+		if fk.child == sp.ID || fk.parent == sp.ID {
+			return ClientError(ER_DROP_SPACE, sp.Name, "the space has foreign key constraints")
+		}
+	}
+	if len(s.cks[sp.ID]) > 0 {
+		return ClientError(ER_DROP_SPACE, sp.Name, "the space has check constraints")
+	}
+	return nil
+}
+
+// referencedIndex returns the error if the index of the space is used by a foreign key
+func (s *Storage) referencedIndex(sp *Space, id uint64) error {
+	for _, fk := range s.fks {
+		if idx := fk.parentIndex(sp); fk.parent == sp.ID && idx != nil && idx.ID == id {
+			return ClientError(ER_ALTER_SPACE, sp.Name, "can not drop a referenced index")
+		}
+	}
+	return nil
+}
+
+func fieldValues(tuple []any, fields []uint64) []any {
+	values := make([]any, len(fields))
+	for i, no := range fields {
+		values[i] = tupleField(tuple, no)
+	}
+	return values
+}
+
+func hasNull(values []any) bool {
+	for _, v := range values {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func equalValues(a, b []any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if CompareValues(a[i], b[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package tarantella
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraints(t *testing.T) {
+	dir := t.TempDir()
+	inst, err := NewInstance(&Config{DataDir: dir})
+	require.NoError(t, err)
+	s := inst.storage
+
+	pk := []any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}}
+	accounts, err := s.createSpace("ACCOUNTS", map[any]any{}, []any{
+		map[any]any{"name": "ID", "type": "unsigned"},
+		map[any]any{"name": "NAME", "type": "string"},
+	}, pk)
+	require.NoError(t, err)
+	payments, err := s.createSpace("PAYMENTS", map[any]any{}, []any{
+		map[any]any{"name": "ID", "type": "unsigned"},
+		map[any]any{"name": "ACCOUNT", "type": "unsigned", "is_nullable": true},
+		map[any]any{"name": "AMOUNT", "type": "integer"},
+	}, pk)
+	require.NoError(t, err)
+	refunds, err := s.createSpace("REFUNDS", map[any]any{}, []any{
+		map[any]any{"name": "ID", "type": "unsigned"},
+		map[any]any{"name": "ACCOUNT", "type": "unsigned"},
+	}, pk)
+	require.NoError(t, err)
+
+	fk := func(name string, child *Space, deferred bool) *InsertRequest {
+		return &InsertRequest{SpaceID: BOX_FK_CONSTRAINT_ID, Tuple: []any{name, child.ID, accounts.ID, deferred,
+			"simple", "no_action", "no_action", []any{uint64(1)}, []any{uint64(0)}}}
+	}
+	ck := func(name, code string) *InsertRequest {
+		return &InsertRequest{SpaceID: BOX_CK_CONSTRAINT_ID, Tuple: []any{payments.ID, name, false, "SQL", code, true}}
+	}
+	insert := func(sp *Space, tuple ...any) error {
+		_, err := s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: tuple})
+		return err
+	}
+	code := func(err error) uint32 {
+		require.Error(t, err)
+		return err.(*BoxError).Code
+	}
+
+	_, err = s.Execute(fk("fk_payment_account", payments, false))
+	require.NoError(t, err)
+	_, err = s.Execute(fk("fk_refund_account", refunds, true))
+	require.NoError(t, err)
+	_, err = s.Execute(ck("ck_amount", "amount >= 0 AND amount BETWEEN 0 AND 1000000"))
+	require.NoError(t, err)
+	_, err = s.Execute(ck("ck_wrong", "AMOUNT >"))
+	require.Equal(t, ER_CREATE_CK_CONSTRAINT, code(err))
+	_, err = s.Execute(ck("ck_field", "BALANCE > 0"))
+	require.Equal(t, ER_SQL_CANT_RESOLVE_FIELD, code(err))
+
+	// references are checked on both sides, NULL refers to nothing
+	require.Equal(t, ER_SQL_EXECUTE, code(insert(payments, uint64(1), uint64(1), int64(10))))
+	require.NoError(t, insert(accounts, uint64(1), "alice"))
+	require.NoError(t, insert(payments, uint64(1), uint64(1), int64(10)))
+	require.NoError(t, insert(payments, uint64(2), nil, int64(20)))
+	err = insert(payments, uint64(3), uint64(1), int64(-5))
+	require.Equal(t, "Check constraint failed 'ck_amount': amount >= 0 AND amount BETWEEN 0 AND 1000000", err.Error())
+	_, err = s.Execute(&DeleteRequest{SpaceID: accounts.ID, Key: []any{uint64(1)}})
+	require.Equal(t, ER_SQL_EXECUTE, code(err))
+	_, err = s.Execute(&UpdateRequest{SpaceID: accounts.ID, Key: []any{uint64(1)}, Ops: []any{[]any{"=", uint64(1), "bob"}}})
+	require.NoError(t, err)
+	_, err = s.Execute(ck("ck_small", "AMOUNT < 15"))
+	require.Equal(t, ER_CK_CONSTRAINT_FAILED, code(err))
+
+	// deferred foreign keys are checked by the commit
+	require.Equal(t, ER_FOREIGN_KEY_CONSTRAINT, code(insert(refunds, uint64(1), uint64(2))))
+	tx := s.Begin(0)
+	for _, req := range []any{
+		&InsertRequest{SpaceID: refunds.ID, Tuple: []any{uint64(1), uint64(2)}},
+		&InsertRequest{SpaceID: accounts.ID, Tuple: []any{uint64(2), "carol"}},
+	} {
+		_, err = tx.Execute(req)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	tx = s.Begin(0)
+	_, err = tx.Execute(&InsertRequest{SpaceID: refunds.ID, Tuple: []any{uint64(2), uint64(3)}})
+	require.NoError(t, err)
+	require.Equal(t, ER_FOREIGN_KEY_CONSTRAINT, code(tx.Commit()))
+	require.Equal(t, 1, refunds.Len())
+
+	// referenced spaces and indexes can't be dropped
+	_, err = s.Execute(&DeleteRequest{SpaceID: BOX_INDEX_ID, Key: []any{accounts.ID, uint64(0)}})
+	require.Equal(t, ER_ALTER_SPACE, code(err))
+
+	// constraints are recovered
+	require.NoError(t, inst.Close())
+	inst, err = NewInstance(&Config{DataDir: dir})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	s = inst.storage
+	require.Equal(t, ER_SQL_EXECUTE, code(insert(payments, uint64(4), uint64(5), int64(1))))
+	require.Equal(t, ER_CK_CONSTRAINT_FAILED, code(insert(payments, uint64(4), uint64(1), int64(-1))))
+	_, err = s.Execute(&DeleteRequest{SpaceID: BOX_CK_CONSTRAINT_ID, Key: []any{payments.ID, "ck_amount"}})
+	require.NoError(t, err)
+	require.NoError(t, insert(payments, uint64(4), uint64(1), int64(-1)))
+
+	// SQL isn't run, so statements with constraints fail instead of passing silently
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rc := connectReplica(t, ctx, inst)
+	for _, sql := range []string{
+		"CREATE TABLE orders (id INT PRIMARY KEY, amount INT, CHECK (amount >= 0))",
+		"INSERT INTO orders VALUES (1, -5)",
+	} {
+		rc.send(IPROTO_EXECUTE, map[any]any{IPROTO_SQL_TEXT: sql, IPROTO_SQL_BIND: []any{}})
+		h, body := rc.read()
+		require.Equal(t, IPROTO_TYPE_ERROR|uint64(ER_UNSUPPORTED), h[IPROTO_REQUEST_TYPE])
+		require.Equal(t, "tarantella does not support SQL", body[IPROTO_ERROR_24])
+	}
+}
+
+func TestSQLExpr(t *testing.T) {
+	sp := &Space{Format: []FieldDef{{Name: "ID"}, {Name: "NAME"}, {Name: "score"}}}
+	tuple := []any{uint64(7), "Alice", nil}
+	for code, expected := range map[string]any{
+		"id * 2 - 4 = 10 AND NOT id < 0":          true,
+		"ID IN (1, 2, 3) OR ID / 2 = 3":           true,
+		"name LIKE 'Al_c%' AND LENGTH(name) = 5":  true,
+		"UPPER(name) || '!' = 'ALICE!'":           true,
+		"score > 0":                               nil,
+		"score IS NULL AND \"score\" IS NOT NULL": false,
+		"score > 0 OR id <> 7":                    nil,
+		"ABS(-id) NOT BETWEEN 1 AND 6":            true,
+		"1.5 + id > 8.4":                          true,
+	} {
+		e, err := parseSQLExpr(code, sp)
+		require.NoError(t, err, code)
+		require.Equal(t, expected, e(sp, tuple), code)
+	}
+}
@@ -0,0 +1,708 @@
+package tarantella
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// The crud module is emulated: crud.insert, crud.get, crud.select and others are functions of every
+// instance working with its spaces. On the router of vshard they work with the storages: a tuple goes
+// to the storage of its bucket, select and count collect tuples of all storages. Like crud, results are
+// {metadata = format of the space, rows = tuples}, errors are objects of the errors module returned as
+// values, bucket_id field is filled by crc32 of the primary key
+
+type (
+	// crud is the set of storages crud functions work with
+	crud struct {
+		storages    func() []*Instance
+		route       func(bucketID uint64) (*Instance, error)
+		bucketCount uint64
+	}
+
+	// crudErr is an error of the errors module, it's returned to clients as a map
+	crudErr struct {
+		m map[any]any
+	}
+
+	// crudCondition is a condition of crud.select: {operator, field or index name, value}
+	crudCondition struct {
+		iterator uint64
+		fields   []uint64
+		value    []any
+		index    *Index // the index the condition may be scanned by, nil if there is no such one
+	}
+)
+
+// crudOperators are operators of conditions and iterators they are scanned with
+var crudOperators = map[string]uint64{
+	"=":  ITER_EQ,
+	"==": ITER_EQ,
+	"<":  ITER_LT,
+	"<=": ITER_LE,
+	">":  ITER_GT,
+	">=": ITER_GE,
+}
+
+// localCrud works with spaces of the instance
+func localCrud(inst *Instance) *crud {
+	return &crud{
+		storages:    func() []*Instance { return []*Instance{inst} },
+		route:       func(uint64) (*Instance, error) { return inst, nil },
+		bucketCount: defaultBucketCount,
+	}
+}
+
+func registerCrud(inst *Instance, c *crud) {
+	put := func(class string, replace, object bool) Function {
+		return crudFunction(func(ctx *CallContext, args []any) (any, error) {
+			return c.put(ctx, class, args, replace, object)
+		})
+	}
+	inst.RegisterFunction("crud.insert", put("InsertError", false, false))
+	inst.RegisterFunction("crud.insert_object", put("InsertError", false, true))
+	inst.RegisterFunction("crud.replace", put("ReplaceError", true, false))
+	inst.RegisterFunction("crud.replace_object", put("ReplaceError", true, true))
+	upsert := func(object bool) Function {
+		return crudFunction(func(ctx *CallContext, args []any) (any, error) {
+			return c.upsert(ctx, args, object)
+		})
+	}
+	inst.RegisterFunction("crud.upsert", upsert(false))
+	inst.RegisterFunction("crud.upsert_object", upsert(true))
+	inst.RegisterFunction("crud.get", crudFunction(c.get))
+	inst.RegisterFunction("crud.update", crudFunction(c.update))
+	inst.RegisterFunction("crud.delete", crudFunction(c.delete))
+	inst.RegisterFunction("crud.select", crudFunction(c.selectRows))
+	inst.RegisterFunction("crud.count", crudFunction(c.count))
+	inst.RegisterFunction("crud.len", crudFunction(c.len))
+	inst.RegisterFunction("crud.truncate", crudFunction(c.truncate))
+	inst.RegisterFunction("crud.min", crudFunction(func(ctx *CallContext, args []any) (any, error) {
+		return c.border(args, false)
+	}))
+	inst.RegisterFunction("crud.max", crudFunction(func(ctx *CallContext, args []any) (any, error) {
+		return c.border(args, true)
+	}))
+}
+
+// crudFunction returns the result of the function and nil or nil and the error like crud does
+func crudFunction(fn func(ctx *CallContext, args []any) (any, error)) Function {
+	return func(ctx *CallContext, args []any) ([]any, error) {
+		res, err := fn(ctx, args)
+		if err != nil {
+			if ce, ok := err.(*crudErr); ok {
+				return []any{nil, ce.m}, nil
+			}
+			return nil, err
+		}
+		return []any{res, nil}, nil
+	}
+}
+
+// put inserts or replaces the tuple or the object: space_name, tuple, opts
+func (c *crud) put(ctx context.Context, class string, args []any, replace, object bool) (any, error) {
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	tuple, err := crudTuple(class, sp, arg(args, 1), object)
+	if err != nil {
+		return nil, err
+	}
+	opts := crudOpts(arg(args, 2))
+	tuple, bucket := c.bucketID(sp, tuple, opts)
+	op := "insert"
+	if replace {
+		op = "replace"
+	}
+	rows, err := c.call(ctx, class, op, sp, bucket, func(spaceID uint64) any {
+		return &InsertRequest{Replace: replace, SpaceID: spaceID, Tuple: tuple}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crudResult(class, sp, rows, opts)
+}
+
+// upsert inserts the tuple or the object or updates the existing one: space_name, tuple, operations, opts
+func (c *crud) upsert(ctx context.Context, args []any, object bool) (any, error) {
+	const class = "UpsertError"
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	tuple, err := crudTuple(class, sp, arg(args, 1), object)
+	if err != nil {
+		return nil, err
+	}
+	ops, _ := arg(args, 2).([]any)
+	opts := crudOpts(arg(args, 3))
+	tuple, bucket := c.bucketID(sp, tuple, opts)
+	if _, err := c.call(ctx, class, "upsert", sp, bucket, func(spaceID uint64) any {
+		return &UpsertRequest{SpaceID: spaceID, IndexBase: 1, Tuple: tuple, Ops: ops}
+	}); err != nil {
+		return nil, err
+	}
+	return crudResult(class, sp, nil, opts)
+}
+
+// get returns the tuple by the primary key: space_name, key, opts
+func (c *crud) get(ctx *CallContext, args []any) (any, error) {
+	const class = "GetError"
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	key, opts := crudKey(arg(args, 1)), crudOpts(arg(args, 2))
+	rows, err := c.call(ctx, class, "get", sp, c.keyBucketID(key, opts), func(spaceID uint64) any {
+		return &SelectRequest{SpaceID: spaceID, Iterator: ITER_EQ, Key: key, Limit: 1}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crudResult(class, sp, rows, opts)
+}
+
+// update updates the tuple by the primary key: space_name, key, operations, opts
+func (c *crud) update(ctx *CallContext, args []any) (any, error) {
+	const class = "UpdateError"
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	key, opts := crudKey(arg(args, 1)), crudOpts(arg(args, 3))
+	ops, _ := arg(args, 2).([]any)
+	rows, err := c.call(ctx, class, "update", sp, c.keyBucketID(key, opts), func(spaceID uint64) any {
+		return &UpdateRequest{SpaceID: spaceID, IndexBase: 1, Key: key, Ops: ops}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crudResult(class, sp, rows, opts)
+}
+
+// delete deletes the tuple by the primary key: space_name, key, opts
+func (c *crud) delete(ctx *CallContext, args []any) (any, error) {
+	const class = "DeleteError"
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	key, opts := crudKey(arg(args, 1)), crudOpts(arg(args, 2))
+	rows, err := c.call(ctx, class, "delete", sp, c.keyBucketID(key, opts), func(spaceID uint64) any {
+		return &DeleteRequest{SpaceID: spaceID, Key: key}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crudResult(class, sp, rows, opts)
+}
+
+// selectRows returns tuples matching the conditions: space_name, conditions, opts with first and after
+func (c *crud) selectRows(ctx *CallContext, args []any) (any, error) {
+	const class = "SelectError"
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	opts := crudOpts(arg(args, 2))
+	tuples, scan, sign, err := c.find(class, sp, arg(args, 1), opts)
+	if err != nil {
+		return nil, err
+	}
+	if tuples, err = paginate(class, sp, tuples, scan, sign, opts); err != nil {
+		return nil, err
+	}
+	return crudResult(class, sp, tuples, opts)
+}
+
+// count returns the number of tuples matching the conditions: space_name, conditions, opts
+func (c *crud) count(ctx *CallContext, args []any) (any, error) {
+	const class = "CountError"
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	tuples, _, _, err := c.find(class, sp, arg(args, 1), crudOpts(arg(args, 2)))
+	if err != nil {
+		return nil, err
+	}
+	return uint64(len(tuples)), nil
+}
+
+// len returns the number of tuples of the space: space_name, opts
+func (c *crud) len(ctx *CallContext, args []any) (any, error) {
+	const class = "LenError"
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	tuples, _, _, err := c.find(class, sp, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return uint64(len(tuples)), nil
+}
+
+// truncate deletes all tuples of the space on all storages: space_name, opts
+func (c *crud) truncate(ctx *CallContext, args []any) (any, error) {
+	const class = "TruncateError"
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	for _, inst := range c.storages() {
+		local, ok := inst.storage.SpaceByName(sp.Name)
+		if !ok {
+			return nil, storageError(class, "truncate", inst, ErrNoSuchSpace(sp.Name))
+		}
+		data, err := inst.storage.Select(&SelectRequest{SpaceID: local.ID, Iterator: ITER_ALL, Limit: math.MaxUint32})
+		if err != nil {
+			return nil, storageError(class, "truncate", inst, err)
+		}
+		pk := local.primary()
+		for _, t := range data {
+			req := &DeleteRequest{SpaceID: local.ID, Key: pk.extractKey(t.([]any))}
+			if _, err := inst.Execute(ctx, req); err != nil {
+				return nil, storageError(class, "truncate", inst, err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// border returns the first or the last tuple of the index: space_name, index_name, opts
+func (c *crud) border(args []any, last bool) (any, error) {
+	const class = "BorderError"
+	sp, err := c.space(class, arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	idx := sp.primary()
+	if name, ok := arg(args, 1).(string); ok {
+		if idx, ok = sp.IndexByName(name); !ok {
+			return nil, crudError(class, "Index %q of space %q doesn't exist", name, sp.Name)
+		}
+	}
+	if idx == nil {
+		return nil, crudError(class, "Space %q has no primary index", sp.Name)
+	}
+	iterator, sign := uint64(ITER_GE), 1
+	if last {
+		iterator, sign = ITER_LE, -1
+	}
+	var border []any
+	for _, inst := range c.storages() {
+		local, ok := inst.storage.SpaceByName(sp.Name)
+		if !ok {
+			continue
+		}
+		data, err := inst.storage.Select(&SelectRequest{SpaceID: local.ID, IndexID: idx.ID, Iterator: iterator, Limit: 1})
+		if err != nil {
+			return nil, storageError(class, "borders", inst, err)
+		}
+		if len(data) > 0 && (border == nil || sign*idx.compareTuples(data[0].([]any), border) < 0) {
+			border = data[0].([]any)
+		}
+	}
+	var rows []any
+	if border != nil {
+		rows = []any{border}
+	}
+	return crudResult(class, sp, rows, crudOpts(arg(args, 2)))
+}
+
+// space returns the space of the first storage by name
+func (c *crud) space(class string, name any) (*Space, error) {
+	spaceName, ok := name.(string)
+	if !ok {
+		return nil, crudError(class, "Space name should be a string")
+	}
+	if storages := c.storages(); len(storages) > 0 {
+		if sp, ok := storages[0].storage.SpaceByName(spaceName); ok {
+			return sp, nil
+		}
+	}
+	return nil, crudError(class, "Space %q doesn't exist", spaceName)
+}
+
+// call executes the request for the space on the storage of the bucket, a select request selects
+func (c *crud) call(ctx context.Context, class, op string, sp *Space, bucket uint64, request func(spaceID uint64) any) ([]any, error) {
+	inst, err := c.route(bucket)
+	if err != nil {
+		return nil, crudError(class, "Failed to call %s on storage-side: %s", op, err)
+	}
+	local, ok := inst.storage.SpaceByName(sp.Name)
+	if !ok {
+		return nil, storageError(class, op, inst, ErrNoSuchSpace(sp.Name))
+	}
+	var rows []any
+	switch req := request(local.ID).(type) {
+	case *SelectRequest:
+		rows, err = inst.storage.Select(req)
+	default:
+		var tuple []any
+		if tuple, err = inst.Execute(ctx, req); tuple != nil {
+			rows = []any{tuple}
+		}
+	}
+	if err != nil {
+		return nil, storageError(class, op, inst, err)
+	}
+	return rows, nil
+}
+
+// bucketID sets bucket_id field of the tuple if the space has it, the bucket is given by opts,
+// by the field or calculated by the primary key
+func (c *crud) bucketID(sp *Space, tuple []any, opts map[any]any) ([]any, uint64) {
+	no, hasField := sp.fieldNo("bucket_id")
+	id, ok := uintArg([]any{opts["bucket_id"]}, 0)
+	if !ok && hasField {
+		id, ok = uintArg(tuple, int(no))
+	}
+	if !ok {
+		var key []any
+		if pk := sp.primary(); pk != nil {
+			key = pk.extractKey(tuple)
+		}
+		id = bucketID(key, c.bucketCount, luaString)
+	}
+	if hasField {
+		for uint64(len(tuple)) <= no {
+			tuple = append(tuple, nil)
+		}
+		tuple[no] = id
+	}
+	return tuple, id
+}
+
+// keyBucketID returns the bucket of the primary key
+func (c *crud) keyBucketID(key []any, opts map[any]any) uint64 {
+	if id, ok := uintArg([]any{opts["bucket_id"]}, 0); ok {
+		return id
+	}
+	return bucketID(key, c.bucketCount, luaString)
+}
+
+// find returns tuples of all storages matching the conditions, they are ordered by the scanned index,
+// sign is -1 if the order is descending
+func (c *crud) find(class string, sp *Space, conditions any, opts map[any]any) ([]any, *Index, int, error) {
+	conds, err := parseConditions(sp, conditions)
+	if err != nil {
+		return nil, nil, 0, crudError(class, "Failed to parse conditions: %s", err)
+	}
+	// the first condition having an index is scanned, others filter tuples
+	scan, iterator, key := sp.primary(), uint64(ITER_ALL), []any(nil)
+	for _, cond := range conds {
+		if cond.index != nil {
+			scan, iterator, key = cond.index, cond.iterator, cond.value
+			break
+		}
+	}
+	if scan == nil {
+		return nil, nil, 0, crudError(class, "Space %q has no primary index", sp.Name)
+	}
+	sign := 1
+	if iterator == ITER_LT || iterator == ITER_LE {
+		sign = -1
+	}
+
+	storages := c.storages()
+	if id, ok := uintArg([]any{opts["bucket_id"]}, 0); ok {
+		inst, err := c.route(id)
+		if err != nil {
+			return nil, nil, 0, crudError(class, "Failed to call select on storage-side: %s", err)
+		}
+		storages = []*Instance{inst}
+	}
+	tuples := []any{}
+	for _, inst := range storages {
+		local, ok := inst.storage.SpaceByName(sp.Name)
+		if !ok {
+			return nil, nil, 0, storageError(class, "select", inst, ErrNoSuchSpace(sp.Name))
+		}
+		data, err := inst.storage.Select(&SelectRequest{
+			SpaceID: local.ID, IndexID: scan.ID, Iterator: iterator, Key: key, Limit: math.MaxUint32,
+		})
+		if err != nil {
+			return nil, nil, 0, storageError(class, "select", inst, err)
+		}
+		for _, t := range data {
+			if matchConditions(conds, t.([]any)) {
+				tuples = append(tuples, t)
+			}
+		}
+	}
+	sort.SliceStable(tuples, func(i, j int) bool {
+		return sign*scan.compareTuples(tuples[i].([]any), tuples[j].([]any)) < 0
+	})
+	return tuples, scan, sign, nil
+}
+
+// paginate returns first tuples after the after tuple, negative first means tuples before it
+func paginate(class string, sp *Space, tuples []any, scan *Index, sign int, opts map[any]any) ([]any, error) {
+	var first int64
+	limited := true
+	switch v := opts["first"].(type) {
+	case uint64:
+		first = int64(v)
+	case int64:
+		first = v
+	case nil:
+		limited = false
+	default:
+		return nil, crudError(class, "Invalid first option: integer expected")
+	}
+	after, err := crudAfter(class, sp, opts["after"])
+	if err != nil {
+		return nil, err
+	}
+	if first < 0 && after == nil {
+		return nil, crudError(class, "Negative first should be specified only with after option")
+	}
+	if after != nil {
+		rest := []any{}
+		for _, t := range tuples {
+			c := sign * scan.compareTuples(t.([]any), after)
+			if (first >= 0 && c > 0) || (first < 0 && c < 0) {
+				rest = append(rest, t)
+			}
+		}
+		tuples = rest
+	}
+	switch {
+	case !limited:
+	case first >= 0 && int64(len(tuples)) > first:
+		tuples = tuples[:first]
+	case first < 0 && int64(len(tuples)) > -first:
+		tuples = tuples[int64(len(tuples))+first:]
+	}
+	return tuples, nil
+}
+
+// crudAfter returns the after option which is a tuple or an object
+func crudAfter(class string, sp *Space, v any) ([]any, error) {
+	switch after := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		return after, nil
+	case map[any]any:
+		tuple, err := flatten(sp, after, false)
+		if err != nil {
+			return nil, crudError(class, "Failed to flatten after object: %s", err)
+		}
+		return tuple, nil
+	}
+	return nil, crudError(class, "Invalid after option: tuple or object expected")
+}
+
+// parseConditions parses conditions {{operator, field or index name, value}, ...}
+func parseConditions(sp *Space, v any) ([]crudCondition, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, errors.New("Conditions should be a table")
+	}
+	conds := make([]crudCondition, 0, len(list))
+	for i, item := range list {
+		c, ok := item.([]any)
+		if !ok || len(c) != 3 {
+			return nil, errors.Errorf("Condition #%d should be {operator, operand, value}", i+1)
+		}
+		op, _ := c[0].(string)
+		iterator, ok := crudOperators[op]
+		if !ok {
+			return nil, errors.Errorf("condition #%d: unknown operator %v", i+1, c[0])
+		}
+		name, _ := c[1].(string)
+		cond := crudCondition{iterator: iterator}
+		if idx, ok := sp.IndexByName(name); ok {
+			cond.index = idx
+			for _, p := range idx.Parts {
+				cond.fields = append(cond.fields, p.Field)
+			}
+			if cond.value, ok = c[2].([]any); !ok {
+				cond.value = []any{c[2]}
+			}
+			if len(cond.value) > len(cond.fields) {
+				return nil, errors.Errorf("condition #%d: index %q has %d parts", i+1, name, len(cond.fields))
+			}
+		} else if no, ok := sp.fieldNo(name); ok {
+			cond.fields, cond.value = []uint64{no}, []any{c[2]}
+			for _, idx := range sp.Indexes {
+				if idx.Parts[0].Field == no {
+					cond.index = idx
+					break
+				}
+			}
+		} else {
+			return nil, errors.Errorf("No field or index %q found", name)
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+// matchConditions checks the tuple satisfies all conditions
+func matchConditions(conds []crudCondition, tuple []any) bool {
+	for _, cond := range conds {
+		c := 0
+		for i, v := range cond.value {
+			if c = CompareValues(tupleField(tuple, cond.fields[i]), v); c != 0 {
+				break
+			}
+		}
+		var ok bool
+		switch cond.iterator {
+		case ITER_EQ:
+			ok = c == 0
+		case ITER_LT:
+			ok = c < 0
+		case ITER_LE:
+			ok = c <= 0
+		case ITER_GT:
+			ok = c > 0
+		case ITER_GE:
+			ok = c >= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// crudTuple returns the copy of the tuple or the tuple made of the object
+func crudTuple(class string, sp *Space, v any, object bool) ([]any, error) {
+	if object {
+		m, ok := v.(map[any]any)
+		if !ok {
+			return nil, crudError(class, "Object should be a map")
+		}
+		tuple, err := flatten(sp, m, true)
+		if err != nil {
+			return nil, crudError(class, "Failed to flatten object: %s", err)
+		}
+		return tuple, nil
+	}
+	tuple, ok := v.([]any)
+	if !ok {
+		return nil, crudError(class, "Tuple should be a table")
+	}
+	return append([]any{}, tuple...), nil
+}
+
+// flatten makes the tuple of the object by the space format, bucket_id may be missing
+func flatten(sp *Space, object map[any]any, check bool) ([]any, error) {
+	for name := range object {
+		s, _ := name.(string)
+		if _, ok := sp.fieldNo(s); !ok {
+			return nil, errors.Errorf("Unknown field %q is specified", fmt.Sprint(name))
+		}
+	}
+	tuple := make([]any, len(sp.Format))
+	for i, f := range sp.Format {
+		v, ok := object[f.Name]
+		if check && (!ok || v == nil) && !f.IsNullable && f.Name != "bucket_id" {
+			return nil, errors.Errorf("Field %q isn't nullable", f.Name)
+		}
+		tuple[i] = v
+	}
+	for len(tuple) > 0 && tuple[len(tuple)-1] == nil {
+		tuple = tuple[:len(tuple)-1]
+	}
+	return tuple, nil
+}
+
+// crudResult makes {metadata, rows}, the fields option selects fields of rows
+func crudResult(class string, sp *Space, rows []any, opts map[any]any) (any, error) {
+	metadata := make([]any, 0, len(sp.Format))
+	for _, f := range sp.Format {
+		metadata = append(metadata, fieldMetadata(f))
+	}
+	if rows == nil {
+		rows = []any{}
+	}
+	if names, ok := opts["fields"].([]any); ok && len(names) > 0 {
+		fields := make([]uint64, 0, len(names))
+		metadata = metadata[:0]
+		for _, name := range names {
+			s, _ := name.(string)
+			no, ok := sp.fieldNo(s)
+			if !ok {
+				return nil, crudError(class, "Space format doesn't contain field named %q", fmt.Sprint(name))
+			}
+			fields = append(fields, no)
+			metadata = append(metadata, fieldMetadata(sp.Format[no]))
+		}
+		projected := make([]any, 0, len(rows))
+		for _, row := range rows {
+			tuple := make([]any, len(fields))
+			for i, no := range fields {
+				tuple[i] = tupleField(row.([]any), no)
+			}
+			projected = append(projected, tuple)
+		}
+		rows = projected
+	}
+	return map[any]any{"metadata": metadata, "rows": rows}, nil
+}
+
+// fieldMetadata describes the field like space:format() does
+func fieldMetadata(f FieldDef) map[any]any {
+	m := map[any]any{"name": f.Name, "type": f.Type}
+	if f.IsNullable {
+		m["is_nullable"] = true
+	}
+	return m
+}
+
+// crudKey returns the key which may be a scalar
+func crudKey(v any) []any {
+	switch key := v.(type) {
+	case nil:
+		return []any{}
+	case []any:
+		return key
+	}
+	return []any{v}
+}
+
+// crudOpts returns the options map, it's empty if there are no options
+func crudOpts(v any) map[any]any {
+	if opts, ok := v.(map[any]any); ok {
+		return opts
+	}
+	return map[any]any{}
+}
+
+func (e *crudErr) Error() string {
+	msg, _ := e.m["str"].(string)
+	return msg
+}
+
+// crudError makes the error of the class like errors.new_class() of crud does
+func crudError(class, format string, args ...any) *crudErr {
+	msg := fmt.Sprintf(format, args...)
+	return &crudErr{m: map[any]any{
+		"class_name": class,
+		"err":        msg,
+		"str":        class + ": " + msg,
+	}}
+}
+
+// storageError wraps the error of the storage like crud does for errors of storage calls
+func storageError(class, op string, inst *Instance, err error) *crudErr {
+	msg := err.Error()
+	if be, ok := AsBoxError(err); ok {
+		msg = be.Message
+	}
+	return crudError(class, "Failed to call %s on storage-side: Failed for %s: Function returned an error: %s",
+		op, inst.storage.replicasetUUID(), msg)
+}
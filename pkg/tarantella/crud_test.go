@@ -0,0 +1,101 @@
+package tarantella
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrud(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inst, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	_, err = inst.storage.createSpace("customers", map[any]any{}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "bucket_id", "type": "unsigned"},
+		map[any]any{"name": "name", "type": "string"},
+		map[any]any{"name": "age", "type": "unsigned", "is_nullable": true},
+	},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}},
+		[]any{1, "age", "tree", map[any]any{"unique": false}, []any{map[any]any{"field": uint64(3), "type": "unsigned", "is_nullable": true}}},
+	)
+	require.NoError(t, err)
+
+	call := func(name string, args ...any) (any, map[any]any) {
+		ret, err := inst.Call(ctx, name, args)
+		require.NoError(t, err)
+		require.Len(t, ret, 2)
+		e, _ := ret[1].(map[any]any)
+		return ret[0], e
+	}
+	rows := func(res any) []any {
+		return res.(map[any]any)["rows"].([]any)
+	}
+
+	// bucket_id is calculated by the primary key
+	res, e := call("crud.insert_object", "customers", map[any]any{"id": uint64(1), "name": "Elizabeth", "age": uint64(24)})
+	require.Nil(t, e)
+	bucket := bucketID([]any{uint64(1)}, defaultBucketCount, luaString)
+	require.Equal(t, []any{[]any{uint64(1), bucket, "Elizabeth", uint64(24)}}, rows(res))
+	require.Equal(t, map[any]any{"name": "age", "type": "unsigned", "is_nullable": true},
+		res.(map[any]any)["metadata"].([]any)[3])
+	for _, c := range []struct {
+		id   uint64
+		name string
+		age  uint64
+	}{{2, "Mary", 46}, {3, "David", 33}, {4, "William", 81}, {5, "Mary", 33}} {
+		_, e = call("crud.insert", "customers", []any{c.id, nil, c.name, c.age})
+		require.Nil(t, e)
+	}
+
+	_, e = call("crud.insert", "customers", []any{uint64(1), nil, "Elizabeth"})
+	require.Equal(t, "InsertError", e["class_name"])
+	require.Contains(t, e["err"], "Duplicate key exists")
+	_, e = call("crud.insert_object", "customers", map[any]any{"id": uint64(6)})
+	require.Equal(t, `Failed to flatten object: Field "name" isn't nullable`, e["err"])
+	_, e = call("crud.get", "no_such_space", uint64(1))
+	require.Equal(t, `GetError: Space "no_such_space" doesn't exist`, e["str"])
+
+	res, _ = call("crud.get", "customers", uint64(2), map[any]any{"fields": []any{"id", "name"}})
+	require.Equal(t, []any{[]any{uint64(2), "Mary"}}, rows(res))
+	res, _ = call("crud.update", "customers", uint64(2), []any{[]any{"+", "age", uint64(1)}})
+	require.Equal(t, uint64(47), rows(res)[0].([]any)[3])
+	res, _ = call("crud.delete", "customers", uint64(4))
+	require.Len(t, rows(res), 1)
+	res, _ = call("crud.upsert_object", "customers", map[any]any{"id": uint64(6), "name": "Anna"}, []any{})
+	require.Empty(t, rows(res))
+
+	// the age index is scanned, the name condition filters
+	ids := func(res any) []any {
+		var ids []any
+		for _, t := range rows(res) {
+			ids = append(ids, t.([]any)[0])
+		}
+		return ids
+	}
+	conditions := []any{[]any{">=", "age", uint64(30)}, []any{"==", "name", "Mary"}}
+	res, _ = call("crud.select", "customers", conditions, map[any]any{})
+	require.Equal(t, []any{uint64(5), uint64(2)}, ids(res))
+	res, _ = call("crud.select", "customers", []any{[]any{"<", "age", uint64(47)}}, map[any]any{"first": uint64(2)})
+	require.Equal(t, []any{uint64(5), uint64(3)}, ids(res))
+	after := rows(res)[1]
+	res, _ = call("crud.select", "customers", []any{[]any{"<", "age", uint64(47)}}, map[any]any{"after": after})
+	require.Equal(t, []any{uint64(1), uint64(6)}, ids(res))
+	res, _ = call("crud.select", "customers", []any{[]any{"<", "age", uint64(47)}},
+		map[any]any{"after": after, "first": int64(-1)})
+	require.Equal(t, []any{uint64(5)}, ids(res))
+	_, e = call("crud.select", "customers", []any{[]any{"==", "email", "x"}})
+	require.Equal(t, `Failed to parse conditions: No field or index "email" found`, e["err"])
+
+	count, _ := call("crud.count", "customers", []any{[]any{"==", "age", uint64(33)}})
+	require.Equal(t, uint64(2), count)
+	res, _ = call("crud.max", "customers", "age")
+	require.Equal(t, []any{uint64(2)}, ids(res))
+	ok, _ := call("crud.truncate", "customers")
+	require.Equal(t, true, ok)
+	count, _ = call("crud.len", "customers")
+	require.Equal(t, uint64(0), count)
+}
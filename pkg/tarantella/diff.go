@@ -0,0 +1,354 @@
+package tarantella
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint: gosec
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Differential testing mode: every request of the client is mirrored into a reference
+// Tarantool through a separate connection and responses are compared field by field.
+
+const (
+	mirrorQueueSize  = 1024
+	mirrorTimeout    = 5 * time.Second
+	handshakeTimeout = 5 * time.Second
+)
+
+type (
+	// Divergence describes one field which differs between tarantella and reference responses
+	Divergence struct {
+		Path   string `yaml:"path"`
+		Ours   any    `yaml:"ours"`
+		Theirs any    `yaml:"theirs"`
+	}
+
+	// DiffReport is a record of the divergences found for one request
+	DiffReport struct {
+		Time        time.Time    `yaml:"time"`
+		Request     any          `yaml:"request"`
+		Divergences []Divergence `yaml:"divergences"`
+	}
+
+	// mirror keeps a connection to the reference Tarantool for one client connection
+	mirror struct {
+		c      net.Conn
+		report string
+		queue  chan mirrorItem
+		done   chan struct{}
+	}
+
+	mirrorItem struct {
+		req *Package
+		res *Package
+	}
+)
+
+// reportMu serializes writes into the report file from different connections
+var reportMu sync.Mutex
+
+// newMirror connects to the reference Tarantool, authenticates and starts the comparing goroutine
+func newMirror(cfg *Config) (*mirror, error) {
+	c, err := net.DialTimeout("tcp", cfg.DiffWith, mirrorTimeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to connect to reference %s", cfg.DiffWith)
+	}
+
+	m := &mirror{
+		c:      c,
+		report: cfg.DiffReport,
+		queue:  make(chan mirrorItem, mirrorQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	greeting, err := handshake(c, cfg.DiffUser, cfg.DiffPassword)
+	if err != nil {
+		c.Close() //nolint: errcheck
+		return nil, errors.Wrap(err, "reference")
+	}
+	log.Info().Str("greeting", greeting).Msg("Connected to the reference")
+
+	go m.run()
+	return m, nil
+}
+
+// handshake reads the greeting of the server and authenticates if user is set, the first
+// line of the greeting is returned
+func handshake(c net.Conn, user, password string) (string, error) {
+	c.SetDeadline(time.Now().Add(handshakeTimeout)) //nolint: errcheck
+	defer c.SetDeadline(time.Time{})                //nolint: errcheck
+
+	greeting := make([]byte, IPROTO_GREETING_SIZE)
+	if _, err := io.ReadFull(c, greeting); err != nil {
+		return "", errors.Wrap(err, "unable to read greeting")
+	}
+	version := strings.TrimSpace(string(greeting[:IPROTO_GREETING_SIZE/2]))
+	if user == "" {
+		return version, nil
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(greeting[IPROTO_GREETING_SIZE/2:])))
+	if err != nil {
+		return "", errors.Wrap(err, "unable to decode salt")
+	}
+	if len(salt) < sha1.Size {
+		return "", errors.Errorf("salt of the greeting is too short: %d bytes", len(salt))
+	}
+
+	auth := &Package{}
+	auth.SetHeader(IPROTO_REQUEST_TYPE, IPROTO_AUTH)
+	auth.SetHeader(IPROTO_SYNC, uint64(0))
+	auth.SetBody(IPROTO_USER_NAME, user)
+	auth.SetBody(IPROTO_TUPLE, []any{"chap-sha1", string(scramble(salt, password))})
+	if err := auth.Encode(); err != nil {
+		return "", errors.Wrap(err, "unable to encode auth request")
+	}
+	if _, err := c.Write(auth.ToBytes()); err != nil {
+		return "", errors.Wrap(err, "unable to send auth request")
+	}
+
+	res, err := readPackage(c)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read auth response")
+	}
+	if rt := res.HeaderRequestType(); rt != IPROTO_OK {
+		return "", errors.Errorf("authentication is rejected: %v", res.Body()[IPROTO_ERROR_24])
+	}
+	return version, nil
+}
+
+// scramble calculates chap-sha1 scramble like tarantool does
+func scramble(salt []byte, password string) []byte {
+	step1 := sha1.Sum([]byte(password)) //nolint: gosec
+	step2 := sha1.Sum(step1[:])         //nolint: gosec
+
+	h := sha1.New() //nolint: gosec
+	h.Write(salt[:sha1.Size])
+	h.Write(step2[:])
+	step3 := h.Sum(nil)
+
+	for i := range step3 {
+		step3[i] ^= step1[i]
+	}
+	return step3
+}
+
+// enqueue passes the request and tarantella's response to the comparing goroutine.
+// It never blocks the client: if the reference is too slow the pair is dropped
+func (m *mirror) enqueue(req, res *Package) {
+	select {
+	case m.queue <- mirrorItem{req: req, res: res}:
+	default:
+		log.Warn().Str("request-type", RequestTypeDescr(req.HeaderRequestType())).
+			Msg("Mirror queue is full, request is not compared")
+	}
+}
+
+// close stops the comparing goroutine and closes connection to the reference
+func (m *mirror) close() {
+	close(m.queue)
+	<-m.done
+	m.c.Close() //nolint: errcheck
+}
+
+func (m *mirror) run() {
+	defer close(m.done)
+
+	for item := range m.queue {
+		theirs, err := m.roundTrip(item.req)
+		if err != nil {
+			log.Error().Err(err).Msg("Reference is unreachable, stop mirroring")
+			break
+		}
+
+		// compare with the same decoder on both sides to get rid of the types noise
+		ours := &Package{}
+		if err := ours.Decode(item.res.rawData); err != nil {
+			log.Error().Err(err).Msg("Unable to decode own response")
+			continue
+		}
+
+		if divs := DiffPackages(ours, theirs); len(divs) > 0 {
+			m.reportDivergences(item.req, divs)
+		}
+	}
+
+	// drain the queue to let enqueue never block
+	for range m.queue { //nolint: revive
+	}
+}
+
+func (m *mirror) roundTrip(req *Package) (*Package, error) {
+	m.c.SetDeadline(time.Now().Add(mirrorTimeout)) //nolint: errcheck
+
+	if _, err := m.c.Write(req.ToBytes()); err != nil {
+		return nil, errors.Wrap(err, "unable to send request to reference")
+	}
+	res, err := readPackage(m.c)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read response of reference")
+	}
+	return res, nil
+}
+
+func (m *mirror) reportDivergences(req *Package, divs []Divergence) {
+	info := req.Info()
+	for _, d := range divs {
+		log.Warn().Any("request", info).Str("path", d.Path).
+			Any("ours", d.Ours).Any("theirs", d.Theirs).
+			Msg("Divergence with the reference")
+	}
+
+	if m.report == "" {
+		return
+	}
+
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	f, err := os.OpenFile(m.report, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Error().Err(err).Str("file", m.report).Msg("Unable to open diff report file")
+		return
+	}
+	defer f.Close() //nolint: errcheck
+
+	if _, e := f.WriteString("---\n"); e != nil {
+		log.Error().Err(e).Msg("Unable to save divergences into file")
+	}
+	enc := yaml.NewEncoder(f)
+	if e := enc.Encode(&DiffReport{Time: time.Now(), Request: info, Divergences: divs}); e != nil {
+		log.Error().Err(e).Msg("Unable to save divergences into file")
+	}
+	enc.Close() //nolint: errcheck
+}
+
+// DiffPackages compares two packages field by field ignoring IPROTO_SYNC and
+// IPROTO_SCHEMA_VERSION in the header
+func DiffPackages(ours, theirs *Package) []Divergence {
+	var divs []Divergence
+	divs = diffMaps("header", normalizeHeader(ours.Header()), normalizeHeader(theirs.Header()), divs)
+	divs = diffMaps("body", ours.Body(), theirs.Body(), divs)
+	return divs
+}
+
+// normalizeHeader removes the fields which are different by their nature
+func normalizeHeader(h map[any]any) map[any]any {
+	dst := make(map[any]any, len(h))
+	for k, v := range h {
+		if sameScalar(k, IPROTO_SYNC) || sameScalar(k, IPROTO_SCHEMA_VERSION) {
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+func diffMaps(path string, ours, theirs map[any]any, divs []Divergence) []Divergence {
+	keys := make(map[string]any)
+	for k := range ours {
+		keys[fmt.Sprint(k)] = k
+	}
+	for k := range theirs {
+		keys[fmt.Sprint(k)] = k
+	}
+	names := make([]string, 0, len(keys))
+	for n := range keys {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	top := !strings.Contains(path, "/")
+	for _, n := range names {
+		k := keys[n]
+		p := path + "/" + n
+		if kname, ok := iproto_key[k]; ok && top {
+			p = path + "/" + kname
+		}
+
+		o, okOurs := lookup(ours, k)
+		t, okTheirs := lookup(theirs, k)
+		switch {
+		case !okOurs:
+			divs = append(divs, Divergence{Path: p, Theirs: t})
+		case !okTheirs:
+			divs = append(divs, Divergence{Path: p, Ours: o})
+		default:
+			divs = diffValues(p, o, t, divs)
+		}
+	}
+	return divs
+}
+
+// lookup finds a key in the map, integer keys of different types are equal
+func lookup(m map[any]any, key any) (any, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if sameScalar(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func diffValues(path string, ours, theirs any, divs []Divergence) []Divergence {
+	switch o := ours.(type) {
+	case map[any]any:
+		if t, ok := theirs.(map[any]any); ok {
+			return diffMaps(path, o, t, divs)
+		}
+	case []any:
+		if t, ok := theirs.([]any); ok {
+			if len(o) != len(t) {
+				return append(divs, Divergence{Path: path + "/#len", Ours: len(o), Theirs: len(t)})
+			}
+			for i := range o {
+				divs = diffValues(fmt.Sprintf("%s/%d", path, i), o[i], t[i], divs)
+			}
+			return divs
+		}
+	default:
+		if sameScalar(ours, theirs) {
+			return divs
+		}
+	}
+	return append(divs, Divergence{Path: path, Ours: ours, Theirs: theirs})
+}
+
+// sameScalar compares scalars, integers of any type are compared by their values
+func sameScalar(a, b any) bool {
+	if isInteger(a) && isInteger(b) {
+		return fmt.Sprint(a) == fmt.Sprint(b)
+	}
+	if ab, ok := a.([]byte); ok {
+		if bb, ok := b.([]byte); ok {
+			return bytes.Equal(ab, bb)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func isInteger(v any) bool {
+	switch reflect.ValueOf(v).Kind() { //nolint: exhaustive
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,59 @@
+package tarantella
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPackages(t *testing.T) {
+	pack := func(h, b map[any]any) *Package {
+		p := &Package{}
+		for k, v := range h {
+			p.SetHeader(k, v)
+		}
+		for k, v := range b {
+			p.SetBody(k, v)
+		}
+		require.NoError(t, p.Encode())
+
+		decoded := &Package{}
+		require.NoError(t, decoded.Decode(p.rawData))
+		return decoded
+	}
+
+	ours := pack(
+		map[any]any{IPROTO_REQUEST_TYPE: IPROTO_OK, IPROTO_SYNC: 1, IPROTO_SCHEMA_VERSION: 86},
+		map[any]any{IPROTO_DATA: []any{[]any{1, "Roxette", 1986}}},
+	)
+	theirs := pack(
+		map[any]any{IPROTO_REQUEST_TYPE: IPROTO_OK, IPROTO_SYNC: 2, IPROTO_SCHEMA_VERSION: 80},
+		map[any]any{IPROTO_DATA: []any{[]any{uint64(1), "Roxette", uint16(1986)}}},
+	)
+	require.Empty(t, DiffPackages(ours, theirs))
+
+	theirs = pack(
+		map[any]any{IPROTO_REQUEST_TYPE: IPROTO_TYPE_ERROR | 36, IPROTO_SYNC: 2},
+		map[any]any{IPROTO_ERROR_24: "Space '600' does not exist"},
+	)
+	divs := DiffPackages(ours, theirs)
+	require.Equal(t, []Divergence{
+		{Path: "header/IPROTO_REQUEST_TYPE", Ours: uint64(IPROTO_OK), Theirs: uint64(IPROTO_TYPE_ERROR | 36)},
+		{Path: "body/IPROTO_DATA", Ours: []any{[]any{uint64(1), "Roxette", uint64(1986)}}},
+		{Path: "body/IPROTO_ERROR_24", Theirs: "Space '600' does not exist"},
+	}, divs)
+}
+
+func TestHandshakeShortSalt(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close() //nolint: errcheck
+	go func() {
+		greeting := fmt.Sprintf("%-63s\n%-63s\n", "Tarantool 2.11.0 (Binary)", "c2hvcnQ=")
+		server.Write([]byte(greeting)) //nolint: errcheck
+		server.Close()                 //nolint: errcheck
+	}()
+	_, err := handshake(client, "admin", "secret")
+	require.ErrorContains(t, err, "too short")
+}
@@ -3,14 +3,10 @@ package tarantella
 import (
 	_ "embed"
 
-	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 )
 
-var (
-	dummyInstanceID = uuid.New().String()
-	schemaVersion   = 0x56 // has no special meaning for the stub
-)
+var schemaVersion uint64 = 0x56 // has no special meaning for the stub
 
 //go:embed dummy-281_vspace.yaml
 var dummySpacesYaml []byte
@@ -20,10 +16,6 @@ var dummySpaces = parseYamlArray(dummySpacesYaml)
 var dummyIndexesYaml []byte
 var dummyIndexes = parseYamlArray(dummyIndexesYaml)
 
-//go:embed dummy-execute.1.yaml
-var dummyExecute1Yaml []byte
-var dummyExecute1 = parseYamlMap(dummyExecute1Yaml)
-
 // parseYamlArray just parses YAML content into array
 func parseYamlArray(content []byte) []any {
 	var m []any
@@ -33,13 +25,3 @@ func parseYamlArray(content []byte) []any {
 	}
 	return m
 }
-
-// parseYamlArray just parses YAML content into map
-func parseYamlMap(content []byte) map[any]any {
-	m := make(map[any]any)
-	err := yaml.Unmarshal(content, &m)
-	if err != nil {
-		panic(err)
-	}
-	return m
-}
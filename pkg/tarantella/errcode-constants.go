@@ -0,0 +1,273 @@
+package tarantella
+
+// from https://github.com/tarantool/tarantool/blob/247a9a418338b2d150ab648c54169ec1f1af2d76/src/box/errcode.h
+// enum box_error_code
+const (
+	ER_UNKNOWN                           uint32 = 0   // "Unknown error"
+	ER_ILLEGAL_PARAMS                    uint32 = 1   // "Illegal parameters, %s"
+	ER_MEMORY_ISSUE                      uint32 = 2   // "Failed to allocate %u bytes in %s for %s"
+	ER_TUPLE_FOUND                       uint32 = 3   // "Duplicate key exists in unique index \"%s\" in space \"%s\" with old tuple - %s and new tuple - %s"
+	ER_TUPLE_NOT_FOUND                   uint32 = 4   // "Tuple doesn't exist in index '%s' in space '%s'"
+	ER_UNSUPPORTED                       uint32 = 5   // "%s does not support %s"
+	ER_NONMASTER                         uint32 = 6   // "Can't modify data on a replication slave. My master is: %s"
+	ER_READONLY                          uint32 = 7   // "Can't modify data on a read-only instance"
+	ER_INJECTION                         uint32 = 8   // "Error injection '%s'"
+	ER_CREATE_SPACE                      uint32 = 9   // "Failed to create space '%s': %s"
+	ER_SPACE_EXISTS                      uint32 = 10  // "Space '%s' already exists"
+	ER_DROP_SPACE                        uint32 = 11  // "Can't drop space '%s': %s"
+	ER_ALTER_SPACE                       uint32 = 12  // "Can't modify space '%s': %s"
+	ER_INDEX_TYPE                        uint32 = 13  // "Unsupported index type supplied for index '%s' in space '%s'"
+	ER_MODIFY_INDEX                      uint32 = 14  // "Can't create or modify index '%s' in space '%s': %s"
+	ER_LAST_DROP                         uint32 = 15  // "Can't drop the primary key in a system space, space '%s'"
+	ER_TUPLE_FORMAT_LIMIT                uint32 = 16  // "Tuple format limit reached: %u"
+	ER_DROP_PRIMARY_KEY                  uint32 = 17  // "Can't drop primary key in space '%s' while secondary keys exist"
+	ER_KEY_PART_TYPE                     uint32 = 18  // "Supplied key type of part %u does not match index part type: expected %s"
+	ER_EXACT_MATCH                       uint32 = 19  // "Invalid key part count in an exact match (expected %u, got %u)"
+	ER_INVALID_MSGPACK                   uint32 = 20  // "Invalid MsgPack - %s"
+	ER_PROC_RET                          uint32 = 21  // "msgpack.encode: can not encode Lua type '%s'"
+	ER_TUPLE_NOT_ARRAY                   uint32 = 22  // "Tuple/Key must be MsgPack array"
+	ER_FIELD_TYPE                        uint32 = 23  // "Tuple field %s type does not match one required by operation: expected %s, got %s"
+	ER_INDEX_PART_TYPE_MISMATCH          uint32 = 24  // "Field %s has type '%s' in one index, but type '%s' in another"
+	ER_UPDATE_SPLICE                     uint32 = 25  // "SPLICE error on field %s: %s"
+	ER_UPDATE_ARG_TYPE                   uint32 = 26  // "Argument type in operation '%c' on field %s does not match field type: expected %s"
+	ER_FORMAT_MISMATCH_INDEX_PART        uint32 = 27  // "Field %s has type '%s' in space format, but type '%s' in index definition"
+	ER_UNKNOWN_UPDATE_OP                 uint32 = 28  // "Unknown UPDATE operation #%d: %s"
+	ER_UPDATE_FIELD                      uint32 = 29  // "Field %s UPDATE error: %s"
+	ER_FUNCTION_TX_ACTIVE                uint32 = 30  // "Transaction is active at return from function"
+	ER_KEY_PART_COUNT                    uint32 = 31  // "Invalid key part count (expected [0..%u], got %u)"
+	ER_PROC_LUA                          uint32 = 32  // "%s"
+	ER_NO_SUCH_PROC                      uint32 = 33  // "Procedure '%.*s' is not defined"
+	ER_NO_SUCH_TRIGGER                   uint32 = 34  // "Trigger '%s' doesn't exist"
+	ER_NO_SUCH_INDEX_ID                  uint32 = 35  // "No index #%u is defined in space '%s'"
+	ER_NO_SUCH_SPACE                     uint32 = 36  // "Space '%s' does not exist"
+	ER_NO_SUCH_FIELD_NO                  uint32 = 37  // "Field %d was not found in the tuple"
+	ER_EXACT_FIELD_COUNT                 uint32 = 38  // "Tuple field count %u does not match space field count %u"
+	ER_FIELD_MISSING                     uint32 = 39  // "Tuple field %s required by space format is missing"
+	ER_WAL_IO                            uint32 = 40  // "Failed to write to disk"
+	ER_MORE_THAN_ONE_TUPLE               uint32 = 41  // "Get() doesn't support partial keys and non-unique indexes"
+	ER_ACCESS_DENIED                     uint32 = 42  // "%s access to %s '%s' is denied for user '%s'"
+	ER_CREATE_USER                       uint32 = 43  // "Failed to create user '%s': %s"
+	ER_DROP_USER                         uint32 = 44  // "Failed to drop user or role '%s': %s"
+	ER_NO_SUCH_USER                      uint32 = 45  // "User '%s' is not found"
+	ER_USER_EXISTS                       uint32 = 46  // "User '%s' already exists"
+	ER_CREDS_MISMATCH                    uint32 = 47  // "User not found or supplied credentials are invalid"
+	ER_UNKNOWN_REQUEST_TYPE              uint32 = 48  // "Unknown request type %u"
+	ER_UNKNOWN_SCHEMA_OBJECT             uint32 = 49  // "Unknown object type '%s'"
+	ER_CREATE_FUNCTION                   uint32 = 50  // "Failed to create function '%s': %s"
+	ER_NO_SUCH_FUNCTION                  uint32 = 51  // "Function '%s' does not exist"
+	ER_FUNCTION_EXISTS                   uint32 = 52  // "Function '%s' already exists"
+	ER_BEFORE_REPLACE_RET                uint32 = 53  // "Invalid return value of space:before_replace trigger: expected tuple or nil, got %s"
+	ER_MULTISTATEMENT_TRANSACTION        uint32 = 54  // "Can not perform %s in a multi-statement transaction"
+	ER_TRIGGER_EXISTS                    uint32 = 55  // "Trigger '%s' already exists"
+	ER_USER_MAX                          uint32 = 56  // "A limit on the total number of users has been reached: %u"
+	ER_NO_SUCH_ENGINE                    uint32 = 57  // "Space engine '%s' does not exist"
+	ER_RELOAD_CFG                        uint32 = 58  // "Can't set option '%s' dynamically"
+	ER_CFG                               uint32 = 59  // "Incorrect value for option '%s': %s"
+	ER_SAVEPOINT_EMPTY_TX                uint32 = 60  // "Can not set a savepoint in an empty transaction"
+	ER_NO_SUCH_SAVEPOINT                 uint32 = 61  // "Can not rollback to savepoint: the savepoint does not exist"
+	ER_UNKNOWN_REPLICA                   uint32 = 62  // "Replica %s is not registered with replica set %s"
+	ER_REPLICASET_UUID_MISMATCH          uint32 = 63  // "Replica set UUID mismatch: expected %s, got %s"
+	ER_INVALID_UUID                      uint32 = 64  // "Invalid UUID: %s"
+	ER_REPLICASET_UUID_IS_RO             uint32 = 65  // "Can't reset replica set UUID: it is already assigned"
+	ER_INSTANCE_UUID_MISMATCH            uint32 = 66  // "Instance UUID mismatch: expected %s, got %s"
+	ER_REPLICA_ID_IS_RESERVED            uint32 = 67  // "Can't initialize replica id with a reserved value %u"
+	ER_INVALID_ORDER                     uint32 = 68  // "Invalid LSN order for instance %u: previous LSN = %llu, new lsn = %llu"
+	ER_MISSING_REQUEST_FIELD             uint32 = 69  // "Missing mandatory field '%s' in request"
+	ER_IDENTIFIER                        uint32 = 70  // "Invalid identifier '%s' (expected printable symbols only or it is too long)"
+	ER_DROP_FUNCTION                     uint32 = 71  // "Can't drop function %u: %s"
+	ER_ITERATOR_TYPE                     uint32 = 72  // "Unknown iterator type '%s'"
+	ER_REPLICA_MAX                       uint32 = 73  // "Replica count limit reached: %u"
+	ER_INVALID_XLOG                      uint32 = 74  // "Failed to read xlog: %lld"
+	ER_INVALID_XLOG_NAME                 uint32 = 75  // "Invalid xlog name: expected %lld got %lld"
+	ER_INVALID_XLOG_ORDER                uint32 = 76  // "Invalid xlog order: %lld and %lld"
+	ER_NO_CONNECTION                     uint32 = 77  // "Connection is not established"
+	ER_TIMEOUT                           uint32 = 78  // "Timeout exceeded"
+	ER_ACTIVE_TRANSACTION                uint32 = 79  // "Operation is not permitted when there is an active transaction "
+	ER_CURSOR_NO_TRANSACTION             uint32 = 80  // "The transaction the cursor belongs to has ended"
+	ER_CROSS_ENGINE_TRANSACTION          uint32 = 81  // "A multi-statement transaction can not use multiple storage engines"
+	ER_NO_SUCH_ROLE                      uint32 = 82  // "Role '%s' is not found"
+	ER_ROLE_EXISTS                       uint32 = 83  // "Role '%s' already exists"
+	ER_CREATE_ROLE                       uint32 = 84  // "Failed to create role '%s': %s"
+	ER_INDEX_EXISTS                      uint32 = 85  // "Index '%s' already exists"
+	ER_SESSION_CLOSED                    uint32 = 86  // "Session is closed"
+	ER_ROLE_LOOP                         uint32 = 87  // "Granting role '%s' to role '%s' would create a loop"
+	ER_GRANT                             uint32 = 88  // "Incorrect grant arguments: %s"
+	ER_PRIV_GRANTED                      uint32 = 89  // "User '%s' already has %s access on %s%s"
+	ER_ROLE_GRANTED                      uint32 = 90  // "User '%s' already has role '%s'"
+	ER_PRIV_NOT_GRANTED                  uint32 = 91  // "User '%s' does not have %s access on %s '%s'"
+	ER_ROLE_NOT_GRANTED                  uint32 = 92  // "User '%s' does not have role '%s'"
+	ER_MISSING_SNAPSHOT                  uint32 = 93  // "Can't find snapshot"
+	ER_CANT_UPDATE_PRIMARY_KEY           uint32 = 94  // "Attempt to modify a tuple field which is part of primary index in space '%s'"
+	ER_UPDATE_INTEGER_OVERFLOW           uint32 = 95  // "Integer overflow when performing '%c' operation on field %s"
+	ER_GUEST_USER_PASSWORD               uint32 = 96  // "Setting password for guest user has no effect"
+	ER_TRANSACTION_CONFLICT              uint32 = 97  // "Transaction has been aborted by conflict"
+	ER_UNSUPPORTED_PRIV                  uint32 = 98  // "Unsupported %s privilege '%s'"
+	ER_LOAD_FUNCTION                     uint32 = 99  // "Failed to dynamically load function '%s': %s"
+	ER_FUNCTION_LANGUAGE                 uint32 = 100 // "Unsupported language '%s' specified for function '%s'"
+	ER_RTREE_RECT                        uint32 = 101 // "RTree: %s must be an array with %u (point) or %u (rectangle/box) numeric coordinates"
+	ER_PROC_C                            uint32 = 102 // "%s"
+	ER_UNKNOWN_RTREE_INDEX_DISTANCE_TYPE uint32 = 103 // "Unknown RTREE index distance type %s"
+	ER_PROTOCOL                          uint32 = 104 // "%s"
+	ER_UPSERT_UNIQUE_SECONDARY_KEY       uint32 = 105 // "Space %s has a unique secondary index and does not support UPSERT"
+	ER_WRONG_INDEX_RECORD                uint32 = 106 // "Wrong record in _index space: got {%s}, expected {%s}"
+	ER_WRONG_INDEX_PARTS                 uint32 = 107 // "Wrong index part %u: %s"
+	ER_WRONG_INDEX_OPTIONS               uint32 = 108 // "Wrong index options: %s"
+	ER_WRONG_SCHEMA_VERSION              uint32 = 109 // "Wrong schema version, current: %d, in request: %llu"
+	ER_MEMTX_MAX_TUPLE_SIZE              uint32 = 110 // "Failed to allocate %u bytes for tuple: tuple is too large. Check 'memtx_max_tuple_size' configuration option."
+	ER_WRONG_SPACE_OPTIONS               uint32 = 111 // "Wrong space options: %s"
+	ER_UNSUPPORTED_INDEX_FEATURE         uint32 = 112 // "Index '%s' (%s) of space '%s' (%s) does not support %s"
+	ER_VIEW_IS_RO                        uint32 = 113 // "View '%s' is read-only"
+	ER_NO_TRANSACTION                    uint32 = 114 // "No active transaction"
+	ER_SYSTEM                            uint32 = 115 // "%s"
+	ER_LOADING                           uint32 = 116 // "Instance bootstrap hasn't finished yet"
+	ER_CONNECTION_TO_SELF                uint32 = 117 // "Connection to self"
+	ER_KEY_PART_IS_TOO_LONG              uint32 = 118 // "Key part is too long: %u of %u bytes"
+	ER_COMPRESSION                       uint32 = 119 // "Compression error: %s"
+	ER_CHECKPOINT_IN_PROGRESS            uint32 = 120 // "Snapshot is already in progress"
+	ER_SUB_STMT_MAX                      uint32 = 121 // "Can not execute a nested statement: nesting limit reached"
+	ER_COMMIT_IN_SUB_STMT                uint32 = 122 // "Can not commit transaction in a nested statement"
+	ER_ROLLBACK_IN_SUB_STMT              uint32 = 123 // "Rollback called in a nested statement"
+	ER_DECOMPRESSION                     uint32 = 124 // "Decompression error: %s"
+	ER_INVALID_XLOG_TYPE                 uint32 = 125 // "Invalid xlog type: expected %s, got %s"
+	ER_ALREADY_RUNNING                   uint32 = 126 // "Failed to lock WAL directory %s and hot_standby mode is off"
+	ER_INDEX_FIELD_COUNT_LIMIT           uint32 = 127 // "Indexed field count limit reached: %d indexed fields"
+	ER_LOCAL_INSTANCE_ID_IS_READ_ONLY    uint32 = 128 // "The local instance id %u is read-only"
+	ER_BACKUP_IN_PROGRESS                uint32 = 129 // "Backup is already in progress"
+	ER_READ_VIEW_ABORTED                 uint32 = 130 // "The read view is aborted"
+	ER_INVALID_INDEX_FILE                uint32 = 131 // "Invalid INDEX file %s: %s"
+	ER_INVALID_RUN_FILE                  uint32 = 132 // "Invalid RUN file: %s"
+	ER_INVALID_VYLOG_FILE                uint32 = 133 // "Invalid VYLOG file: %s"
+	ER_CASCADE_ROLLBACK                  uint32 = 134 // "WAL has a rollback in progress"
+	ER_VY_QUOTA_TIMEOUT                  uint32 = 135 // "Timed out waiting for Vinyl memory quota"
+	ER_PARTIAL_KEY                       uint32 = 136 // "%s index does not support selects via a partial key (expected %u parts, got %u). Please Consider changing index type to TREE."
+	ER_TRUNCATE_SYSTEM_SPACE             uint32 = 137 // "Can't truncate a system space, space '%s'"
+	ER_LOAD_MODULE                       uint32 = 138 // "Failed to dynamically load module '%.*s': %s"
+	ER_VINYL_MAX_TUPLE_SIZE              uint32 = 139 // "Failed to allocate %u bytes for tuple: tuple is too large. Check 'vinyl_max_tuple_size' configuration option."
+	ER_WRONG_DD_VERSION                  uint32 = 140 // "Wrong _schema version: expected 'major.minor[.patch]'"
+	ER_WRONG_SPACE_FORMAT                uint32 = 141 // "Wrong space format field %u: %s"
+	ER_CREATE_SEQUENCE                   uint32 = 142 // "Failed to create sequence '%s': %s"
+	ER_ALTER_SEQUENCE                    uint32 = 143 // "Can't modify sequence '%s': %s"
+	ER_DROP_SEQUENCE                     uint32 = 144 // "Can't drop sequence '%s': %s"
+	ER_NO_SUCH_SEQUENCE                  uint32 = 145 // "Sequence '%s' does not exist"
+	ER_SEQUENCE_EXISTS                   uint32 = 146 // "Sequence '%s' already exists"
+	ER_SEQUENCE_OVERFLOW                 uint32 = 147 // "Sequence '%s' has overflowed"
+	ER_NO_SUCH_INDEX_NAME                uint32 = 148 // "No index '%s' is defined in space '%s'"
+	ER_SPACE_FIELD_IS_DUPLICATE          uint32 = 149 // "Space field '%s' is duplicate"
+	ER_CANT_CREATE_COLLATION             uint32 = 150 // "Failed to initialize collation: %s."
+	ER_WRONG_COLLATION_OPTIONS           uint32 = 151 // "Wrong collation options: %s"
+	ER_NULLABLE_PRIMARY                  uint32 = 152 // "Primary index of space '%s' can not contain nullable parts"
+	ER_NO_SUCH_FIELD_NAME_IN_SPACE       uint32 = 153 // "Field '%s' was not found in space '%s' format"
+	ER_TRANSACTION_YIELD                 uint32 = 154 // "Transaction has been aborted by a fiber yield"
+	ER_NO_SUCH_GROUP                     uint32 = 155 // "Replication group '%s' does not exist"
+	ER_SQL_BIND_VALUE                    uint32 = 156 // "Bind value for parameter %s is out of range for type %s"
+	ER_SQL_BIND_TYPE                     uint32 = 157 // "Bind value type %s for parameter %s is not supported"
+	ER_SQL_BIND_PARAMETER_MAX            uint32 = 158 // "SQL bind parameter limit reached: %d"
+	ER_SQL_EXECUTE                       uint32 = 159 // "Failed to execute SQL statement: %s"
+	ER_UPDATE_DECIMAL_OVERFLOW           uint32 = 160 // "Decimal overflow when performing operation '%c' on field %s"
+	ER_SQL_BIND_NOT_FOUND                uint32 = 161 // "Parameter %s was not found in the statement"
+	ER_ACTION_MISMATCH                   uint32 = 162 // "Field %s contains %s on conflict action, but %s in index parts"
+	ER_VIEW_MISSING_SQL                  uint32 = 163 // "Space declared as a view must have SQL statement"
+	ER_FOREIGN_KEY_CONSTRAINT            uint32 = 164 // "Can not commit transaction: deferred foreign keys violations are not resolved"
+	ER_NO_SUCH_MODULE                    uint32 = 165 // "Module '%s' does not exist"
+	ER_NO_SUCH_COLLATION                 uint32 = 166 // "Collation '%s' does not exist"
+	ER_CREATE_FK_CONSTRAINT              uint32 = 167 // "Failed to create foreign key constraint '%s': %s"
+	ER_DROP_FK_CONSTRAINT                uint32 = 168 // "Failed to drop foreign key constraint '%s': %s"
+	ER_NO_SUCH_CONSTRAINT                uint32 = 169 // "Constraint '%s' does not exist in space '%s'"
+	ER_CONSTRAINT_EXISTS                 uint32 = 170 // "%s constraint '%s' already exists in space '%s'"
+	ER_SQL_TYPE_MISMATCH                 uint32 = 171 // "Type mismatch: can not convert %s to %s"
+	ER_ROWID_OVERFLOW                    uint32 = 172 // "Rowid is overflowed: too many entries in ephemeral space"
+	ER_DROP_COLLATION                    uint32 = 173 // "Can't drop collation %s : %s"
+	ER_ILLEGAL_COLLATION_MIX             uint32 = 174 // "Illegal mix of collations"
+	ER_SQL_NO_SUCH_PRAGMA                uint32 = 175 // "Pragma '%s' does not exist"
+	ER_SQL_CANT_RESOLVE_FIELD            uint32 = 176 // "Can’t resolve field '%s'"
+	ER_INDEX_EXISTS_IN_SPACE             uint32 = 177 // "Index '%s' already exists in space '%s'"
+	ER_INCONSISTENT_TYPES                uint32 = 178 // "Inconsistent types: expected %s got %s"
+	ER_SQL_SYNTAX_WITH_POS               uint32 = 179 // "Syntax error at line %d at or near position %d: %s"
+	ER_SQL_STACK_OVERFLOW                uint32 = 180 // "Failed to parse SQL statement: parser stack limit reached"
+	ER_SQL_SELECT_WILDCARD               uint32 = 181 // "Failed to expand '*' in SELECT statement without FROM clause"
+	ER_SQL_STATEMENT_EMPTY               uint32 = 182 // "Failed to execute an empty SQL statement"
+	ER_SQL_KEYWORD_IS_RESERVED           uint32 = 183 // "At line %d at or near position %d: keyword '%.*s' is reserved. Please use double quotes if '%.*s' is an identifier."
+	ER_SQL_SYNTAX_NEAR_TOKEN             uint32 = 184 // "Syntax error at line %d near '%.*s'"
+	ER_SQL_UNKNOWN_TOKEN                 uint32 = 185 // "At line %d at or near position %d: unrecognized token '%.*s'"
+	ER_SQL_PARSER_GENERIC                uint32 = 186 // "%s"
+	ER_SQL_ANALYZE_ARGUMENT              uint32 = 187 // "ANALYZE statement argument %s is not a base table"
+	ER_SQL_COLUMN_COUNT_MAX              uint32 = 188 // "Failed to create space '%s': space column count %d exceeds the limit (%d)"
+	ER_HEX_LITERAL_MAX                   uint32 = 189 // "Hex literal %s%s length %d exceeds the supported limit (%d)"
+	ER_INT_LITERAL_MAX                   uint32 = 190 // "Integer literal %s%s exceeds the supported range [-9223372036854775808, 18446744073709551615]"
+	ER_SQL_PARSER_LIMIT                  uint32 = 191 // "%s %d exceeds the limit (%d)"
+	ER_INDEX_DEF_UNSUPPORTED             uint32 = 192 // "%s are prohibited in an index definition"
+	ER_CK_DEF_UNSUPPORTED                uint32 = 193 // "%s are prohibited in a ck constraint definition"
+	ER_MULTIKEY_INDEX_MISMATCH           uint32 = 194 // "Field %s is used as multikey in one index and as single key in another"
+	ER_CREATE_CK_CONSTRAINT              uint32 = 195 // "Failed to create check constraint '%s': %s"
+	ER_CK_CONSTRAINT_FAILED              uint32 = 196 // "Check constraint failed '%s': %s"
+	ER_SQL_COLUMN_COUNT                  uint32 = 197 // "Unequal number of entries in row expression: left side has %u, but right side - %u"
+	ER_FUNC_INDEX_FUNC                   uint32 = 198 // "Failed to build a key for functional index '%s' of space '%s': %s"
+	ER_FUNC_INDEX_FORMAT                 uint32 = 199 // "Key format doesn't match one defined in functional index '%s' of space '%s': %s"
+	ER_FUNC_INDEX_PARTS                  uint32 = 200 // "Wrong functional index definition: %s"
+	ER_NO_SUCH_FIELD_NAME                uint32 = 201 // "Field '%s' was not found in the tuple"
+	ER_FUNC_WRONG_ARG_COUNT              uint32 = 202 // "Wrong number of arguments is passed to %s(): expected %s, got %d"
+	ER_BOOTSTRAP_READONLY                uint32 = 203 // "Trying to bootstrap a local read-only instance as master"
+	ER_SQL_FUNC_WRONG_RET_COUNT          uint32 = 204 // "SQL expects exactly one argument returned from %s, got %d"
+	ER_FUNC_INVALID_RETURN_TYPE          uint32 = 205 // "Function '%s' returned value of invalid type: expected %s got %s"
+	ER_SQL_PARSER_GENERIC_WITH_POS       uint32 = 206 // "At line %d at or near position %d: %s"
+	ER_REPLICA_NOT_ANON                  uint32 = 207 // "Replica '%s' is not anonymous and cannot register."
+	ER_CANNOT_REGISTER                   uint32 = 208 // "Couldn't find an instance to register this replica on."
+	ER_SESSION_SETTING_INVALID_VALUE     uint32 = 209 // "Session setting %s expected a value of type %s"
+	ER_SQL_PREPARE                       uint32 = 210 // "Failed to prepare SQL statement: %s"
+	ER_WRONG_QUERY_ID                    uint32 = 211 // "Prepared statement with id %u does not exist"
+	ER_SEQUENCE_NOT_STARTED              uint32 = 212 // "Sequence '%s' is not started"
+	ER_NO_SUCH_SESSION_SETTING           uint32 = 213 // "Session setting %s doesn't exist"
+	ER_UNCOMMITTED_FOREIGN_SYNC_TXNS     uint32 = 214 // "Found uncommitted sync transactions from other instance with id %u"
+	ER_SYNC_MASTER_MISMATCH              uint32 = 215 // "CONFIRM message arrived for an unknown master id %d, expected %d"
+	ER_SYNC_QUORUM_TIMEOUT               uint32 = 216 // "Quorum collection for a synchronous transaction is timed out"
+	ER_SYNC_ROLLBACK                     uint32 = 217 // "A rollback for a synchronous transaction is received"
+	ER_TUPLE_METADATA_IS_TOO_BIG         uint32 = 218 // "Can't create tuple: metadata size %u is too big"
+	ER_XLOG_GAP                          uint32 = 219 // "%s"
+	ER_TOO_EARLY_SUBSCRIBE               uint32 = 220 // "Can't subscribe non-anonymous replica %s until join is done"
+	ER_SQL_CANT_ADD_AUTOINC              uint32 = 221 // "Can't add AUTOINCREMENT: space %s can't feature more than one AUTOINCREMENT field"
+	ER_QUORUM_WAIT                       uint32 = 222 // "Couldn't wait for quorum %d: %s"
+	ER_INTERFERING_PROMOTE               uint32 = 223 // "Instance with replica id %u was promoted first"
+	ER_ELECTION_DISABLED                 uint32 = 224 // "Elections were turned off"
+	ER_TXN_ROLLBACK                      uint32 = 225 // "Transaction was rolled back"
+	ER_NOT_LEADER                        uint32 = 226 // "The instance is not a leader. New leader is %u"
+	ER_SYNC_QUEUE_UNCLAIMED              uint32 = 227 // "The synchronous transaction queue doesn't belong to any instance"
+	ER_SYNC_QUEUE_FOREIGN                uint32 = 228 // "The synchronous transaction queue belongs to other instance with id %u"
+	ER_UNABLE_TO_PROCESS_IN_STREAM       uint32 = 229 // "Unable to process %s request in stream"
+	ER_UNABLE_TO_PROCESS_OUT_OF_STREAM   uint32 = 230 // "Unable to process %s request out of stream"
+	ER_TRANSACTION_TIMEOUT               uint32 = 231 // "Transaction has been aborted by timeout"
+	ER_ACTIVE_TIMER                      uint32 = 232 // "Operation is not permitted if timer is already running"
+	ER_TUPLE_FIELD_COUNT_LIMIT           uint32 = 233 // "Tuple field count limit reached: see box.schema.FIELD_MAX"
+	ER_CREATE_CONSTRAINT                 uint32 = 234 // "Failed to create constraint '%s' in space '%s': %s"
+	ER_FIELD_CONSTRAINT_FAILED           uint32 = 235 // "Check constraint '%s' failed for field '%s'"
+	ER_TUPLE_CONSTRAINT_FAILED           uint32 = 236 // "Check constraint '%s' failed for tuple"
+	ER_CREATE_FOREIGN_KEY                uint32 = 237 // "Failed to create foreign key '%s' in space '%s': %s"
+	ER_FOREIGN_KEY_INTEGRITY             uint32 = 238 // "Foreign key '%s' integrity check failed: %s"
+	ER_FIELD_FOREIGN_KEY_FAILED          uint32 = 239 // "Foreign key constraint '%s' failed for field '%s': %s"
+	ER_COMPLEX_FOREIGN_KEY_FAILED        uint32 = 240 // "Foreign key constraint '%s' failed: %s"
+	ER_WRONG_SPACE_UPGRADE_OPTIONS       uint32 = 241 // "Wrong space upgrade options: %s"
+	ER_NO_ELECTION_QUORUM                uint32 = 242 // "Not enough peers connected to start elections: %d out of minimal required %d"
+	ER_SSL                               uint32 = 243 // "%s"
+	ER_SPLIT_BRAIN                       uint32 = 244 // "Split-Brain discovered: %s"
+	ER_OLD_TERM                          uint32 = 245 // "The term is outdated: old - %llu, new - %llu"
+	ER_INTERFERING_ELECTIONS             uint32 = 246 // "Interfering elections started"
+	ER_ITERATOR_POSITION                 uint32 = 247 // "Iterator position is invalid"
+	ER_UNUSED                            uint32 = 248 // ""
+	ER_UNKNOWN_AUTH_METHOD               uint32 = 249 // "Unknown authentication method '%s'"
+	ER_INVALID_AUTH_DATA                 uint32 = 250 // "Invalid '%s' data: %s"
+	ER_INVALID_AUTH_REQUEST              uint32 = 251 // "Invalid '%s' request: %s"
+	ER_WEAK_PASSWORD                     uint32 = 252 // "Password doesn't meet security requirements: %s"
+	ER_OLD_PASSWORD                      uint32 = 253 // "Password must differ from last %d passwords"
+	ER_NO_SUCH_SESSION                   uint32 = 254 // "Session %llu does not exist"
+	ER_WRONG_SESSION_TYPE                uint32 = 255 // "Session '%s' is not supported"
+	ER_PASSWORD_EXPIRED                  uint32 = 256 // "Password expired"
+	ER_AUTH_DELAY                        uint32 = 257 // "Too many authentication attempts"
+	ER_AUTH_REQUIRED                     uint32 = 258 // "Authentication required"
+	ER_SQL_SEQ_SCAN                      uint32 = 259 // "Scanning is not allowed for %s"
+	ER_NO_SUCH_EVENT                     uint32 = 260 // "Unknown event %s"
+	ER_BOOTSTRAP_NOT_UNANIMOUS           uint32 = 261 // "Replica %s chose a different bootstrap leader %s"
+	ER_CANT_CHECK_BOOTSTRAP_LEADER       uint32 = 262 // "Can't check who replica %s chose its bootstrap leader"
+	ER_BOOTSTRAP_CONNECTION_NOT_TO_ALL   uint32 = 263 // "Some replica set members were not specified in box.cfg.replication"
+	ER_NIL_UUID                          uint32 = 264 // "Nil UUID is reserved and can't be used in replication"
+	ER_WRONG_FUNCTION_OPTIONS            uint32 = 265 // "Wrong function options: %s"
+	ER_MISSING_SYSTEM_SPACES             uint32 = 266 // "Snapshot has no system spaces"
+)
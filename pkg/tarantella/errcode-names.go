@@ -0,0 +1,543 @@
+package tarantella
+
+// generated by errcode-names.py
+var box_error_code = map[uint32]string{
+	uint32(0):   "ER_UNKNOWN",
+	uint32(1):   "ER_ILLEGAL_PARAMS",
+	uint32(2):   "ER_MEMORY_ISSUE",
+	uint32(3):   "ER_TUPLE_FOUND",
+	uint32(4):   "ER_TUPLE_NOT_FOUND",
+	uint32(5):   "ER_UNSUPPORTED",
+	uint32(6):   "ER_NONMASTER",
+	uint32(7):   "ER_READONLY",
+	uint32(8):   "ER_INJECTION",
+	uint32(9):   "ER_CREATE_SPACE",
+	uint32(10):  "ER_SPACE_EXISTS",
+	uint32(11):  "ER_DROP_SPACE",
+	uint32(12):  "ER_ALTER_SPACE",
+	uint32(13):  "ER_INDEX_TYPE",
+	uint32(14):  "ER_MODIFY_INDEX",
+	uint32(15):  "ER_LAST_DROP",
+	uint32(16):  "ER_TUPLE_FORMAT_LIMIT",
+	uint32(17):  "ER_DROP_PRIMARY_KEY",
+	uint32(18):  "ER_KEY_PART_TYPE",
+	uint32(19):  "ER_EXACT_MATCH",
+	uint32(20):  "ER_INVALID_MSGPACK",
+	uint32(21):  "ER_PROC_RET",
+	uint32(22):  "ER_TUPLE_NOT_ARRAY",
+	uint32(23):  "ER_FIELD_TYPE",
+	uint32(24):  "ER_INDEX_PART_TYPE_MISMATCH",
+	uint32(25):  "ER_UPDATE_SPLICE",
+	uint32(26):  "ER_UPDATE_ARG_TYPE",
+	uint32(27):  "ER_FORMAT_MISMATCH_INDEX_PART",
+	uint32(28):  "ER_UNKNOWN_UPDATE_OP",
+	uint32(29):  "ER_UPDATE_FIELD",
+	uint32(30):  "ER_FUNCTION_TX_ACTIVE",
+	uint32(31):  "ER_KEY_PART_COUNT",
+	uint32(32):  "ER_PROC_LUA",
+	uint32(33):  "ER_NO_SUCH_PROC",
+	uint32(34):  "ER_NO_SUCH_TRIGGER",
+	uint32(35):  "ER_NO_SUCH_INDEX_ID",
+	uint32(36):  "ER_NO_SUCH_SPACE",
+	uint32(37):  "ER_NO_SUCH_FIELD_NO",
+	uint32(38):  "ER_EXACT_FIELD_COUNT",
+	uint32(39):  "ER_FIELD_MISSING",
+	uint32(40):  "ER_WAL_IO",
+	uint32(41):  "ER_MORE_THAN_ONE_TUPLE",
+	uint32(42):  "ER_ACCESS_DENIED",
+	uint32(43):  "ER_CREATE_USER",
+	uint32(44):  "ER_DROP_USER",
+	uint32(45):  "ER_NO_SUCH_USER",
+	uint32(46):  "ER_USER_EXISTS",
+	uint32(47):  "ER_CREDS_MISMATCH",
+	uint32(48):  "ER_UNKNOWN_REQUEST_TYPE",
+	uint32(49):  "ER_UNKNOWN_SCHEMA_OBJECT",
+	uint32(50):  "ER_CREATE_FUNCTION",
+	uint32(51):  "ER_NO_SUCH_FUNCTION",
+	uint32(52):  "ER_FUNCTION_EXISTS",
+	uint32(53):  "ER_BEFORE_REPLACE_RET",
+	uint32(54):  "ER_MULTISTATEMENT_TRANSACTION",
+	uint32(55):  "ER_TRIGGER_EXISTS",
+	uint32(56):  "ER_USER_MAX",
+	uint32(57):  "ER_NO_SUCH_ENGINE",
+	uint32(58):  "ER_RELOAD_CFG",
+	uint32(59):  "ER_CFG",
+	uint32(60):  "ER_SAVEPOINT_EMPTY_TX",
+	uint32(61):  "ER_NO_SUCH_SAVEPOINT",
+	uint32(62):  "ER_UNKNOWN_REPLICA",
+	uint32(63):  "ER_REPLICASET_UUID_MISMATCH",
+	uint32(64):  "ER_INVALID_UUID",
+	uint32(65):  "ER_REPLICASET_UUID_IS_RO",
+	uint32(66):  "ER_INSTANCE_UUID_MISMATCH",
+	uint32(67):  "ER_REPLICA_ID_IS_RESERVED",
+	uint32(68):  "ER_INVALID_ORDER",
+	uint32(69):  "ER_MISSING_REQUEST_FIELD",
+	uint32(70):  "ER_IDENTIFIER",
+	uint32(71):  "ER_DROP_FUNCTION",
+	uint32(72):  "ER_ITERATOR_TYPE",
+	uint32(73):  "ER_REPLICA_MAX",
+	uint32(74):  "ER_INVALID_XLOG",
+	uint32(75):  "ER_INVALID_XLOG_NAME",
+	uint32(76):  "ER_INVALID_XLOG_ORDER",
+	uint32(77):  "ER_NO_CONNECTION",
+	uint32(78):  "ER_TIMEOUT",
+	uint32(79):  "ER_ACTIVE_TRANSACTION",
+	uint32(80):  "ER_CURSOR_NO_TRANSACTION",
+	uint32(81):  "ER_CROSS_ENGINE_TRANSACTION",
+	uint32(82):  "ER_NO_SUCH_ROLE",
+	uint32(83):  "ER_ROLE_EXISTS",
+	uint32(84):  "ER_CREATE_ROLE",
+	uint32(85):  "ER_INDEX_EXISTS",
+	uint32(86):  "ER_SESSION_CLOSED",
+	uint32(87):  "ER_ROLE_LOOP",
+	uint32(88):  "ER_GRANT",
+	uint32(89):  "ER_PRIV_GRANTED",
+	uint32(90):  "ER_ROLE_GRANTED",
+	uint32(91):  "ER_PRIV_NOT_GRANTED",
+	uint32(92):  "ER_ROLE_NOT_GRANTED",
+	uint32(93):  "ER_MISSING_SNAPSHOT",
+	uint32(94):  "ER_CANT_UPDATE_PRIMARY_KEY",
+	uint32(95):  "ER_UPDATE_INTEGER_OVERFLOW",
+	uint32(96):  "ER_GUEST_USER_PASSWORD",
+	uint32(97):  "ER_TRANSACTION_CONFLICT",
+	uint32(98):  "ER_UNSUPPORTED_PRIV",
+	uint32(99):  "ER_LOAD_FUNCTION",
+	uint32(100): "ER_FUNCTION_LANGUAGE",
+	uint32(101): "ER_RTREE_RECT",
+	uint32(102): "ER_PROC_C",
+	uint32(103): "ER_UNKNOWN_RTREE_INDEX_DISTANCE_TYPE",
+	uint32(104): "ER_PROTOCOL",
+	uint32(105): "ER_UPSERT_UNIQUE_SECONDARY_KEY",
+	uint32(106): "ER_WRONG_INDEX_RECORD",
+	uint32(107): "ER_WRONG_INDEX_PARTS",
+	uint32(108): "ER_WRONG_INDEX_OPTIONS",
+	uint32(109): "ER_WRONG_SCHEMA_VERSION",
+	uint32(110): "ER_MEMTX_MAX_TUPLE_SIZE",
+	uint32(111): "ER_WRONG_SPACE_OPTIONS",
+	uint32(112): "ER_UNSUPPORTED_INDEX_FEATURE",
+	uint32(113): "ER_VIEW_IS_RO",
+	uint32(114): "ER_NO_TRANSACTION",
+	uint32(115): "ER_SYSTEM",
+	uint32(116): "ER_LOADING",
+	uint32(117): "ER_CONNECTION_TO_SELF",
+	uint32(118): "ER_KEY_PART_IS_TOO_LONG",
+	uint32(119): "ER_COMPRESSION",
+	uint32(120): "ER_CHECKPOINT_IN_PROGRESS",
+	uint32(121): "ER_SUB_STMT_MAX",
+	uint32(122): "ER_COMMIT_IN_SUB_STMT",
+	uint32(123): "ER_ROLLBACK_IN_SUB_STMT",
+	uint32(124): "ER_DECOMPRESSION",
+	uint32(125): "ER_INVALID_XLOG_TYPE",
+	uint32(126): "ER_ALREADY_RUNNING",
+	uint32(127): "ER_INDEX_FIELD_COUNT_LIMIT",
+	uint32(128): "ER_LOCAL_INSTANCE_ID_IS_READ_ONLY",
+	uint32(129): "ER_BACKUP_IN_PROGRESS",
+	uint32(130): "ER_READ_VIEW_ABORTED",
+	uint32(131): "ER_INVALID_INDEX_FILE",
+	uint32(132): "ER_INVALID_RUN_FILE",
+	uint32(133): "ER_INVALID_VYLOG_FILE",
+	uint32(134): "ER_CASCADE_ROLLBACK",
+	uint32(135): "ER_VY_QUOTA_TIMEOUT",
+	uint32(136): "ER_PARTIAL_KEY",
+	uint32(137): "ER_TRUNCATE_SYSTEM_SPACE",
+	uint32(138): "ER_LOAD_MODULE",
+	uint32(139): "ER_VINYL_MAX_TUPLE_SIZE",
+	uint32(140): "ER_WRONG_DD_VERSION",
+	uint32(141): "ER_WRONG_SPACE_FORMAT",
+	uint32(142): "ER_CREATE_SEQUENCE",
+	uint32(143): "ER_ALTER_SEQUENCE",
+	uint32(144): "ER_DROP_SEQUENCE",
+	uint32(145): "ER_NO_SUCH_SEQUENCE",
+	uint32(146): "ER_SEQUENCE_EXISTS",
+	uint32(147): "ER_SEQUENCE_OVERFLOW",
+	uint32(148): "ER_NO_SUCH_INDEX_NAME",
+	uint32(149): "ER_SPACE_FIELD_IS_DUPLICATE",
+	uint32(150): "ER_CANT_CREATE_COLLATION",
+	uint32(151): "ER_WRONG_COLLATION_OPTIONS",
+	uint32(152): "ER_NULLABLE_PRIMARY",
+	uint32(153): "ER_NO_SUCH_FIELD_NAME_IN_SPACE",
+	uint32(154): "ER_TRANSACTION_YIELD",
+	uint32(155): "ER_NO_SUCH_GROUP",
+	uint32(156): "ER_SQL_BIND_VALUE",
+	uint32(157): "ER_SQL_BIND_TYPE",
+	uint32(158): "ER_SQL_BIND_PARAMETER_MAX",
+	uint32(159): "ER_SQL_EXECUTE",
+	uint32(160): "ER_UPDATE_DECIMAL_OVERFLOW",
+	uint32(161): "ER_SQL_BIND_NOT_FOUND",
+	uint32(162): "ER_ACTION_MISMATCH",
+	uint32(163): "ER_VIEW_MISSING_SQL",
+	uint32(164): "ER_FOREIGN_KEY_CONSTRAINT",
+	uint32(165): "ER_NO_SUCH_MODULE",
+	uint32(166): "ER_NO_SUCH_COLLATION",
+	uint32(167): "ER_CREATE_FK_CONSTRAINT",
+	uint32(168): "ER_DROP_FK_CONSTRAINT",
+	uint32(169): "ER_NO_SUCH_CONSTRAINT",
+	uint32(170): "ER_CONSTRAINT_EXISTS",
+	uint32(171): "ER_SQL_TYPE_MISMATCH",
+	uint32(172): "ER_ROWID_OVERFLOW",
+	uint32(173): "ER_DROP_COLLATION",
+	uint32(174): "ER_ILLEGAL_COLLATION_MIX",
+	uint32(175): "ER_SQL_NO_SUCH_PRAGMA",
+	uint32(176): "ER_SQL_CANT_RESOLVE_FIELD",
+	uint32(177): "ER_INDEX_EXISTS_IN_SPACE",
+	uint32(178): "ER_INCONSISTENT_TYPES",
+	uint32(179): "ER_SQL_SYNTAX_WITH_POS",
+	uint32(180): "ER_SQL_STACK_OVERFLOW",
+	uint32(181): "ER_SQL_SELECT_WILDCARD",
+	uint32(182): "ER_SQL_STATEMENT_EMPTY",
+	uint32(183): "ER_SQL_KEYWORD_IS_RESERVED",
+	uint32(184): "ER_SQL_SYNTAX_NEAR_TOKEN",
+	uint32(185): "ER_SQL_UNKNOWN_TOKEN",
+	uint32(186): "ER_SQL_PARSER_GENERIC",
+	uint32(187): "ER_SQL_ANALYZE_ARGUMENT",
+	uint32(188): "ER_SQL_COLUMN_COUNT_MAX",
+	uint32(189): "ER_HEX_LITERAL_MAX",
+	uint32(190): "ER_INT_LITERAL_MAX",
+	uint32(191): "ER_SQL_PARSER_LIMIT",
+	uint32(192): "ER_INDEX_DEF_UNSUPPORTED",
+	uint32(193): "ER_CK_DEF_UNSUPPORTED",
+	uint32(194): "ER_MULTIKEY_INDEX_MISMATCH",
+	uint32(195): "ER_CREATE_CK_CONSTRAINT",
+	uint32(196): "ER_CK_CONSTRAINT_FAILED",
+	uint32(197): "ER_SQL_COLUMN_COUNT",
+	uint32(198): "ER_FUNC_INDEX_FUNC",
+	uint32(199): "ER_FUNC_INDEX_FORMAT",
+	uint32(200): "ER_FUNC_INDEX_PARTS",
+	uint32(201): "ER_NO_SUCH_FIELD_NAME",
+	uint32(202): "ER_FUNC_WRONG_ARG_COUNT",
+	uint32(203): "ER_BOOTSTRAP_READONLY",
+	uint32(204): "ER_SQL_FUNC_WRONG_RET_COUNT",
+	uint32(205): "ER_FUNC_INVALID_RETURN_TYPE",
+	uint32(206): "ER_SQL_PARSER_GENERIC_WITH_POS",
+	uint32(207): "ER_REPLICA_NOT_ANON",
+	uint32(208): "ER_CANNOT_REGISTER",
+	uint32(209): "ER_SESSION_SETTING_INVALID_VALUE",
+	uint32(210): "ER_SQL_PREPARE",
+	uint32(211): "ER_WRONG_QUERY_ID",
+	uint32(212): "ER_SEQUENCE_NOT_STARTED",
+	uint32(213): "ER_NO_SUCH_SESSION_SETTING",
+	uint32(214): "ER_UNCOMMITTED_FOREIGN_SYNC_TXNS",
+	uint32(215): "ER_SYNC_MASTER_MISMATCH",
+	uint32(216): "ER_SYNC_QUORUM_TIMEOUT",
+	uint32(217): "ER_SYNC_ROLLBACK",
+	uint32(218): "ER_TUPLE_METADATA_IS_TOO_BIG",
+	uint32(219): "ER_XLOG_GAP",
+	uint32(220): "ER_TOO_EARLY_SUBSCRIBE",
+	uint32(221): "ER_SQL_CANT_ADD_AUTOINC",
+	uint32(222): "ER_QUORUM_WAIT",
+	uint32(223): "ER_INTERFERING_PROMOTE",
+	uint32(224): "ER_ELECTION_DISABLED",
+	uint32(225): "ER_TXN_ROLLBACK",
+	uint32(226): "ER_NOT_LEADER",
+	uint32(227): "ER_SYNC_QUEUE_UNCLAIMED",
+	uint32(228): "ER_SYNC_QUEUE_FOREIGN",
+	uint32(229): "ER_UNABLE_TO_PROCESS_IN_STREAM",
+	uint32(230): "ER_UNABLE_TO_PROCESS_OUT_OF_STREAM",
+	uint32(231): "ER_TRANSACTION_TIMEOUT",
+	uint32(232): "ER_ACTIVE_TIMER",
+	uint32(233): "ER_TUPLE_FIELD_COUNT_LIMIT",
+	uint32(234): "ER_CREATE_CONSTRAINT",
+	uint32(235): "ER_FIELD_CONSTRAINT_FAILED",
+	uint32(236): "ER_TUPLE_CONSTRAINT_FAILED",
+	uint32(237): "ER_CREATE_FOREIGN_KEY",
+	uint32(238): "ER_FOREIGN_KEY_INTEGRITY",
+	uint32(239): "ER_FIELD_FOREIGN_KEY_FAILED",
+	uint32(240): "ER_COMPLEX_FOREIGN_KEY_FAILED",
+	uint32(241): "ER_WRONG_SPACE_UPGRADE_OPTIONS",
+	uint32(242): "ER_NO_ELECTION_QUORUM",
+	uint32(243): "ER_SSL",
+	uint32(244): "ER_SPLIT_BRAIN",
+	uint32(245): "ER_OLD_TERM",
+	uint32(246): "ER_INTERFERING_ELECTIONS",
+	uint32(247): "ER_ITERATOR_POSITION",
+	uint32(248): "ER_UNUSED",
+	uint32(249): "ER_UNKNOWN_AUTH_METHOD",
+	uint32(250): "ER_INVALID_AUTH_DATA",
+	uint32(251): "ER_INVALID_AUTH_REQUEST",
+	uint32(252): "ER_WEAK_PASSWORD",
+	uint32(253): "ER_OLD_PASSWORD",
+	uint32(254): "ER_NO_SUCH_SESSION",
+	uint32(255): "ER_WRONG_SESSION_TYPE",
+	uint32(256): "ER_PASSWORD_EXPIRED",
+	uint32(257): "ER_AUTH_DELAY",
+	uint32(258): "ER_AUTH_REQUIRED",
+	uint32(259): "ER_SQL_SEQ_SCAN",
+	uint32(260): "ER_NO_SUCH_EVENT",
+	uint32(261): "ER_BOOTSTRAP_NOT_UNANIMOUS",
+	uint32(262): "ER_CANT_CHECK_BOOTSTRAP_LEADER",
+	uint32(263): "ER_BOOTSTRAP_CONNECTION_NOT_TO_ALL",
+	uint32(264): "ER_NIL_UUID",
+	uint32(265): "ER_WRONG_FUNCTION_OPTIONS",
+	uint32(266): "ER_MISSING_SYSTEM_SPACES",
+}
+
+// message templates in Go format
+var box_error_message = map[uint32]string{
+	ER_UNKNOWN:                           "Unknown error",
+	ER_ILLEGAL_PARAMS:                    "Illegal parameters, %s",
+	ER_MEMORY_ISSUE:                      "Failed to allocate %d bytes in %s for %s",
+	ER_TUPLE_FOUND:                       "Duplicate key exists in unique index \"%s\" in space \"%s\" with old tuple - %s and new tuple - %s",
+	ER_TUPLE_NOT_FOUND:                   "Tuple doesn't exist in index '%s' in space '%s'",
+	ER_UNSUPPORTED:                       "%s does not support %s",
+	ER_NONMASTER:                         "Can't modify data on a replication slave. My master is: %s",
+	ER_READONLY:                          "Can't modify data on a read-only instance",
+	ER_INJECTION:                         "Error injection '%s'",
+	ER_CREATE_SPACE:                      "Failed to create space '%s': %s",
+	ER_SPACE_EXISTS:                      "Space '%s' already exists",
+	ER_DROP_SPACE:                        "Can't drop space '%s': %s",
+	ER_ALTER_SPACE:                       "Can't modify space '%s': %s",
+	ER_INDEX_TYPE:                        "Unsupported index type supplied for index '%s' in space '%s'",
+	ER_MODIFY_INDEX:                      "Can't create or modify index '%s' in space '%s': %s",
+	ER_LAST_DROP:                         "Can't drop the primary key in a system space, space '%s'",
+	ER_TUPLE_FORMAT_LIMIT:                "Tuple format limit reached: %d",
+	ER_DROP_PRIMARY_KEY:                  "Can't drop primary key in space '%s' while secondary keys exist",
+	ER_KEY_PART_TYPE:                     "Supplied key type of part %d does not match index part type: expected %s",
+	ER_EXACT_MATCH:                       "Invalid key part count in an exact match (expected %d, got %d)",
+	ER_INVALID_MSGPACK:                   "Invalid MsgPack - %s",
+	ER_PROC_RET:                          "msgpack.encode: can not encode Lua type '%s'",
+	ER_TUPLE_NOT_ARRAY:                   "Tuple/Key must be MsgPack array",
+	ER_FIELD_TYPE:                        "Tuple field %s type does not match one required by operation: expected %s, got %s",
+	ER_INDEX_PART_TYPE_MISMATCH:          "Field %s has type '%s' in one index, but type '%s' in another",
+	ER_UPDATE_SPLICE:                     "SPLICE error on field %s: %s",
+	ER_UPDATE_ARG_TYPE:                   "Argument type in operation '%c' on field %s does not match field type: expected %s",
+	ER_FORMAT_MISMATCH_INDEX_PART:        "Field %s has type '%s' in space format, but type '%s' in index definition",
+	ER_UNKNOWN_UPDATE_OP:                 "Unknown UPDATE operation #%d: %s",
+	ER_UPDATE_FIELD:                      "Field %s UPDATE error: %s",
+	ER_FUNCTION_TX_ACTIVE:                "Transaction is active at return from function",
+	ER_KEY_PART_COUNT:                    "Invalid key part count (expected [0..%d], got %d)",
+	ER_PROC_LUA:                          "%s",
+	ER_NO_SUCH_PROC:                      "Procedure '%s' is not defined",
+	ER_NO_SUCH_TRIGGER:                   "Trigger '%s' doesn't exist",
+	ER_NO_SUCH_INDEX_ID:                  "No index #%d is defined in space '%s'",
+	ER_NO_SUCH_SPACE:                     "Space '%s' does not exist",
+	ER_NO_SUCH_FIELD_NO:                  "Field %d was not found in the tuple",
+	ER_EXACT_FIELD_COUNT:                 "Tuple field count %d does not match space field count %d",
+	ER_FIELD_MISSING:                     "Tuple field %s required by space format is missing",
+	ER_WAL_IO:                            "Failed to write to disk",
+	ER_MORE_THAN_ONE_TUPLE:               "Get() doesn't support partial keys and non-unique indexes",
+	ER_ACCESS_DENIED:                     "%s access to %s '%s' is denied for user '%s'",
+	ER_CREATE_USER:                       "Failed to create user '%s': %s",
+	ER_DROP_USER:                         "Failed to drop user or role '%s': %s",
+	ER_NO_SUCH_USER:                      "User '%s' is not found",
+	ER_USER_EXISTS:                       "User '%s' already exists",
+	ER_CREDS_MISMATCH:                    "User not found or supplied credentials are invalid",
+	ER_UNKNOWN_REQUEST_TYPE:              "Unknown request type %d",
+	ER_UNKNOWN_SCHEMA_OBJECT:             "Unknown object type '%s'",
+	ER_CREATE_FUNCTION:                   "Failed to create function '%s': %s",
+	ER_NO_SUCH_FUNCTION:                  "Function '%s' does not exist",
+	ER_FUNCTION_EXISTS:                   "Function '%s' already exists",
+	ER_BEFORE_REPLACE_RET:                "Invalid return value of space:before_replace trigger: expected tuple or nil, got %s",
+	ER_MULTISTATEMENT_TRANSACTION:        "Can not perform %s in a multi-statement transaction",
+	ER_TRIGGER_EXISTS:                    "Trigger '%s' already exists",
+	ER_USER_MAX:                          "A limit on the total number of users has been reached: %d",
+	ER_NO_SUCH_ENGINE:                    "Space engine '%s' does not exist",
+	ER_RELOAD_CFG:                        "Can't set option '%s' dynamically",
+	ER_CFG:                               "Incorrect value for option '%s': %s",
+	ER_SAVEPOINT_EMPTY_TX:                "Can not set a savepoint in an empty transaction",
+	ER_NO_SUCH_SAVEPOINT:                 "Can not rollback to savepoint: the savepoint does not exist",
+	ER_UNKNOWN_REPLICA:                   "Replica %s is not registered with replica set %s",
+	ER_REPLICASET_UUID_MISMATCH:          "Replica set UUID mismatch: expected %s, got %s",
+	ER_INVALID_UUID:                      "Invalid UUID: %s",
+	ER_REPLICASET_UUID_IS_RO:             "Can't reset replica set UUID: it is already assigned",
+	ER_INSTANCE_UUID_MISMATCH:            "Instance UUID mismatch: expected %s, got %s",
+	ER_REPLICA_ID_IS_RESERVED:            "Can't initialize replica id with a reserved value %d",
+	ER_INVALID_ORDER:                     "Invalid LSN order for instance %d: previous LSN = %d, new lsn = %d",
+	ER_MISSING_REQUEST_FIELD:             "Missing mandatory field '%s' in request",
+	ER_IDENTIFIER:                        "Invalid identifier '%s' (expected printable symbols only or it is too long)",
+	ER_DROP_FUNCTION:                     "Can't drop function %d: %s",
+	ER_ITERATOR_TYPE:                     "Unknown iterator type '%s'",
+	ER_REPLICA_MAX:                       "Replica count limit reached: %d",
+	ER_INVALID_XLOG:                      "Failed to read xlog: %d",
+	ER_INVALID_XLOG_NAME:                 "Invalid xlog name: expected %d got %d",
+	ER_INVALID_XLOG_ORDER:                "Invalid xlog order: %d and %d",
+	ER_NO_CONNECTION:                     "Connection is not established",
+	ER_TIMEOUT:                           "Timeout exceeded",
+	ER_ACTIVE_TRANSACTION:                "Operation is not permitted when there is an active transaction ",
+	ER_CURSOR_NO_TRANSACTION:             "The transaction the cursor belongs to has ended",
+	ER_CROSS_ENGINE_TRANSACTION:          "A multi-statement transaction can not use multiple storage engines",
+	ER_NO_SUCH_ROLE:                      "Role '%s' is not found",
+	ER_ROLE_EXISTS:                       "Role '%s' already exists",
+	ER_CREATE_ROLE:                       "Failed to create role '%s': %s",
+	ER_INDEX_EXISTS:                      "Index '%s' already exists",
+	ER_SESSION_CLOSED:                    "Session is closed",
+	ER_ROLE_LOOP:                         "Granting role '%s' to role '%s' would create a loop",
+	ER_GRANT:                             "Incorrect grant arguments: %s",
+	ER_PRIV_GRANTED:                      "User '%s' already has %s access on %s%s",
+	ER_ROLE_GRANTED:                      "User '%s' already has role '%s'",
+	ER_PRIV_NOT_GRANTED:                  "User '%s' does not have %s access on %s '%s'",
+	ER_ROLE_NOT_GRANTED:                  "User '%s' does not have role '%s'",
+	ER_MISSING_SNAPSHOT:                  "Can't find snapshot",
+	ER_CANT_UPDATE_PRIMARY_KEY:           "Attempt to modify a tuple field which is part of primary index in space '%s'",
+	ER_UPDATE_INTEGER_OVERFLOW:           "Integer overflow when performing '%c' operation on field %s",
+	ER_GUEST_USER_PASSWORD:               "Setting password for guest user has no effect",
+	ER_TRANSACTION_CONFLICT:              "Transaction has been aborted by conflict",
+	ER_UNSUPPORTED_PRIV:                  "Unsupported %s privilege '%s'",
+	ER_LOAD_FUNCTION:                     "Failed to dynamically load function '%s': %s",
+	ER_FUNCTION_LANGUAGE:                 "Unsupported language '%s' specified for function '%s'",
+	ER_RTREE_RECT:                        "RTree: %s must be an array with %d (point) or %d (rectangle/box) numeric coordinates",
+	ER_PROC_C:                            "%s",
+	ER_UNKNOWN_RTREE_INDEX_DISTANCE_TYPE: "Unknown RTREE index distance type %s",
+	ER_PROTOCOL:                          "%s",
+	ER_UPSERT_UNIQUE_SECONDARY_KEY:       "Space %s has a unique secondary index and does not support UPSERT",
+	ER_WRONG_INDEX_RECORD:                "Wrong record in _index space: got {%s}, expected {%s}",
+	ER_WRONG_INDEX_PARTS:                 "Wrong index part %d: %s",
+	ER_WRONG_INDEX_OPTIONS:               "Wrong index options: %s",
+	ER_WRONG_SCHEMA_VERSION:              "Wrong schema version, current: %d, in request: %d",
+	ER_MEMTX_MAX_TUPLE_SIZE:              "Failed to allocate %d bytes for tuple: tuple is too large. Check 'memtx_max_tuple_size' configuration option.",
+	ER_WRONG_SPACE_OPTIONS:               "Wrong space options: %s",
+	ER_UNSUPPORTED_INDEX_FEATURE:         "Index '%s' (%s) of space '%s' (%s) does not support %s",
+	ER_VIEW_IS_RO:                        "View '%s' is read-only",
+	ER_NO_TRANSACTION:                    "No active transaction",
+	ER_SYSTEM:                            "%s",
+	ER_LOADING:                           "Instance bootstrap hasn't finished yet",
+	ER_CONNECTION_TO_SELF:                "Connection to self",
+	ER_KEY_PART_IS_TOO_LONG:              "Key part is too long: %d of %d bytes",
+	ER_COMPRESSION:                       "Compression error: %s",
+	ER_CHECKPOINT_IN_PROGRESS:            "Snapshot is already in progress",
+	ER_SUB_STMT_MAX:                      "Can not execute a nested statement: nesting limit reached",
+	ER_COMMIT_IN_SUB_STMT:                "Can not commit transaction in a nested statement",
+	ER_ROLLBACK_IN_SUB_STMT:              "Rollback called in a nested statement",
+	ER_DECOMPRESSION:                     "Decompression error: %s",
+	ER_INVALID_XLOG_TYPE:                 "Invalid xlog type: expected %s, got %s",
+	ER_ALREADY_RUNNING:                   "Failed to lock WAL directory %s and hot_standby mode is off",
+	ER_INDEX_FIELD_COUNT_LIMIT:           "Indexed field count limit reached: %d indexed fields",
+	ER_LOCAL_INSTANCE_ID_IS_READ_ONLY:    "The local instance id %d is read-only",
+	ER_BACKUP_IN_PROGRESS:                "Backup is already in progress",
+	ER_READ_VIEW_ABORTED:                 "The read view is aborted",
+	ER_INVALID_INDEX_FILE:                "Invalid INDEX file %s: %s",
+	ER_INVALID_RUN_FILE:                  "Invalid RUN file: %s",
+	ER_INVALID_VYLOG_FILE:                "Invalid VYLOG file: %s",
+	ER_CASCADE_ROLLBACK:                  "WAL has a rollback in progress",
+	ER_VY_QUOTA_TIMEOUT:                  "Timed out waiting for Vinyl memory quota",
+	ER_PARTIAL_KEY:                       "%s index does not support selects via a partial key (expected %d parts, got %d). Please Consider changing index type to TREE.",
+	ER_TRUNCATE_SYSTEM_SPACE:             "Can't truncate a system space, space '%s'",
+	ER_LOAD_MODULE:                       "Failed to dynamically load module '%s': %s",
+	ER_VINYL_MAX_TUPLE_SIZE:              "Failed to allocate %d bytes for tuple: tuple is too large. Check 'vinyl_max_tuple_size' configuration option.",
+	ER_WRONG_DD_VERSION:                  "Wrong _schema version: expected 'major.minor[.patch]'",
+	ER_WRONG_SPACE_FORMAT:                "Wrong space format field %d: %s",
+	ER_CREATE_SEQUENCE:                   "Failed to create sequence '%s': %s",
+	ER_ALTER_SEQUENCE:                    "Can't modify sequence '%s': %s",
+	ER_DROP_SEQUENCE:                     "Can't drop sequence '%s': %s",
+	ER_NO_SUCH_SEQUENCE:                  "Sequence '%s' does not exist",
+	ER_SEQUENCE_EXISTS:                   "Sequence '%s' already exists",
+	ER_SEQUENCE_OVERFLOW:                 "Sequence '%s' has overflowed",
+	ER_NO_SUCH_INDEX_NAME:                "No index '%s' is defined in space '%s'",
+	ER_SPACE_FIELD_IS_DUPLICATE:          "Space field '%s' is duplicate",
+	ER_CANT_CREATE_COLLATION:             "Failed to initialize collation: %s.",
+	ER_WRONG_COLLATION_OPTIONS:           "Wrong collation options: %s",
+	ER_NULLABLE_PRIMARY:                  "Primary index of space '%s' can not contain nullable parts",
+	ER_NO_SUCH_FIELD_NAME_IN_SPACE:       "Field '%s' was not found in space '%s' format",
+	ER_TRANSACTION_YIELD:                 "Transaction has been aborted by a fiber yield",
+	ER_NO_SUCH_GROUP:                     "Replication group '%s' does not exist",
+	ER_SQL_BIND_VALUE:                    "Bind value for parameter %s is out of range for type %s",
+	ER_SQL_BIND_TYPE:                     "Bind value type %s for parameter %s is not supported",
+	ER_SQL_BIND_PARAMETER_MAX:            "SQL bind parameter limit reached: %d",
+	ER_SQL_EXECUTE:                       "Failed to execute SQL statement: %s",
+	ER_UPDATE_DECIMAL_OVERFLOW:           "Decimal overflow when performing operation '%c' on field %s",
+	ER_SQL_BIND_NOT_FOUND:                "Parameter %s was not found in the statement",
+	ER_ACTION_MISMATCH:                   "Field %s contains %s on conflict action, but %s in index parts",
+	ER_VIEW_MISSING_SQL:                  "Space declared as a view must have SQL statement",
+	ER_FOREIGN_KEY_CONSTRAINT:            "Can not commit transaction: deferred foreign keys violations are not resolved",
+	ER_NO_SUCH_MODULE:                    "Module '%s' does not exist",
+	ER_NO_SUCH_COLLATION:                 "Collation '%s' does not exist",
+	ER_CREATE_FK_CONSTRAINT:              "Failed to create foreign key constraint '%s': %s",
+	ER_DROP_FK_CONSTRAINT:                "Failed to drop foreign key constraint '%s': %s",
+	ER_NO_SUCH_CONSTRAINT:                "Constraint '%s' does not exist in space '%s'",
+	ER_CONSTRAINT_EXISTS:                 "%s constraint '%s' already exists in space '%s'",
+	ER_SQL_TYPE_MISMATCH:                 "Type mismatch: can not convert %s to %s",
+	ER_ROWID_OVERFLOW:                    "Rowid is overflowed: too many entries in ephemeral space",
+	ER_DROP_COLLATION:                    "Can't drop collation %s : %s",
+	ER_ILLEGAL_COLLATION_MIX:             "Illegal mix of collations",
+	ER_SQL_NO_SUCH_PRAGMA:                "Pragma '%s' does not exist",
+	ER_SQL_CANT_RESOLVE_FIELD:            "Can’t resolve field '%s'",
+	ER_INDEX_EXISTS_IN_SPACE:             "Index '%s' already exists in space '%s'",
+	ER_INCONSISTENT_TYPES:                "Inconsistent types: expected %s got %s",
+	ER_SQL_SYNTAX_WITH_POS:               "Syntax error at line %d at or near position %d: %s",
+	ER_SQL_STACK_OVERFLOW:                "Failed to parse SQL statement: parser stack limit reached",
+	ER_SQL_SELECT_WILDCARD:               "Failed to expand '*' in SELECT statement without FROM clause",
+	ER_SQL_STATEMENT_EMPTY:               "Failed to execute an empty SQL statement",
+	ER_SQL_KEYWORD_IS_RESERVED:           "At line %d at or near position %d: keyword '%s' is reserved. Please use double quotes if '%s' is an identifier.",
+	ER_SQL_SYNTAX_NEAR_TOKEN:             "Syntax error at line %d near '%s'",
+	ER_SQL_UNKNOWN_TOKEN:                 "At line %d at or near position %d: unrecognized token '%s'",
+	ER_SQL_PARSER_GENERIC:                "%s",
+	ER_SQL_ANALYZE_ARGUMENT:              "ANALYZE statement argument %s is not a base table",
+	ER_SQL_COLUMN_COUNT_MAX:              "Failed to create space '%s': space column count %d exceeds the limit (%d)",
+	ER_HEX_LITERAL_MAX:                   "Hex literal %s%s length %d exceeds the supported limit (%d)",
+	ER_INT_LITERAL_MAX:                   "Integer literal %s%s exceeds the supported range [-9223372036854775808, 18446744073709551615]",
+	ER_SQL_PARSER_LIMIT:                  "%s %d exceeds the limit (%d)",
+	ER_INDEX_DEF_UNSUPPORTED:             "%s are prohibited in an index definition",
+	ER_CK_DEF_UNSUPPORTED:                "%s are prohibited in a ck constraint definition",
+	ER_MULTIKEY_INDEX_MISMATCH:           "Field %s is used as multikey in one index and as single key in another",
+	ER_CREATE_CK_CONSTRAINT:              "Failed to create check constraint '%s': %s",
+	ER_CK_CONSTRAINT_FAILED:              "Check constraint failed '%s': %s",
+	ER_SQL_COLUMN_COUNT:                  "Unequal number of entries in row expression: left side has %d, but right side - %d",
+	ER_FUNC_INDEX_FUNC:                   "Failed to build a key for functional index '%s' of space '%s': %s",
+	ER_FUNC_INDEX_FORMAT:                 "Key format doesn't match one defined in functional index '%s' of space '%s': %s",
+	ER_FUNC_INDEX_PARTS:                  "Wrong functional index definition: %s",
+	ER_NO_SUCH_FIELD_NAME:                "Field '%s' was not found in the tuple",
+	ER_FUNC_WRONG_ARG_COUNT:              "Wrong number of arguments is passed to %s(): expected %s, got %d",
+	ER_BOOTSTRAP_READONLY:                "Trying to bootstrap a local read-only instance as master",
+	ER_SQL_FUNC_WRONG_RET_COUNT:          "SQL expects exactly one argument returned from %s, got %d",
+	ER_FUNC_INVALID_RETURN_TYPE:          "Function '%s' returned value of invalid type: expected %s got %s",
+	ER_SQL_PARSER_GENERIC_WITH_POS:       "At line %d at or near position %d: %s",
+	ER_REPLICA_NOT_ANON:                  "Replica '%s' is not anonymous and cannot register.",
+	ER_CANNOT_REGISTER:                   "Couldn't find an instance to register this replica on.",
+	ER_SESSION_SETTING_INVALID_VALUE:     "Session setting %s expected a value of type %s",
+	ER_SQL_PREPARE:                       "Failed to prepare SQL statement: %s",
+	ER_WRONG_QUERY_ID:                    "Prepared statement with id %d does not exist",
+	ER_SEQUENCE_NOT_STARTED:              "Sequence '%s' is not started",
+	ER_NO_SUCH_SESSION_SETTING:           "Session setting %s doesn't exist",
+	ER_UNCOMMITTED_FOREIGN_SYNC_TXNS:     "Found uncommitted sync transactions from other instance with id %d",
+	ER_SYNC_MASTER_MISMATCH:              "CONFIRM message arrived for an unknown master id %d, expected %d",
+	ER_SYNC_QUORUM_TIMEOUT:               "Quorum collection for a synchronous transaction is timed out",
+	ER_SYNC_ROLLBACK:                     "A rollback for a synchronous transaction is received",
+	ER_TUPLE_METADATA_IS_TOO_BIG:         "Can't create tuple: metadata size %d is too big",
+	ER_XLOG_GAP:                          "%s",
+	ER_TOO_EARLY_SUBSCRIBE:               "Can't subscribe non-anonymous replica %s until join is done",
+	ER_SQL_CANT_ADD_AUTOINC:              "Can't add AUTOINCREMENT: space %s can't feature more than one AUTOINCREMENT field",
+	ER_QUORUM_WAIT:                       "Couldn't wait for quorum %d: %s",
+	ER_INTERFERING_PROMOTE:               "Instance with replica id %d was promoted first",
+	ER_ELECTION_DISABLED:                 "Elections were turned off",
+	ER_TXN_ROLLBACK:                      "Transaction was rolled back",
+	ER_NOT_LEADER:                        "The instance is not a leader. New leader is %d",
+	ER_SYNC_QUEUE_UNCLAIMED:              "The synchronous transaction queue doesn't belong to any instance",
+	ER_SYNC_QUEUE_FOREIGN:                "The synchronous transaction queue belongs to other instance with id %d",
+	ER_UNABLE_TO_PROCESS_IN_STREAM:       "Unable to process %s request in stream",
+	ER_UNABLE_TO_PROCESS_OUT_OF_STREAM:   "Unable to process %s request out of stream",
+	ER_TRANSACTION_TIMEOUT:               "Transaction has been aborted by timeout",
+	ER_ACTIVE_TIMER:                      "Operation is not permitted if timer is already running",
+	ER_TUPLE_FIELD_COUNT_LIMIT:           "Tuple field count limit reached: see box.schema.FIELD_MAX",
+	ER_CREATE_CONSTRAINT:                 "Failed to create constraint '%s' in space '%s': %s",
+	ER_FIELD_CONSTRAINT_FAILED:           "Check constraint '%s' failed for field '%s'",
+	ER_TUPLE_CONSTRAINT_FAILED:           "Check constraint '%s' failed for tuple",
+	ER_CREATE_FOREIGN_KEY:                "Failed to create foreign key '%s' in space '%s': %s",
+	ER_FOREIGN_KEY_INTEGRITY:             "Foreign key '%s' integrity check failed: %s",
+	ER_FIELD_FOREIGN_KEY_FAILED:          "Foreign key constraint '%s' failed for field '%s': %s",
+	ER_COMPLEX_FOREIGN_KEY_FAILED:        "Foreign key constraint '%s' failed: %s",
+	ER_WRONG_SPACE_UPGRADE_OPTIONS:       "Wrong space upgrade options: %s",
+	ER_NO_ELECTION_QUORUM:                "Not enough peers connected to start elections: %d out of minimal required %d",
+	ER_SSL:                               "%s",
+	ER_SPLIT_BRAIN:                       "Split-Brain discovered: %s",
+	ER_OLD_TERM:                          "The term is outdated: old - %d, new - %d",
+	ER_INTERFERING_ELECTIONS:             "Interfering elections started",
+	ER_ITERATOR_POSITION:                 "Iterator position is invalid",
+	ER_UNUSED:                            "",
+	ER_UNKNOWN_AUTH_METHOD:               "Unknown authentication method '%s'",
+	ER_INVALID_AUTH_DATA:                 "Invalid '%s' data: %s",
+	ER_INVALID_AUTH_REQUEST:              "Invalid '%s' request: %s",
+	ER_WEAK_PASSWORD:                     "Password doesn't meet security requirements: %s",
+	ER_OLD_PASSWORD:                      "Password must differ from last %d passwords",
+	ER_NO_SUCH_SESSION:                   "Session %d does not exist",
+	ER_WRONG_SESSION_TYPE:                "Session '%s' is not supported",
+	ER_PASSWORD_EXPIRED:                  "Password expired",
+	ER_AUTH_DELAY:                        "Too many authentication attempts",
+	ER_AUTH_REQUIRED:                     "Authentication required",
+	ER_SQL_SEQ_SCAN:                      "Scanning is not allowed for %s",
+	ER_NO_SUCH_EVENT:                     "Unknown event %s",
+	ER_BOOTSTRAP_NOT_UNANIMOUS:           "Replica %s chose a different bootstrap leader %s",
+	ER_CANT_CHECK_BOOTSTRAP_LEADER:       "Can't check who replica %s chose its bootstrap leader",
+	ER_BOOTSTRAP_CONNECTION_NOT_TO_ALL:   "Some replica set members were not specified in box.cfg.replication",
+	ER_NIL_UUID:                          "Nil UUID is reserved and can't be used in replication",
+	ER_WRONG_FUNCTION_OPTIONS:            "Wrong function options: %s",
+	ER_MISSING_SYSTEM_SPACES:             "Snapshot has no system spaces",
+}
@@ -0,0 +1,241 @@
+package tarantella
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ClientError creates an error with the code and message made of the code template
+// from errcode.h, arguments must fit the template
+func ClientError(code uint32, args ...any) *BoxError {
+	return newClientError(3, code, args...)
+}
+
+func newClientError(skip int, code uint32, args ...any) *BoxError {
+	e := &BoxError{
+		Type:    boxErrorClient,
+		Code:    code,
+		Message: fmt.Sprintf(box_error_message[code], args...),
+	}
+	e.File, e.Line = caller(skip)
+	return e
+}
+
+// ErrorCodeName returns ER_XXX name of the code
+func ErrorCodeName(code uint32) string {
+	if name, ok := box_error_code[code]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(code), 10)
+}
+
+// ErrIllegalParams is ER_ILLEGAL_PARAMS
+func ErrIllegalParams(format string, args ...any) *BoxError {
+	return newClientError(3, ER_ILLEGAL_PARAMS, fmt.Sprintf(format, args...))
+}
+
+// ErrTupleFound is ER_TUPLE_FOUND
+func ErrTupleFound(index, space string, oldTuple, newTuple []any) *BoxError {
+	return newClientError(3, ER_TUPLE_FOUND, index, space, TupleString(oldTuple), TupleString(newTuple))
+}
+
+// ErrUnsupported is ER_UNSUPPORTED
+func ErrUnsupported(what, feature string) *BoxError {
+	return newClientError(3, ER_UNSUPPORTED, what, feature)
+}
+
+// ErrReadonly is ER_READONLY
+func ErrReadonly() *BoxError {
+	return newClientError(3, ER_READONLY)
+}
+
+// ErrInvalidMsgpack is ER_INVALID_MSGPACK
+func ErrInvalidMsgpack(details string) *BoxError {
+	return newClientError(3, ER_INVALID_MSGPACK, details)
+}
+
+// ErrTupleNotArray is ER_TUPLE_NOT_ARRAY
+func ErrTupleNotArray() *BoxError {
+	return newClientError(3, ER_TUPLE_NOT_ARRAY)
+}
+
+// ErrFieldType is ER_FIELD_TYPE, field is a field number (1-based), a field name or a namedField
+func ErrFieldType(field any, expected, got string) *BoxError {
+	return newClientError(3, ER_FIELD_TYPE, fieldRef(field), expected, got)
+}
+
+// ErrFieldMissing is ER_FIELD_MISSING, field is a field number (1-based), a field name or a namedField
+func ErrFieldMissing(field any) *BoxError {
+	return newClientError(3, ER_FIELD_MISSING, fieldRef(field))
+}
+
+// ErrKeyPartType is ER_KEY_PART_TYPE, part is 0-based
+func ErrKeyPartType(part int, expected string) *BoxError {
+	return newClientError(3, ER_KEY_PART_TYPE, part, expected)
+}
+
+// ErrKeyPartCount is ER_KEY_PART_COUNT
+func ErrKeyPartCount(expected, got int) *BoxError {
+	return newClientError(3, ER_KEY_PART_COUNT, expected, got)
+}
+
+// ErrExactMatch is ER_EXACT_MATCH
+func ErrExactMatch(expected, got int) *BoxError {
+	return newClientError(3, ER_EXACT_MATCH, expected, got)
+}
+
+// ErrNoSuchSpace is ER_NO_SUCH_SPACE, space is an id or a name of the space
+func ErrNoSuchSpace(space any) *BoxError {
+	return newClientError(3, ER_NO_SUCH_SPACE, fmt.Sprint(space))
+}
+
+// ErrSpaceExists is ER_SPACE_EXISTS
+func ErrSpaceExists(space string) *BoxError {
+	return newClientError(3, ER_SPACE_EXISTS, space)
+}
+
+// ErrNoSuchIndexID is ER_NO_SUCH_INDEX_ID
+func ErrNoSuchIndexID(id uint64, space string) *BoxError {
+	return newClientError(3, ER_NO_SUCH_INDEX_ID, id, space)
+}
+
+// ErrNoSuchIndexName is ER_NO_SUCH_INDEX_NAME
+func ErrNoSuchIndexName(name, space string) *BoxError {
+	return newClientError(3, ER_NO_SUCH_INDEX_NAME, name, space)
+}
+
+// ErrIndexExistsInSpace is ER_INDEX_EXISTS_IN_SPACE
+func ErrIndexExistsInSpace(index, space string) *BoxError {
+	return newClientError(3, ER_INDEX_EXISTS_IN_SPACE, index, space)
+}
+
+// ErrNoSuchProc is ER_NO_SUCH_PROC
+func ErrNoSuchProc(name string) *BoxError {
+	return newClientError(3, ER_NO_SUCH_PROC, name)
+}
+
+// ErrProcLua is ER_PROC_LUA
+func ErrProcLua(format string, args ...any) *BoxError {
+	return newClientError(3, ER_PROC_LUA, fmt.Sprintf(format, args...))
+}
+
+// ErrUnknownRequestType is ER_UNKNOWN_REQUEST_TYPE
+func ErrUnknownRequestType(requestType uint64) *BoxError {
+	return newClientError(3, ER_UNKNOWN_REQUEST_TYPE, requestType)
+}
+
+// ErrMissingRequestField is ER_MISSING_REQUEST_FIELD, key is an IPROTO key
+func ErrMissingRequestField(key uint64) *BoxError {
+	return newClientError(3, ER_MISSING_REQUEST_FIELD, iprotoKeyName(key))
+}
+
+// ErrIteratorType is ER_ITERATOR_TYPE
+func ErrIteratorType(iterator string) *BoxError {
+	return newClientError(3, ER_ITERATOR_TYPE, iterator)
+}
+
+// ErrTransactionConflict is ER_TRANSACTION_CONFLICT
+func ErrTransactionConflict() *BoxError {
+	return newClientError(3, ER_TRANSACTION_CONFLICT)
+}
+
+// ErrConnectionToSelf is ER_CONNECTION_TO_SELF
+func ErrConnectionToSelf() *BoxError {
+	return newClientError(3, ER_CONNECTION_TO_SELF)
+}
+
+// ErrReplicaMax is ER_REPLICA_MAX
+func ErrReplicaMax() *BoxError {
+	return newClientError(3, ER_REPLICA_MAX, vclockMax)
+}
+
+// ErrTooEarlySubscribe is ER_TOO_EARLY_SUBSCRIBE
+func ErrTooEarlySubscribe(instanceUUID string) *BoxError {
+	return newClientError(3, ER_TOO_EARLY_SUBSCRIBE, instanceUUID)
+}
+
+// ErrXlogGap is ER_XLOG_GAP: rows between the vclocks are not kept by logs
+func ErrXlogGap(from, to Vclock) *BoxError {
+	return newClientError(3, ER_XLOG_GAP, fmt.Sprintf("Missing .xlog file between LSN %d %s and %d %s",
+		from.Signature(), from, to.Signature(), to))
+}
+
+// fieldRef formats field reference like tarantool does: numbers as is, names in quotes
+func fieldRef(field any) string {
+	if s, ok := field.(string); ok {
+		return "'" + s + "'"
+	}
+	return fmt.Sprint(field)
+}
+
+// iprotoKeyName returns IPROTO key name like tarantool does in messages: lower case without prefix
+func iprotoKeyName(key uint64) string {
+	if name, ok := iproto_key[key]; ok {
+		return strings.ToLower(strings.TrimPrefix(name, "IPROTO_"))
+	}
+	return strconv.FormatUint(key, 10)
+}
+
+// TupleString formats the tuple like tarantool does in error messages
+func TupleString(tuple []any) string {
+	sb := &strings.Builder{}
+	writeMpString(sb, tuple)
+	return sb.String()
+}
+
+func writeMpString(sb *strings.Builder, v any) {
+	switch vv := v.(type) {
+	case nil:
+		sb.WriteString("null")
+	case string:
+		sb.WriteString(strconv.Quote(vv))
+	case []byte:
+		sb.WriteString(strconv.Quote(string(vv)))
+	case float32:
+		writeMpFloat(sb, float64(vv))
+	case float64:
+		writeMpFloat(sb, vv)
+	case []any:
+		sb.WriteByte('[')
+		for i, item := range vv {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeMpString(sb, item)
+		}
+		sb.WriteByte(']')
+	case map[any]any:
+		keys := sortedKeys(vv)
+		sb.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeMpString(sb, k)
+			sb.WriteString(": ")
+			writeMpString(sb, vv[k])
+		}
+		sb.WriteByte('}')
+	default:
+		fmt.Fprint(sb, vv)
+	}
+}
+
+// writeMpFloat prints floats like %lg does
+func writeMpFloat(sb *strings.Builder, f float64) {
+	sb.WriteString(strconv.FormatFloat(f, 'g', 6, 64))
+}
+
+// sortedKeys returns keys of the map in the stable order
+func sortedKeys(m map[any]any) []any {
+	keys := make([]any, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
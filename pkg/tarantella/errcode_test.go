@@ -0,0 +1,26 @@
+package tarantella
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorMessages(t *testing.T) {
+	require.Equal(t, "Space '600' does not exist", ErrNoSuchSpace(600).Error())
+	require.Equal(t, "No index #3 is defined in space 'tester'", ErrNoSuchIndexID(3, "tester").Error())
+	require.Equal(t, "Unknown request type 68", ErrUnknownRequestType(IPROTO_VOTE).Error())
+	require.Equal(t, "Missing mandatory field 'space_id' in request", ErrMissingRequestField(IPROTO_SPACE_ID).Error())
+	require.Equal(t, "Procedure 'crud.select' is not defined", ErrNoSuchProc("crud.select").Error())
+	require.Equal(t,
+		`Duplicate key exists in unique index "primary" in space "tester" with old tuple - [1, "Roxette", 1986] and new tuple - [1, "ABBA", 1972.5]`,
+		ErrTupleFound("primary", "tester", []any{1, "Roxette", 1986}, []any{1, "ABBA", 1972.5}).Error())
+	require.Equal(t,
+		"Tuple field 1 type does not match one required by operation: expected unsigned, got string",
+		ErrFieldType(1, "unsigned", "string").Error())
+
+	e := ErrReadonly()
+	require.Equal(t, ER_READONLY, e.Code)
+	require.Equal(t, "ER_READONLY", ErrorCodeName(e.Code))
+	require.Equal(t, "errcode_test.go", e.File)
+}
@@ -0,0 +1,162 @@
+package tarantella
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Events are values of keys broadcast by the instance like box.broadcast does, clients watch
+// them by IPROTO_WATCH. A client gets IPROTO_EVENT with the current value, the next one is
+// sent when the value changes and the client acknowledges the previous one by IPROTO_WATCH
+
+// keys broadcast by the instance
+const eventBoxStatus = "box.status"
+
+type (
+	// events keeps broadcast values, each change has a new version
+	events struct {
+		mu      sync.Mutex
+		values  map[string]any
+		version map[string]uint64
+		changed chan struct{} // closed and replaced by each broadcast
+	}
+
+	// watchers are keys watched by one connection
+	watchers struct {
+		mu      sync.Mutex
+		keys    map[string]*watcher
+		kick    chan struct{}
+		started bool
+	}
+
+	watcher struct {
+		acked bool   // the client waits for the next event
+		sent  uint64 // version of the last sent value
+		fresh bool   // nothing is sent yet
+	}
+)
+
+func newEvents() *events {
+	return &events{
+		values:  make(map[string]any),
+		version: make(map[string]uint64),
+		changed: make(chan struct{}),
+	}
+}
+
+// Broadcast sets the value of the key and notifies watchers, nil deletes the value
+func (inst *Instance) Broadcast(key string, value any) {
+	e := inst.events
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if value == nil {
+		delete(e.values, key)
+	} else {
+		e.values[key] = value
+	}
+	e.version[key]++
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// get returns the value of the key and its version
+func (e *events) get(key string) (any, uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.values[key], e.version[key]
+}
+
+// wait returns the channel which is closed by the next broadcast
+func (e *events) wait() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.changed
+}
+
+// broadcastStatus updates box.status: {is_ro, is_ro_cfg, status}
+func (inst *Instance) broadcastStatus() {
+	readOnly := inst.storage.isReadOnly()
+	inst.Broadcast(eventBoxStatus, map[any]any{"is_ro": readOnly, "is_ro_cfg": readOnly, "status": "running"})
+}
+
+// watch registers the key or acknowledges the last event of it
+func (clc *clientConnection) watch(r *WatchRequest) {
+	ws := &clc.watchers
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.keys == nil {
+		ws.keys = make(map[string]*watcher)
+		ws.kick = make(chan struct{}, 1)
+	}
+	if r.Unwatch {
+		delete(ws.keys, r.Key)
+		return
+	}
+	if w, ok := ws.keys[r.Key]; ok {
+		w.acked = true
+	} else {
+		ws.keys[r.Key] = &watcher{acked: true, fresh: true}
+	}
+	if !ws.started {
+		ws.started = true
+		go clc.notify()
+	}
+	select {
+	case ws.kick <- struct{}{}:
+	default:
+	}
+}
+
+// notify sends events to the client till the connection is closed
+func (clc *clientConnection) notify() {
+	ws := &clc.watchers
+	for {
+		wait := clc.inst.events.wait()
+
+		var events []*Package
+		ws.mu.Lock()
+		for key, w := range ws.keys {
+			value, version := clc.inst.events.get(key)
+			if !w.acked || (!w.fresh && w.sent == version) {
+				continue
+			}
+			w.acked, w.fresh, w.sent = false, false, version
+			ev := NewResponse(RequestHeader{})
+			ev.SetHeader(IPROTO_REQUEST_TYPE, IPROTO_EVENT)
+			ev.SetBody(IPROTO_EVENT_KEY, key)
+			if value != nil {
+				ev.SetBody(IPROTO_EVENT_DATA, value)
+			}
+			events = append(events, ev)
+		}
+		ws.mu.Unlock()
+
+		if len(events) > 0 {
+			clc.writeMu.Lock()
+			var err error
+			for _, ev := range events {
+				if err == nil {
+					err = clc.writeResponse(ev, clc.w)
+				}
+				ev.release()
+			}
+			if err == nil {
+				err = clc.w.Flush()
+			}
+			clc.writeMu.Unlock()
+			if err != nil {
+				log.Debug().Err(err).Msg("Unable to send event")
+				return
+			}
+		}
+
+		select {
+		case <-clc.ctx.Done():
+			return
+		case <-wait:
+		case <-ws.kick:
+		}
+	}
+}
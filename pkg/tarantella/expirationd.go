@@ -0,0 +1,492 @@
+package tarantella
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The expirationd module is emulated: a task started by expirationd.start or Instance.StartExpiration scans
+// the space by the primary key in batches of tuples_per_iteration, expired tuples of a batch are deleted by one
+// transaction unless process_expired_tuple is set. A tuple is expired by the predicate (a Go function or a stored
+// function called with args and the tuple) or by the timestamp field older than ttl. Batches are spread over
+// full_scan_time but not delayed longer than iteration_delay, full scans are repeated after full_scan_delay.
+// Tasks use Config.Clock, FakeClock drives them in tests
+
+type (
+	// Clock tells the time to expiration tasks
+	Clock interface {
+		Now() time.Time
+		After(d time.Duration) <-chan time.Time
+	}
+
+	// FakeClock is the clock moved by Advance only
+	FakeClock struct {
+		mu      sync.Mutex
+		now     time.Time
+		waiters []fakeWaiter
+	}
+
+	fakeWaiter struct {
+		at time.Time
+		ch chan time.Time
+	}
+
+	realClock struct{}
+
+	// ExpirationOptions configure the expiration task like options of expirationd.start
+	ExpirationOptions struct {
+		// IsExpired is the predicate of expired tuples, if it's nil tuples are expired when Field
+		// (unix time in seconds or datetime) is older than TTL
+		IsExpired func(tuple []any) bool
+		Field     uint64 // 0-based number of the timestamp field
+		TTL       time.Duration
+
+		// Process is called for expired tuples instead of deleting them
+		Process func(tuple []any) error
+
+		TuplesPerIteration int           // tuples scanned by a batch, 1024 by default
+		FullScanTime       time.Duration // desired duration of the full scan, 1 hour by default
+		IterationDelay     time.Duration // the longest delay between batches, 1s by default
+		FullScanDelay      time.Duration // the delay between full scans, 1s by default
+	}
+
+	// ExpirationStats are statistics of the task like expirationd.stats
+	ExpirationStats struct {
+		CheckedCount uint64
+		ExpiredCount uint64
+		Restarts     uint64
+		WorkingTime  time.Duration
+	}
+
+	// expirationd keeps expiration tasks of the instance
+	expirationd struct {
+		mu    sync.Mutex
+		tasks map[string]*expirationTask
+	}
+
+	expirationTask struct {
+		name     string
+		space    uint64
+		opts     ExpirationOptions
+		started  time.Time
+		restarts uint64
+		checked  atomic.Uint64
+		expired  atomic.Uint64
+		cancel   context.CancelFunc
+		done     chan struct{}
+	}
+)
+
+// NewFakeClock returns the clock standing at the time till it's advanced
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns the channel receiving the time when the clock is advanced by the duration
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward waking up waiters whose time has come
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	rest := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			rest = append(rest, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = rest
+}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func newExpirationd() *expirationd {
+	return &expirationd{tasks: make(map[string]*expirationTask)}
+}
+
+func (inst *Instance) registerExpirationd() {
+	inst.RegisterFunction("expirationd.start", func(ctx *CallContext, args []any) ([]any, error) {
+		return nil, ctx.Instance.startExpirationCall(args)
+	})
+	inst.RegisterFunction("expirationd.kill", func(ctx *CallContext, args []any) ([]any, error) {
+		name, ok := arg(args, 0).(string)
+		if !ok {
+			return nil, ErrProcLua("Usage: expirationd.kill(name)")
+		}
+		return nil, ctx.Instance.KillExpiration(name)
+	})
+	inst.RegisterFunction("expirationd.stats", func(ctx *CallContext, args []any) ([]any, error) {
+		if name, ok := arg(args, 0).(string); ok {
+			stats, ok := ctx.Instance.ExpirationStats(name)
+			if !ok {
+				return nil, ErrProcLua("Task '%s' doesn't exist", name)
+			}
+			return []any{stats.toMap()}, nil
+		}
+		all := make(map[any]any)
+		for _, name := range ctx.Instance.expirationd.names() {
+			if stats, ok := ctx.Instance.ExpirationStats(name); ok {
+				all[name] = stats.toMap()
+			}
+		}
+		return []any{all}, nil
+	})
+	inst.RegisterFunction("expirationd.tasks", func(ctx *CallContext, args []any) ([]any, error) {
+		names := []any{}
+		for _, name := range ctx.Instance.expirationd.names() {
+			names = append(names, name)
+		}
+		return []any{names}, nil
+	})
+}
+
+// startExpirationCall starts the task like expirationd.start(name, space, is_tuple_expired, options): the predicate
+// and process_expired_tuple are names of stored functions called with args and the tuple, field (a name or 1-based
+// number) and ttl in seconds expire tuples without the predicate
+func (inst *Instance) startExpirationCall(args []any) error {
+	name, _ := arg(args, 0).(string)
+	opts, _ := arg(args, 3).(map[any]any)
+	sp, ok := inst.callSpace(arg(args, 1))
+	if name == "" || !ok {
+		return ErrProcLua("Usage: expirationd.start(name, space, is_tuple_expired, options)")
+	}
+
+	var o ExpirationOptions
+	stored := func(fn string) func(tuple []any) ([]any, error) {
+		return func(tuple []any) ([]any, error) {
+			return inst.call(&CallContext{Context: context.Background(), Instance: inst}, fn, []any{opts["args"], tuple})
+		}
+	}
+	if fn, ok := arg(args, 2).(string); ok {
+		call := stored(fn)
+		o.IsExpired = func(tuple []any) bool {
+			result, err := call(tuple)
+			if err != nil {
+				log.Warn().Err(err).Str("task", name).Msg("Expiration predicate failed")
+				return false
+			}
+			truth, known := sqlTruth(arg(result, 0))
+			return known && truth
+		}
+	}
+	if fn, ok := opts["process_expired_tuple"].(string); ok {
+		call := stored(fn)
+		o.Process = func(tuple []any) error {
+			_, err := call(tuple)
+			return err
+		}
+	}
+	switch field := opts["field"].(type) {
+	case nil:
+	case string:
+		if o.Field, ok = sp.fieldNo(field); !ok {
+			return ErrProcLua("expirationd: field '%s' doesn't exist in space '%s'", field, sp.Name)
+		}
+	default:
+		no, ok := uintArg([]any{field}, 0)
+		if !ok || no == 0 {
+			return ErrProcLua("expirationd: field must be a name or a number")
+		}
+		o.Field = no - 1
+	}
+
+	durations := map[string]*time.Duration{"ttl": &o.TTL, "full_scan_time": &o.FullScanTime,
+		"iteration_delay": &o.IterationDelay, "full_scan_delay": &o.FullScanDelay}
+	for key, d := range durations {
+		if v, ok := opts[key]; ok {
+			if *d, ok = seconds([]any{v}); !ok {
+				return ErrProcLua("expirationd: %s must be a non-negative number of seconds", key)
+			}
+		}
+	}
+	if v, ok := opts["tuples_per_iteration"]; ok {
+		n, ok := uintArg([]any{v}, 0)
+		if !ok || n == 0 {
+			return ErrProcLua("expirationd: tuples_per_iteration must be a positive number")
+		}
+		o.TuplesPerIteration = int(n)
+	}
+	return inst.StartExpiration(name, sp.Name, o)
+}
+
+// callSpace returns the space by id or name given to the call
+func (inst *Instance) callSpace(v any) (*Space, bool) {
+	if name, ok := v.(string); ok {
+		return inst.storage.SpaceByName(name)
+	}
+	id, ok := uintArg([]any{v}, 0)
+	if !ok {
+		return nil, false
+	}
+	return inst.storage.Space(id)
+}
+
+// StartExpiration starts the task expiring tuples of the space, the task with the same name is restarted
+func (inst *Instance) StartExpiration(name, space string, opts ExpirationOptions) error {
+	sp, ok := inst.storage.SpaceByName(space)
+	if !ok {
+		return ErrNoSuchSpace(space)
+	}
+	if opts.IsExpired == nil {
+		if opts.TTL <= 0 {
+			return ErrProcLua("expirationd: is_tuple_expired or ttl is required")
+		}
+		field, ttl := opts.Field, opts.TTL
+		opts.IsExpired = func(tuple []any) bool { return expiredByTTL(tupleField(tuple, field), ttl, inst.clock.Now()) }
+	}
+	if opts.TuplesPerIteration <= 0 {
+		opts.TuplesPerIteration = 1024
+	}
+	if opts.FullScanTime <= 0 {
+		opts.FullScanTime = time.Hour
+	}
+	if opts.IterationDelay <= 0 {
+		opts.IterationDelay = time.Second
+	}
+	if opts.FullScanDelay <= 0 {
+		opts.FullScanDelay = time.Second
+	}
+
+	e := inst.expirationd
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t := &expirationTask{name: name, space: sp.ID, opts: opts, started: inst.clock.Now(), done: make(chan struct{})}
+	if old, ok := e.tasks[name]; ok {
+		old.stop()
+		t.restarts = old.restarts + 1
+	}
+	var ctx context.Context
+	ctx, t.cancel = context.WithCancel(context.Background())
+	e.tasks[name] = t
+	go t.run(ctx, inst)
+	log.Info().Str("task", name).Str("space", sp.Name).Msg("Expiration task is started")
+	return nil
+}
+
+// KillExpiration stops the task
+func (inst *Instance) KillExpiration(name string) error {
+	e := inst.expirationd
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.tasks[name]
+	if !ok {
+		return ErrProcLua("Task '%s' doesn't exist", name)
+	}
+	t.stop()
+	delete(e.tasks, name)
+	return nil
+}
+
+// ExpirationStats returns statistics of the task
+func (inst *Instance) ExpirationStats(name string) (ExpirationStats, bool) {
+	e := inst.expirationd
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.tasks[name]
+	if !ok {
+		return ExpirationStats{}, false
+	}
+	return ExpirationStats{
+		CheckedCount: t.checked.Load(),
+		ExpiredCount: t.expired.Load(),
+		Restarts:     t.restarts,
+		WorkingTime:  inst.clock.Now().Sub(t.started),
+	}, true
+}
+
+func (s ExpirationStats) toMap() map[any]any {
+	return map[any]any{"checked_count": s.CheckedCount, "expired_count": s.ExpiredCount, "restarts": s.Restarts,
+		"working_time": uint64(s.WorkingTime / time.Second)}
+}
+
+// names returns sorted names of tasks
+func (e *expirationd) names() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := make([]string, 0, len(e.tasks))
+	for name := range e.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stopAll stops tasks when the instance is closed
+func (e *expirationd) stopAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for name, t := range e.tasks {
+		t.stop()
+		delete(e.tasks, name)
+	}
+}
+
+// stop cancels the task and waits till it's done
+func (t *expirationTask) stop() {
+	t.cancel()
+	<-t.done
+}
+
+func (t *expirationTask) run(ctx context.Context, inst *Instance) {
+	defer close(t.done)
+	for {
+		t.scan(ctx, inst)
+		if !t.sleep(ctx, inst.clock, t.opts.FullScanDelay) {
+			return
+		}
+	}
+}
+
+// scan checks tuples of the space by batches, expired ones are processed after each batch
+func (t *expirationTask) scan(ctx context.Context, inst *Instance) {
+	var (
+		iterator = ITER_ALL
+		key      []any
+		limit    = t.opts.TuplesPerIteration
+	)
+	for {
+		data, next, size, err := inst.storage.scanBatch(t.space, iterator, key, limit)
+		if err != nil {
+			log.Warn().Err(err).Str("task", t.name).Msg("Unable to scan the space of the expiration task")
+			return
+		}
+		if len(data) == 0 {
+			return
+		}
+		var expired [][]any
+		for _, d := range data {
+			tuple, _ := d.([]any)
+			t.checked.Add(1)
+			if t.opts.IsExpired(tuple) {
+				expired = append(expired, tuple)
+			}
+		}
+		if err := t.expire(inst, expired); err != nil {
+			log.Warn().Err(err).Str("task", t.name).Msg("Unable to expire tuples")
+		}
+		if len(data) < limit {
+			return
+		}
+		iterator, key = ITER_GT, next
+
+		// batches are spread over the full scan time
+		delay := time.Duration(int64(t.opts.FullScanTime) * int64(limit) / int64(size+1))
+		if delay > t.opts.IterationDelay {
+			delay = t.opts.IterationDelay
+		}
+		if !t.sleep(ctx, inst.clock, delay) {
+			return
+		}
+	}
+}
+
+// scanBatch selects tuples of the space by the primary key, it returns the key of the last one and the number
+// of tuples in the space
+func (s *Storage) scanBatch(id uint64, iterator uint64, key []any, limit int) ([]any, []any, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sp, err := s.space(id)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	pk, err := sp.index(0)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	data, err := pk.selectTuples(iterator, key, 0, uint64(limit))
+	if err != nil || len(data) == 0 {
+		return nil, nil, 0, err
+	}
+	return data, pk.extractKey(data[len(data)-1].([]any)), sp.Len(), nil
+}
+
+// expire processes expired tuples or deletes them by one transaction
+func (t *expirationTask) expire(inst *Instance, tuples [][]any) error {
+	if t.opts.Process == nil {
+		n, err := inst.storage.deleteUnchanged(t.space, tuples)
+		t.expired.Add(uint64(n))
+		return err
+	}
+	for _, tuple := range tuples {
+		if err := t.opts.Process(tuple); err != nil {
+			return err
+		}
+		t.expired.Add(1)
+	}
+	return nil
+}
+
+// sleep waits for the delay, it returns false if the task is stopped
+func (t *expirationTask) sleep(ctx context.Context, clock Clock, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-clock.After(d):
+		return ctx.Err() == nil
+	}
+}
+
+// expiredByTTL is true if the timestamp (unix time in seconds or datetime) is older than ttl
+func expiredByTTL(v any, ttl time.Duration, now time.Time) bool {
+	var ts time.Time
+	switch vv := v.(type) {
+	case Datetime:
+		ts = vv.Time
+	default:
+		if classOf(v) != mpClassNumber {
+			return false
+		}
+		seconds, _ := numberRat(v).Float64()
+		ts = time.Unix(0, int64(seconds*float64(time.Second)))
+	}
+	return !ts.Add(ttl).After(now)
+}
+
+// deleteUnchanged deletes tuples which are not changed since they were read by one transaction,
+// it returns the number of deleted tuples
+func (s *Storage) deleteUnchanged(id uint64, tuples [][]any) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	sp, err := s.space(id)
+	if err != nil || len(tuples) == 0 || sp.primary() == nil {
+		return 0, err
+	}
+	pk := sp.primary()
+	var reqs []any
+	for _, t := range tuples {
+		if current, _ := pk.find(t, false); current != nil && reflect.DeepEqual(current, t) {
+			reqs = append(reqs, &DeleteRequest{SpaceID: id, Key: pk.extractKey(t)})
+		}
+	}
+	if err := s.commit(nil, reqs, 0); err != nil {
+		return 0, err
+	}
+	return len(reqs), nil
+}
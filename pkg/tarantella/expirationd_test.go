@@ -0,0 +1,90 @@
+package tarantella
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpirationd(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	inst, err := NewInstance(&Config{DataDir: t.TempDir(), Clock: clock, Functions: map[string]Function{
+		"is_blocked": func(ctx *CallContext, args []any) ([]any, error) {
+			tuple, _ := arg(args, 1).([]any)
+			return []any{tupleField(tuple, 1) == arg(args, 0)}, nil
+		},
+	}})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	s := inst.storage
+
+	pk := []any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}}
+	sessions, err := s.createSpace("sessions", map[any]any{}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "touched", "type": "number"},
+	}, pk)
+	require.NoError(t, err)
+	limits, err := s.createSpace("limits", map[any]any{}, []any{}, pk)
+	require.NoError(t, err)
+	for i := uint64(1); i <= 5; i++ {
+		_, err = s.Execute(&InsertRequest{SpaceID: sessions.ID, Tuple: []any{i, now.Unix() - int64(i*20)}})
+		require.NoError(t, err)
+		state := "ok"
+		if i%2 == 0 {
+			state = "blocked"
+		}
+		_, err = s.Execute(&InsertRequest{SpaceID: limits.ID, Tuple: []any{i, state}})
+		require.NoError(t, err)
+	}
+	count := func(sp *Space) int {
+		data, err := s.Select(&SelectRequest{SpaceID: sp.ID, Iterator: ITER_ALL, Limit: 100})
+		require.NoError(t, err)
+		return len(data)
+	}
+	// tasks sleep on the fake clock, so it's moved till they catch up
+	eventually := func(condition func() bool) {
+		require.Eventually(t, func() bool {
+			clock.Advance(time.Second)
+			return condition()
+		}, 5*time.Second, time.Millisecond)
+	}
+
+	// sessions untouched for a minute are deleted in batches
+	_, err = inst.Call(ctx, "expirationd.start", []any{"sessions", "sessions", nil,
+		map[any]any{"field": "touched", "ttl": uint64(60), "tuples_per_iteration": uint64(2)}})
+	require.NoError(t, err)
+	eventually(func() bool { return count(sessions) <= 2 })
+	eventually(func() bool {
+		stats, ok := inst.ExpirationStats("sessions")
+		return ok && stats.ExpiredCount == 5 && count(sessions) == 0
+	})
+
+	// the stored predicate gets args and the tuple
+	_, err = inst.Call(ctx, "expirationd.start", []any{"limits", limits.ID, "is_blocked", map[any]any{"args": "blocked"}})
+	require.NoError(t, err)
+	eventually(func() bool {
+		data, err := inst.Call(ctx, "expirationd.stats", []any{"limits"})
+		require.NoError(t, err)
+		return data[0].(map[any]any)["expired_count"] == uint64(2) && count(limits) == 3
+	})
+
+	// a Go predicate replaces the task
+	require.NoError(t, inst.StartExpiration("limits", "limits", ExpirationOptions{
+		IsExpired: func(tuple []any) bool { return tupleField(tuple, 0) == uint64(1) },
+	}))
+	eventually(func() bool { return count(limits) == 2 })
+	stats, _ := inst.ExpirationStats("limits")
+	require.Equal(t, uint64(1), stats.Restarts)
+
+	data, err := inst.Call(ctx, "expirationd.tasks", nil)
+	require.NoError(t, err)
+	require.Equal(t, []any{"limits", "sessions"}, data[0])
+	_, err = inst.Call(ctx, "expirationd.kill", []any{"limits"})
+	require.NoError(t, err)
+	_, err = inst.Call(ctx, "expirationd.kill", []any{"limits"})
+	require.Equal(t, ER_PROC_LUA, err.(*BoxError).Code)
+}
@@ -0,0 +1,636 @@
+package tarantella
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// expressions of check constraints are a subset of SQL: fields of the space, NULL, TRUE, FALSE, numbers and
+// strings, arithmetic, ||, comparisons, IS [NOT] NULL, [NOT] IN, [NOT] LIKE, [NOT] BETWEEN, NOT, AND, OR and
+// functions LENGTH, CHAR_LENGTH, ABS, UPPER, LOWER, TRIM. Unquoted names are upper-cased like in SQL
+
+type (
+	// sqlExpr evaluates the expression on the tuple of the space, nil is NULL
+	sqlExpr func(sp *Space, tuple []any) any
+
+	sqlToken struct {
+		kind byte // 'n'umber, 's'tring, 'i'dentifier, 'q'uoted identifier, 'o'perator or 0 at the end
+		text string
+	}
+
+	sqlParser struct {
+		tokens []sqlToken
+		pos    int
+		fields func(name string) (uint64, bool) // resolves names of fields
+	}
+)
+
+// parseSQLExpr parses the expression resolving names of fields by the space format
+func parseSQLExpr(code string, sp *Space) (sqlExpr, error) {
+	tokens, err := sqlTokens(code)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens, fields: func(name string) (uint64, bool) { return sp.fieldNo(name) }}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != 0 {
+		return nil, fmt.Errorf("syntax error near '%s'", t.text)
+	}
+	return e, nil
+}
+
+func sqlTokens(code string) ([]sqlToken, error) { //nolint: cyclop
+	var tokens []sqlToken
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(code) && code[i+1] >= '0' && code[i+1] <= '9':
+			j := i
+			for j < len(code) && (code[j] >= '0' && code[j] <= '9' || code[j] == '.' ||
+				(code[j] == 'e' || code[j] == 'E') ||
+				(code[j] == '+' || code[j] == '-') && (code[j-1] == 'e' || code[j-1] == 'E')) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{'n', code[i:j]})
+			i = j
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(code); j++ {
+				if code[j] == c {
+					if j+1 < len(code) && code[j+1] == c {
+						b.WriteByte(c)
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(code[j])
+			}
+			if j >= len(code) {
+				return nil, fmt.Errorf("unrecognized token: '%s'", code[i:])
+			}
+			kind := byte('s')
+			if c == '"' {
+				kind = 'q'
+			}
+			tokens = append(tokens, sqlToken{kind, b.String()})
+			i = j + 1
+		case c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(code) {
+				r, size := utf8.DecodeRuneInString(code[j:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			tokens = append(tokens, sqlToken{'i', code[i:j]})
+			i = j
+		default:
+			op := code[i : i+1]
+			if i+1 < len(code) {
+				switch two := code[i : i+2]; two {
+				case "<=", ">=", "<>", "!=", "==", "||":
+					op = two
+				}
+			}
+			switch op {
+			case "(", ")", ",", "+", "-", "*", "/", "%", "||":
+			default:
+				if !sqlComparison(op) {
+					return nil, fmt.Errorf("unrecognized token: '%s'", op)
+				}
+			}
+			tokens = append(tokens, sqlToken{'o', op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func (p *sqlParser) peek() sqlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return sqlToken{}
+}
+
+// accept skips the operator or the keyword if it's next
+func (p *sqlParser) accept(text string) bool {
+	t := p.peek()
+	if t.kind == 'o' && t.text == text || t.kind == 'i' && strings.EqualFold(t.text, text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("syntax error near '%s', expected %s", p.peek().text, text)
+	}
+	return nil
+}
+
+func (p *sqlParser) or() (sqlExpr, error) {
+	left, err := p.and()
+	for err == nil && p.accept("OR") {
+		var right sqlExpr
+		if right, err = p.and(); err == nil {
+			left = sqlLogic(left, right, true)
+		}
+	}
+	return left, err
+}
+
+func (p *sqlParser) and() (sqlExpr, error) {
+	left, err := p.not()
+	for err == nil && p.accept("AND") {
+		var right sqlExpr
+		if right, err = p.not(); err == nil {
+			left = sqlLogic(left, right, false)
+		}
+	}
+	return left, err
+}
+
+func (p *sqlParser) not() (sqlExpr, error) {
+	if p.accept("NOT") {
+		e, err := p.not()
+		return sqlNot(e), err
+	}
+	return p.comparison()
+}
+
+func (p *sqlParser) comparison() (sqlExpr, error) { //nolint: cyclop
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == 'o' && sqlComparison(t.text):
+			p.pos++
+			right, err := p.sum()
+			if err != nil {
+				return nil, err
+			}
+			left = sqlCompareOp(t.text, left, right)
+			continue
+		case p.accept("IS"):
+			negate := p.accept("NOT")
+			if err := p.expect("NULL"); err != nil {
+				return nil, err
+			}
+			e := left
+			left = func(sp *Space, tuple []any) any { return (e(sp, tuple) == nil) != negate }
+			continue
+		}
+
+		negate := false
+		if t.kind == 'i' && strings.EqualFold(t.text, "NOT") {
+			negate = true
+			p.pos++
+		}
+		var e sqlExpr
+		switch {
+		case p.accept("IN"):
+			e, err = p.in(left)
+		case p.accept("LIKE"):
+			e, err = p.like(left)
+		case p.accept("BETWEEN"):
+			e, err = p.between(left)
+		case negate:
+			return nil, fmt.Errorf("syntax error near '%s'", p.peek().text)
+		default:
+			return left, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			e = sqlNot(e)
+		}
+		left = e
+	}
+}
+
+func (p *sqlParser) in(left sqlExpr) (sqlExpr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var list []sqlExpr
+	for {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return func(sp *Space, tuple []any) any {
+		v := left(sp, tuple)
+		if v == nil {
+			return nil
+		}
+		var result any = false
+		for _, e := range list {
+			c, ok := sqlCompare(v, e(sp, tuple))
+			if !ok {
+				result = nil
+			} else if c == 0 {
+				return true
+			}
+		}
+		return result
+	}, nil
+}
+
+func (p *sqlParser) like(left sqlExpr) (sqlExpr, error) {
+	pattern, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return func(sp *Space, tuple []any) any {
+		s, ok1 := left(sp, tuple).(string)
+		pat, ok2 := pattern(sp, tuple).(string)
+		if !ok1 || !ok2 {
+			return nil
+		}
+		return sqlLike([]rune(s), []rune(pat))
+	}, nil
+}
+
+func (p *sqlParser) between(left sqlExpr) (sqlExpr, error) {
+	lo, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("AND"); err != nil {
+		return nil, err
+	}
+	hi, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return sqlLogic(sqlCompareOp(">=", left, lo), sqlCompareOp("<=", left, hi), false), nil
+}
+
+func (p *sqlParser) sum() (sqlExpr, error) {
+	left, err := p.product()
+	for err == nil {
+		op := p.peek().text
+		if p.peek().kind != 'o' || op != "+" && op != "-" {
+			break
+		}
+		p.pos++
+		var right sqlExpr
+		if right, err = p.product(); err == nil {
+			left = sqlArithmetic(op, left, right)
+		}
+	}
+	return left, err
+}
+
+func (p *sqlParser) product() (sqlExpr, error) {
+	left, err := p.concat()
+	for err == nil {
+		op := p.peek().text
+		if p.peek().kind != 'o' || op != "*" && op != "/" && op != "%" {
+			break
+		}
+		p.pos++
+		var right sqlExpr
+		if right, err = p.concat(); err == nil {
+			left = sqlArithmetic(op, left, right)
+		}
+	}
+	return left, err
+}
+
+func (p *sqlParser) concat() (sqlExpr, error) {
+	left, err := p.unary()
+	for err == nil && p.accept("||") {
+		var right sqlExpr
+		if right, err = p.unary(); err == nil {
+			l, r := left, right
+			left = func(sp *Space, tuple []any) any {
+				a, ok1 := l(sp, tuple).(string)
+				b, ok2 := r(sp, tuple).(string)
+				if !ok1 || !ok2 {
+					return nil
+				}
+				return a + b
+			}
+		}
+	}
+	return left, err
+}
+
+func (p *sqlParser) unary() (sqlExpr, error) {
+	switch {
+	case p.accept("-"):
+		e, err := p.unary()
+		return func(sp *Space, tuple []any) any { return sqlNegate(e(sp, tuple)) }, err
+	case p.accept("+"):
+		return p.unary()
+	}
+	return p.primary()
+}
+
+func (p *sqlParser) primary() (sqlExpr, error) { //nolint: cyclop
+	t := p.peek()
+	p.pos++
+	constant := func(v any) (sqlExpr, error) { return func(*Space, []any) any { return v }, nil }
+	switch t.kind {
+	case 'n':
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return constant(i)
+		}
+		if u, err := strconv.ParseUint(t.text, 10, 64); err == nil {
+			return constant(u)
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unrecognized token: '%s'", t.text)
+		}
+		return constant(f)
+	case 's':
+		return constant(t.text)
+	case 'o':
+		if t.text == "(" {
+			e, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		}
+	case 'q':
+		return p.field(t.text, t.text)
+	case 'i':
+		switch name := strings.ToUpper(t.text); name {
+		case "NULL":
+			return constant(nil)
+		case "TRUE":
+			return constant(true)
+		case "FALSE":
+			return constant(false)
+		default:
+			if p.accept("(") {
+				return p.function(name)
+			}
+			return p.field(name, t.text)
+		}
+	}
+	return nil, fmt.Errorf("syntax error near '%s'", t.text)
+}
+
+// field refers to the field by the upper-cased name, the name as is is tried too
+func (p *sqlParser) field(name, orig string) (sqlExpr, error) {
+	no, ok := p.fields(name)
+	if !ok {
+		if no, ok = p.fields(orig); !ok {
+			return nil, ClientError(ER_SQL_CANT_RESOLVE_FIELD, name)
+		}
+	}
+	return func(sp *Space, tuple []any) any { return tupleField(tuple, no) }, nil
+}
+
+func (p *sqlParser) function(name string) (sqlExpr, error) {
+	arg, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	var fn func(v any) any
+	switch name {
+	case "LENGTH", "CHAR_LENGTH", "CHARACTER_LENGTH":
+		fn = func(v any) any {
+			switch s := v.(type) {
+			case string:
+				return int64(utf8.RuneCountInString(s))
+			case []byte:
+				return int64(len(s))
+			}
+			return nil
+		}
+	case "UPPER", "LOWER", "TRIM":
+		fn = func(v any) any {
+			s, ok := v.(string)
+			switch {
+			case !ok:
+				return nil
+			case name == "UPPER":
+				return strings.ToUpper(s)
+			case name == "LOWER":
+				return strings.ToLower(s)
+			}
+			return strings.TrimSpace(s)
+		}
+	case "ABS":
+		fn = func(v any) any {
+			if classOf(v) != mpClassNumber {
+				return nil
+			}
+			if compareNumbers(v, int64(0)) < 0 {
+				return sqlNegate(v)
+			}
+			return v
+		}
+	default:
+		return nil, fmt.Errorf("no such function: %s", name)
+	}
+	return func(sp *Space, tuple []any) any { return fn(arg(sp, tuple)) }, nil
+}
+
+// sqlTruth returns the truth of the value, known is false for NULL
+func sqlTruth(v any) (truth, known bool) {
+	switch vv := v.(type) {
+	case nil:
+		return false, false
+	case bool:
+		return vv, true
+	}
+	if classOf(v) == mpClassNumber {
+		return compareNumbers(v, int64(0)) != 0, true
+	}
+	return true, true
+}
+
+func sqlNot(e sqlExpr) sqlExpr {
+	return func(sp *Space, tuple []any) any {
+		truth, known := sqlTruth(e(sp, tuple))
+		if !known {
+			return nil
+		}
+		return !truth
+	}
+}
+
+// sqlLogic is OR or AND of three-valued logic
+func sqlLogic(left, right sqlExpr, or bool) sqlExpr {
+	return func(sp *Space, tuple []any) any {
+		l, lknown := sqlTruth(left(sp, tuple))
+		if lknown && l == or {
+			return or
+		}
+		r, rknown := sqlTruth(right(sp, tuple))
+		switch {
+		case rknown && r == or:
+			return or
+		case lknown && rknown:
+			return !or
+		}
+		return nil
+	}
+}
+
+// sqlCompare compares values, ok is false if any of them is NULL
+func sqlCompare(a, b any) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	return CompareValues(a, b), true
+}
+
+func sqlComparison(op string) bool {
+	switch op {
+	case "=", "==", "!=", "<>", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+func sqlCompareOp(op string, left, right sqlExpr) sqlExpr {
+	return func(sp *Space, tuple []any) any {
+		c, ok := sqlCompare(left(sp, tuple), right(sp, tuple))
+		if !ok {
+			return nil
+		}
+		switch op {
+		case "=", "==":
+			return c == 0
+		case "!=", "<>":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		}
+		return c >= 0
+	}
+}
+
+// sqlArithmetic calculates integers while they fit int64, floats otherwise; division by zero is NULL
+func sqlArithmetic(op string, left, right sqlExpr) sqlExpr {
+	return func(sp *Space, tuple []any) any {
+		a, b := left(sp, tuple), right(sp, tuple)
+		if classOf(a) != mpClassNumber || classOf(b) != mpClassNumber {
+			return nil
+		}
+		ka, ia, _, fa := normalizeNumber(a)
+		kb, ib, _, fb := normalizeNumber(b)
+		if ka == numberInt && kb == numberInt {
+			switch op {
+			case "+":
+				if r := ia + ib; (r > ia) == (ib > 0) {
+					return r
+				}
+			case "-":
+				if r := ia - ib; (r < ia) == (ib > 0) {
+					return r
+				}
+			case "*":
+				if r := ia * ib; ia == 0 || r/ia == ib && !(ia == -1 && ib == math.MinInt64) {
+					return r
+				}
+			case "/", "%":
+				if ib == 0 {
+					return nil
+				}
+				if op == "/" {
+					return ia / ib
+				}
+				return ia % ib
+			}
+		}
+		fa, fb = sqlFloat(ka, ia, fa, a), sqlFloat(kb, ib, fb, b)
+		switch op {
+		case "+":
+			return fa + fb
+		case "-":
+			return fa - fb
+		case "*":
+			return fa * fb
+		}
+		if fb == 0 {
+			return nil
+		}
+		if op == "/" {
+			return fa / fb
+		}
+		return math.Mod(fa, fb)
+	}
+}
+
+func sqlNegate(v any) any {
+	zero := func(*Space, []any) any { return int64(0) }
+	return sqlArithmetic("-", zero, func(*Space, []any) any { return v })(nil, nil)
+}
+
+// sqlFloat converts the normalized number to float64
+func sqlFloat(kind numberKind, i int64, f float64, v any) float64 {
+	switch kind {
+	case numberInt:
+		return float64(i)
+	case numberFloat:
+		return f
+	}
+	r, _ := numberRat(v).Float64()
+	return r
+}
+
+// sqlLike matches the string by the pattern of LIKE: % is any string, _ is any character
+func sqlLike(s, pattern []rune) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '%':
+			for i := 0; i <= len(s); i++ {
+				if sqlLike(s[i:], pattern[1:]) {
+					return true
+				}
+			}
+			return false
+		case '_':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		s, pattern = s[1:], pattern[1:]
+	}
+	return len(s) == 0
+}
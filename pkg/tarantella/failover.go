@@ -0,0 +1,109 @@
+package tarantella
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Instances of the replicaset started by one process may swap their roles by
+// tarantella.failover('host:port') called on any of them: the leader becomes read-only,
+// the chosen replica catches up with it and becomes writable, the others follow the new leader
+
+// failoverTimeout is how long the new leader may catch up with the old one
+const failoverTimeout = 10 * time.Second
+
+type (
+	// replicaset is a set of instances of one process
+	replicaset struct {
+		ctx     context.Context
+		mu      sync.Mutex
+		members []*Instance
+		leader  *Instance
+	}
+)
+
+// add makes tarantella.failover available on the instance, the first member is the leader
+func (rs *replicaset) add(inst *Instance) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.members = append(rs.members, inst)
+	if rs.leader == nil {
+		rs.leader = inst
+	}
+
+	inst.RegisterFunction("tarantella.failover", func(ctx *CallContext, args []any) ([]any, error) {
+		var addr string
+		if len(args) == 1 {
+			addr, _ = args[0].(string)
+		}
+		if addr == "" {
+			return nil, ErrIllegalParams("Usage: tarantella.failover('host:port')")
+		}
+		if err := rs.failover(ctx, addr); err != nil {
+			return nil, err
+		}
+		return []any{addr}, nil
+	})
+}
+
+// failover makes the member listening on addr the leader
+func (rs *replicaset) failover(ctx context.Context, addr string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	var leader *Instance
+	for _, inst := range rs.members {
+		if inst.cfg.ListenOn == addr {
+			leader = inst
+		}
+	}
+	switch {
+	case leader == nil:
+		return ErrIllegalParams("%s is not a member of the replicaset", addr)
+	case leader == rs.leader:
+		return nil
+	case leader.ID == 0:
+		return ErrIllegalParams("%s is an anonymous replica", addr)
+	}
+
+	// writes stop on the old leader, so its vclock is final
+	old := rs.leader
+	old.SetReadOnly(true)
+	if err := leader.catchUp(ctx, old.Vclock()); err != nil {
+		old.SetReadOnly(false)
+		return err
+	}
+
+	leader.follow(rs.ctx, "")
+	leader.SetReadOnly(false)
+	for _, inst := range rs.members {
+		if inst != leader {
+			inst.follow(rs.ctx, addr)
+		}
+	}
+	rs.leader = leader
+	log.Info().Str("old-leader", old.cfg.ListenOn).Str("leader", addr).Msg("Leader of the replicaset is changed")
+	return nil
+}
+
+// catchUp waits till the instance applies rows of the vclock
+func (inst *Instance) catchUp(ctx context.Context, vclock Vclock) error {
+	timeout := time.NewTimer(failoverTimeout)
+	defer timeout.Stop()
+	for {
+		changed := inst.wal.changed()
+		if inst.Vclock().Reached(vclock) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return ErrProcLua("%s hasn't caught up with vclock %s in %s", inst.cfg.ListenOn, vclock, failoverTimeout)
+		case <-changed:
+		}
+	}
+}
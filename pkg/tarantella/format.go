@@ -0,0 +1,163 @@
+package tarantella
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tuples are checked against the space format and index parts like tarantool does: the type of a field is the
+// narrowest one of the format and the parts, all fields are checked before required fields are looked for
+
+// namedField refers to a field in error messages like tarantool does for fields of the format: "2 (name)"
+type namedField struct {
+	no   uint64 // 1-based
+	name string
+}
+
+func (f namedField) String() string {
+	return fmt.Sprintf("%d (%s)", f.no, f.name)
+}
+
+// fieldRef returns the reference to the 0-based field for error messages
+func (sp *Space) fieldRef(no uint64) any {
+	if sp != nil && no < uint64(len(sp.Format)) {
+		return namedField{no: no + 1, name: sp.Format[no].Name}
+	}
+	return no + 1
+}
+
+// canonicalFieldType returns the field type without aliases
+func canonicalFieldType(typ string) string {
+	switch typ = strings.ToLower(typ); typ {
+	case "", "*":
+		return "any"
+	case "num":
+		return "number"
+	case "str":
+		return "string"
+	}
+	return typ
+}
+
+// fieldTypeContains reports whether values of the inner type are values of the outer one,
+// like field_type1_contains_type2 of tarantool
+func fieldTypeContains(outer, inner string) bool {
+	outer, inner = canonicalFieldType(outer), canonicalFieldType(inner)
+	if outer == inner || outer == "any" {
+		return true
+	}
+	switch outer {
+	case "scalar":
+		return inner != "array" && inner != "map" && inner != "interval"
+	case "number":
+		return inner == "unsigned" || inner == "integer" || inner == "double" || inner == "decimal"
+	case "integer":
+		return inner == "unsigned"
+	}
+	return false
+}
+
+// fieldType returns the type of the 0-based field, whether it's nullable and whether it's required
+func (sp *Space) fieldType(no uint64) (typ string, nullable, required bool) {
+	typ = "any"
+	parts := 0
+	partsNullable := true
+	if no < uint64(len(sp.Format)) {
+		f := sp.Format[no]
+		typ, nullable, required = f.Type, f.IsNullable, !f.IsNullable
+	}
+	for _, idx := range sp.Indexes {
+		if idx.keyFunc != nil {
+			continue
+		}
+		for _, p := range idx.Parts {
+			if p.Field != no || len(p.path) > 0 {
+				continue
+			}
+			if fieldTypeContains(typ, p.Type) {
+				typ = p.Type
+			}
+			parts++
+			partsNullable = partsNullable && p.IsNullable
+		}
+	}
+	if parts > 0 {
+		nullable = nullable || partsNullable
+		required = !nullable
+	}
+	return canonicalFieldType(typ), nullable, required
+}
+
+// checkTuple checks the tuple matches the format of the space and its indexed fields
+func (sp *Space) checkTuple(tuple []any) error {
+	if sp.FieldCount > 0 && uint64(len(tuple)) != sp.FieldCount {
+		return ClientError(ER_EXACT_FIELD_COUNT, len(tuple), sp.FieldCount)
+	}
+	for no, v := range tuple {
+		typ, nullable, _ := sp.fieldType(uint64(no))
+		if !fieldTypeMatches(typ, v) && !(v == nil && nullable) {
+			return ErrFieldType(sp.fieldRef(uint64(no)), typ, mpTypeName(v))
+		}
+	}
+	for no := uint64(len(tuple)); no < sp.maxRequiredField(); no++ {
+		if _, _, required := sp.fieldType(no); required {
+			return ErrFieldMissing(sp.fieldRef(no))
+		}
+	}
+	// values by JSON paths and keys of functions
+	for _, idx := range sp.Indexes {
+		if !idx.simple() {
+			if _, err := idx.keys(tuple); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// maxRequiredField returns the number of fields described by the format or indexes
+func (sp *Space) maxRequiredField() uint64 {
+	n := uint64(len(sp.Format))
+	for _, idx := range sp.Indexes {
+		if idx.keyFunc != nil {
+			continue
+		}
+		for _, p := range idx.Parts {
+			if p.Field >= n {
+				n = p.Field + 1
+			}
+		}
+	}
+	return n
+}
+
+// checkIndexParts checks types of index parts are compatible with the format and other indexes
+func (sp *Space) checkIndexParts(idx *Index) error {
+	if idx.keyFunc != nil {
+		return nil
+	}
+	for _, p := range idx.Parts {
+		if len(p.path) > 0 {
+			continue
+		}
+		if p.Field < uint64(len(sp.Format)) {
+			f := sp.Format[p.Field]
+			if !fieldTypeContains(f.Type, p.Type) && !fieldTypeContains(p.Type, f.Type) {
+				return ClientError(ER_FORMAT_MISMATCH_INDEX_PART, sp.fieldRef(p.Field),
+					canonicalFieldType(f.Type), canonicalFieldType(p.Type))
+			}
+		}
+		for _, other := range sp.Indexes {
+			if other.ID == idx.ID {
+				continue
+			}
+			for _, op := range other.Parts {
+				if op.Field == p.Field && len(op.path) == 0 && other.keyFunc == nil && !fieldTypeContains(op.Type, p.Type) && !fieldTypeContains(p.Type, op.Type) {
+					return ClientError(ER_INDEX_PART_TYPE_MISMATCH, sp.fieldRef(p.Field),
+						canonicalFieldType(op.Type), canonicalFieldType(p.Type))
+				}
+			}
+		}
+	}
+	return nil
+}
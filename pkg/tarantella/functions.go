@@ -0,0 +1,201 @@
+package tarantella
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+type (
+	// Function is a stored function called by IPROTO_CALL, it returns values of the call
+	Function func(ctx *CallContext, args []any) ([]any, error)
+
+	// CallContext is passed to stored functions
+	CallContext struct {
+		context.Context
+		Instance *Instance
+		Session  uint64 // id of the client session, 0 for calls made by the process
+	}
+)
+
+// RegisterFunction makes the function available for IPROTO_CALL
+func (inst *Instance) RegisterFunction(name string, fn Function) {
+	inst.functionsMu.Lock()
+	defer inst.functionsMu.Unlock()
+	inst.functions[name] = fn
+	delete(inst.blocking, name)
+}
+
+// RegisterBlockingFunction makes the function available for IPROTO_CALL, the function may wait long,
+// so a client call of it doesn't delay other requests of the connection
+func (inst *Instance) RegisterBlockingFunction(name string, fn Function) {
+	inst.functionsMu.Lock()
+	defer inst.functionsMu.Unlock()
+	inst.functions[name] = fn
+	inst.blocking[name] = true
+}
+
+// unregisterFunction removes the function
+func (inst *Instance) unregisterFunction(name string) {
+	inst.functionsMu.Lock()
+	defer inst.functionsMu.Unlock()
+	delete(inst.functions, name)
+	delete(inst.blocking, name)
+}
+
+// isBlocking is true if the function is registered by RegisterBlockingFunction
+func (inst *Instance) isBlocking(name string) bool {
+	inst.functionsMu.RLock()
+	defer inst.functionsMu.RUnlock()
+	return inst.blocking[name]
+}
+
+// Call calls the stored function, the session of the calling function is kept
+func (inst *Instance) Call(ctx context.Context, name string, args []any) ([]any, error) {
+	var session uint64
+	if cc, ok := ctx.(*CallContext); ok {
+		session = cc.Session
+	}
+	return inst.call(&CallContext{Context: ctx, Instance: inst, Session: session}, name, args)
+}
+
+func (inst *Instance) call(ctx *CallContext, name string, args []any) ([]any, error) {
+	inst.functionsMu.RLock()
+	fn, ok := inst.functions[name]
+	inst.functionsMu.RUnlock()
+	if !ok {
+		fn, ok = inst.sequenceFunction(name)
+	}
+	if !ok {
+		return nil, ErrNoSuchProc(name)
+	}
+	return fn(ctx, args)
+}
+
+func (inst *Instance) registerBuiltins() {
+	inst.RegisterFunction("box.info", func(ctx *CallContext, args []any) ([]any, error) {
+		return []any{ctx.Instance.Info()}, nil
+	})
+	inst.RegisterFunction("box.snapshot", func(ctx *CallContext, args []any) ([]any, error) {
+		if err := ctx.Instance.Snapshot(); err != nil {
+			return nil, newSystemError(err, "%s", err.Error())
+		}
+		return []any{"ok"}, nil
+	})
+	inst.RegisterFunction("box.schema.sequence.create", func(ctx *CallContext, args []any) ([]any, error) {
+		name, ok := arg(args, 0).(string)
+		if !ok {
+			return nil, ErrIllegalParams("Usage: box.schema.sequence.create(name, opts)")
+		}
+		opts, _ := arg(args, 1).(map[any]any)
+		seq, err := ctx.Instance.storage.CreateSequence(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []any{map[any]any{"id": seq.ID, "name": seq.Name, "step": intTuple(seq.Step), "min": intTuple(seq.Min),
+			"max": intTuple(seq.Max), "start": intTuple(seq.Start), "cache": intTuple(seq.Cache), "cycle": seq.Cycle}}, nil
+	})
+	inst.RegisterFunction("box.schema.func.create", func(ctx *CallContext, args []any) ([]any, error) {
+		name, ok := arg(args, 0).(string)
+		if !ok {
+			return nil, ErrIllegalParams("Usage: box.schema.func.create(name, opts)")
+		}
+		opts, _ := arg(args, 1).(map[any]any)
+		return nil, ctx.Instance.storage.createFunction(name, opts)
+	})
+	inst.RegisterFunction("box.cfg", func(ctx *CallContext, args []any) ([]any, error) {
+		return nil, ctx.Instance.configure(args)
+	})
+	inst.RegisterFunction("box.ctl.promote", func(ctx *CallContext, args []any) ([]any, error) {
+		return nil, ctx.Instance.Promote(ctx, 0)
+	})
+	inst.RegisterFunction("box.ctl.demote", func(ctx *CallContext, args []any) ([]any, error) {
+		return nil, ctx.Instance.Demote(ctx)
+	})
+	inst.RegisterFunction("tarantella.synchro_quorum_delay", func(ctx *CallContext, args []any) ([]any, error) {
+		seconds, ok := seconds(args)
+		if !ok {
+			return nil, ErrIllegalParams("Usage: tarantella.synchro_quorum_delay(seconds)")
+		}
+		ctx.Instance.SetSynchroQuorumDelay(seconds)
+		return nil, nil
+	})
+	registerCrud(inst, localCrud(inst))
+	inst.registerQueue()
+	inst.registerExpirationd()
+}
+
+// configure changes options at runtime like box.cfg{...}, read_only and replication_synchro_timeout
+// are supported
+func (inst *Instance) configure(args []any) error {
+	if len(args) == 0 {
+		return nil
+	}
+	opts, ok := args[0].(map[any]any)
+	if len(args) > 1 || !ok {
+		return ErrIllegalParams("Usage: box.cfg{key = value, ...}")
+	}
+	for key, value := range opts {
+		switch key {
+		case "read_only":
+			readOnly, ok := value.(bool)
+			if !ok {
+				return ErrProcLua("Incorrect value for option 'read_only': should be of type boolean")
+			}
+			inst.SetReadOnly(readOnly)
+		case "replication_synchro_timeout":
+			timeout, ok := seconds([]any{value})
+			if !ok {
+				return ErrProcLua("Incorrect value for option 'replication_synchro_timeout': should be of type number")
+			}
+			inst.SetSynchroTimeout(timeout)
+		default:
+			return ErrUnsupported("tarantella", fmt.Sprintf("box.cfg option %v", key))
+		}
+	}
+	return nil
+}
+
+// Info returns box.info of the instance
+func (inst *Instance) Info() map[any]any {
+	vclock := inst.Vclock()
+	return map[any]any{
+		"id":               inst.ID,
+		"uuid":             inst.UUID,
+		"lsn":              vclock[inst.ID],
+		"vclock":           vclock.toMap(),
+		"signature":        vclock.Signature(),
+		"status":           "running",
+		"ro":               inst.storage.isReadOnly(),
+		"pid":              uint64(os.Getpid()),
+		"uptime":           uint64(time.Since(inst.started).Seconds()),
+		"version":          versionString(),
+		"listen":           inst.cfg.ListenOn,
+		"replication":      inst.replicationInfo(),
+		"replication_anon": map[any]any{"count": inst.anonReplicas()},
+		"election":         inst.raft.info(),
+		"synchro":          inst.raft.synchroInfo(),
+		"gc": map[any]any{
+			"checkpoints": []any{map[any]any{"signature": inst.checkpointed}},
+		},
+	}
+}
+
+// seconds converts the only argument given in seconds into the duration
+func seconds(args []any) (time.Duration, bool) {
+	if len(args) != 1 {
+		return 0, false
+	}
+	switch v := args[0].(type) {
+	case uint64:
+		return time.Duration(v) * time.Second, true
+	case int64:
+		return time.Duration(v) * time.Second, v >= 0
+	case float64:
+		return time.Duration(v * float64(time.Second)), v >= 0
+	case float32:
+		return time.Duration(float64(v) * float64(time.Second)), v >= 0
+	}
+	return 0, false
+}
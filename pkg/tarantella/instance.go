@@ -0,0 +1,424 @@
+package tarantella
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+type (
+	// Instance is one emulated tarantool: storage, its durability and stored functions
+	Instance struct {
+		cfg     *Config
+		UUID    string
+		ID      uint64 // replica id
+		storage *Storage
+		wal     *wal
+		events  *events
+		raft    *raft
+		limbo   limbo
+		queue   *queue
+		started time.Time
+		clock   Clock
+
+		expirationd *expirationd
+
+		functionsMu sync.RWMutex
+		functions   map[string]Function
+		blocking    map[string]bool // functions which may wait long
+
+		sessions atomic.Uint64 // the last id of client sessions
+
+		checkpointMu sync.Mutex // one snapshot at a time
+		checkpointed uint64     // signature of the last snapshot
+
+		relaysMu sync.Mutex
+		relays   map[*relay]struct{} // replicas fed by the instance
+
+		applierMu sync.Mutex
+		applier   *applier // not nil if the instance follows a master
+	}
+)
+
+// NewInstance creates the instance recovering its data from DataDir, the new instance is bootstrapped
+// and its initial snapshot is written
+func NewInstance(cfg *Config) (*Instance, error) {
+	inst := &Instance{
+		cfg:       cfg,
+		ID:        1,
+		storage:   NewStorage(),
+		events:    newEvents(),
+		raft:      newRaft(),
+		queue:     newQueue(),
+		functions: make(map[string]Function),
+		blocking:  make(map[string]bool),
+		started:   time.Now(),
+		relays:    make(map[*relay]struct{}),
+		clock:     cfg.Clock,
+
+		expirationd: newExpirationd(),
+	}
+	if inst.clock == nil {
+		inst.clock = realClock{}
+	}
+	inst.registerBuiltins()
+	for name, fn := range cfg.Functions {
+		inst.RegisterFunction(name, fn)
+	}
+	inst.storage.callFunction = func(name string, args []any) ([]any, error) {
+		return inst.call(&CallContext{Context: context.Background(), Instance: inst}, name, args)
+	}
+	inst.SetSynchroQuorumDelay(cfg.SynchroQuorumDelay)
+	inst.SetSynchroTimeout(cfg.SynchroTimeout)
+	for _, t := range cfg.QueueTubes {
+		name, driver, _ := strings.Cut(t, ":")
+		if err := inst.CreateTube(name, driver, nil); err != nil {
+			return nil, errors.Wrapf(err, "unable to create tube %s", name)
+		}
+	}
+
+	mode := cfg.WalMode
+	if mode == "" {
+		mode = WalModeWrite
+	}
+	switch mode {
+	case WalModeNone, WalModeWrite, WalModeFsync:
+	default:
+		return nil, errors.Errorf("unknown wal mode '%s'", mode)
+	}
+
+	if cfg.ReplicationSource != "" {
+		inst.applier = newApplier(inst, cfg.ReplicationSource, !cfg.registered)
+		inst.storage.setReadOnly(true)
+	}
+
+	if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "unable to create data directory %s", cfg.DataDir)
+	}
+
+	vclock, bootstrapped, err := inst.recover()
+	if err != nil {
+		return nil, err
+	}
+	inst.wal = openWal(cfg.DataDir, mode, inst.UUID, inst.ID, vclock)
+	inst.storage.journal = inst.wal
+
+	if bootstrapped {
+		if err := inst.checkpoint(); err != nil {
+			return nil, err
+		}
+	}
+
+	inst.raft.restore(inst.ID)
+	inst.broadcastStatus()
+	inst.broadcastElection()
+
+	log.Info().Str("data-dir", cfg.DataDir).Str("wal-mode", mode).Str("uuid", inst.UUID).
+		Uint64("id", inst.ID).Stringer("vclock", vclock).Msg("Instance is recovered")
+	return inst, nil
+}
+
+// recover loads the last snapshot and replays logs written after it, it returns the vclock
+// of the last row; the instance is bootstrapped if there are no files
+func (inst *Instance) recover() (Vclock, bool, error) {
+	dir := inst.cfg.DataDir
+
+	snaps, err := listFiles(dir, snapSuffix)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to list snapshots")
+	}
+	xlogs, err := listFiles(dir, walSuffix)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to list logs")
+	}
+
+	if len(snaps) == 0 {
+		if len(xlogs) > 0 {
+			return nil, false, errors.Errorf("there is no snapshot in %s to replay logs from", dir)
+		}
+		inst.UUID = uuid.New().String()
+		if inst.applier != nil {
+			vclock, err := inst.applier.bootstrap(context.Background())
+			if err != nil {
+				return nil, false, err
+			}
+			// an anonymous replica has no id
+			inst.ID, _ = inst.storage.replicaID(inst.UUID)
+			return vclock, true, nil
+		}
+		inst.storage.bootstrapUserSpaces()
+		inst.storage.bootstrapSystemData(inst.UUID, uuid.New().String())
+		return Vclock{}, true, nil
+	}
+
+	vclock, err := inst.loadSnapshot(fileName(dir, snaps[len(snaps)-1], snapSuffix))
+	if err != nil {
+		return nil, false, err
+	}
+	inst.checkpointed = vclock.Signature()
+
+	for i, signature := range xlogs {
+		// skip logs which end before the snapshot
+		if i+1 < len(xlogs) && xlogs[i+1] <= inst.checkpointed {
+			continue
+		}
+		if err := inst.replay(fileName(dir, signature, walSuffix), vclock); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if id, ok := inst.storage.replicaID(inst.UUID); ok {
+		inst.ID = id
+	} else if inst.applier != nil {
+		inst.ID = 0
+	} else {
+		log.Warn().Str("uuid", inst.UUID).Msg("Instance is not registered in _cluster, id 1 is used")
+	}
+	return vclock, false, nil
+}
+
+// loadSnapshot applies rows of the snapshot, it returns the vclock of the snapshot
+func (inst *Instance) loadSnapshot(path string) (Vclock, error) {
+	x, err := openXlog(path, snapFiletype)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load snapshot")
+	}
+	defer x.close()
+
+	log.Info().Str("file", path).Str("version", x.meta.Version).Msg("Loading snapshot")
+	inst.UUID = x.meta.Instance
+	err = x.each(func(row *Row) error {
+		switch row.Type {
+		case IPROTO_RAFT_PROMOTE, IPROTO_RAFT_DEMOTE:
+			inst.raft.observe(row)
+		}
+		if !row.isDML() {
+			return nil // the election state is not kept
+		}
+		row.snapshot = true
+		return inst.storage.Apply(row)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load snapshot")
+	}
+	if !x.eof {
+		return nil, errors.Errorf("snapshot %s has no EOF marker", path)
+	}
+	return x.meta.Vclock, nil
+}
+
+// replay applies rows of the log which are not applied yet moving the vclock forward
+func (inst *Instance) replay(path string, vclock Vclock) error {
+	x, err := openXlog(path, xlogFiletype)
+	if err != nil {
+		return errors.Wrap(err, "unable to replay log")
+	}
+	defer x.close()
+
+	if x.meta.Instance != inst.UUID {
+		return errors.Errorf("%s: instance UUID mismatch, expected %s, got %s", path, inst.UUID, x.meta.Instance)
+	}
+	log.Info().Str("file", path).Msg("Replaying log")
+	return x.each(func(row *Row) error {
+		if row.LSN <= vclock[row.ReplicaID] {
+			return nil
+		}
+		switch row.Type {
+		case IPROTO_RAFT_PROMOTE, IPROTO_RAFT_DEMOTE:
+			inst.raft.observe(row)
+		}
+		if row.isDML() {
+			if err := inst.storage.Apply(row); err != nil {
+				return errors.Wrapf(err, "unable to apply row {%d: %d}", row.ReplicaID, row.LSN)
+			}
+		}
+		vclock[row.ReplicaID] = row.LSN
+		return nil
+	})
+}
+
+// Run follows the master and makes periodic snapshots till the context is done
+func (inst *Instance) Run(ctx context.Context) {
+	inst.applierMu.Lock()
+	if inst.applier != nil {
+		inst.applier.start(ctx)
+	}
+	inst.applierMu.Unlock()
+	if inst.cfg.CheckpointInterval <= 0 {
+		return
+	}
+	t := time.NewTicker(inst.cfg.CheckpointInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := inst.Snapshot(); err != nil {
+				log.Error().Err(err).Msg("Unable to make snapshot")
+			}
+		}
+	}
+}
+
+// Snapshot writes all spaces into the snapshot file, starts the new log and removes old files
+func (inst *Instance) Snapshot() error {
+	inst.checkpointMu.Lock()
+	defer inst.checkpointMu.Unlock()
+
+	if inst.wal.Vclock().Signature() == inst.checkpointed {
+		return nil
+	}
+	return inst.checkpoint()
+}
+
+func (inst *Instance) checkpoint() error {
+	s := inst.storage
+	dir := inst.cfg.DataDir
+
+	// the lock is held while rows are written, so the vclock and data are consistent
+	s.mu.RLock()
+	vclock := inst.wal.Vclock()
+	err := inst.wal.rotate()
+	if err == nil {
+		err = writeSnapshot(fileName(dir, vclock.Signature(), snapSuffix), inst.UUID, vclock, s.sortedSpaces(),
+			inst.raft.queueRows())
+	}
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	inst.checkpointed = vclock.Signature()
+	log.Info().Stringer("vclock", vclock).Msg("Snapshot is made")
+	return removeOldFiles(dir)
+}
+
+// writeSnapshot writes tuples of spaces as INSERT rows numbered from 1 like tarantool does and
+// the state of the synchronous queue after them, the file appears only when it's complete
+func writeSnapshot(path, instance string, vclock Vclock, spaces []*Space, synchro []*Row) error {
+	tmp := path + ".inprogress"
+	meta := &xlogMeta{Filetype: snapFiletype, Version: versionString(), Instance: instance, Vclock: vclock}
+	x, err := createXlog(tmp, meta)
+	if err != nil {
+		return errors.Wrap(err, "unable to create snapshot")
+	}
+	defer os.Remove(tmp) //nolint: errcheck
+
+	now := float64(time.Now().UnixNano()) / 1e9
+	var lsn uint64
+	for _, sp := range spaces {
+		if !sp.persistent() {
+			continue
+		}
+		for _, t := range sp.Tuples() {
+			lsn++
+			row := &Row{Type: IPROTO_INSERT, LSN: lsn, Timestamp: now,
+				Body: map[any]any{IPROTO_SPACE_ID: sp.ID, IPROTO_TUPLE: t}}
+			err := x.add(row)
+			if err == nil && x.pending() >= xlogBlockThreshold {
+				err = x.commit()
+			}
+			if err != nil {
+				x.close() //nolint: errcheck
+				return errors.Wrap(err, "unable to write snapshot")
+			}
+		}
+	}
+	for _, row := range synchro {
+		if err := x.add(row); err != nil {
+			x.close() //nolint: errcheck
+			return errors.Wrap(err, "unable to write snapshot")
+		}
+	}
+	if err := x.close(); err != nil {
+		return errors.Wrap(err, "unable to write snapshot")
+	}
+	return errors.Wrap(os.Rename(tmp, path), "unable to rename snapshot")
+}
+
+// removeOldFiles keeps checkpointCount snapshots and logs needed to recover from them
+func removeOldFiles(dir string) error {
+	snaps, err := listFiles(dir, snapSuffix)
+	if err != nil || len(snaps) <= checkpointCount {
+		return err
+	}
+	oldest := snaps[len(snaps)-checkpointCount]
+	for _, signature := range snaps[:len(snaps)-checkpointCount] {
+		os.Remove(fileName(dir, signature, snapSuffix)) //nolint: errcheck
+	}
+
+	xlogs, err := listFiles(dir, walSuffix)
+	if err != nil {
+		return err
+	}
+	for i, signature := range xlogs {
+		// the log is needed if it has rows after the oldest snapshot
+		if i+1 < len(xlogs) && xlogs[i+1] <= oldest {
+			os.Remove(fileName(dir, signature, walSuffix)) //nolint: errcheck
+		}
+	}
+	return nil
+}
+
+// gcVclock returns the vclock of the oldest snapshot, rows before it are collected
+func (inst *Instance) gcVclock() Vclock {
+	dir := inst.cfg.DataDir
+	if snaps, err := listFiles(dir, snapSuffix); err == nil && len(snaps) > 0 {
+		if x, err := openXlog(fileName(dir, snaps[0], snapSuffix), snapFiletype); err == nil {
+			defer x.close()
+			return x.meta.Vclock
+		}
+	}
+	return inst.Vclock()
+}
+
+// SetReadOnly switches the read-only mode like box.cfg{read_only = ...}, clients learn it by box.status
+func (inst *Instance) SetReadOnly(readOnly bool) {
+	inst.storage.setReadOnly(readOnly)
+	inst.broadcastStatus()
+	inst.broadcastElection()
+}
+
+// follow makes the instance a replica of the master, an empty source stops following
+func (inst *Instance) follow(ctx context.Context, source string) {
+	inst.applierMu.Lock()
+	defer inst.applierMu.Unlock()
+
+	if inst.applier != nil {
+		inst.applier.stop()
+		inst.applier = nil
+	}
+	if source != "" {
+		inst.applier = newApplier(inst, source, inst.ID == 0)
+		inst.applier.start(ctx)
+	}
+}
+
+// Close stops following the master and closes the log
+func (inst *Instance) Close() error {
+	inst.expirationd.stopAll()
+	inst.applierMu.Lock()
+	if inst.applier != nil {
+		inst.applier.stop()
+	}
+	inst.applierMu.Unlock()
+	return inst.wal.close()
+}
+
+// LSN returns LSN of the last row committed by the instance
+func (inst *Instance) LSN() uint64 {
+	return inst.wal.LSN()
+}
+
+// Vclock returns the vector clock of the instance
+func (inst *Instance) Vclock() Vclock {
+	return inst.wal.Vclock()
+}
@@ -102,3 +102,66 @@ var iproto_type = map[any]string{
 	uint64(128):            "IPROTO_CHUNK",
 	uint64(math.MaxUint64): "IPROTO_UNKNOWN",
 }
+
+var iproto_feature_id = map[any]string{
+	uint64(0): "IPROTO_FEATURE_STREAMS",
+	uint64(1): "IPROTO_FEATURE_TRANSACTIONS",
+	uint64(2): "IPROTO_FEATURE_ERROR_EXTENSION",
+	uint64(3): "IPROTO_FEATURE_WATCHERS",
+	uint64(4): "IPROTO_FEATURE_PAGINATION",
+}
+
+var mp_error = map[any]string{
+	uint64(0x00): "MP_ERROR_STACK",
+}
+
+var mp_error_details = map[any]string{
+	uint64(0x00): "MP_ERROR_TYPE",
+	uint64(0x01): "MP_ERROR_FILE",
+	uint64(0x02): "MP_ERROR_LINE",
+	uint64(0x03): "MP_ERROR_MESSAGE",
+	uint64(0x04): "MP_ERROR_ERRNO",
+	uint64(0x05): "MP_ERROR_CODE",
+	uint64(0x06): "MP_ERROR_FIELDS",
+}
+
+var iproto_metadata_key = map[any]string{
+	uint64(0): "IPROTO_FIELD_NAME",
+	uint64(1): "IPROTO_FIELD_TYPE",
+	uint64(2): "IPROTO_FIELD_COLL",
+	uint64(3): "IPROTO_FIELD_IS_NULLABLE",
+	uint64(4): "IPROTO_FIELD_IS_AUTOINCREMENT",
+	uint64(5): "IPROTO_FIELD_SPAN",
+}
+
+var sql_info_key = map[any]string{
+	uint64(0): "SQL_INFO_ROW_COUNT",
+	uint64(1): "SQL_INFO_AUTOINCREMENT_IDS",
+}
+
+var iproto_flag = map[any]string{
+	uint64(0x01): "IPROTO_FLAG_COMMIT",
+	uint64(0x02): "IPROTO_FLAG_WAIT_SYNC",
+	uint64(0x04): "IPROTO_FLAG_WAIT_ACK",
+}
+
+var iproto_ballot_key = map[any]string{
+	uint64(0x01): "IPROTO_BALLOT_IS_RO_CFG",
+	uint64(0x02): "IPROTO_BALLOT_VCLOCK",
+	uint64(0x03): "IPROTO_BALLOT_GC_VCLOCK",
+	uint64(0x04): "IPROTO_BALLOT_IS_RO",
+	uint64(0x05): "IPROTO_BALLOT_IS_ANON",
+	uint64(0x06): "IPROTO_BALLOT_IS_BOOTED",
+	uint64(0x07): "IPROTO_BALLOT_CAN_LEAD",
+	uint64(0x08): "IPROTO_BALLOT_BOOTSTRAP_LEADER_UUID",
+	uint64(0x09): "IPROTO_BALLOT_REGISTERED_REPLICA_UUIDS",
+}
+
+var iproto_raft_keys = map[any]string{
+	uint64(0): "IPROTO_RAFT_TERM",
+	uint64(1): "IPROTO_RAFT_VOTE",
+	uint64(2): "IPROTO_RAFT_STATE",
+	uint64(3): "IPROTO_RAFT_VCLOCK",
+	uint64(4): "IPROTO_RAFT_LEADER_ID",
+	uint64(5): "IPROTO_RAFT_IS_LEADER_SEEN",
+}
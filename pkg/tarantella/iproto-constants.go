@@ -241,3 +241,100 @@ const (
 	 */
 	IPROTO_UNKNOWN uint64 = math.MaxUint64
 )
+
+// from https://github.com/tarantool/tarantool/blob/5d658e7e1aceba1daef8491d321941f08bbd7cfd/src/box/iproto_features.h#L20
+// enum iproto_feature_id
+const (
+	/**
+	 * Streams support: IPROTO_STREAM_ID header key.
+	 */
+	IPROTO_FEATURE_STREAMS uint64 = 0
+	/**
+	 * Transactions in the protocol:
+	 * IPROTO_BEGIN, IPROTO_COMMIT, IPROTO_ROLLBACK commands.
+	 */
+	IPROTO_FEATURE_TRANSACTIONS uint64 = 1
+	/**
+	 * MP_ERROR MsgPack extension support.
+	 */
+	IPROTO_FEATURE_ERROR_EXTENSION uint64 = 2
+	/**
+	 * Remote watchers support:
+	 * IPROTO_WATCH, IPROTO_UNWATCH, IPROTO_EVENT commands.
+	 */
+	IPROTO_FEATURE_WATCHERS uint64 = 3
+	/**
+	 * Pagination support:
+	 * IPROTO_AFTER_POSITION, IPROTO_AFTER_TUPLE, IPROTO_FETCH_POSITION keys.
+	 */
+	IPROTO_FEATURE_PAGINATION uint64 = 4
+)
+
+// from https://github.com/tarantool/tarantool/blob/5d658e7e1aceba1daef8491d321941f08bbd7cfd/src/box/mp_error.cc#L57
+// enum mp_error
+const (
+	MP_ERROR_STACK uint64 = 0x00
+)
+
+// enum mp_error_details
+const (
+	MP_ERROR_TYPE    uint64 = 0x00
+	MP_ERROR_FILE    uint64 = 0x01
+	MP_ERROR_LINE    uint64 = 0x02
+	MP_ERROR_MESSAGE uint64 = 0x03
+	MP_ERROR_ERRNO   uint64 = 0x04
+	MP_ERROR_CODE    uint64 = 0x05
+	MP_ERROR_FIELDS  uint64 = 0x06
+)
+
+// from https://github.com/tarantool/tarantool/blob/5d658e7e1aceba1daef8491d321941f08bbd7cfd/src/box/iproto_constants.h#L290
+// enum iproto_metadata_key
+const (
+	IPROTO_FIELD_NAME             uint64 = 0
+	IPROTO_FIELD_TYPE             uint64 = 1
+	IPROTO_FIELD_COLL             uint64 = 2
+	IPROTO_FIELD_IS_NULLABLE      uint64 = 3
+	IPROTO_FIELD_IS_AUTOINCREMENT uint64 = 4
+	IPROTO_FIELD_SPAN             uint64 = 5
+)
+
+// from https://github.com/tarantool/tarantool/blob/5d658e7e1aceba1daef8491d321941f08bbd7cfd/src/box/execute.h#L45
+// enum sql_info_key
+const (
+	SQL_INFO_ROW_COUNT         uint64 = 0
+	SQL_INFO_AUTOINCREMENT_IDS uint64 = 1
+)
+
+// from https://github.com/tarantool/tarantool/blob/5d658e7e1aceba1daef8491d321941f08bbd7cfd/src/box/iproto_constants.h
+// enum iproto_flag
+const (
+	IPROTO_FLAG_COMMIT    uint64 = 0x01
+	IPROTO_FLAG_WAIT_SYNC uint64 = 0x02
+	IPROTO_FLAG_WAIT_ACK  uint64 = 0x04
+)
+
+// from https://github.com/tarantool/tarantool/blob/5d658e7e1aceba1daef8491d321941f08bbd7cfd/src/box/iproto_constants.h
+// enum iproto_ballot_key
+const (
+	IPROTO_BALLOT_IS_RO_CFG uint64 = 0x01
+	IPROTO_BALLOT_VCLOCK    uint64 = 0x02
+	IPROTO_BALLOT_GC_VCLOCK uint64 = 0x03
+	/** is_loading in old versions */
+	IPROTO_BALLOT_IS_RO                    uint64 = 0x04
+	IPROTO_BALLOT_IS_ANON                  uint64 = 0x05
+	IPROTO_BALLOT_IS_BOOTED                uint64 = 0x06
+	IPROTO_BALLOT_CAN_LEAD                 uint64 = 0x07
+	IPROTO_BALLOT_BOOTSTRAP_LEADER_UUID    uint64 = 0x08
+	IPROTO_BALLOT_REGISTERED_REPLICA_UUIDS uint64 = 0x09
+)
+
+// from https://github.com/tarantool/tarantool/blob/5d658e7e1aceba1daef8491d321941f08bbd7cfd/src/box/iproto_constants.h
+// enum iproto_raft_keys
+const (
+	IPROTO_RAFT_TERM           uint64 = 0
+	IPROTO_RAFT_VOTE           uint64 = 1
+	IPROTO_RAFT_STATE          uint64 = 2
+	IPROTO_RAFT_VCLOCK         uint64 = 3
+	IPROTO_RAFT_LEADER_ID      uint64 = 4
+	IPROTO_RAFT_IS_LEADER_SEEN uint64 = 5
+)
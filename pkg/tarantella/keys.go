@@ -0,0 +1,319 @@
+package tarantella
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keys of indexes: a part refers to a field or to a value inside it by a JSON path, [*] in the path makes
+// the index multikey, so a tuple has a key for each element of the array; a functional index takes keys
+// from a function registered by the instance, its parts refer to fields of the returned key
+
+// pathToken is a step of a JSON path: a map key, a 1-based array index or [*]
+type pathToken struct {
+	key   string
+	index uint64
+	any   bool
+}
+
+func (t pathToken) String() string {
+	switch {
+	case t.any:
+		return "[*]"
+	case t.index > 0:
+		return fmt.Sprintf("[%d]", t.index)
+	}
+	return fmt.Sprintf("[%q]", t.key)
+}
+
+// parsePath parses JSON path like .user.id, [2].name, ["key"] or .tags[*]
+func parsePath(path string) ([]pathToken, error) {
+	var tokens []pathToken
+	for pos := 0; pos < len(path); {
+		switch c := path[pos]; {
+		case c == '[':
+			end := strings.IndexByte(path[pos:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path '%s'", path)
+			}
+			inner := path[pos+1 : pos+end]
+			switch {
+			case inner == "*":
+				tokens = append(tokens, pathToken{any: true})
+			case len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0]:
+				tokens = append(tokens, pathToken{key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.ParseUint(inner, 10, 64)
+				if err != nil || n == 0 {
+					return nil, fmt.Errorf("invalid JSON path '%s'", path)
+				}
+				tokens = append(tokens, pathToken{index: n})
+			}
+			pos += end + 1
+		case c == '.' || pos == 0:
+			if c == '.' {
+				pos++
+			}
+			end := strings.IndexAny(path[pos:], ".[")
+			if end < 0 {
+				end = len(path) - pos
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid JSON path '%s'", path)
+			}
+			tokens = append(tokens, pathToken{key: path[pos : pos+end]})
+			pos += end
+		default:
+			return nil, fmt.Errorf("invalid JSON path '%s'", path)
+		}
+	}
+	return tokens, nil
+}
+
+// walk returns the value by the path, nil if there is no such value
+func walk(v any, path []pathToken) any {
+	for _, t := range path {
+		switch vv := v.(type) {
+		case map[any]any:
+			if t.index > 0 {
+				v = vv[t.index]
+			} else {
+				v = vv[t.key]
+			}
+		case []any:
+			if t.index == 0 || t.index > uint64(len(vv)) {
+				return nil
+			}
+			v = vv[t.index-1]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// multikeyAt returns the position of [*] in the path, -1 if there is none
+func multikeyAt(path []pathToken) int {
+	for i, t := range path {
+		if t.any {
+			return i
+		}
+	}
+	return -1
+}
+
+// value returns the value of the part in the tuple, for functional indexes the tuple is the key of the function
+func (p *IndexPart) value(tuple []any) any {
+	v := tupleField(tuple, p.Field)
+	if len(p.path) > 0 {
+		v = walk(v, p.path)
+	}
+	return v
+}
+
+// pathRef refers to a value by JSON path in error messages, it's not quoted unlike field names
+type pathRef string
+
+// ref returns the reference to the value of the part for error messages like [3]["user"]["id"]
+func (p *IndexPart) ref(sp *Space) any {
+	if len(p.path) == 0 {
+		return sp.fieldRef(p.Field)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%d]", p.Field+1)
+	for _, t := range p.path {
+		b.WriteString(t.String())
+	}
+	return pathRef(b.String())
+}
+
+// fieldPath splits a field name like data.user.id into the field and the path
+func (sp *Space) fieldPath(name string) (uint64, string, bool) {
+	if no, ok := sp.fieldNo(name); ok {
+		return no, "", true
+	}
+	if i := strings.IndexAny(name, ".["); i > 0 {
+		if no, ok := sp.fieldNo(name[:i]); ok {
+			return no, name[i:], true
+		}
+	}
+	return 0, "", false
+}
+
+// simple is true if parts of the index are fields of the tuple
+func (idx *Index) simple() bool {
+	if idx.keyFunc != nil || idx.Type == "RTREE" {
+		return false
+	}
+	for _, p := range idx.Parts {
+		if len(p.path) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// keys returns comparison keys of the tuple: values of the parts followed by primary key parts of
+// non-unique indexes, several ones for multikey and functional indexes
+func (idx *Index) keys(tuple []any) ([][]any, error) {
+	heads, err := idx.heads(tuple)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([][]any, 0, len(heads))
+	for _, head := range heads {
+		key := make([]any, len(idx.cmp))
+		copy(key, head)
+		for i := len(head); i < len(idx.cmp); i++ {
+			key[i] = idx.cmp[i].value(tuple)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// heads returns values of the index parts of the tuple, equal keys of a multikey index are merged
+func (idx *Index) heads(tuple []any) ([][]any, error) {
+	switch {
+	case idx.keyFunc != nil:
+		return idx.functionalKeys(tuple)
+	case idx.multikey:
+		return idx.multikeys(tuple)
+	}
+	head := make([]any, len(idx.Parts))
+	for i := range idx.Parts {
+		p := &idx.Parts[i]
+		head[i] = p.value(tuple)
+		if err := p.check(head[i], idx.space); err != nil {
+			return nil, err
+		}
+	}
+	if !idx.ordered() {
+		// entries of RTREE and BITSET indexes are sorted by the primary key
+		if idx.Type == "RTREE" {
+			if _, err := idx.rect(head[0], "Field"); err != nil {
+				return nil, err
+			}
+		}
+		return [][]any{{}}, nil
+	}
+	return [][]any{head}, nil
+}
+
+// check checks the value of the part
+func (p *IndexPart) check(v any, sp *Space) error {
+	switch {
+	case v == nil && p.IsNullable:
+		return nil
+	case v == nil && len(p.path) > 0:
+		return ErrFieldMissing(p.ref(sp))
+	case !fieldTypeMatches(p.Type, v):
+		return ErrFieldType(p.ref(sp), p.Type, mpTypeName(v))
+	}
+	return nil
+}
+
+func (idx *Index) multikeys(tuple []any) ([][]any, error) {
+	// all multikey parts of tarantool share the array, it's taken by the first one
+	var (
+		array []any
+		found bool
+	)
+	for i := range idx.Parts {
+		p := &idx.Parts[i]
+		if at := multikeyAt(p.path); at >= 0 {
+			v := walk(tupleField(tuple, p.Field), p.path[:at])
+			if v == nil {
+				return nil, nil
+			}
+			if array, found = v.([]any); !found {
+				prefix := IndexPart{Field: p.Field, path: p.path[:at]}
+				return nil, ErrFieldType(prefix.ref(idx.space), "array", mpTypeName(v))
+			}
+			break
+		}
+	}
+
+	var heads [][]any
+next:
+	for _, elem := range array {
+		head := make([]any, len(idx.Parts))
+		for i := range idx.Parts {
+			p := &idx.Parts[i]
+			if at := multikeyAt(p.path); at >= 0 {
+				head[i] = walk(elem, p.path[at+1:])
+			} else {
+				head[i] = p.value(tuple)
+			}
+			if err := p.check(head[i], idx.space); err != nil {
+				return nil, err
+			}
+		}
+		for _, prev := range heads {
+			if idx.compareWithKey(prev, head) == 0 {
+				continue next
+			}
+		}
+		heads = append(heads, head)
+	}
+	return heads, nil
+}
+
+func (idx *Index) functionalKeys(tuple []any) ([][]any, error) {
+	keys, err := idx.keyFunc(tuple)
+	if err != nil {
+		return nil, err
+	}
+	heads := make([][]any, 0, len(keys))
+	for _, key := range keys {
+		if len(key) != len(idx.Parts) {
+			return nil, ClientError(ER_FUNC_INDEX_FORMAT, idx.Name, idx.space.Name,
+				fmt.Sprintf("Invalid key part count (expected %d, got %d)", len(idx.Parts), len(key)))
+		}
+		for i, p := range idx.Parts {
+			if !fieldTypeMatches(p.Type, key[i]) && !(key[i] == nil && p.IsNullable) {
+				return nil, ClientError(ER_FUNC_INDEX_FORMAT, idx.Name, idx.space.Name,
+					fmt.Sprintf("Supplied key type of part %d does not match index part type: expected %s", i, p.Type))
+			}
+		}
+		heads = append(heads, key)
+	}
+	return heads, nil
+}
+
+// keyFunction returns keys of the functional index by the function of _func, the function is looked up
+// when it's called as _index is recovered before _func; the function must not touch the storage
+func (s *Storage) keyFunction(idx *Index, id uint64) func(tuple []any) ([][]any, error) {
+	return func(tuple []any) ([][]any, error) {
+		var fn []any
+		if sp, ok := s.spaces[BOX_FUNC_ID]; ok {
+			fn, _ = sp.get(0, []any{id})
+		}
+		name, _ := tupleField(fn, 2).(string)
+		if fn == nil || s.callFunction == nil {
+			return nil, ClientError(ER_FUNC_INDEX_FUNC, idx.Name, idx.space.Name, fmt.Sprintf("function %d does not exist", id))
+		}
+		ret, err := s.callFunction(name, []any{tuple})
+		if err != nil {
+			return nil, ClientError(ER_FUNC_INDEX_FUNC, idx.Name, idx.space.Name, err.Error())
+		}
+		key, ok := arg(ret, 0).([]any)
+		if !ok {
+			return nil, ClientError(ER_FUNC_INDEX_FORMAT, idx.Name, idx.space.Name, "Supplied key type is invalid: expected array")
+		}
+		opts, _ := tupleField(fn, 15).(map[any]any)
+		if multikey, _ := opts["is_multikey"].(bool); !multikey {
+			return [][]any{key}, nil
+		}
+		keys := make([][]any, 0, len(key))
+		for _, k := range key {
+			k, ok := k.([]any)
+			if !ok {
+				return nil, ClientError(ER_FUNC_INDEX_FORMAT, idx.Name, idx.space.Name, "Supplied key type is invalid: expected array")
+			}
+			keys = append(keys, k)
+		}
+		return keys, nil
+	}
+}
@@ -0,0 +1,99 @@
+package tarantella
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	cfg := &Config{DataDir: dir, Functions: map[string]Function{
+		"lower_name": func(ctx *CallContext, args []any) ([]any, error) {
+			name, _ := tupleField(arg(args, 0).([]any), 1).(string)
+			return []any{[]any{strings.ToLower(name)}}, nil
+		},
+	}}
+	inst, err := NewInstance(cfg)
+	require.NoError(t, err)
+	s := inst.storage
+	_, err = inst.Call(ctx, "box.schema.func.create", []any{"lower_name", map[any]any{"is_deterministic": true, "is_sandboxed": true}})
+	require.NoError(t, err)
+
+	sp, err := s.createSpace("docs", map[any]any{}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "name", "type": "string"},
+		map[any]any{"name": "data", "type": "map"},
+	},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}},
+		[]any{1, "user", "tree", map[any]any{"unique": true}, []any{map[any]any{"field": "data.user.id", "type": "unsigned"}}},
+		[]any{2, "tags", "tree", map[any]any{"unique": false}, []any{map[any]any{"field": uint64(2), "path": ".tags[*]", "type": "string"}}},
+		[]any{3, "lower", "tree", map[any]any{"unique": true, "func": "lower_name"}, []any{[]any{0, "string"}}},
+	)
+	require.NoError(t, err)
+	insert := func(tuple ...any) error {
+		_, err := s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: tuple})
+		return err
+	}
+	ids := func(index uint64, key ...any) []any {
+		data, err := s.Select(&SelectRequest{SpaceID: sp.ID, IndexID: index, Key: key, Limit: 10})
+		require.NoError(t, err)
+		var ids []any
+		for _, t := range data {
+			ids = append(ids, t.([]any)[0])
+		}
+		return ids
+	}
+	doc := func(user uint64, tags ...any) map[any]any {
+		return map[any]any{"user": map[any]any{"id": user}, "tags": tags}
+	}
+
+	require.NoError(t, insert(uint64(1), "Alice", doc(10, "a", "b", "a")))
+	require.NoError(t, insert(uint64(2), "Bob", doc(20, "b", "c")))
+	require.NoError(t, insert(uint64(3), "Carol", doc(30)))
+
+	require.Equal(t, []any{uint64(2)}, ids(1, uint64(20)))
+	require.Equal(t, []any{uint64(1), uint64(2)}, ids(2, "b"))
+	require.Equal(t, []any{uint64(1), uint64(1), uint64(2), uint64(2)}, ids(2))
+	require.Equal(t, []any{uint64(3)}, ids(3, "carol"))
+
+	// unique keys are checked by paths and functions, values are checked by paths
+	err = insert(uint64(4), "Dave", doc(10))
+	require.Equal(t, ER_TUPLE_FOUND, err.(*BoxError).Code)
+	err = insert(uint64(4), "ALICE", doc(40))
+	require.Equal(t, ER_TUPLE_FOUND, err.(*BoxError).Code)
+	err = insert(uint64(4), "Dave", map[any]any{"user": map[any]any{}})
+	require.EqualError(t, err, `Tuple field [3]["user"]["id"] required by space format is missing`)
+	err = insert(uint64(4), "Dave", map[any]any{"user": map[any]any{"id": uint64(40)}, "tags": "d"})
+	require.EqualError(t, err, `Tuple field [3]["tags"] type does not match one required by operation: expected array, got string`)
+
+	// entries of the replaced tuple are replaced
+	_, err = s.Execute(&InsertRequest{Replace: true, SpaceID: sp.ID, Tuple: []any{uint64(2), "Bob", doc(20, "d")}})
+	require.NoError(t, err)
+	require.Equal(t, []any{uint64(1)}, ids(2, "b"))
+	require.Equal(t, []any{uint64(2)}, ids(2, "d"))
+
+	fn, err := s.functionID("lower_name")
+	require.NoError(t, err)
+	_, err = s.Execute(&DeleteRequest{SpaceID: BOX_FUNC_ID, Key: []any{fn}})
+	require.Equal(t, ER_DROP_FUNCTION, err.(*BoxError).Code)
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{sp.ID, uint64(4), "tags_unique", "tree", map[any]any{},
+		[]any{map[any]any{"field": uint64(2), "path": ".tags[*]", "type": "string"}}}})
+	require.NoError(t, err)
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{sp.ID, uint64(5), "tags_hash", "hash", map[any]any{},
+		[]any{map[any]any{"field": uint64(2), "path": ".tags[*]", "type": "string"}}}})
+	require.Equal(t, ER_MODIFY_INDEX, err.(*BoxError).Code)
+
+	// the functional index is recovered with the function of the config
+	require.NoError(t, inst.Close())
+	inst, err = NewInstance(cfg)
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	data, err := inst.storage.Select(&SelectRequest{SpaceID: sp.ID, IndexID: 3, Key: []any{"bob"}, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, []any{[]any{uint64(2), "Bob", doc(20, "d")}}, data)
+}
@@ -0,0 +1,649 @@
+package tarantella
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// see https://www.tarantool.io/en/doc/latest/dev_guide/internals/msgpack_extensions/
+
+// MP_EXT types of tarantool
+const (
+	mpExtDecimal  int8 = 1
+	mpExtUUID     int8 = 2
+	mpExtError    int8 = 3
+	mpExtDatetime int8 = 4
+	mpExtInterval int8 = 6
+)
+
+type (
+	// MpExtValue is implemented by values encoded as MP_EXT
+	MpExtValue interface {
+		mpExt() (int8, []byte)
+	}
+
+	// MpExt is MP_EXT value of the unknown type, kept as is
+	MpExt struct {
+		Type int8
+		Data []byte
+	}
+
+	// Decimal is a fixed point number, value is Unscaled * 10^-Scale
+	Decimal struct {
+		Unscaled *big.Int
+		Scale    int32
+	}
+
+	// Datetime is tarantool datetime value
+	Datetime struct {
+		Time    time.Time
+		TzIndex int16 // index of the timezone in tarantool timezone table, 0 if not known
+	}
+
+	// Interval is tarantool datetime.interval value
+	Interval struct {
+		Year   int64  `json:"year,omitempty" yaml:"year,omitempty"`
+		Month  int64  `json:"month,omitempty" yaml:"month,omitempty"`
+		Week   int64  `json:"week,omitempty" yaml:"week,omitempty"`
+		Day    int64  `json:"day,omitempty" yaml:"day,omitempty"`
+		Hour   int64  `json:"hour,omitempty" yaml:"hour,omitempty"`
+		Min    int64  `json:"min,omitempty" yaml:"min,omitempty"`
+		Sec    int64  `json:"sec,omitempty" yaml:"sec,omitempty"`
+		Nsec   int64  `json:"nsec,omitempty" yaml:"nsec,omitempty"`
+		Adjust string `json:"adjust,omitempty" yaml:"adjust,omitempty"` // none (default), excess or last
+	}
+)
+
+// interval fields, see src/lib/core/mp_interval.c
+const (
+	intervalYear uint64 = iota
+	intervalMonth
+	intervalWeek
+	intervalDay
+	intervalHour
+	intervalMin
+	intervalSec
+	intervalNsec
+	intervalAdjust
+)
+
+// adjust values of interval, DT_EXCESS, DT_LIMIT and DT_SNAP
+var intervalAdjusts = []string{"excess", "none", "last"}
+
+// decodeExtValue decodes MP_EXT of the type
+func decodeExtValue(typ int8, data []byte) (any, error) {
+	switch typ {
+	case mpExtDecimal:
+		return unpackDecimal(data)
+	case mpExtUUID:
+		return uuid.FromBytes(data)
+	case mpExtError:
+		return unpackError(data)
+	case mpExtDatetime:
+		return unpackDatetime(data)
+	case mpExtInterval:
+		return unpackInterval(data)
+	default:
+		return MpExt{Type: typ, Data: append([]byte{}, data...)}, nil
+	}
+}
+
+func (ext MpExt) mpExt() (int8, []byte) {
+	return ext.Type, ext.Data
+}
+
+// NewDecimal creates decimal value * 10^-scale
+func NewDecimal(value int64, scale int32) Decimal {
+	return Decimal{Unscaled: big.NewInt(value), Scale: scale}
+}
+
+// ParseDecimal parses decimal from string like "-12.345"
+func ParseDecimal(s string) (Decimal, error) {
+	digits := strings.TrimSpace(s)
+	var scale int32
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		scale = int32(len(digits) - i - 1)
+		digits = digits[:i] + digits[i+1:]
+	}
+	n, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, errors.Errorf("invalid decimal '%s'", s)
+	}
+	return Decimal{Unscaled: n, Scale: scale}, nil
+}
+
+// String formats decimal without exponent
+func (d Decimal) String() string {
+	if d.Unscaled == nil {
+		return "0"
+	}
+	sign := ""
+	digits := new(big.Int).Abs(d.Unscaled).String()
+	if d.Unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if d.Scale <= 0 {
+		return sign + digits + strings.Repeat("0", int(-d.Scale))
+	}
+	if len(digits) <= int(d.Scale) {
+		digits = strings.Repeat("0", int(d.Scale)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(d.Scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Rat returns decimal as rational number
+func (d Decimal) Rat() *big.Rat {
+	r := new(big.Rat)
+	if d.Unscaled == nil {
+		return r
+	}
+	r.SetInt(d.Unscaled)
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs32(d.Scale))), nil)
+	if d.Scale > 0 {
+		return r.Quo(r, new(big.Rat).SetInt(pow))
+	}
+	return r.Mul(r, new(big.Rat).SetInt(pow))
+}
+
+// Cmp compares decimals by value
+func (d Decimal) Cmp(other Decimal) int {
+	return d.Rat().Cmp(other.Rat())
+}
+
+func abs32(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// mpExt packs decimal: scale as MP_INT followed by packed BCD with the sign nibble
+func (d Decimal) mpExt() (int8, []byte) {
+	e := &mpEncoder{}
+	e.encodeInt(int64(d.Scale))
+
+	digits := "0"
+	negative := false
+	if d.Unscaled != nil {
+		digits = new(big.Int).Abs(d.Unscaled).String()
+		negative = d.Unscaled.Sign() < 0
+	}
+	nibbles := make([]byte, 0, len(digits)+2)
+	if len(digits)%2 == 0 {
+		nibbles = append(nibbles, 0)
+	}
+	for _, c := range []byte(digits) {
+		nibbles = append(nibbles, c-'0')
+	}
+	if negative {
+		nibbles = append(nibbles, 0x0d)
+	} else {
+		nibbles = append(nibbles, 0x0c)
+	}
+	for i := 0; i < len(nibbles); i += 2 {
+		e.writeByte(nibbles[i]<<4 | nibbles[i+1])
+	}
+	return mpExtDecimal, e.buf
+}
+
+func unpackDecimal(data []byte) (Decimal, error) {
+	d := &mpDecoder{buf: data}
+	s, err := d.decodeAny()
+	if err != nil {
+		return Decimal{}, errors.Wrap(err, "unable to decode decimal scale")
+	}
+	var scale int64
+	switch v := s.(type) {
+	case uint64:
+		scale = int64(v)
+	case int64:
+		scale = v
+	default:
+		return Decimal{}, errors.Errorf("invalid decimal scale %#v", s)
+	}
+
+	bcd := data[d.pos:]
+	if len(bcd) == 0 {
+		return Decimal{}, errors.New("decimal has no digits")
+	}
+	sb := strings.Builder{}
+	for i, b := range bcd {
+		sb.WriteByte('0' + b>>4)
+		if i < len(bcd)-1 {
+			sb.WriteByte('0' + b&0x0f)
+		}
+	}
+	n, ok := new(big.Int).SetString(sb.String(), 10)
+	if !ok {
+		return Decimal{}, errors.Errorf("invalid decimal digits %x", bcd)
+	}
+	if sign := bcd[len(bcd)-1] & 0x0f; sign == 0x0b || sign == 0x0d {
+		n.Neg(n)
+	}
+	return Decimal{Unscaled: n, Scale: int32(scale)}, nil
+}
+
+// NewDatetime makes datetime from the time
+func NewDatetime(t time.Time) Datetime {
+	return Datetime{Time: t}
+}
+
+// String formats datetime like RFC3339 with nanoseconds
+func (dt Datetime) String() string {
+	return dt.Time.Format(time.RFC3339Nano)
+}
+
+// pack returns seconds (int64), and optionally nsec (int32), tzoffset (int16) and tzindex (int16), little-endian
+func (dt Datetime) pack() []byte {
+	_, offset := dt.Time.Zone()
+	nsec := dt.Time.Nanosecond()
+
+	buf := binary.LittleEndian.AppendUint64(nil, uint64(dt.Time.Unix()))
+	if nsec != 0 || offset != 0 || dt.TzIndex != 0 {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(int32(nsec)))
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(int16(offset/60)))
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(dt.TzIndex))
+	}
+	return buf
+}
+
+func (dt Datetime) mpExt() (int8, []byte) {
+	return mpExtDatetime, dt.pack()
+}
+
+func unpackDatetime(data []byte) (Datetime, error) {
+	if len(data) != 8 && len(data) != 16 {
+		return Datetime{}, errors.Errorf("invalid datetime length %d", len(data))
+	}
+	sec := int64(binary.LittleEndian.Uint64(data))
+	if len(data) == 8 {
+		return Datetime{Time: time.Unix(sec, 0).UTC()}, nil
+	}
+
+	nsec := int32(binary.LittleEndian.Uint32(data[8:]))
+	offset := int16(binary.LittleEndian.Uint16(data[12:]))
+	dt := Datetime{
+		Time:    time.Unix(sec, int64(nsec)).UTC(),
+		TzIndex: int16(binary.LittleEndian.Uint16(data[14:])),
+	}
+	if offset != 0 {
+		dt.Time = dt.Time.In(time.FixedZone("", int(offset)*60))
+	}
+	return dt, nil
+}
+
+// fields returns non-zero fields of the interval in the packing order
+func (iv Interval) fields() [][2]int64 {
+	adjust := int64(1) // none
+	for i, a := range intervalAdjusts {
+		if a == iv.Adjust {
+			adjust = int64(i)
+		}
+	}
+
+	var ff [][2]int64
+	for i, v := range []int64{iv.Year, iv.Month, iv.Week, iv.Day, iv.Hour, iv.Min, iv.Sec, iv.Nsec, adjust} {
+		if v != 0 {
+			ff = append(ff, [2]int64{int64(i), v})
+		}
+	}
+	return ff
+}
+
+// mpExt packs the count of fields followed by pairs of field id and value
+func (iv Interval) mpExt() (int8, []byte) {
+	ff := iv.fields()
+	e := &mpEncoder{}
+	e.writeByte(byte(len(ff)))
+	for _, f := range ff {
+		e.encodeUint(uint64(f[0]))
+		e.encodeInt(f[1])
+	}
+	return mpExtInterval, e.buf
+}
+
+func unpackInterval(data []byte) (Interval, error) {
+	if len(data) == 0 {
+		return Interval{}, errors.New("empty interval")
+	}
+	d := &mpDecoder{buf: data, pos: 1}
+	iv := Interval{Adjust: "excess"}
+	for i := 0; i < int(data[0]); i++ {
+		k, err := d.decodeAny()
+		if err != nil {
+			return Interval{}, errors.Wrap(err, "unable to decode interval field")
+		}
+		v, err := d.decodeAny()
+		if err != nil {
+			return Interval{}, errors.Wrap(err, "unable to decode interval value")
+		}
+		n, ok := toInt64(v)
+		if !ok {
+			return Interval{}, errors.Errorf("invalid interval value %#v", v)
+		}
+		switch k {
+		case intervalYear:
+			iv.Year = n
+		case intervalMonth:
+			iv.Month = n
+		case intervalWeek:
+			iv.Week = n
+		case intervalDay:
+			iv.Day = n
+		case intervalHour:
+			iv.Hour = n
+		case intervalMin:
+			iv.Min = n
+		case intervalSec:
+			iv.Sec = n
+		case intervalNsec:
+			iv.Nsec = n
+		case intervalAdjust:
+			if n < 0 || int(n) >= len(intervalAdjusts) {
+				return Interval{}, errors.Errorf("invalid interval adjust %d", n)
+			}
+			iv.Adjust = intervalAdjusts[n]
+		}
+	}
+	if iv.Adjust == "none" {
+		iv.Adjust = ""
+	}
+	return iv, nil
+}
+
+// toInt64 converts decoded integer into int64
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// unpackError decodes MP_ERROR into BoxError
+func unpackError(data []byte) (*BoxError, error) {
+	v, err := mpUnmarshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode error")
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("error must be a map")
+	}
+	return BoxErrorFromMp(m)
+}
+
+// BoxErrorFromMp restores the error stack from MP_ERROR map
+func BoxErrorFromMp(m map[any]any) (*BoxError, error) {
+	stack, ok := m[MP_ERROR_STACK].([]any)
+	if !ok || len(stack) == 0 {
+		return nil, errors.New("error has no stack")
+	}
+
+	var top, last *BoxError
+	for _, item := range stack {
+		details, ok := item.(map[any]any)
+		if !ok {
+			return nil, errors.New("error stack item must be a map")
+		}
+		e := &BoxError{}
+		e.Type, _ = details[MP_ERROR_TYPE].(string)
+		e.File, _ = details[MP_ERROR_FILE].(string)
+		e.Message, _ = details[MP_ERROR_MESSAGE].(string)
+		if n, ok := toInt64(details[MP_ERROR_LINE]); ok {
+			e.Line = uint64(n)
+		}
+		if n, ok := toInt64(details[MP_ERROR_ERRNO]); ok {
+			e.Errno = uint64(n)
+		}
+		if n, ok := toInt64(details[MP_ERROR_CODE]); ok {
+			e.Code = uint32(n)
+		}
+		if fields, ok := details[MP_ERROR_FIELDS].(map[any]any); ok {
+			for k, v := range fields {
+				e.WithField(fmt.Sprint(k), v)
+			}
+		}
+
+		if top == nil {
+			top = e
+		} else {
+			last.Prev = e
+		}
+		last = e
+	}
+	return top, nil
+}
+
+// MarshalJSON makes decimal a JSON number
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// MarshalJSON makes datetime a JSON string
+func (dt Datetime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dt.String())
+}
+
+// MarshalJSON makes ext of unknown type a JSON object
+func (ext MpExt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{"ext": ext.Type, "data": ext.Data})
+}
+
+// MarshalJSON makes error a JSON object
+func (e *BoxError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.yamlError())
+}
+
+// YAML tags for MP_EXT values, the diff report keeps them to restore values while reading
+const (
+	yamlTagDecimal  = "!decimal"
+	yamlTagUUID     = "!uuid"
+	yamlTagError    = "!error"
+	yamlTagDatetime = "!datetime"
+	yamlTagInterval = "!interval"
+	yamlTagExt      = "!ext"
+)
+
+type (
+	// yamlBoxError is YAML representation of BoxError
+	yamlBoxError struct {
+		Type    string         `yaml:"type"`
+		Code    uint32         `yaml:"code"`
+		Message string         `yaml:"message"`
+		File    string         `yaml:"file,omitempty"`
+		Line    uint64         `yaml:"line,omitempty"`
+		Errno   uint64         `yaml:"errno,omitempty"`
+		Fields  map[string]any `yaml:"fields,omitempty"`
+		Prev    *yamlBoxError  `yaml:"prev,omitempty"`
+	}
+
+	// yamlDatetime is YAML representation of Datetime with the timezone index, datetimes without it
+	// are plain RFC3339 scalars
+	yamlDatetime struct {
+		Time    string `yaml:"time"`
+		TzIndex int16  `yaml:"tzindex"`
+	}
+
+	// yamlMpExt is YAML representation of MpExt
+	yamlMpExt struct {
+		Type int8   `yaml:"type"`
+		Data []byte `yaml:"data"`
+	}
+)
+
+func (e *BoxError) yamlError() *yamlBoxError {
+	if e == nil {
+		return nil
+	}
+	return &yamlBoxError{
+		Type: e.Type, Code: e.Code, Message: e.Message,
+		File: e.File, Line: e.Line, Errno: e.Errno, Fields: e.Fields,
+		Prev: e.Prev.yamlError(),
+	}
+}
+
+func (ye *yamlBoxError) boxError() *BoxError {
+	if ye == nil {
+		return nil
+	}
+	return &BoxError{
+		Type: ye.Type, Code: ye.Code, Message: ye.Message,
+		File: ye.File, Line: ye.Line, Errno: ye.Errno, Fields: ye.Fields,
+		Prev: ye.Prev.boxError(),
+	}
+}
+
+// taggedNode encodes the value into YAML node with the tag
+func taggedNode(tag string, v any) (*yaml.Node, error) {
+	n := &yaml.Node{}
+	if err := n.Encode(v); err != nil {
+		return nil, err
+	}
+	n.Tag = tag
+	return n, nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (d Decimal) MarshalYAML() (any, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: yamlTagDecimal, Value: d.String()}, nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (dt Datetime) MarshalYAML() (any, error) {
+	if dt.TzIndex != 0 {
+		return taggedNode(yamlTagDatetime, &yamlDatetime{Time: dt.String(), TzIndex: dt.TzIndex})
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: yamlTagDatetime, Value: dt.String()}, nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (iv Interval) MarshalYAML() (any, error) {
+	type plain Interval
+	return taggedNode(yamlTagInterval, plain(iv))
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (e *BoxError) MarshalYAML() (any, error) {
+	return taggedNode(yamlTagError, e.yamlError())
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (ext MpExt) MarshalYAML() (any, error) {
+	return taggedNode(yamlTagExt, &yamlMpExt{Type: ext.Type, Data: ext.Data})
+}
+
+// yamlUUID wraps uuid.UUID to emit it with the tag
+type yamlUUID uuid.UUID
+
+// MarshalYAML implements yaml.Marshaler
+func (u yamlUUID) MarshalYAML() (any, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: yamlTagUUID, Value: uuid.UUID(u).String()}, nil
+}
+
+// yamlExtValues replaces values without own YAML representation by wrappers
+func yamlExtValues(v any) any {
+	switch vv := v.(type) {
+	case uuid.UUID:
+		return yamlUUID(vv)
+	case []any:
+		dst := make([]any, len(vv))
+		for i, item := range vv {
+			dst[i] = yamlExtValues(item)
+		}
+		return dst
+	case map[any]any:
+		dst := make(map[any]any, len(vv))
+		for k, item := range vv {
+			dst[k] = yamlExtValues(item)
+		}
+		return dst
+	default:
+		return v
+	}
+}
+
+// yamlNodeValue decodes YAML node restoring MP_EXT values by their tags
+func yamlNodeValue(n *yaml.Node) (any, error) { //nolint: cyclop
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlNodeValue(n.Content[0])
+	case yaml.AliasNode:
+		return yamlNodeValue(n.Alias)
+	case yaml.SequenceNode:
+		arr := make([]any, len(n.Content))
+		for i, item := range n.Content {
+			v, err := yamlNodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = v
+		}
+		return arr, nil
+	case yaml.MappingNode:
+		switch n.Tag {
+		case yamlTagInterval:
+			iv := Interval{}
+			err := n.Decode(&iv)
+			return iv, err
+		case yamlTagError:
+			ye := &yamlBoxError{}
+			err := n.Decode(ye)
+			return ye.boxError(), err
+		case yamlTagDatetime:
+			yd := &yamlDatetime{}
+			if err := n.Decode(yd); err != nil {
+				return nil, err
+			}
+			t, err := time.Parse(time.RFC3339Nano, yd.Time)
+			return Datetime{Time: t, TzIndex: yd.TzIndex}, err
+		case yamlTagExt:
+			ye := &yamlMpExt{}
+			err := n.Decode(ye)
+			return MpExt{Type: ye.Type, Data: ye.Data}, err
+		}
+		m := make(map[any]any, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, err := yamlNodeValue(n.Content[i])
+			if err != nil {
+				return nil, err
+			}
+			v, err := yamlNodeValue(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	}
+
+	switch n.Tag {
+	case yamlTagDecimal:
+		return ParseDecimal(n.Value)
+	case yamlTagUUID:
+		return uuid.Parse(n.Value)
+	case yamlTagDatetime:
+		t, err := time.Parse(time.RFC3339Nano, n.Value)
+		return Datetime{Time: t}, err
+	}
+	var v any
+	err := n.Decode(&v)
+	return v, err
+}
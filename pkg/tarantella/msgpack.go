@@ -0,0 +1,697 @@
+package tarantella
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// The package has its own MessagePack codec: msgpack.v2 keeps MP_EXT types in a global registry,
+// which conflicts with go-tarantool registering the same ids when both are linked into one binary.
+//
+// Decoded values have the same types msgpack.v2 produces: positive integers are uint64, negative
+// ones are int64, strings are string, binaries are []byte, arrays are []any and maps are map[any]any.
+// MP_EXT values are decoded into Decimal, uuid.UUID, *BoxError, Datetime, Interval or MpExt.
+
+// msgpack format codes
+const (
+	mpNil      byte = 0xc0
+	mpFalse    byte = 0xc2
+	mpTrue     byte = 0xc3
+	mpBin8     byte = 0xc4
+	mpBin16    byte = 0xc5
+	mpBin32    byte = 0xc6
+	mpExt8     byte = 0xc7
+	mpExt16    byte = 0xc8
+	mpExt32    byte = 0xc9
+	mpFloat    byte = 0xca
+	mpDouble   byte = 0xcb
+	mpUint8    byte = 0xcc
+	mpUint16   byte = 0xcd
+	mpUint32   byte = 0xce
+	mpUint64   byte = 0xcf
+	mpInt8     byte = 0xd0
+	mpInt16    byte = 0xd1
+	mpInt32    byte = 0xd2
+	mpInt64    byte = 0xd3
+	mpFixExt1  byte = 0xd4
+	mpFixExt2  byte = 0xd5
+	mpFixExt4  byte = 0xd6
+	mpFixExt8  byte = 0xd7
+	mpFixExt16 byte = 0xd8
+	mpStr8     byte = 0xd9
+	mpStr16    byte = 0xda
+	mpStr32    byte = 0xdb
+	mpArray16  byte = 0xdc
+	mpArray32  byte = 0xdd
+	mpMap16    byte = 0xde
+	mpMap32    byte = 0xdf
+)
+
+var errMpShort = errors.New("msgpack: unexpected end of data")
+
+type (
+	// mpDecoder decodes values from the byte slice
+	mpDecoder struct {
+		buf []byte
+		pos int
+	}
+
+	// mpEncoder appends encoded values to the byte slice
+	mpEncoder struct {
+		buf []byte
+
+		// errorExtension makes *BoxError encoded as MP_ERROR extension, otherwise
+		// errors are encoded as strings like tarantool does for old clients
+		errorExtension bool
+	}
+)
+
+// mpUnmarshal decodes one value from the data
+func mpUnmarshal(data []byte) (any, error) {
+	d := &mpDecoder{buf: data}
+	return d.decodeAny()
+}
+
+// mpMarshal encodes values one by one
+func mpMarshal(vv ...any) ([]byte, error) {
+	e := &mpEncoder{}
+	for _, v := range vv {
+		if err := e.encodeAny(v); err != nil {
+			return nil, err
+		}
+	}
+	return e.buf, nil
+}
+
+func (d *mpDecoder) eof() bool {
+	return d.pos >= len(d.buf)
+}
+
+func (d *mpDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.buf) {
+		return 0, errMpShort
+	}
+	c := d.buf[d.pos]
+	d.pos++
+	return c, nil
+}
+
+func (d *mpDecoder) readN(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, errMpShort
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// readLen reads the big-endian length of size bytes
+func (d *mpDecoder) readLen(size int) (int, error) {
+	b, err := d.readN(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+// decodeAny decodes the next value
+func (d *mpDecoder) decodeAny() (any, error) { //nolint: gocyclo, cyclop
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return uint64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMapBody(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.decodeArrayBody(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.decodeStr(int(c & 0x1f))
+	}
+
+	switch c {
+	case mpNil:
+		return nil, nil
+	case mpFalse:
+		return false, nil
+	case mpTrue:
+		return true, nil
+	case mpUint8, mpUint16, mpUint32, mpUint64:
+		b, err := d.readN(1 << (c - mpUint8))
+		if err != nil {
+			return nil, err
+		}
+		return beUint(b), nil
+	case mpInt8, mpInt16, mpInt32, mpInt64:
+		b, err := d.readN(1 << (c - mpInt8))
+		if err != nil {
+			return nil, err
+		}
+		return beInt(b), nil
+	case mpFloat:
+		b, err := d.readN(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case mpDouble:
+		b, err := d.readN(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case mpStr8, mpStr16, mpStr32:
+		n, err := d.readLen(1 << (c - mpStr8))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeStr(n)
+	case mpBin8, mpBin16, mpBin32:
+		n, err := d.readLen(1 << (c - mpBin8))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.readN(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case mpArray16, mpArray32:
+		n, err := d.readLen(2 << (c - mpArray16))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArrayBody(n)
+	case mpMap16, mpMap32:
+		n, err := d.readLen(2 << (c - mpMap16))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMapBody(n)
+	case mpFixExt1, mpFixExt2, mpFixExt4, mpFixExt8, mpFixExt16:
+		return d.decodeExt(1 << (c - mpFixExt1))
+	case mpExt8, mpExt16, mpExt32:
+		n, err := d.readLen(1 << (c - mpExt8))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	}
+
+	return nil, errors.Errorf("msgpack: unknown code %#x", c)
+}
+
+// skip skips the next value checking it is well-formed, nothing is allocated
+func (d *mpDecoder) skip() error { //nolint: cyclop
+	c, err := d.readByte()
+	if err != nil {
+		return err
+	}
+
+	n, items := 0, 0 // bytes and values to skip
+	switch {
+	case c <= 0x7f || c >= 0xe0:
+	case c&0xf0 == 0x80:
+		items = 2 * int(c&0x0f)
+	case c&0xf0 == 0x90:
+		items = int(c & 0x0f)
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+	case c == mpNil || c == mpFalse || c == mpTrue:
+	case c >= mpUint8 && c <= mpUint64:
+		n = 1 << (c - mpUint8)
+	case c >= mpInt8 && c <= mpInt64:
+		n = 1 << (c - mpInt8)
+	case c == mpFloat:
+		n = 4
+	case c == mpDouble:
+		n = 8
+	case c >= mpStr8 && c <= mpStr32:
+		n, err = d.readLen(1 << (c - mpStr8))
+	case c >= mpBin8 && c <= mpBin32:
+		n, err = d.readLen(1 << (c - mpBin8))
+	case c == mpArray16 || c == mpArray32:
+		items, err = d.readLen(2 << (c - mpArray16))
+	case c == mpMap16 || c == mpMap32:
+		items, err = d.readLen(2 << (c - mpMap16))
+		items *= 2
+	case c >= mpFixExt1 && c <= mpFixExt16:
+		n = 1 + 1<<(c-mpFixExt1)
+	case c >= mpExt8 && c <= mpExt32:
+		n, err = d.readLen(1 << (c - mpExt8))
+		n++
+	default:
+		return errors.Errorf("msgpack: unknown code %#x", c)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := d.readN(n); err != nil {
+		return err
+	}
+	for i := 0; i < items; i++ {
+		if err := d.skip(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMapLen reads the header of the map
+func (d *mpDecoder) readMapLen() (int, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), nil
+	case c == mpMap16 || c == mpMap32:
+		return d.readLen(2 << (c - mpMap16))
+	}
+	return 0, errors.Errorf("msgpack: map expected, got code %#x", c)
+}
+
+// readUint reads unsigned integer, ok is false if the value has another type,
+// in this case the value is skipped
+func (d *mpDecoder) readUint() (uint64, bool, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch {
+	case c <= 0x7f:
+		return uint64(c), true, nil
+	case c >= mpUint8 && c <= mpUint64:
+		b, err := d.readN(1 << (c - mpUint8))
+		if err != nil {
+			return 0, false, err
+		}
+		return beUint(b), true, nil
+	}
+	d.pos--
+	return 0, false, d.skip()
+}
+
+// lookup scans the map for the unsigned key and positions the decoder at its value,
+// nothing is allocated while scanning
+func (d *mpDecoder) lookup(key uint64) (bool, error) {
+	n, err := d.readMapLen()
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < n; i++ {
+		k, ok, err := d.readUint()
+		if err != nil {
+			return false, err
+		}
+		if ok && k == key {
+			return true, nil
+		}
+		if err := d.skip(); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (d *mpDecoder) decodeStr(n int) (any, error) {
+	b, err := d.readN(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *mpDecoder) decodeArrayBody(n int) (any, error) {
+	if n > len(d.buf)-d.pos {
+		return nil, errMpShort
+	}
+	arr := make([]any, n)
+	for i := range arr {
+		v, err := d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+func (d *mpDecoder) decodeMapBody(n int) (any, error) {
+	if n > len(d.buf)-d.pos {
+		return nil, errMpShort
+	}
+	m := make(map[any]any, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+		if !isHashable(k) {
+			return nil, errors.Errorf("msgpack: unsupported map key type %T", k)
+		}
+		v, err := d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// decodeExt decodes MP_EXT value with n bytes of data
+func (d *mpDecoder) decodeExt(n int) (any, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.readN(n)
+	if err != nil {
+		return nil, err
+	}
+	return decodeExtValue(int8(c), data)
+}
+
+// isHashable tells if the value can be a key of Go map, MpExt with its data isn't
+func isHashable(v any) bool {
+	return v == nil || reflect.TypeOf(v).Comparable()
+}
+
+func beUint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b))
+	default:
+		return binary.BigEndian.Uint64(b)
+	}
+}
+
+func beInt(b []byte) int64 {
+	switch len(b) {
+	case 1:
+		return int64(int8(b[0]))
+	case 2:
+		return int64(int16(binary.BigEndian.Uint16(b)))
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(b)))
+	default:
+		return int64(binary.BigEndian.Uint64(b))
+	}
+}
+
+func (e *mpEncoder) writeByte(c byte) {
+	e.buf = append(e.buf, c)
+}
+
+// writeCode writes code with big-endian length of size bytes
+func (e *mpEncoder) writeCode(c byte, size int, n uint64) {
+	e.buf = append(e.buf, c)
+	switch size {
+	case 1:
+		e.buf = append(e.buf, byte(n))
+	case 2:
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case 4:
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	case 8:
+		e.buf = binary.BigEndian.AppendUint64(e.buf, n)
+	}
+}
+
+func (e *mpEncoder) encodeNil() {
+	e.writeByte(mpNil)
+}
+
+func (e *mpEncoder) encodeBool(b bool) {
+	if b {
+		e.writeByte(mpTrue)
+	} else {
+		e.writeByte(mpFalse)
+	}
+}
+
+func (e *mpEncoder) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.writeByte(byte(n))
+	case n <= math.MaxUint8:
+		e.writeCode(mpUint8, 1, n)
+	case n <= math.MaxUint16:
+		e.writeCode(mpUint16, 2, n)
+	case n <= math.MaxUint32:
+		e.writeCode(mpUint32, 4, n)
+	default:
+		e.writeCode(mpUint64, 8, n)
+	}
+}
+
+// encodeInt encodes non-negative numbers as unsigned like tarantool does
+func (e *mpEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.writeByte(byte(int8(n)))
+	case n >= math.MinInt8:
+		e.writeCode(mpInt8, 1, uint64(n))
+	case n >= math.MinInt16:
+		e.writeCode(mpInt16, 2, uint64(n))
+	case n >= math.MinInt32:
+		e.writeCode(mpInt32, 4, uint64(n))
+	default:
+		e.writeCode(mpInt64, 8, uint64(n))
+	}
+}
+
+func (e *mpEncoder) encodeFloat(f float32) {
+	e.writeCode(mpFloat, 4, uint64(math.Float32bits(f)))
+}
+
+func (e *mpEncoder) encodeDouble(f float64) {
+	e.writeCode(mpDouble, 8, math.Float64bits(f))
+}
+
+func (e *mpEncoder) encodeStr(s string) {
+	n := uint64(len(s))
+	switch {
+	case n <= 31:
+		e.writeByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.writeCode(mpStr8, 1, n)
+	case n <= math.MaxUint16:
+		e.writeCode(mpStr16, 2, n)
+	default:
+		e.writeCode(mpStr32, 4, n)
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *mpEncoder) encodeBin(b []byte) {
+	n := uint64(len(b))
+	switch {
+	case n <= math.MaxUint8:
+		e.writeCode(mpBin8, 1, n)
+	case n <= math.MaxUint16:
+		e.writeCode(mpBin16, 2, n)
+	default:
+		e.writeCode(mpBin32, 4, n)
+	}
+	e.buf = append(e.buf, b...)
+}
+
+func (e *mpEncoder) encodeArrayLen(n int) {
+	switch {
+	case n <= 15:
+		e.writeByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.writeCode(mpArray16, 2, uint64(n))
+	default:
+		e.writeCode(mpArray32, 4, uint64(n))
+	}
+}
+
+func (e *mpEncoder) encodeMapLen(n int) {
+	switch {
+	case n <= 15:
+		e.writeByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.writeCode(mpMap16, 2, uint64(n))
+	default:
+		e.writeCode(mpMap32, 4, uint64(n))
+	}
+}
+
+// encodeExt writes MP_EXT header and data
+func (e *mpEncoder) encodeExt(typ int8, data []byte) {
+	n := uint64(len(data))
+	switch n {
+	case 1:
+		e.writeByte(mpFixExt1)
+	case 2:
+		e.writeByte(mpFixExt2)
+	case 4:
+		e.writeByte(mpFixExt4)
+	case 8:
+		e.writeByte(mpFixExt8)
+	case 16:
+		e.writeByte(mpFixExt16)
+	default:
+		switch {
+		case n <= math.MaxUint8:
+			e.writeCode(mpExt8, 1, n)
+		case n <= math.MaxUint16:
+			e.writeCode(mpExt16, 2, n)
+		default:
+			e.writeCode(mpExt32, 4, n)
+		}
+	}
+	e.writeByte(byte(typ))
+	e.buf = append(e.buf, data...)
+}
+
+// encodeAny encodes the value of any supported type
+func (e *mpEncoder) encodeAny(v any) error { //nolint: gocyclo, cyclop
+	switch vv := v.(type) {
+	case nil:
+		e.encodeNil()
+	case bool:
+		e.encodeBool(vv)
+	case int:
+		e.encodeInt(int64(vv))
+	case int8:
+		e.encodeInt(int64(vv))
+	case int16:
+		e.encodeInt(int64(vv))
+	case int32:
+		e.encodeInt(int64(vv))
+	case int64:
+		e.encodeInt(vv)
+	case uint:
+		e.encodeUint(uint64(vv))
+	case uint8:
+		e.encodeUint(uint64(vv))
+	case uint16:
+		e.encodeUint(uint64(vv))
+	case uint32:
+		e.encodeUint(uint64(vv))
+	case uint64:
+		e.encodeUint(vv)
+	case float32:
+		e.encodeFloat(vv)
+	case float64:
+		e.encodeDouble(vv)
+	case string:
+		e.encodeStr(vv)
+	case []byte:
+		e.encodeBin(vv)
+	case []any:
+		e.encodeArrayLen(len(vv))
+		for _, item := range vv {
+			if err := e.encodeAny(item); err != nil {
+				return err
+			}
+		}
+	case map[any]any:
+		e.encodeMapLen(len(vv))
+		for k, item := range vv {
+			if err := e.encodeAny(k); err != nil {
+				return err
+			}
+			if err := e.encodeAny(item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		e.encodeMapLen(len(vv))
+		for k, item := range vv {
+			e.encodeStr(k)
+			if err := e.encodeAny(item); err != nil {
+				return err
+			}
+		}
+	case time.Time:
+		e.encodeExt(mpExtDatetime, Datetime{Time: vv}.pack())
+	case *BoxError:
+		if !e.errorExtension {
+			e.encodeStr(vv.Message)
+			return nil
+		}
+		data, err := mpMarshal(vv.MpError())
+		if err != nil {
+			return err
+		}
+		e.encodeExt(mpExtError, data)
+	case uuid.UUID:
+		e.encodeExt(mpExtUUID, vv[:])
+	case MpExtValue:
+		e.encodeExt(vv.mpExt())
+	default:
+		return e.encodeReflect(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+// encodeReflect encodes named types, slices and maps of concrete types
+func (e *mpEncoder) encodeReflect(v reflect.Value) error {
+	switch v.Kind() { //nolint: exhaustive
+	case reflect.Slice, reflect.Array:
+		e.encodeArrayLen(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeAny(v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		e.encodeMapLen(v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encodeAny(iter.Key().Interface()); err != nil {
+				return err
+			}
+			if err := e.encodeAny(iter.Value().Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		e.encodeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.encodeDouble(v.Float())
+	case reflect.String:
+		e.encodeStr(v.String())
+	case reflect.Bool:
+		e.encodeBool(v.Bool())
+	case reflect.Pointer:
+		if v.IsNil() {
+			e.encodeNil()
+			return nil
+		}
+		return e.encodeAny(v.Elem().Interface())
+	default:
+		return errors.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
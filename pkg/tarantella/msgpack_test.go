@@ -0,0 +1,140 @@
+package tarantella
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMsgpackExt(t *testing.T) {
+	roundTrip := func(t *testing.T, v any, encoded string) any {
+		bb, err := mpMarshal(v)
+		require.NoError(t, err)
+		if encoded != "" {
+			require.Equal(t, encoded, hex.EncodeToString(bb))
+		}
+		decoded, err := mpUnmarshal(bb)
+		require.NoError(t, err)
+		return decoded
+	}
+
+	t.Run("decimal", func(t *testing.T) {
+		d, err := ParseDecimal("-12.34")
+		require.NoError(t, err)
+		decoded := roundTrip(t, d, "d6010201234d")
+		require.Equal(t, "-12.34", decoded.(Decimal).String())
+		require.Equal(t, 0, d.Cmp(decoded.(Decimal)))
+
+		decoded = roundTrip(t, NewDecimal(5, -3), "")
+		require.Equal(t, "5000", decoded.(Decimal).String())
+	})
+
+	t.Run("uuid", func(t *testing.T) {
+		u := uuid.MustParse("c8f0fa1f-da29-438c-a040-393f1126ad39")
+		require.Equal(t, u, roundTrip(t, u, "d802c8f0fa1fda29438ca040393f1126ad39"))
+	})
+
+	t.Run("datetime", func(t *testing.T) {
+		dt := NewDatetime(time.Date(2022, 1, 31, 12, 0, 0, 500, time.FixedZone("", 3*3600)))
+		decoded := roundTrip(t, dt, "").(Datetime)
+		require.True(t, dt.Time.Equal(decoded.Time))
+		_, offset := decoded.Time.Zone()
+		require.Equal(t, 3*3600, offset)
+
+		dt = NewDatetime(time.Unix(1643630400, 0).UTC())
+		require.Equal(t, dt, roundTrip(t, dt, "d70440cff76100000000"))
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		iv := Interval{Year: 1, Day: -2, Adjust: "last"}
+		require.Equal(t, iv, roundTrip(t, iv, "c7070603000103fe0802"))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		e := NewCustomError("MyError", "something went wrong").WithPrev(ErrNoSuchSpace(512))
+		enc := &mpEncoder{errorExtension: true}
+		require.NoError(t, enc.encodeAny(e))
+		decoded, err := mpUnmarshal(enc.buf)
+		require.NoError(t, err)
+		require.Equal(t, e, decoded)
+
+		// without error extension errors are sent as strings
+		require.Equal(t, "something went wrong", roundTrip(t, e, ""))
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		d, _ := ParseDecimal("100.50")
+		ri := &RequestInfo{RT: "IPROTO_INSERT(0x2)", B: map[any]any{"tuple": []any{
+			d, uuid.MustParse("c8f0fa1f-da29-438c-a040-393f1126ad39"),
+			NewDatetime(time.Unix(1643630400, 0).UTC()), Interval{Month: 3},
+			ErrReadonly(),
+		}}}
+		bb, err := yaml.Marshal(ri)
+		require.NoError(t, err)
+
+		restored := &RequestInfo{}
+		require.NoError(t, yaml.Unmarshal(bb, restored))
+		require.Equal(t, ri.B, restored.B)
+
+		// the timezone index survives the round trip and keeps MP_EXT encoding
+		dt := Datetime{Time: time.Unix(1643630400, 0).In(time.FixedZone("", 3*3600)), TzIndex: 947}
+		bb, err = yaml.Marshal(&RequestInfo{B: map[any]any{"tuple": []any{dt}}})
+		require.NoError(t, err)
+		restored = &RequestInfo{}
+		require.NoError(t, yaml.Unmarshal(bb, restored))
+		tuple := restored.B["tuple"].([]any)
+		require.Equal(t, dt.TzIndex, tuple[0].(Datetime).TzIndex)
+		expected, err := mpMarshal(dt)
+		require.NoError(t, err)
+		actual, err := mpMarshal(tuple[0])
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	})
+}
+
+func TestMsgpackMapKeys(t *testing.T) {
+	v, err := mpUnmarshal([]byte{0x81, 0xd8, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01})
+	require.NoError(t, err)
+	require.Equal(t, map[any]any{uuid.UUID{}: uint64(1)}, v)
+
+	// MP_EXT of the unknown type keeps its data in a slice, so it can't be a key
+	_, err = mpUnmarshal([]byte{0x81, 0xd4, 0x10, 0x00, 0x00})
+	require.Error(t, err)
+
+	// select with the key [{<fixext1 0x10>: 0}]
+	pack, err := readPackage(bytes.NewReader([]byte{0xce, 0x00, 0x00, 0x00, 0x13,
+		0x82, 0x00, 0x01, 0x01, 0x00,
+		0x83, 0x10, 0xcd, 0x02, 0x00, 0x12, 0x0a, 0x20, 0x91, 0x81, 0xd4, 0x10, 0x00, 0x00}))
+	require.NoError(t, err)
+	_, err = DecodeRequest(pack, IPROTO_SELECT)
+	be, _ := AsBoxError(err)
+	require.NotNil(t, be)
+	require.Equal(t, ER_INVALID_MSGPACK, be.Code)
+	require.Empty(t, pack.Body())
+}
+
+func TestCompareValues(t *testing.T) {
+	d, _ := ParseDecimal("1.5")
+	ordered := []any{
+		nil, false, true,
+		math.NaN(), math.Inf(-1), int64(-5), uint64(1), d, 2.5, uint64(math.MaxUint64), math.Inf(1),
+		"", "a", "b", []byte("a"),
+		uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		NewDatetime(time.Unix(0, 0).UTC()),
+		[]any{uint64(1)}, []any{uint64(1), "a"},
+	}
+	for i := range ordered {
+		for j := range ordered {
+			require.Equal(t, cmpInt(int64(i), int64(j)), CompareValues(ordered[i], ordered[j]), "%d <=> %d", i, j)
+		}
+	}
+	require.Equal(t, 0, CompareValues(uint64(3), 3.0))
+	require.Equal(t, 0, CompareValues(NewDecimal(30, 1), int64(3)))
+}
@@ -4,24 +4,32 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"math"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/vmihailenco/msgpack.v2"
 	"gopkg.in/yaml.v3"
 )
 
 // see https://www.tarantool.io/en/doc/latest/dev_guide/internals/iproto/keys/
 
 type (
-	// Package represents a request or response PROTO package
+	// Package represents a request or response PROTO package. Header and body of a decoded
+	// package are kept raw and decoded on demand: typed values are scanned by key without
+	// decoding the whole map, Header and Body decode maps on the first call
 	Package struct {
-		rawLen  []byte // 5 bytes length
-		rawData []byte // header + body
-		header  map[any]any
-		body    map[any]any
+		rawLen    []byte // 5 bytes length
+		rawData   []byte // header + body
+		rawHeader []byte // not decoded part of rawData, nil when header is decoded
+		rawBody   []byte
+		header    map[any]any
+		body      map[any]any
+		pooled    *[]byte // backing buffer of rawData taken from the pool
 	}
 
 	// RequestInfo describes package while marshall or unmarshal package into or from a file
@@ -32,6 +40,32 @@ type (
 	}
 )
 
+// MarshalYAML tags MP_EXT values, so they can be restored while reading
+func (ri *RequestInfo) MarshalYAML() (any, error) {
+	type plain RequestInfo
+	return &plain{
+		RT: ri.RT,
+		H:  yamlExtValues(ri.H).(map[any]any),
+		B:  yamlExtValues(ri.B).(map[any]any),
+	}, nil
+}
+
+// UnmarshalYAML restores MP_EXT values by their tags
+func (ri *RequestInfo) UnmarshalYAML(n *yaml.Node) error {
+	v, err := yamlNodeValue(n)
+	if err != nil {
+		return err
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return errors.New("request info must be a map")
+	}
+	ri.RT, _ = m["rt"].(string)
+	ri.H, _ = m["h"].(map[any]any)
+	ri.B, _ = m["b"].(map[any]any)
+	return nil
+}
+
 // Yaml mutates map with mutators (if any), an return yaml representation for it
 func Yaml(src map[any]any, mutators ...func(src map[any]any) map[any]any) ([]byte, error) {
 	for _, m := range mutators {
@@ -78,8 +112,8 @@ func Cast(src map[any]any) map[any]any {
 func (pack *Package) Info() any {
 	return &RequestInfo{
 		RT: RequestTypeDescr(pack.HeaderRequestType()),
-		H:  Cast(pack.header),
-		B:  Cast(pack.body),
+		H:  Cast(pack.Header()),
+		B:  Cast(pack.Body()),
 	}
 }
 
@@ -99,137 +133,198 @@ func (pack *Package) CastInfo() any {
 		Body   map[any]any
 	}{}
 	info.Length = len(pack.rawData)
-	info.Header = Cast(pack.header)
-	info.Body = Cast(pack.body)
+	info.Header = Cast(pack.Header())
+	info.Body = Cast(pack.Body())
 
 	return info
 }
 
 // HeaderRequestType returns IPROTO_REQUEST_TYPE
 func (pack *Package) HeaderRequestType() uint64 {
-	return header[uint64](pack, IPROTO_REQUEST_TYPE)
+	n, _, _ := pack.headerUint(IPROTO_REQUEST_TYPE)
+	return n
 }
 
 // HeaderSync returns IPROTO_SYNC
 func (pack *Package) HeaderSync() uint64 {
-	return header[uint64](pack, IPROTO_SYNC)
-}
-
-// BodyVersion returns IPROTO_VERSION
-func (pack *Package) BodyVersion() uint64 {
-	return body[uint64](pack, IPROTO_VERSION)
+	n, _, _ := pack.headerUint(IPROTO_SYNC)
+	return n
 }
 
-// BodySpaceID returns IPROTO_SPACE_ID
-func (pack *Package) BodySpaceID() uint64 {
-	return body[uint64](pack, IPROTO_SPACE_ID)
+// Header returns the header decoding it if needed, broken header is returned as an empty map,
+// use DecodeHeader to validate the header
+func (pack *Package) Header() map[any]any {
+	if pack.header == nil {
+		pack.header = decodeRawMap(pack.rawHeader)
+		pack.rawHeader = nil
+	}
+	return pack.header
 }
 
-// BodySQLText returns IPROTO_SQL_TEXT
-func (pack *Package) BodySQLText() string {
-	return body[string](pack, IPROTO_SQL_TEXT)
+// Body returns the body decoding it if needed, broken body is returned as an empty map,
+// use DecodeRequest to validate the body
+func (pack *Package) Body() map[any]any {
+	if pack.body == nil {
+		pack.body = decodeRawMap(pack.rawBody)
+		pack.rawBody = nil
+	}
+	return pack.body
 }
 
-// BodyFeatures returns IPROTO_FEATURES
-func (pack *Package) BodyFeatures() []any {
-	return body[[]any](pack, IPROTO_FEATURES)
+func decodeRawMap(raw []byte) map[any]any {
+	if raw != nil {
+		d := &mpDecoder{buf: raw}
+		if v, err := d.decodeAny(); err == nil {
+			if m, ok := v.(map[any]any); ok {
+				return m
+			}
+		}
+	}
+	return make(map[any]any)
 }
 
-// BodyUsername returns IPROTO_USER_NAME
-func (pack *Package) BodyUsername() string {
-	return body[string](pack, IPROTO_USER_NAME)
+// headerUint returns unsigned value of the header key, ok is false if the value has another type
+func (pack *Package) headerUint(key uint64) (n uint64, found, ok bool) {
+	return rawUint(pack.rawHeader, pack.header, key)
 }
 
-// header returns a key value from the header
-func header[T any](pack *Package, key uint64) T {
-	if v, ok := pack.header[key].(T); !ok {
-		panic(errors.Errorf("unable to cast header value '%#v' with key '%v' for type '%T'", pack.header[key], key, *new(T)))
-	} else {
-		return v
+// bodyValue returns the value of the body key decoding only this value
+func (pack *Package) bodyValue(key uint64) (v any, found bool, err error) {
+	if pack.rawBody == nil {
+		v, found = pack.body[key]
+		return v, found, nil
+	}
+	d := &mpDecoder{buf: pack.rawBody}
+	if found, err = d.lookup(key); !found || err != nil {
+		return nil, false, err
 	}
+	v, err = d.decodeAny()
+	return v, true, err
 }
 
-// body returns a key value from the body
-func body[T any](pack *Package, key uint64) T {
-	if v, ok := pack.body[key].(T); !ok {
-		panic(errors.Errorf("unable to cast body value '%#v' with key '%v' for type '%T'", pack.body[key], key, *new(T)))
-	} else {
-		return v
+// rawUint looks for unsigned value in the raw map or in the decoded one if raw is nil
+func rawUint(raw []byte, m map[any]any, key uint64) (n uint64, found, ok bool) {
+	if raw == nil {
+		v, found := m[key]
+		n, ok = v.(uint64)
+		return n, found, ok
 	}
+	d := &mpDecoder{buf: raw}
+	found, err := d.lookup(key)
+	if !found || err != nil {
+		return 0, found, false
+	}
+	n, ok, err = d.readUint()
+	return n, true, ok && err == nil
 }
 
 // SetHeader sets one field of the package header
 func (pack *Package) SetHeader(k, v any) {
-	if pack.header == nil {
-		pack.header = make(map[any]any)
-	}
-	pack.header[k] = v
+	pack.Header()[k] = v
 }
 
 // SetBody sets one field of the package body
 func (pack *Package) SetBody(k, v any) {
-	if pack.body == nil {
-		pack.body = make(map[any]any)
-	}
-	pack.body[k] = v
+	pack.Body()[k] = v
+}
+
+// resetBody drops all fields of the body
+func (pack *Package) resetBody() {
+	pack.rawBody = nil
+	pack.body = make(map[any]any)
 }
 
 // Encode encodes Header, Body and Len into byte arrays
 func (pack *Package) Encode() error {
-	if pack.header == nil {
-		pack.header = make(map[any]any)
+	e := &mpEncoder{}
+	if err := pack.encodeTo(e); err != nil {
+		return err
 	}
-	if pack.body == nil {
-		pack.body = make(map[any]any)
-	}
-
-	buff := &bytes.Buffer{}
-	e := msgpack.NewEncoder(buff)
+	pack.rawData = e.buf
+	pack.rawLen = pack.len()
+	return nil
+}
 
-	if e := e.Encode(pack.header); e != nil {
-		return errors.Wrap(e, "unable to encode header")
+// encodeTo appends header and body to the encoder, errors inside the body are sent
+// as MP_ERROR if errorExtension of the encoder is set
+func (pack *Package) encodeTo(e *mpEncoder) error {
+	if err := e.encodeAny(pack.Header()); err != nil {
+		return errors.Wrap(err, "unable to encode header")
 	}
-	if e := e.Encode(pack.body); e != nil {
-		return errors.Wrap(e, "unable to encode body")
+	if err := e.encodeAny(pack.Body()); err != nil {
+		return errors.Wrap(err, "unable to encode body")
 	}
-	pack.rawData = buff.Bytes()
-	pack.rawLen = pack.len()
 	return nil
 }
 
-// Decode gets byte stream and read from it header and body of the package as a map[any]any
-func (pack *Package) Decode(rawData []byte) error {
-	pack.rawData = make([]byte, len(rawData))
-	copy(pack.rawData, rawData)
+// writeTo encodes the package into the pooled buffer and writes it, the buffer is kept
+// in rawData till release
+func (pack *Package) writeTo(w io.Writer, errorExtension bool) error {
+	pb := getBuffer()
+	e := &mpEncoder{buf: append((*pb)[:0], mpUint32, 0, 0, 0, 0), errorExtension: errorExtension}
+	err := pack.encodeTo(e)
+	*pb = e.buf
+	if err != nil {
+		putBuffer(pb)
+		return err
+	}
+	binary.BigEndian.PutUint32(e.buf[1:5], uint32(len(e.buf)-5))
 
-	d := msgpack.NewDecoder(bytes.NewBuffer(pack.rawData))
+	pack.release()
+	pack.pooled = pb
+	pack.rawLen, pack.rawData = e.buf[:5], e.buf[5:]
 
-	var (
-		err error
-		ok  bool
-	)
+	_, err = w.Write(e.buf)
+	return err
+}
 
-	m, err := d.DecodeMap()
-	if err != nil {
+// Decode gets byte stream and checks it has header and body maps. The package references
+// rawData, maps are decoded on demand
+func (pack *Package) Decode(rawData []byte) error {
+	pack.rawData = rawData
+	pack.header, pack.body = nil, nil
+
+	d := &mpDecoder{buf: rawData}
+
+	if _, err := d.readMapLen(); err != nil {
 		return errors.Wrap(err, "unable to decode package header")
 	}
+	d.pos = 0
+	if err := d.skip(); err != nil {
+		return errors.Wrap(err, "unable to decode package header")
+	}
+	pack.rawHeader = rawData[:d.pos:d.pos]
 
-	if pack.header, ok = m.(map[any]any); !ok {
-		return errors.New("unable to decode package header")
+	// body may be omitted
+	if d.eof() {
+		pack.rawBody = nil
+		pack.body = make(map[any]any)
+		return nil
 	}
 
-	m, err = d.DecodeMap()
-	if err != nil {
+	start := d.pos
+	if _, err := d.readMapLen(); err != nil {
 		return errors.Wrap(err, "unable to decode package body")
 	}
-
-	if pack.body, ok = m.(map[any]any); !ok {
-		return errors.New("unable to decode package body")
+	d.pos = start
+	if err := d.skip(); err != nil {
+		return errors.Wrap(err, "unable to decode package body")
 	}
+	pack.rawBody = rawData[start:d.pos:d.pos]
 
 	return nil
 }
 
+// release returns the buffer of the package to the pool, not decoded parts are lost
+func (pack *Package) release() {
+	if pack.pooled == nil {
+		return
+	}
+	putBuffer(pack.pooled)
+	pack.pooled = nil
+	pack.rawLen, pack.rawData, pack.rawHeader, pack.rawBody = nil, nil, nil, nil
+}
+
 // len returns length rawData package size preamble
 func (pack *Package) len() []byte {
 	l := [5]byte{}
@@ -245,17 +340,50 @@ func (pack *Package) len() []byte {
 
 // SetLen sets len of the package
 func (pack *Package) SetLen(rawLen [5]byte) (uint32, error) {
-	var length uint32
-	err := msgpack.NewDecoder(bytes.NewBuffer(rawLen[:])).Decode(&length)
+	length, err := packageLen(rawLen[:])
+	if err != nil {
+		return 0, err
+	}
+	pack.rawLen = rawLen[:]
+	return length, nil
+}
+
+// packageLen decodes the size preamble
+func packageLen(rawLen []byte) (uint32, error) {
+	d := &mpDecoder{buf: rawLen}
+	length, ok, err := d.readUint()
 	if err != nil {
 		return 0, errors.Wrap(err, "unable to decode package length")
 	}
+	if !ok || length > math.MaxUint32 {
+		return 0, errors.Errorf("unable to decode package length %x", rawLen)
+	}
 
 	if length == 0 {
 		return 0, errors.New("Response should not be 0 length")
 	}
-	pack.rawLen = rawLen[:]
-	return length, nil
+	return uint32(length), nil
+}
+
+// buffers of packages, see readPackage and writeTo
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// maxPooledBuffer limits buffers kept by the pool, huge ones are left to GC
+const maxPooledBuffer = 1 << 20
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) <= maxPooledBuffer {
+		bufferPool.Put(b)
+	}
 }
 
 // ToBytes emit Len+Head+Body as a whole
@@ -266,13 +394,13 @@ func (pack *Package) ToBytes() []byte {
 	return buff
 }
 
-func createGreeting() []byte {
+func createGreeting(instanceUUID string) []byte {
 	greetingBuf := &bytes.Buffer{}
 
 	h := IPROTO_GREETING_SIZE / 2
 
 	fmt.Fprintf(greetingBuf, "Tarantool %d.%d.%d (Binary) ", versionMajor, versionMinor, versionPatch)
-	greetingBuf.WriteString(dummyInstanceID)
+	greetingBuf.WriteString(instanceUUID)
 
 	r := len(greetingBuf.Bytes())
 	greetingBuf.WriteString(strings.Repeat(" ", h-r-1))
@@ -1,6 +1,7 @@
 package tarantella
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/hex"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"path"
 	"testing"
 
+	"github.com/rs/zerolog"
 	"github.com/ryboe/q"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/vmihailenco/msgpack.v2"
@@ -61,3 +63,93 @@ func TestParse(t *testing.T) {
 		parsePackageData(t, path.Base(t.Name()))
 	})
 }
+
+// requestBytes encodes the request like a client does
+func requestBytes(b testing.TB, requestType uint64, body map[any]any) []byte {
+	req := &Package{}
+	req.SetHeader(IPROTO_REQUEST_TYPE, requestType)
+	req.SetHeader(IPROTO_SYNC, uint64(100500))
+	for k, v := range body {
+		req.SetBody(k, v)
+	}
+	require.NoError(b, req.Encode())
+	return req.ToBytes()
+}
+
+func BenchmarkDecodeSelect(b *testing.B) {
+	raw := requestBytes(b, IPROTO_SELECT, map[any]any{
+		IPROTO_SPACE_ID: uint64(512), IPROTO_INDEX_ID: uint64(0), IPROTO_LIMIT: uint64(100),
+		IPROTO_OFFSET: uint64(0), IPROTO_ITERATOR: ITER_GE, IPROTO_KEY: []any{uint64(1)},
+	})
+	r := bytes.NewReader(raw)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(raw)
+		pack, err := readPackage(r)
+		if err != nil {
+			b.Fatal(err)
+		}
+		h, err := DecodeHeader(pack)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := DecodeRequest(pack, h.Type); err != nil {
+			b.Fatal(err)
+		}
+		pack.release()
+	}
+}
+
+func BenchmarkEncodeResponse(b *testing.B) {
+	data := []any{
+		[]any{uint64(1), "Roxette", uint64(1986)},
+		[]any{uint64(2), "Scorpions", uint64(2015)},
+		[]any{uint64(3), "Ace of Base", uint64(1993)},
+	}
+	w := bufio.NewWriter(io.Discard)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := NewResponse(RequestHeader{Sync: 100500})
+		res.SetSchemaVersion(schemaVersion)
+		res.SetData(data)
+		if err := res.writeTo(w, false); err != nil {
+			b.Fatal(err)
+		}
+		res.release()
+	}
+}
+
+// BenchmarkPing measures the whole request processing without network
+func BenchmarkPing(b *testing.B) {
+	raw := requestBytes(b, IPROTO_PING, nil)
+	r := bytes.NewReader(raw)
+	w := bufio.NewWriter(io.Discard)
+	clc := &clientConnection{}
+
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	defer zerolog.SetGlobalLevel(level)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(raw)
+		req, err := readPackage(r)
+		if err != nil {
+			b.Fatal(err)
+		}
+		res, err := clc.prepareResponse(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := clc.writeResponse(res, w); err != nil {
+			b.Fatal(err)
+		}
+		req.release()
+		res.release()
+	}
+}
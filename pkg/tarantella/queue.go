@@ -0,0 +1,566 @@
+package tarantella
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The queue module is emulated: tubes of fifo, fifottl, utube and utubettl drivers are created by
+// queue.create_tube or Config.QueueTubes, their methods are functions like queue.tube.jobs:put. Tasks are
+// kept in memory and returned as {task_id, status, data}. take(timeout) waits for a task parking the calling
+// request only, tasks taken by a session are released when its connection is closed
+
+// statuses of tasks
+const (
+	taskReady   = "r"
+	taskTaken   = "t"
+	taskDone    = "-"
+	taskBuried  = "!"
+	taskDelayed = "~"
+)
+
+// tubeDrivers are supported drivers: ttl ones support ttl, ttr, pri and delay options,
+// utube ones give one task of a subqueue at a time
+var tubeDrivers = map[string]struct{ ttl, utube bool }{
+	"fifo":     {},
+	"fifottl":  {ttl: true},
+	"utube":    {utube: true},
+	"utubettl": {ttl: true, utube: true},
+}
+
+// tubeCalls are counters of queue.statistics
+var tubeCalls = []string{"put", "take", "ack", "release", "bury", "kick", "delete", "touch", "ttl", "ttr", "delay"}
+
+type (
+	// queue keeps tubes of the instance
+	queue struct {
+		mu    sync.Mutex
+		tubes map[string]*tube
+		wake  chan struct{} // closed when tasks may be taken
+	}
+
+	// tube is a queue of tasks
+	tube struct {
+		name       string
+		ttl, utube bool
+		opts       map[any]any // defaults of options of put
+		nextID     uint64
+		tasks      map[uint64]*task
+		done       uint64 // number of acknowledged tasks
+		calls      map[string]uint64
+		functions  []string // names of functions of tube methods
+	}
+
+	task struct {
+		id       uint64
+		status   string
+		data     any
+		utube    string
+		pri      any
+		ttr      time.Duration // 0 means infinity
+		deadline time.Time     // the task is deleted by ttl, zero if it lives forever
+		event    time.Time     // the end of the delay or of ttr, zero if there is none
+		session  uint64        // the session which has taken the task
+	}
+
+	// tubeMethod is a method of a tube like tube:put(), it's called with the queue locked
+	tubeMethod func(q *queue, ctx *CallContext, t *tube, args []any) ([]any, error)
+)
+
+var tubeMethods = map[string]tubeMethod{
+	"put":         (*queue).put,
+	"ack":         (*queue).ack,
+	"release":     (*queue).release,
+	"bury":        (*queue).bury,
+	"kick":        (*queue).kick,
+	"peek":        (*queue).peek,
+	"delete":      (*queue).delete,
+	"touch":       (*queue).touch,
+	"truncate":    (*queue).truncate,
+	"release_all": (*queue).releaseAll,
+	"drop":        (*queue).drop,
+}
+
+func newQueue() *queue {
+	return &queue{tubes: make(map[string]*tube), wake: make(chan struct{})}
+}
+
+func (inst *Instance) registerQueue() {
+	inst.RegisterFunction("queue.create_tube", func(ctx *CallContext, args []any) ([]any, error) {
+		name, _ := arg(args, 0).(string)
+		driver, _ := arg(args, 1).(string)
+		if name == "" || driver == "" {
+			return nil, ErrProcLua("Usage: queue.create_tube(name, type, opts)")
+		}
+		opts, _ := arg(args, 2).(map[any]any)
+		return nil, ctx.Instance.CreateTube(name, driver, opts)
+	})
+	inst.RegisterFunction("queue.statistics", func(ctx *CallContext, args []any) ([]any, error) {
+		return []any{ctx.Instance.queue.statistics(arg(args, 0))}, nil
+	})
+}
+
+// CreateTube creates the tube like queue.create_tube(name, driver, opts): ttl, ttr and pri options are
+// defaults for tasks, if_not_exists allows the existing tube
+func (inst *Instance) CreateTube(name, driver string, opts map[any]any) error {
+	q := inst.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.tubes[name]; ok {
+		if exists, _ := opts["if_not_exists"].(bool); exists {
+			return nil
+		}
+		return ErrProcLua("Tube %s already exists", name)
+	}
+	d, ok := tubeDrivers[driver]
+	if !ok {
+		return ErrProcLua("Unknown tube type %s", driver)
+	}
+	t := &tube{name: name, ttl: d.ttl, utube: d.utube, opts: opts, tasks: make(map[uint64]*task), calls: make(map[string]uint64)}
+	q.tubes[name] = t
+
+	prefix := "queue.tube." + name + ":"
+	for method, fn := range tubeMethods {
+		fn := fn
+		t.functions = append(t.functions, prefix+method)
+		inst.RegisterFunction(prefix+method, func(ctx *CallContext, args []any) ([]any, error) {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if q.tubes[name] != t {
+				return nil, ErrProcLua("Tube %s doesn't exist", name)
+			}
+			t.expire(time.Now())
+			return fn(q, ctx, t, args)
+		})
+	}
+	t.functions = append(t.functions, prefix+"take")
+	inst.RegisterBlockingFunction(prefix+"take", func(ctx *CallContext, args []any) ([]any, error) {
+		return q.take(ctx, t, args)
+	})
+	return nil
+}
+
+// notify wakes up takers, it's called with the queue locked
+func (q *queue) notify() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// take takes the next task waiting for it till the timeout, infinitely if there is no timeout
+func (q *queue) take(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	var deadline time.Time
+	if timeout := arg(args, 0); timeout != nil {
+		d, ok := seconds([]any{timeout})
+		if !ok {
+			return nil, ErrProcLua("Usage: tube:take(timeout)")
+		}
+		deadline = time.Now().Add(d)
+	}
+	for {
+		q.mu.Lock()
+		if err := ctx.Err(); err != nil {
+			q.mu.Unlock()
+			return nil, err
+		}
+		if q.tubes[t.name] != t {
+			q.mu.Unlock()
+			return []any{}, nil
+		}
+		now := time.Now()
+		t.expire(now)
+		if tk := t.next(); tk != nil {
+			tk.status, tk.session = taskTaken, ctx.Session
+			if tk.ttr > 0 {
+				tk.event = now.Add(tk.ttr)
+			}
+			t.calls["take"]++
+			taken := tk.tuple()
+			q.mu.Unlock()
+			return []any{taken}, nil
+		}
+		wake, event := q.wake, t.nextEvent()
+		q.mu.Unlock()
+
+		// the taker wakes up by a change, by the next event of tasks or by the timeout
+		if !deadline.IsZero() {
+			if !now.Before(deadline) {
+				return []any{}, nil
+			}
+			if event.IsZero() || deadline.Before(event) {
+				event = deadline
+			}
+		}
+		var timer *time.Timer
+		var fired <-chan time.Time
+		if !event.IsZero() {
+			timer = time.NewTimer(event.Sub(now))
+			fired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-fired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// put puts the task: data, opts
+func (q *queue) put(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	opts, _ := arg(args, 1).(map[any]any)
+	tk := &task{id: t.nextID, status: taskReady, data: arg(args, 0), pri: uint64(0)}
+	if t.ttl {
+		ttl, err := t.option(opts, "ttl")
+		if err != nil {
+			return nil, err
+		}
+		if tk.ttr, err = t.option(opts, "ttr"); err != nil {
+			return nil, err
+		}
+		if tk.ttr == 0 {
+			tk.ttr = ttl
+		}
+		delay, err := t.option(opts, "delay")
+		if err != nil {
+			return nil, err
+		}
+		if pri, ok := opts["pri"]; ok {
+			tk.pri = pri
+		} else if pri, ok := t.opts["pri"]; ok {
+			tk.pri = pri
+		}
+		now := time.Now()
+		if delay > 0 {
+			tk.status, tk.event = taskDelayed, now.Add(delay)
+		}
+		if ttl > 0 {
+			tk.deadline = now.Add(delay + ttl)
+		}
+	}
+	if u, ok := opts["utube"]; ok && t.utube {
+		tk.utube = fmt.Sprint(u)
+	}
+	t.nextID++
+	t.tasks[tk.id] = tk
+	t.calls["put"]++
+	q.notify()
+	return []any{tk.tuple()}, nil
+}
+
+// ack finishes the task taken by the session: task_id
+func (q *queue) ack(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	tk, err := t.taken(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	delete(t.tasks, tk.id)
+	tk.status = taskDone
+	t.done++
+	t.calls["ack"]++
+	q.notify()
+	return []any{tk.tuple()}, nil
+}
+
+// release returns the task taken by the session into the tube: task_id, opts with delay
+func (q *queue) release(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	tk, err := t.taken(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	opts, _ := arg(args, 1).(map[any]any)
+	delay, err := t.option(opts, "delay")
+	if err != nil {
+		return nil, err
+	}
+	tk.status, tk.event, tk.session = taskReady, time.Time{}, 0
+	if delay > 0 && t.ttl {
+		tk.status, tk.event = taskDelayed, time.Now().Add(delay)
+	}
+	t.calls["release"]++
+	q.notify()
+	return []any{tk.tuple()}, nil
+}
+
+// bury buries the task: task_id
+func (q *queue) bury(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	tk, err := t.task(args)
+	if err != nil {
+		return nil, err
+	}
+	if tk.status == taskTaken {
+		if tk, err = t.taken(ctx, args); err != nil {
+			return nil, err
+		}
+	}
+	tk.status, tk.event, tk.session = taskBuried, time.Time{}, 0
+	t.calls["bury"]++
+	q.notify()
+	return []any{tk.tuple()}, nil
+}
+
+// kick makes buried tasks ready: count
+func (q *queue) kick(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	count, ok := uintArg(args, 0)
+	if !ok {
+		return nil, ErrProcLua("Usage: tube:kick(count)")
+	}
+	var kicked uint64
+	for _, tk := range t.sorted() {
+		if kicked == count {
+			break
+		}
+		if tk.status == taskBuried {
+			tk.status = taskReady
+			kicked++
+		}
+	}
+	t.calls["kick"]++
+	q.notify()
+	return []any{kicked}, nil
+}
+
+// peek returns the task: task_id
+func (q *queue) peek(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	tk, err := t.task(args)
+	if err != nil {
+		return nil, err
+	}
+	return []any{tk.tuple()}, nil
+}
+
+// delete deletes the task: task_id
+func (q *queue) delete(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	tk, err := t.task(args)
+	if err != nil {
+		return nil, err
+	}
+	delete(t.tasks, tk.id)
+	tk.status = taskDone
+	t.calls["delete"]++
+	q.notify()
+	return []any{tk.tuple()}, nil
+}
+
+// touch prolongs ttr and ttl of the task taken by the session: task_id, delta
+func (q *queue) touch(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	tk, err := t.taken(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	delta, ok := seconds([]any{arg(args, 1)})
+	if !ok {
+		return nil, ErrProcLua("Usage: tube:touch(id, delta)")
+	}
+	if t.ttl && delta > 0 {
+		if tk.ttr > 0 {
+			tk.ttr += delta
+		}
+		if !tk.event.IsZero() {
+			tk.event = tk.event.Add(delta)
+		}
+		if !tk.deadline.IsZero() {
+			tk.deadline = tk.deadline.Add(delta)
+		}
+	}
+	t.calls["touch"]++
+	return []any{tk.tuple()}, nil
+}
+
+// truncate deletes all tasks
+func (q *queue) truncate(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	t.tasks = make(map[uint64]*task)
+	q.notify()
+	return []any{}, nil
+}
+
+// releaseAll releases all taken tasks
+func (q *queue) releaseAll(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	for _, tk := range t.tasks {
+		if tk.status == taskTaken {
+			tk.status, tk.event, tk.session = taskReady, time.Time{}, 0
+		}
+	}
+	q.notify()
+	return []any{}, nil
+}
+
+// drop drops the tube without taken tasks
+func (q *queue) drop(ctx *CallContext, t *tube, args []any) ([]any, error) {
+	for _, tk := range t.tasks {
+		if tk.status == taskTaken {
+			return nil, ErrProcLua("There are taken tasks in the tube")
+		}
+	}
+	delete(q.tubes, t.name)
+	for _, name := range t.functions {
+		ctx.Instance.unregisterFunction(name)
+	}
+	q.notify()
+	return []any{true}, nil
+}
+
+// releaseSession releases tasks taken by the closed session
+func (q *queue) releaseSession(session uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	released := false
+	for _, t := range q.tubes {
+		for _, tk := range t.tasks {
+			if tk.status == taskTaken && tk.session == session {
+				tk.status, tk.event, tk.session = taskReady, time.Time{}, 0
+				released = true
+			}
+		}
+	}
+	if released {
+		q.notify()
+	}
+}
+
+// statistics returns queue.statistics() of all tubes or of the named one
+func (q *queue) statistics(name any) any {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if name != nil {
+		s, _ := name.(string)
+		if t, ok := q.tubes[s]; ok {
+			return t.statistics()
+		}
+		return nil
+	}
+	all := make(map[any]any)
+	for name, t := range q.tubes {
+		all[name] = t.statistics()
+	}
+	return all
+}
+
+func (t *tube) statistics() map[any]any {
+	t.expire(time.Now())
+	tasks := map[any]any{"ready": uint64(0), "taken": uint64(0), "buried": uint64(0), "delayed": uint64(0),
+		"done": t.done, "total": uint64(len(t.tasks))}
+	names := map[string]string{taskReady: "ready", taskTaken: "taken", taskBuried: "buried", taskDelayed: "delayed"}
+	for _, tk := range t.tasks {
+		tasks[names[tk.status]] = tasks[names[tk.status]].(uint64) + 1
+	}
+	calls := make(map[any]any, len(tubeCalls))
+	for _, name := range tubeCalls {
+		calls[name] = t.calls[name]
+	}
+	return map[any]any{"tasks": tasks, "calls": calls}
+}
+
+// expire deletes tasks after ttl, returns taken tasks after ttr and delayed ones after the delay
+func (t *tube) expire(now time.Time) {
+	for id, tk := range t.tasks {
+		if !tk.deadline.IsZero() && !now.Before(tk.deadline) {
+			delete(t.tasks, id)
+			t.calls["ttl"]++
+			continue
+		}
+		if tk.event.IsZero() || now.Before(tk.event) {
+			continue
+		}
+		switch tk.status {
+		case taskTaken:
+			t.calls["ttr"]++
+		case taskDelayed:
+			t.calls["delay"]++
+		}
+		tk.status, tk.event, tk.session = taskReady, time.Time{}, 0
+	}
+}
+
+// nextEvent returns when the next task expires or becomes ready, zero if there is no such one
+func (t *tube) nextEvent() time.Time {
+	var next time.Time
+	for _, tk := range t.tasks {
+		for _, at := range []time.Time{tk.deadline, tk.event} {
+			if !at.IsZero() && (next.IsZero() || at.Before(next)) {
+				next = at
+			}
+		}
+	}
+	return next
+}
+
+// next returns the ready task to take: the first one by priority and id, subqueues of utube
+// with taken tasks are skipped
+func (t *tube) next() *task {
+	busy := make(map[string]bool)
+	if t.utube {
+		for _, tk := range t.tasks {
+			if tk.status == taskTaken {
+				busy[tk.utube] = true
+			}
+		}
+	}
+	var next *task
+	for _, tk := range t.sorted() {
+		if tk.status != taskReady || busy[tk.utube] {
+			continue
+		}
+		if next == nil || CompareValues(tk.pri, next.pri) < 0 {
+			next = tk
+		}
+	}
+	return next
+}
+
+// sorted returns tasks ordered by id
+func (t *tube) sorted() []*task {
+	tasks := make([]*task, 0, len(t.tasks))
+	for _, tk := range t.tasks {
+		tasks = append(tasks, tk)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].id < tasks[j].id })
+	return tasks
+}
+
+// task returns the task by id, the first argument
+func (t *tube) task(args []any) (*task, error) {
+	id, ok := uintArg(args, 0)
+	if !ok {
+		return nil, ErrProcLua("Task id must be a number")
+	}
+	tk, ok := t.tasks[id]
+	if !ok {
+		return nil, ErrProcLua("Task %d not found", id)
+	}
+	return tk, nil
+}
+
+// taken returns the task taken by the session
+func (t *tube) taken(ctx *CallContext, args []any) (*task, error) {
+	id, _ := uintArg(args, 0)
+	tk, ok := t.tasks[id]
+	if !ok || tk.status != taskTaken || tk.session != ctx.Session {
+		return nil, ErrProcLua("Task was not taken")
+	}
+	return tk, nil
+}
+
+// option returns the option given in seconds, the default one of the tube or 0
+func (t *tube) option(opts map[any]any, name string) (time.Duration, error) {
+	v, ok := opts[name]
+	if !ok {
+		v = t.opts[name]
+	}
+	if v == nil {
+		return 0, nil
+	}
+	d, ok := seconds([]any{v})
+	if !ok {
+		return 0, ErrProcLua("Option %s must be a non-negative number", name)
+	}
+	return d, nil
+}
+
+// tuple is the task like the queue returns it: {task_id, status, data}
+func (tk *task) tuple() []any {
+	return []any{tk.id, tk.status, tk.data}
+}
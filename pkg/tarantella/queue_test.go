@@ -0,0 +1,105 @@
+package tarantella
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inst, err := NewInstance(&Config{DataDir: t.TempDir(), QueueTubes: []string{"jobs:fifottl"}})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	call := func(name string, args ...any) []any {
+		ret, err := inst.Call(ctx, name, args)
+		require.NoError(t, err)
+		return ret
+	}
+
+	// take parks the request only, the ping is answered before it
+	rc := connectReplica(t, ctx, inst)
+	rc.send(IPROTO_CALL, map[any]any{IPROTO_FUNCTION_NAME: "queue.tube.jobs:take", IPROTO_TUPLE: []any{uint64(5)}})
+	rc.send(IPROTO_PING, map[any]any{})
+	_, body := rc.read()
+	require.NotContains(t, body, IPROTO_DATA)
+	require.Equal(t, []any{[]any{uint64(0), taskReady, "first"}}, call("queue.tube.jobs:put", "first"))
+	_, body = rc.read()
+	require.Equal(t, []any{[]any{uint64(0), taskTaken, "first"}}, body[IPROTO_DATA])
+
+	_, err = inst.Call(ctx, "queue.tube.jobs:ack", []any{uint64(0)})
+	require.Equal(t, "Task was not taken", err.(*BoxError).Message)
+	// the task is released when the connection is closed
+	rc.c.Close()
+	require.Eventually(t, func() bool {
+		return call("queue.tube.jobs:peek", uint64(0))[0].([]any)[1] == taskReady
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, []any{[]any{uint64(0), taskTaken, "first"}}, call("queue.tube.jobs:take", uint64(0)))
+	require.Equal(t, []any{[]any{uint64(0), taskDone, "first"}}, call("queue.tube.jobs:ack", uint64(0)))
+
+	// delayed tasks become ready, taken ones are returned after ttr
+	require.Equal(t, taskDelayed, call("queue.tube.jobs:put", "delayed", map[any]any{"delay": 0.05})[0].([]any)[1])
+	require.Empty(t, call("queue.tube.jobs:take", uint64(0)))
+	require.Equal(t, []any{[]any{uint64(1), taskTaken, "delayed"}}, call("queue.tube.jobs:take", uint64(1)))
+	require.Equal(t, taskBuried, call("queue.tube.jobs:bury", uint64(1))[0].([]any)[1])
+	require.Equal(t, []any{uint64(1)}, call("queue.tube.jobs:kick", uint64(10)))
+	call("queue.tube.jobs:delete", uint64(1))
+	call("queue.tube.jobs:put", "slow", map[any]any{"ttr": 0.05})
+	require.Equal(t, uint64(2), call("queue.tube.jobs:take", uint64(0))[0].([]any)[0])
+	require.Equal(t, uint64(2), call("queue.tube.jobs:take", uint64(1))[0].([]any)[0])
+
+	stat := call("queue.statistics", "jobs")[0].(map[any]any)
+	require.Equal(t, map[any]any{"ready": uint64(0), "taken": uint64(1), "buried": uint64(0), "delayed": uint64(0),
+		"done": uint64(1), "total": uint64(1)}, stat["tasks"])
+	calls := stat["calls"].(map[any]any)
+	require.Equal(t, []any{uint64(1), uint64(1), uint64(5)}, []any{calls["delay"], calls["ttr"], calls["take"]})
+
+	// utube gives one task of a subqueue at a time
+	call("queue.create_tube", "mail", "utube")
+	for _, u := range []string{"alice", "alice", "bob"} {
+		call("queue.tube.mail:put", u, map[any]any{"utube": u})
+	}
+	require.Equal(t, uint64(0), call("queue.tube.mail:take", uint64(0))[0].([]any)[0])
+	require.Equal(t, uint64(2), call("queue.tube.mail:take", uint64(0))[0].([]any)[0])
+	require.Empty(t, call("queue.tube.mail:take", uint64(0)))
+	call("queue.tube.mail:ack", uint64(0))
+	require.Equal(t, uint64(1), call("queue.tube.mail:take", uint64(0))[0].([]any)[0])
+
+	_, err = inst.Call(ctx, "queue.tube.mail:drop", nil)
+	require.Error(t, err)
+	call("queue.tube.mail:release_all")
+	call("queue.tube.mail:drop")
+	_, err = inst.Call(ctx, "queue.tube.mail:put", []any{"x"})
+	require.Equal(t, ER_NO_SUCH_PROC, err.(*BoxError).Code)
+}
+
+func TestQueueTakeSubscribed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inst, err := NewInstance(&Config{DataDir: t.TempDir(), QueueTubes: []string{"jobs:fifo"},
+		ReplicationTimeout: 20 * time.Millisecond})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+
+	// the parked take is answered after the stream of rows, not inside it
+	rc := connectReplica(t, ctx, inst)
+	rc.send(IPROTO_CALL, map[any]any{IPROTO_FUNCTION_NAME: "queue.tube.jobs:take", IPROTO_TUPLE: []any{uint64(5)}})
+	rc.send(IPROTO_SUBSCRIBE, map[any]any{
+		IPROTO_INSTANCE_UUID: "9d8c6b1c-54b5-4d35-a2cb-3a1e0fcd6c3e",
+		IPROTO_VCLOCK:        inst.Vclock().toMap(),
+		IPROTO_REPLICA_ANON:  true,
+	})
+	h, body := rc.read()
+	require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+	require.Contains(t, body, IPROTO_VCLOCK)
+	_, err = inst.Call(ctx, "queue.tube.jobs:put", []any{"first"})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		h, body = rc.read()
+		require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+		require.NotContains(t, body, IPROTO_DATA)
+	}
+}
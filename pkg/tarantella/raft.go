@@ -0,0 +1,231 @@
+package tarantella
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The election state machine of tarantool is emulated: there are no real votes, box.ctl.promote()
+// (or IPROTO_RAFT_PROMOTE) starts the next term, waits for the quorum like a synchronous transaction
+// and makes the instance the leader and the owner of the synchronous queue. The claim is written into
+// the log by RAFT_PROMOTE row, box.ctl.demote() gives it up by RAFT_DEMOTE. Replicas learn the term and
+// the leader from these rows and IPROTO_RAFT messages of the master. The state is broadcast by box.election
+
+const eventBoxElection = "box.election"
+
+// raft states like box.info.election.state
+const (
+	raftFollower  = "follower"
+	raftCandidate = "candidate"
+	raftLeader    = "leader"
+)
+
+// raftStates are values of IPROTO_RAFT_STATE
+var raftStates = map[uint64]string{1: raftFollower, 2: raftCandidate, 3: raftLeader}
+
+type (
+	// raft is the election state of the instance
+	raft struct {
+		mu         sync.Mutex
+		term       uint64
+		vote       uint64 // replica id voted for in the term
+		leader     uint64 // replica id of the leader, 0 if it's unknown
+		state      string
+		leaderSeen time.Time // when the leader was seen the last time
+		owner      uint64    // replica id of the owner of the synchronous queue, 0 if it's unclaimed
+		queueTerm  uint64    // term of the last PROMOTE or DEMOTE
+	}
+)
+
+func newRaft() *raft {
+	return &raft{term: 1, state: raftFollower}
+}
+
+// Promote makes the instance the leader of the term and the owner of the synchronous queue,
+// the next term is started if the term is 0
+func (inst *Instance) Promote(ctx context.Context, term uint64) error {
+	// pending synchronous transactions are finished first
+	inst.limbo.mu.Lock()
+	defer inst.limbo.mu.Unlock()
+
+	if inst.ID == 0 {
+		return ErrUnsupported("anonymous replica", "box.ctl.promote()")
+	}
+	r := inst.raft
+	r.mu.Lock()
+	if r.state == raftLeader && r.owner == inst.ID && (term == 0 || term == r.term) {
+		r.mu.Unlock()
+		return nil
+	}
+	if term == 0 {
+		term = r.term + 1
+	} else if term <= r.term {
+		r.mu.Unlock()
+		return ClientError(ER_SPLIT_BRAIN, "Got a PROMOTE/DEMOTE with an obsolete term")
+	}
+	r.term, r.vote, r.leader, r.state = term, inst.ID, 0, raftCandidate
+	r.mu.Unlock()
+	inst.broadcastElection()
+
+	ok, err := inst.limbo.quorum(ctx)
+	if err == nil && !ok {
+		err = ClientError(ER_QUORUM_WAIT, 1, "timed out")
+	}
+	if err == nil {
+		err = inst.writeSynchro(IPROTO_RAFT_PROMOTE, term)
+	}
+	r.mu.Lock()
+	if err != nil {
+		r.state = raftFollower
+	} else {
+		r.state, r.leader, r.leaderSeen = raftLeader, inst.ID, time.Now()
+		r.owner, r.queueTerm = inst.ID, term
+	}
+	r.mu.Unlock()
+	inst.broadcastElection()
+	if err == nil {
+		log.Info().Uint64("term", term).Msg("Instance is promoted")
+	}
+	return err
+}
+
+// Demote gives up the leadership and the synchronous queue starting the next term
+func (inst *Instance) Demote(ctx context.Context) error {
+	inst.limbo.mu.Lock()
+	defer inst.limbo.mu.Unlock()
+
+	r := inst.raft
+	r.mu.Lock()
+	term := r.term + 1
+	if r.state != raftLeader && r.owner != inst.ID {
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
+
+	if err := inst.writeSynchro(IPROTO_RAFT_DEMOTE, term); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.term, r.vote, r.leader, r.state = term, 0, 0, raftFollower
+	r.owner, r.queueTerm = 0, term
+	r.mu.Unlock()
+	inst.broadcastElection()
+	log.Info().Uint64("term", term).Msg("Instance is demoted")
+	return nil
+}
+
+// writeSynchro logs RAFT_PROMOTE or RAFT_DEMOTE row, rows of the instance are confirmed till its LSN
+func (inst *Instance) writeSynchro(requestType, term uint64) error {
+	return inst.wal.write([]*Row{{Type: requestType, Body: map[any]any{
+		IPROTO_REPLICA_ID: inst.ID,
+		IPROTO_LSN:        inst.LSN(),
+		IPROTO_TERM:       term,
+	}}})
+}
+
+// observe follows RAFT_PROMOTE or RAFT_DEMOTE row read from a log or a master
+func (r *raft) observe(row *Row) {
+	term, _ := row.Body[IPROTO_TERM].(uint64)
+	origin, _ := row.Body[IPROTO_REPLICA_ID].(uint64)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if term < r.queueTerm {
+		return
+	}
+	if term > r.term {
+		r.term, r.vote = term, 0
+	}
+	r.state, r.queueTerm, r.owner, r.leader = raftFollower, term, 0, 0
+	if row.Type == IPROTO_RAFT_PROMOTE {
+		r.owner, r.leader, r.leaderSeen = origin, origin, time.Now()
+	}
+}
+
+// observeMessage follows IPROTO_RAFT message of the master
+func (r *raft) observeMessage(masterID uint64, body map[any]any) {
+	term, _ := body[IPROTO_RAFT_TERM].(uint64)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if term < r.term {
+		return
+	}
+	if term > r.term {
+		r.term, r.vote, r.leader = term, 0, 0
+	}
+	r.state = raftFollower
+	if state, _ := body[IPROTO_RAFT_STATE].(uint64); raftStates[state] == raftLeader {
+		r.leader = masterID
+	} else if leader, ok := body[IPROTO_RAFT_LEADER_ID].(uint64); ok {
+		r.leader = leader
+	}
+	if r.leader != 0 {
+		r.leaderSeen = time.Now()
+	}
+}
+
+// restore makes the recovered instance the leader if it owns the synchronous queue
+func (r *raft) restore(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id != 0 && r.owner == id {
+		r.state, r.leader = raftLeader, id
+	}
+}
+
+// queueRows returns RAFT_PROMOTE or RAFT_DEMOTE row describing the synchronous queue for the snapshot
+func (r *raft) queueRows() []*Row {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.queueTerm == 0 {
+		return nil
+	}
+	requestType := IPROTO_RAFT_PROMOTE
+	if r.owner == 0 {
+		requestType = IPROTO_RAFT_DEMOTE
+	}
+	return []*Row{{Type: requestType, Body: map[any]any{
+		IPROTO_REPLICA_ID: r.owner,
+		IPROTO_TERM:       r.queueTerm,
+	}}}
+}
+
+// queueOwner returns replica id of the owner of the synchronous queue
+func (r *raft) queueOwner() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.owner
+}
+
+// info describes the state like box.info.election
+func (r *raft) info() map[any]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := map[any]any{"state": r.state, "term": r.term, "vote": r.vote, "leader": r.leader}
+	if r.leader != 0 {
+		info["leader_idle"] = time.Since(r.leaderSeen).Seconds()
+	}
+	return info
+}
+
+// synchroInfo describes the synchronous queue like box.info.synchro
+func (r *raft) synchroInfo() map[any]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return map[any]any{
+		"queue":  map[any]any{"owner": r.owner, "term": r.queueTerm, "len": uint64(0), "busy": false},
+		"quorum": uint64(1),
+	}
+}
+
+// broadcastElection updates box.election: {term, role, is_ro, leader}
+func (inst *Instance) broadcastElection() {
+	r := inst.raft
+	r.mu.Lock()
+	value := map[any]any{"term": r.term, "role": r.state, "is_ro": inst.storage.isReadOnly(), "leader": r.leader}
+	r.mu.Unlock()
+	inst.Broadcast(eventBoxElection, value)
+}
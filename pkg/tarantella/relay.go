@@ -0,0 +1,299 @@
+package tarantella
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Relays send rows to replicas like tarantool relays do: rows are read from log files,
+// so a replica may catch up from any vclock kept by the logs, and the files being written
+// are followed till the replica disconnects
+
+const defaultReplicationTimeout = time.Second
+
+type (
+	// relay feeds one replica connected by IPROTO_JOIN, IPROTO_REGISTER or IPROTO_SUBSCRIBE
+	relay struct {
+		inst     *Instance
+		w        *bufio.Writer
+		sync     uint64   // rows are sent with the sync of the request
+		uuid     string   // instance UUID of the replica
+		id       uint64   // replica id, 0 for anonymous replicas
+		idFilter []uint64 // rows of these replicas are not sent
+
+		mu    sync.Mutex
+		ack   Vclock    // the last vclock acknowledged by the replica
+		acked time.Time // when the last acknowledgement was received
+	}
+
+	// walCursor reads rows of log files after the vclock following the files being written
+	walCursor struct {
+		wal       *wal
+		vclock    Vclock // rows up to it are read
+		x         *xlogReader
+		signature uint64 // signature of the current file
+		opened    bool   // a file was opened, the next one continues it
+	}
+)
+
+// errCaughtUp is returned by walCursor when all written rows are read
+var errCaughtUp = errors.New("all rows are read")
+
+// writeRow sends the row as a package with the sync of the request
+func writeRow(w io.Writer, row *Row, sync uint64) error {
+	h := row.header()
+	h[IPROTO_SYNC] = sync
+
+	pb := getBuffer()
+	defer putBuffer(pb)
+	e := &mpEncoder{buf: append((*pb)[:0], mpUint32, 0, 0, 0, 0)}
+	err := e.encodeAny(h)
+	if err == nil && row.Body != nil {
+		err = e.encodeAny(row.Body)
+	}
+	*pb = e.buf
+	if err != nil {
+		return errors.Wrap(err, "unable to encode row")
+	}
+	binary.BigEndian.PutUint32(e.buf[1:5], uint32(len(e.buf)-5))
+	_, err = w.Write(e.buf)
+	return err
+}
+
+func newWalCursor(w *wal, vclock Vclock) *walCursor {
+	return &walCursor{wal: w, vclock: vclock.Copy()}
+}
+
+// next returns the next row after the vclock, errCaughtUp is returned if there are no more rows yet
+func (c *walCursor) next() (*Row, error) {
+	for {
+		if c.x == nil {
+			if err := c.open(); err != nil {
+				return nil, err
+			}
+		}
+		row, err := c.x.next()
+		switch {
+		case err == nil:
+			if row.LSN <= c.vclock[row.ReplicaID] {
+				continue
+			}
+			c.vclock[row.ReplicaID] = row.LSN
+			return row, nil
+		case errors.Is(err, io.EOF) && c.x.eof:
+			// the file is closed by rotation, rows continue in the next one
+			c.close()
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			// the block is being written, it's read again later
+			if err := c.x.rewind(); err != nil {
+				return nil, errors.Wrapf(err, "unable to read %s", c.x.path)
+			}
+			return nil, errCaughtUp
+		default:
+			return nil, errors.Wrapf(err, "unable to read %s", c.x.path)
+		}
+	}
+}
+
+// open opens the file containing rows after the vclock: the next file after the current one
+// or the last file starting before the vclock
+func (c *walCursor) open() error {
+	files, err := listFiles(c.wal.dir, walSuffix)
+	if err != nil {
+		return errors.Wrap(err, "unable to list logs")
+	}
+	signature, found := uint64(0), false
+	if c.opened {
+		for _, s := range files {
+			if s > c.signature {
+				signature, found = s, true
+				break
+			}
+		}
+	} else {
+		for _, s := range files {
+			if s <= c.vclock.Signature() {
+				signature, found = s, true
+			}
+		}
+	}
+	if !found {
+		if vclock := c.wal.Vclock(); !c.opened && vclock.Signature() > c.vclock.Signature() {
+			return ErrXlogGap(c.vclock, vclock)
+		}
+		return errCaughtUp
+	}
+
+	x, err := openXlog(fileName(c.wal.dir, signature, walSuffix), xlogFiletype)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errCaughtUp // the meta is not written yet
+		}
+		return err
+	}
+	c.x, c.signature, c.opened = x, signature, true
+	return nil
+}
+
+func (c *walCursor) close() {
+	if c.x != nil {
+		c.x.close()
+		c.x = nil
+	}
+}
+
+func (inst *Instance) newRelay(w *bufio.Writer, sync uint64, uuid string, id uint64) *relay {
+	return &relay{inst: inst, w: w, sync: sync, uuid: uuid, id: id}
+}
+
+func (inst *Instance) replicationTimeout() time.Duration {
+	if inst.cfg.ReplicationTimeout > 0 {
+		return inst.cfg.ReplicationTimeout
+	}
+	return defaultReplicationTimeout
+}
+
+// finalJoin sends rows written after the initial data was read till the stop vclock
+func (rl *relay) finalJoin(ctx context.Context, start, stop Vclock) error {
+	c := newWalCursor(rl.inst.wal, start)
+	defer c.close()
+
+	for !c.vclock.Reached(stop) {
+		changed := rl.inst.wal.changed()
+		row, err := c.next()
+		if errors.Is(err, errCaughtUp) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeRow(rl.w, row, rl.sync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribe sends rows after the vclock till the replica disconnects, heartbeats are sent
+// when there is nothing to send. The replica acknowledges received rows by its vclock
+func (rl *relay) subscribe(ctx context.Context, r *bufio.Reader, vclock Vclock) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		err := rl.readAcks(r)
+		log.Debug().Err(err).Str("uuid", rl.uuid).Msg("Replica stopped acknowledging rows")
+		cancel()
+	}()
+
+	c := newWalCursor(rl.inst.wal, vclock)
+	defer c.close()
+
+	timeout := rl.inst.replicationTimeout()
+	heartbeat := time.NewTicker(timeout / 2)
+	defer heartbeat.Stop()
+	sent := time.Now()
+	for {
+		changed := rl.inst.wal.changed()
+		row, err := c.next()
+		if err == nil {
+			if rl.filtered(row) {
+				continue
+			}
+			if err := writeRow(rl.w, row, rl.sync); err != nil {
+				return err
+			}
+			sent = time.Now()
+			continue
+		}
+		if !errors.Is(err, errCaughtUp) {
+			return err
+		}
+		if err := rl.w.Flush(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-heartbeat.C:
+			if time.Since(sent) < timeout {
+				continue
+			}
+			row := &Row{Type: IPROTO_OK, ReplicaID: rl.inst.ID, Timestamp: float64(time.Now().UnixNano()) / 1e9}
+			if err := writeRow(rl.w, row, rl.sync); err != nil {
+				return err
+			}
+			sent = time.Now()
+		}
+	}
+}
+
+// filtered is true for rows which the replica doesn't need: its own rows and rows of ID_FILTER
+func (rl *relay) filtered(row *Row) bool {
+	if rl.id != 0 && row.ReplicaID == rl.id {
+		return true
+	}
+	for _, id := range rl.idFilter {
+		if row.ReplicaID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// readAcks reads IPROTO_OK packages with the vclock of the replica
+func (rl *relay) readAcks(r *bufio.Reader) error {
+	for {
+		pack, err := readPackage(r)
+		if err != nil {
+			return err
+		}
+		br := &bodyReader{raw: pack.rawBody, m: pack.body, part: "packet body"}
+		vclock := br.vclock(IPROTO_VCLOCK, false)
+		pack.release()
+		if br.err != nil {
+			return br.err
+		}
+
+		rl.mu.Lock()
+		rl.ack, rl.acked = vclock, time.Now()
+		rl.mu.Unlock()
+	}
+}
+
+// downstream describes the relay like box.info.replication[id].downstream
+func (rl *relay) downstream() map[any]any {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	info := map[any]any{"status": "follow"}
+	if rl.ack != nil {
+		info["vclock"] = rl.ack.toMap()
+		info["idle"] = time.Since(rl.acked).Seconds()
+	}
+	return info
+}
+
+// addRelay makes the relay visible in box.info, call the returned function when it stops
+func (inst *Instance) addRelay(rl *relay) func() {
+	inst.relaysMu.Lock()
+	defer inst.relaysMu.Unlock()
+	inst.relays[rl] = struct{}{}
+	return func() {
+		inst.relaysMu.Lock()
+		defer inst.relaysMu.Unlock()
+		delete(inst.relays, rl)
+	}
+}
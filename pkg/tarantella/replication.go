@@ -0,0 +1,273 @@
+package tarantella
+
+import "github.com/rs/zerolog/log"
+
+// The instance is a replication master: replicas join it getting the data and subscribe
+// to the rows written after. Handlers write the packages of the exchange by themselves, so
+// they return errUnanswerable when it's done
+
+// replicate runs the handler holding the write lock of the connection, so responses to parked requests
+// and events are written after the exchange instead of getting between its packages
+func (clc *clientConnection) replicate(handler func() error) error {
+	clc.writeMu.Lock()
+	defer clc.writeMu.Unlock()
+	return handler()
+}
+
+// checkReplication checks that the instance is able to feed the replica
+func (clc *clientConnection) checkReplication(instanceUUID string) error {
+	if clc.inst.wal.mode == WalModeNone {
+		return ErrUnsupported("Replication", "wal_mode = 'none'")
+	}
+	if instanceUUID == clc.inst.UUID {
+		return ErrConnectionToSelf()
+	}
+	return nil
+}
+
+// join is IPROTO_JOIN: the initial data, registration in _cluster and rows written meanwhile
+func (clc *clientConnection) join(h RequestHeader, r *JoinRequest) error {
+	if err := clc.checkReplication(r.InstanceUUID); err != nil {
+		return err
+	}
+	start, err := clc.initialJoin(h, r.Version)
+	if err != nil {
+		return err
+	}
+	id, err := clc.inst.registerReplica(r.InstanceUUID)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("uuid", r.InstanceUUID).Uint64("id", id).Msg("Replica joined")
+
+	stop := clc.inst.Vclock()
+	if err := clc.sendVclock(h, stop); err != nil {
+		return err
+	}
+	if err := clc.inst.newRelay(clc.w, h.Sync, r.InstanceUUID, id).finalJoin(clc.ctx, start, stop); err != nil {
+		return err
+	}
+	return clc.endStream(h)
+}
+
+// fetchSnapshot is IPROTO_FETCH_SNAPSHOT: the initial data for an anonymous replica
+func (clc *clientConnection) fetchSnapshot(h RequestHeader, r *FetchSnapshotRequest) error {
+	if err := clc.checkReplication(""); err != nil {
+		return err
+	}
+	if _, err := clc.initialJoin(h, r.Version); err != nil {
+		return err
+	}
+	return clc.endStream(h)
+}
+
+// register is IPROTO_REGISTER: the anonymous replica is registered and gets rows after its vclock
+// written till the registration
+func (clc *clientConnection) register(h RequestHeader, r *RegisterRequest) error {
+	if err := clc.checkReplication(r.InstanceUUID); err != nil {
+		return err
+	}
+	id, err := clc.inst.registerReplica(r.InstanceUUID)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("uuid", r.InstanceUUID).Uint64("id", id).Msg("Replica registered")
+
+	stop := clc.inst.Vclock()
+	if err := clc.inst.newRelay(clc.w, h.Sync, r.InstanceUUID, id).finalJoin(clc.ctx, r.Vclock, stop); err != nil {
+		return err
+	}
+	return clc.endStream(h)
+}
+
+// subscribe is IPROTO_SUBSCRIBE: rows are streamed till the replica disconnects, so
+// the connection is done after it
+func (clc *clientConnection) subscribe(h RequestHeader, r *SubscribeRequest) error {
+	if err := clc.checkReplication(r.InstanceUUID); err != nil {
+		return err
+	}
+	var id uint64
+	if !r.Anon {
+		var ok bool
+		if id, ok = clc.inst.storage.replicaID(r.InstanceUUID); !ok {
+			return ErrTooEarlySubscribe(r.InstanceUUID)
+		}
+	}
+
+	res := NewResponse(h)
+	res.SetHeader(IPROTO_REPLICA_ID, clc.inst.ID)
+	res.SetBody(IPROTO_VCLOCK, clc.inst.Vclock().toMap())
+	res.SetBody(IPROTO_REPLICASET_UUID, clc.inst.storage.replicasetUUID())
+	err := clc.writeResponse(res, clc.w)
+	res.release()
+	if err == nil {
+		err = clc.w.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	rl := clc.inst.newRelay(clc.w, h.Sync, r.InstanceUUID, id)
+	rl.idFilter = r.IDFilter
+	defer clc.inst.addRelay(rl)()
+
+	log.Info().Str("uuid", r.InstanceUUID).Bool("anon", r.Anon).Stringer("vclock", r.Vclock).Msg("Replica subscribed")
+	err = rl.subscribe(clc.ctx, clc.r, r.Vclock)
+	if be, ok := AsBoxError(err); ok {
+		// the replica learns why the stream is stopped
+		res := NewResponse(h)
+		res.SetError(be, clc.errorExtension)
+		if clc.writeResponse(res, clc.w) == nil {
+			clc.w.Flush() //nolint: errcheck
+		}
+	}
+	log.Info().Err(err).Str("uuid", r.InstanceUUID).Msg("Replica unsubscribed")
+	return errConnectionDone
+}
+
+// initialJoin sends the vclock of the read view and its tuples, the vclock is returned
+func (clc *clientConnection) initialJoin(h RequestHeader, replicaVersion uint64) (Vclock, error) {
+	vclock, spaces := clc.inst.readView()
+	if err := clc.sendVclock(h, vclock); err != nil {
+		return nil, err
+	}
+	if replicaVersion > 0 {
+		// new replicas expect the meta stage, the instance has no raft or synchro state for it
+		for _, t := range []uint64{IPROTO_JOIN_META, IPROTO_JOIN_SNAPSHOT} {
+			if err := writeRow(clc.w, &Row{Type: t}, h.Sync); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, sp := range spaces {
+		for _, t := range sp.tuples {
+			row := &Row{Type: IPROTO_INSERT, Body: map[any]any{IPROTO_SPACE_ID: sp.id, IPROTO_TUPLE: t}}
+			if err := writeRow(clc.w, row, h.Sync); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return vclock, nil
+}
+
+// sendVclock sends IPROTO_OK with the vclock, it's a stage of JOIN and the end of row streams
+func (clc *clientConnection) sendVclock(h RequestHeader, vclock Vclock) error {
+	res := NewResponse(h)
+	res.SetBody(IPROTO_VCLOCK, vclock.toMap())
+	err := clc.writeResponse(res, clc.w)
+	res.release()
+	if err == nil {
+		err = clc.w.Flush()
+	}
+	return err
+}
+
+// endStream sends the current vclock after the rows
+func (clc *clientConnection) endStream(h RequestHeader) error {
+	if err := clc.sendVclock(h, clc.inst.Vclock()); err != nil {
+		return err
+	}
+	return errUnanswerable
+}
+
+type spaceView struct {
+	id     uint64
+	tuples [][]any
+}
+
+// readView returns tuples of persistent spaces and the vclock they match
+func (inst *Instance) readView() (Vclock, []spaceView) {
+	s := inst.storage
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vclock := inst.wal.Vclock()
+	var spaces []spaceView
+	for _, sp := range s.sortedSpaces() {
+		if sp.persistent() && sp.Len() > 0 {
+			// tuples aren't modified, but indexes are, so the list is copied
+			spaces = append(spaces, spaceView{id: sp.ID, tuples: append([][]any(nil), sp.Tuples()...)})
+		}
+	}
+	return vclock, spaces
+}
+
+// registerReplica adds the replica into _cluster with the smallest free id, the id
+// of an already registered replica is returned as is
+func (inst *Instance) registerReplica(instanceUUID string) (uint64, error) {
+	if id, ok := inst.storage.replicaID(instanceUUID); ok {
+		return id, nil
+	}
+	used := make(map[uint64]bool)
+	for _, t := range inst.storage.replicas() {
+		used[tupleUint(t, 0)] = true
+	}
+	for id := uint64(1); id < vclockMax; id++ {
+		if used[id] {
+			continue
+		}
+		_, err := inst.storage.Execute(&InsertRequest{SpaceID: BOX_CLUSTER_ID, Tuple: []any{id, instanceUUID}})
+		return id, err
+	}
+	return 0, ErrReplicaMax()
+}
+
+// replicationInfo describes known replicas like box.info.replication
+func (inst *Instance) replicationInfo() map[any]any {
+	vclock := inst.Vclock()
+	info := make(map[any]any)
+	for _, t := range inst.storage.replicas() {
+		id := tupleUint(t, 0)
+		info[id] = map[any]any{"id": id, "uuid": t[1], "lsn": vclock[id]}
+	}
+
+	inst.applierMu.Lock()
+	if inst.applier != nil {
+		id, upstream := inst.applier.upstream()
+		if r, ok := info[id].(map[any]any); ok {
+			r["upstream"] = upstream
+		}
+	}
+	inst.applierMu.Unlock()
+
+	inst.relaysMu.Lock()
+	defer inst.relaysMu.Unlock()
+	for rl := range inst.relays {
+		if r, ok := info[rl.id].(map[any]any); ok && rl.id != 0 {
+			r["downstream"] = rl.downstream()
+		}
+	}
+	return info
+}
+
+// anonReplicas returns the number of subscribed anonymous replicas
+func (inst *Instance) anonReplicas() uint64 {
+	inst.relaysMu.Lock()
+	defer inst.relaysMu.Unlock()
+	var n uint64
+	for rl := range inst.relays {
+		if rl.id == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// ballot describes the instance for IPROTO_VOTE, replicas and routers look for the master by it
+func (inst *Instance) ballot() map[any]any {
+	readOnly := inst.storage.isReadOnly()
+	uuids := []any{}
+	for _, t := range inst.storage.replicas() {
+		uuids = append(uuids, t[1])
+	}
+	return map[any]any{
+		IPROTO_BALLOT_IS_RO_CFG:                readOnly,
+		IPROTO_BALLOT_VCLOCK:                   inst.Vclock().toMap(),
+		IPROTO_BALLOT_GC_VCLOCK:                inst.gcVclock().toMap(),
+		IPROTO_BALLOT_IS_RO:                    readOnly,
+		IPROTO_BALLOT_IS_ANON:                  inst.ID == 0,
+		IPROTO_BALLOT_IS_BOOTED:                true,
+		IPROTO_BALLOT_CAN_LEAD:                 false,
+		IPROTO_BALLOT_REGISTERED_REPLICA_UUIDS: uuids,
+	}
+}
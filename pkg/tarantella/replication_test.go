@@ -0,0 +1,400 @@
+package tarantella
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// replicaConn is the connection of a replica or a client to the instance
+type replicaConn struct {
+	t *testing.T
+	c net.Conn
+}
+
+func connectReplica(t *testing.T, ctx context.Context, inst *Instance) *replicaConn {
+	server, client := net.Pipe()
+	go processClient(ctx, server, inst) //nolint: errcheck
+	return newReplicaConn(t, client)
+}
+
+func dialReplica(t *testing.T, addr string) *replicaConn {
+	var c net.Conn
+	require.Eventually(t, func() bool {
+		var err error
+		c, err = net.Dial("tcp", addr)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	return newReplicaConn(t, c)
+}
+
+func newReplicaConn(t *testing.T, c net.Conn) *replicaConn {
+	t.Cleanup(func() { c.Close() })
+	greeting := make([]byte, IPROTO_GREETING_SIZE)
+	_, err := io.ReadFull(c, greeting)
+	require.NoError(t, err)
+	return &replicaConn{t: t, c: c}
+}
+
+func (rc *replicaConn) send(requestType uint64, body map[any]any) {
+	_, err := rc.c.Write(requestBytes(rc.t, requestType, body))
+	require.NoError(rc.t, err)
+}
+
+// read returns the header and the body of the next package
+func (rc *replicaConn) read() (map[any]any, map[any]any) {
+	pack, err := readPackage(rc.c)
+	require.NoError(rc.t, err)
+	return pack.Header(), pack.Body()
+}
+
+// readTill reads packages till IPROTO_OK, INSERT rows into the space are returned
+func (rc *replicaConn) readTill(spaceID uint64) (map[any]any, []*Row) {
+	var rows []*Row
+	for {
+		h, body := rc.read()
+		require.Equal(rc.t, uint64(100500), h[IPROTO_SYNC])
+		switch h[IPROTO_REQUEST_TYPE] {
+		case IPROTO_OK:
+			return body, rows
+		case IPROTO_INSERT:
+			if body[IPROTO_SPACE_ID] == spaceID {
+				lsn, _ := h[IPROTO_LSN].(uint64)
+				rows = append(rows, &Row{Type: IPROTO_INSERT, LSN: lsn, Body: body})
+			}
+		case IPROTO_JOIN_META, IPROTO_JOIN_SNAPSHOT:
+		default:
+			rc.t.Fatalf("unexpected package %v", h)
+		}
+	}
+}
+
+func TestReplication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inst, err := NewInstance(&Config{DataDir: t.TempDir(), ReplicationTimeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	_, err = inst.storage.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{uint64(1), "Roxette", uint64(1986)}})
+	require.NoError(t, err)
+
+	// an anonymous replica gets the data
+	rc := connectReplica(t, ctx, inst)
+	rc.send(IPROTO_FETCH_SNAPSHOT, map[any]any{IPROTO_SERVER_VERSION: uint64(0x20a04)})
+	body, _ := rc.readTill(testerSpaceID)
+	require.Equal(t, map[any]any{uint64(1): uint64(1)}, body[IPROTO_VCLOCK])
+	body, rows := rc.readTill(testerSpaceID)
+	require.Equal(t, map[any]any{uint64(1): uint64(1)}, body[IPROTO_VCLOCK])
+	require.Len(t, rows, 1)
+	require.Equal(t, []any{uint64(1), "Roxette", uint64(1986)}, rows[0].Body[IPROTO_TUPLE])
+
+	// it subscribes to new rows and gets heartbeats
+	rc.send(IPROTO_SUBSCRIBE, map[any]any{
+		IPROTO_INSTANCE_UUID: "9d8c6b1c-54b5-4d35-a2cb-3a1e0fcd6c3e",
+		IPROTO_VCLOCK:        map[any]any{uint64(1): uint64(1)},
+		IPROTO_REPLICA_ANON:  true,
+	})
+	h, body := rc.read()
+	require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+	require.Equal(t, uint64(1), h[IPROTO_REPLICA_ID])
+	require.NotEmpty(t, body[IPROTO_REPLICASET_UUID])
+
+	_, err = inst.storage.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{uint64(2), "Scorpions", uint64(2015)}})
+	require.NoError(t, err)
+	h, body = rc.read()
+	require.Equal(t, IPROTO_INSERT, h[IPROTO_REQUEST_TYPE])
+	require.Equal(t, uint64(2), h[IPROTO_LSN])
+	require.Equal(t, uint64(1), h[IPROTO_REPLICA_ID])
+	require.Contains(t, h, IPROTO_TIMESTAMP)
+	require.Equal(t, []any{uint64(2), "Scorpions", uint64(2015)}, body[IPROTO_TUPLE])
+
+	h, _ = rc.read()
+	require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+	require.Contains(t, h, IPROTO_TIMESTAMP)
+	require.Equal(t, uint64(1), inst.Info()["replication_anon"].(map[any]any)["count"])
+
+	// a replica joins and is registered in _cluster by the logged row
+	const replicaUUID = "4a1e7f66-9b3c-4d2e-8f5a-6b7c8d9e0f1a"
+	rc = connectReplica(t, ctx, inst)
+	rc.send(IPROTO_JOIN, map[any]any{IPROTO_INSTANCE_UUID: replicaUUID})
+	body, _ = rc.readTill(BOX_CLUSTER_ID)
+	require.Equal(t, map[any]any{uint64(1): uint64(2)}, body[IPROTO_VCLOCK])
+	body, rows = rc.readTill(BOX_CLUSTER_ID)
+	require.Equal(t, map[any]any{uint64(1): uint64(3)}, body[IPROTO_VCLOCK])
+	require.Len(t, rows, 1) // the master itself
+	body, rows = rc.readTill(BOX_CLUSTER_ID)
+	require.Equal(t, map[any]any{uint64(1): uint64(3)}, body[IPROTO_VCLOCK])
+	require.Len(t, rows, 1)
+	require.Equal(t, uint64(3), rows[0].LSN)
+	require.Equal(t, []any{uint64(2), replicaUUID}, rows[0].Body[IPROTO_TUPLE])
+
+	replication := inst.Info()["replication"].(map[any]any)
+	require.Equal(t, replicaUUID, replication[uint64(2)].(map[any]any)["uuid"])
+
+	// it is able to subscribe now
+	rc.send(IPROTO_SUBSCRIBE, map[any]any{
+		IPROTO_INSTANCE_UUID: replicaUUID,
+		IPROTO_VCLOCK:        map[any]any{uint64(1): uint64(3)},
+	})
+	h, _ = rc.read()
+	require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+
+	rc = connectReplica(t, ctx, inst)
+	rc.send(IPROTO_SUBSCRIBE, map[any]any{
+		IPROTO_INSTANCE_UUID: "0f6e1d5c-8a7b-4c3d-9e2f-1a0b9c8d7e6f",
+		IPROTO_VCLOCK:        map[any]any{},
+	})
+	h, body = rc.read()
+	require.Equal(t, IPROTO_TYPE_ERROR|uint64(ER_TOO_EARLY_SUBSCRIBE), h[IPROTO_REQUEST_TYPE])
+	require.Contains(t, body[IPROTO_ERROR_24], "until join is done")
+}
+
+func TestAnonymousReplica(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	master, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer master.Close() //nolint: errcheck
+	_, err = master.storage.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{uint64(1), "Roxette", uint64(1986)}})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go processClient(ctx, conn, master) //nolint: errcheck
+		}
+	}()
+
+	// the data is fetched on bootstrap
+	cfg := &Config{DataDir: t.TempDir(), ReplicationSource: ln.Addr().String(), ReplicationTimeout: 100 * time.Millisecond}
+	replica, err := NewInstance(cfg)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), replica.ID)
+	selectAll := func(inst *Instance) []any {
+		data, err := inst.storage.Select(&SelectRequest{SpaceID: testerSpaceID, Limit: 10, Iterator: ITER_ALL})
+		require.NoError(t, err)
+		return data
+	}
+	require.Len(t, selectAll(replica), 1)
+
+	// new rows are applied and logged with LSNs of the master
+	go replica.Run(ctx)
+	_, err = master.storage.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{uint64(2), "Scorpions", uint64(2015)}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(selectAll(replica)) == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, master.Vclock(), replica.Vclock())
+
+	info := replica.Info()
+	require.Equal(t, true, info["ro"])
+	upstream := info["replication"].(map[any]any)[uint64(1)].(map[any]any)["upstream"].(map[any]any)
+	require.Equal(t, "follow", upstream["status"])
+
+	_, err = replica.storage.Execute(&DeleteRequest{SpaceID: testerSpaceID, Key: []any{uint64(1)}})
+	require.Equal(t, "Can't modify data on a read-only instance", err.Error())
+
+	// the master knows the vclock of the replica
+	require.Eventually(t, func() bool { return master.anonReplicas() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// the replica restarts from its own files
+	cancel()
+	require.NoError(t, replica.Close())
+	replica, err = NewInstance(cfg)
+	require.NoError(t, err)
+	defer replica.Close() //nolint: errcheck
+	require.Len(t, selectAll(replica), 2)
+	require.Equal(t, master.Vclock(), replica.Vclock())
+}
+
+func TestReplicaFailedRow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	master, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer master.Close() //nolint: errcheck
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go processClient(ctx, conn, master) //nolint: errcheck
+		}
+	}()
+
+	cfg := &Config{DataDir: t.TempDir(), ReplicationSource: ln.Addr().String(), ReplicationTimeout: 100 * time.Millisecond}
+	replica, err := NewInstance(cfg)
+	require.NoError(t, err)
+	replicaCtx, stopReplica := context.WithCancel(ctx)
+	go replica.Run(replicaCtx)
+	selectAll := func(inst *Instance) []any {
+		data, err := inst.storage.Select(&SelectRequest{SpaceID: testerSpaceID, Limit: 10, Iterator: ITER_ALL})
+		require.NoError(t, err)
+		return data
+	}
+
+	// the tuple which isn't logged by the replica breaks the second row of the transaction
+	require.NoError(t, replica.storage.Apply(&Row{Type: IPROTO_INSERT, Body: map[any]any{
+		IPROTO_SPACE_ID: testerSpaceID, IPROTO_TUPLE: []any{uint64(2), "Europe", uint64(1979)}}}))
+	tx := master.storage.Begin(0)
+	for _, tuple := range [][]any{{uint64(1), "Roxette", uint64(1986)}, {uint64(2), "Scorpions", uint64(2015)}} {
+		_, err = tx.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: tuple})
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	require.Eventually(t, func() bool {
+		upstream := replica.Info()["replication"].(map[any]any)[uint64(1)].(map[any]any)["upstream"].(map[any]any)
+		message, _ := upstream["message"].(string)
+		return strings.Contains(message, "Duplicate key exists")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the first row is undone and nothing is logged
+	require.Equal(t, []any{[]any{uint64(2), "Europe", uint64(1979)}}, selectAll(replica))
+	require.NotEqual(t, master.Vclock(), replica.Vclock())
+
+	// the replica restarts from its files and gets the transaction again
+	stopReplica()
+	require.NoError(t, replica.Close())
+	replica, err = NewInstance(cfg)
+	require.NoError(t, err)
+	defer replica.Close() //nolint: errcheck
+	go replica.Run(ctx)
+	require.Eventually(t, func() bool { return len(selectAll(replica)) == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, selectAll(master), selectAll(replica))
+	require.Equal(t, master.Vclock(), replica.Vclock())
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inst, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer inst.Close()
+	rc := connectReplica(t, ctx, inst)
+
+	status := func() map[any]any {
+		h, body := rc.read()
+		require.Equal(t, IPROTO_EVENT, h[IPROTO_REQUEST_TYPE])
+		require.Equal(t, eventBoxStatus, body[IPROTO_EVENT_KEY])
+		return body[IPROTO_EVENT_DATA].(map[any]any)
+	}
+	rc.send(IPROTO_WATCH, map[any]any{IPROTO_EVENT_KEY: eventBoxStatus})
+	require.Equal(t, false, status()["is_ro"])
+
+	rc.send(IPROTO_CALL, map[any]any{IPROTO_FUNCTION_NAME: "box.cfg", IPROTO_TUPLE: []any{map[any]any{"read_only": true}}})
+	h, _ := rc.read()
+	require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+
+	rc.send(IPROTO_INSERT, map[any]any{IPROTO_SPACE_ID: testerSpaceID, IPROTO_TUPLE: []any{uint64(1), "Roxette", uint64(1986)}})
+	h, _ = rc.read()
+	require.Equal(t, IPROTO_TYPE_ERROR|uint64(ER_READONLY), h[IPROTO_REQUEST_TYPE])
+
+	// the next event is sent after the acknowledgement
+	rc.send(IPROTO_WATCH, map[any]any{IPROTO_EVENT_KEY: eventBoxStatus})
+	require.Equal(t, true, status()["is_ro"])
+
+	inst.SetReadOnly(false)
+	rc.send(IPROTO_WATCH, map[any]any{IPROTO_EVENT_KEY: eventBoxStatus})
+	require.Equal(t, false, status()["is_ro"])
+}
+
+func TestReplicaset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var addrs []string
+	for i := 0; i < 3; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addrs = append(addrs, ln.Addr().String())
+		ln.Close()
+	}
+	cfg := &Config{DataDir: t.TempDir(), Replicaset: addrs, ReplicasetLeader: addrs[1], ReplicationTimeout: 100 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- StartServer(ctx, cfg) }()
+
+	ballot := func(addr string) map[any]any {
+		rc := dialReplica(t, addr)
+		rc.send(IPROTO_VOTE, nil)
+		h, body := rc.read()
+		require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+		return body[IPROTO_BALLOT].(map[any]any)
+	}
+	leader := ballot(addrs[1])
+	require.Equal(t, false, leader[IPROTO_BALLOT_IS_RO])
+	require.Equal(t, false, leader[IPROTO_BALLOT_IS_ANON])
+	require.Equal(t, true, leader[IPROTO_BALLOT_IS_BOOTED])
+
+	// replicas are registered by the leader
+	require.Eventually(t, func() bool {
+		uuids := ballot(addrs[1])[IPROTO_BALLOT_REGISTERED_REPLICA_UUIDS].([]any)
+		return len(uuids) == 3
+	}, 10*time.Second, 20*time.Millisecond)
+	replica := ballot(addrs[0])
+	require.Equal(t, true, replica[IPROTO_BALLOT_IS_RO])
+	require.Equal(t, false, replica[IPROTO_BALLOT_IS_ANON])
+
+	// writes go through the leader only
+	rc := dialReplica(t, addrs[1])
+	rc.send(IPROTO_INSERT, map[any]any{IPROTO_SPACE_ID: testerSpaceID, IPROTO_TUPLE: []any{uint64(1), "Roxette", uint64(1986)}})
+	h, _ := rc.read()
+	require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+
+	rc = dialReplica(t, addrs[2])
+	rc.send(IPROTO_INSERT, map[any]any{IPROTO_SPACE_ID: testerSpaceID, IPROTO_TUPLE: []any{uint64(2), "Scorpions", uint64(2015)}})
+	h, _ = rc.read()
+	require.Equal(t, IPROTO_TYPE_ERROR|uint64(ER_READONLY), h[IPROTO_REQUEST_TYPE])
+
+	require.Eventually(t, func() bool {
+		rc.send(IPROTO_SELECT, map[any]any{IPROTO_SPACE_ID: testerSpaceID, IPROTO_LIMIT: uint64(10), IPROTO_KEY: []any{uint64(1)}})
+		_, body := rc.read()
+		return len(body[IPROTO_DATA].([]any)) == 1
+	}, 10*time.Second, 20*time.Millisecond)
+
+	// the first replica becomes the leader
+	rc.send(IPROTO_CALL, map[any]any{IPROTO_FUNCTION_NAME: "tarantella.failover", IPROTO_TUPLE: []any{addrs[0]}})
+	h, body := rc.read()
+	require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE], body)
+	require.Equal(t, []any{addrs[0]}, body[IPROTO_DATA])
+	require.Equal(t, true, ballot(addrs[1])[IPROTO_BALLOT_IS_RO])
+	require.Equal(t, false, ballot(addrs[0])[IPROTO_BALLOT_IS_RO])
+
+	rc = dialReplica(t, addrs[1])
+	rc.send(IPROTO_INSERT, map[any]any{IPROTO_SPACE_ID: testerSpaceID, IPROTO_TUPLE: []any{uint64(2), "Scorpions", uint64(2015)}})
+	h, _ = rc.read()
+	require.Equal(t, IPROTO_TYPE_ERROR|uint64(ER_READONLY), h[IPROTO_REQUEST_TYPE])
+
+	rc = dialReplica(t, addrs[0])
+	rc.send(IPROTO_INSERT, map[any]any{IPROTO_SPACE_ID: testerSpaceID, IPROTO_TUPLE: []any{uint64(2), "Scorpions", uint64(2015)}})
+	h, _ = rc.read()
+	require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+
+	// the old leader and the other replica follow the new one
+	for _, addr := range addrs[1:] {
+		rc := dialReplica(t, addr)
+		require.Eventually(t, func() bool {
+			rc.send(IPROTO_SELECT, map[any]any{IPROTO_SPACE_ID: testerSpaceID, IPROTO_LIMIT: uint64(10), IPROTO_KEY: []any{uint64(2)}})
+			_, body := rc.read()
+			return len(body[IPROTO_DATA].([]any)) == 1
+		}, 10*time.Second, 20*time.Millisecond, addr)
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,554 @@
+package tarantella
+
+import (
+	"math"
+	"strconv"
+)
+
+// see https://www.tarantool.io/en/doc/latest/dev_guide/internals/box_protocol/
+
+type (
+	// RequestHeader is the header common for all requests
+	RequestHeader struct {
+		Type          uint64
+		Sync          uint64
+		SchemaVersion uint64
+		StreamID      uint64
+	}
+
+	// IDRequest is IPROTO_ID
+	IDRequest struct {
+		Version  uint64
+		Features []uint64
+		AuthType string
+	}
+
+	// AuthRequest is IPROTO_AUTH
+	AuthRequest struct {
+		Username string
+		Method   string // chap-sha1, pap-sha256
+		Scramble []byte
+	}
+
+	// PingRequest is IPROTO_PING
+	PingRequest struct{}
+
+	// SelectRequest is IPROTO_SELECT
+	SelectRequest struct {
+		SpaceID       uint64
+		IndexID       uint64
+		Limit         uint64
+		Offset        uint64
+		Iterator      uint64
+		Key           []any
+		FetchPosition bool
+		AfterPosition []byte
+		AfterTuple    []any
+	}
+
+	// InsertRequest is IPROTO_INSERT or IPROTO_REPLACE
+	InsertRequest struct {
+		Replace bool
+		SpaceID uint64
+		Tuple   []any
+	}
+
+	// UpdateRequest is IPROTO_UPDATE
+	UpdateRequest struct {
+		SpaceID   uint64
+		IndexID   uint64
+		IndexBase uint64
+		Key       []any
+		Ops       []any
+	}
+
+	// UpsertRequest is IPROTO_UPSERT
+	UpsertRequest struct {
+		SpaceID   uint64
+		IndexBase uint64
+		Tuple     []any
+		Ops       []any
+	}
+
+	// DeleteRequest is IPROTO_DELETE
+	DeleteRequest struct {
+		SpaceID uint64
+		IndexID uint64
+		Key     []any
+	}
+
+	// CallRequest is IPROTO_CALL or IPROTO_CALL_16
+	CallRequest struct {
+		Call16       bool // result has to be wrapped into tuples
+		FunctionName string
+		Args         []any
+	}
+
+	// EvalRequest is IPROTO_EVAL
+	EvalRequest struct {
+		Expr string
+		Args []any
+	}
+
+	// ExecuteRequest is IPROTO_EXECUTE or IPROTO_PREPARE, SQLText is empty if StmtID is set
+	ExecuteRequest struct {
+		Prepare bool
+		SQLText string
+		StmtID  uint64
+		Bind    []any
+		Options []any
+	}
+
+	// BeginRequest is IPROTO_BEGIN
+	BeginRequest struct {
+		Timeout      float64
+		TxnIsolation uint64
+	}
+
+	// CommitRequest is IPROTO_COMMIT
+	CommitRequest struct{}
+
+	// RollbackRequest is IPROTO_ROLLBACK
+	RollbackRequest struct{}
+
+	// WatchRequest is IPROTO_WATCH or IPROTO_UNWATCH
+	WatchRequest struct {
+		Unwatch bool
+		Key     string
+	}
+
+	// JoinRequest is IPROTO_JOIN, the replica is registered and gets the data
+	JoinRequest struct {
+		InstanceUUID string
+		Version      uint64 // IPROTO_SERVER_VERSION of the replica, 0 for old ones
+	}
+
+	// FetchSnapshotRequest is IPROTO_FETCH_SNAPSHOT, an anonymous replica gets the data
+	FetchSnapshotRequest struct {
+		Version uint64
+	}
+
+	// RegisterRequest is IPROTO_REGISTER, an anonymous replica becomes a registered one
+	RegisterRequest struct {
+		InstanceUUID string
+		Vclock       Vclock
+	}
+
+	// SubscribeRequest is IPROTO_SUBSCRIBE, the replica gets rows after its vclock
+	SubscribeRequest struct {
+		InstanceUUID   string
+		ReplicasetUUID string
+		Vclock         Vclock
+		Anon           bool
+		IDFilter       []uint64 // rows of these replicas are not sent
+		Version        uint64
+	}
+
+	// VoteRequest is IPROTO_VOTE, the ballot of the instance is requested
+	VoteRequest struct{}
+
+	// PromoteRequest is IPROTO_RAFT_PROMOTE or IPROTO_RAFT_DEMOTE like box.ctl.promote() and box.ctl.demote(),
+	// the term is the next one if it's 0
+	PromoteRequest struct {
+		Demote bool
+		Term   uint64
+	}
+
+	// RawRequest is a request without typed representation, body is left as is
+	RawRequest struct {
+		Body map[any]any
+	}
+
+	// bodyReader extracts typed values from the raw or decoded map validating them
+	bodyReader struct {
+		raw  []byte // nil if the map is decoded
+		m    map[any]any
+		part string // packet body or packet header
+		err  *BoxError
+	}
+)
+
+// iterator types, see https://github.com/tarantool/tarantool/blob/master/src/box/iterator_type.h
+const (
+	ITER_EQ               uint64 = 0
+	ITER_REQ              uint64 = 1
+	ITER_ALL              uint64 = 2
+	ITER_LT               uint64 = 3
+	ITER_LE               uint64 = 4
+	ITER_GE               uint64 = 5
+	ITER_GT               uint64 = 6
+	ITER_BITS_ALL_SET     uint64 = 7
+	ITER_BITS_ANY_SET     uint64 = 8
+	ITER_BITS_ALL_NOT_SET uint64 = 9
+	ITER_OVERLAPS         uint64 = 10
+	ITER_NEIGHBOR         uint64 = 11
+)
+
+// DecodeHeader validates the header of the request
+func DecodeHeader(pack *Package) (RequestHeader, error) {
+	h := RequestHeader{}
+	r := &bodyReader{raw: pack.rawHeader, m: pack.header, part: "packet header"}
+
+	h.Type = r.uint(IPROTO_REQUEST_TYPE, false, 0)
+	h.Sync = r.uint(IPROTO_SYNC, false, 0)
+	h.SchemaVersion = r.uint(IPROTO_SCHEMA_VERSION, false, 0)
+	h.StreamID = r.uint(IPROTO_STREAM_ID, false, 0)
+	if r.err != nil {
+		return h, r.err
+	}
+	return h, nil
+}
+
+// DecodeRequest decodes the body of the package into typed request,
+// validation errors are returned as *BoxError
+func DecodeRequest(pack *Package, requestType uint64) (any, error) {
+	return decodeRequest(&bodyReader{raw: pack.rawBody, m: pack.body, part: "packet body"}, requestType)
+}
+
+// requestFromMap makes typed request from the decoded body
+func requestFromMap(requestType uint64, body map[any]any) (any, error) {
+	return decodeRequest(&bodyReader{m: body, part: "packet body"}, requestType)
+}
+
+func decodeRequest(r *bodyReader, requestType uint64) (any, error) { //nolint: cyclop
+	var req any
+	switch requestType {
+	case IPROTO_ID:
+		req = r.id()
+	case IPROTO_AUTH:
+		req = r.auth()
+	case IPROTO_PING:
+		req = &PingRequest{}
+	case IPROTO_SELECT:
+		req = r.selectRequest()
+	case IPROTO_INSERT, IPROTO_REPLACE:
+		req = &InsertRequest{
+			Replace: requestType == IPROTO_REPLACE,
+			SpaceID: r.uint(IPROTO_SPACE_ID, true, 0),
+			Tuple:   r.array(IPROTO_TUPLE, true),
+		}
+	case IPROTO_UPDATE:
+		req = &UpdateRequest{
+			SpaceID:   r.uint(IPROTO_SPACE_ID, true, 0),
+			IndexID:   r.uint(IPROTO_INDEX_ID, false, 0),
+			IndexBase: r.uint(IPROTO_INDEX_BASE, false, 0),
+			Key:       r.array(IPROTO_KEY, true),
+			Ops:       r.array(IPROTO_TUPLE, true), // UPDATE keeps operations in TUPLE
+		}
+	case IPROTO_UPSERT:
+		req = &UpsertRequest{
+			SpaceID:   r.uint(IPROTO_SPACE_ID, true, 0),
+			IndexBase: r.uint(IPROTO_INDEX_BASE, false, 0),
+			Tuple:     r.array(IPROTO_TUPLE, true),
+			Ops:       r.array(IPROTO_OPS, true),
+		}
+	case IPROTO_DELETE:
+		req = &DeleteRequest{
+			SpaceID: r.uint(IPROTO_SPACE_ID, true, 0),
+			IndexID: r.uint(IPROTO_INDEX_ID, false, 0),
+			Key:     r.array(IPROTO_KEY, true),
+		}
+	case IPROTO_CALL, IPROTO_CALL_16:
+		req = &CallRequest{
+			Call16:       requestType == IPROTO_CALL_16,
+			FunctionName: r.str(IPROTO_FUNCTION_NAME, true),
+			Args:         r.array(IPROTO_TUPLE, false),
+		}
+	case IPROTO_EVAL:
+		req = &EvalRequest{
+			Expr: r.str(IPROTO_EXPR, true),
+			Args: r.array(IPROTO_TUPLE, false),
+		}
+	case IPROTO_EXECUTE, IPROTO_PREPARE:
+		req = r.execute(requestType == IPROTO_PREPARE)
+	case IPROTO_BEGIN:
+		req = &BeginRequest{
+			Timeout:      r.float(IPROTO_TIMEOUT),
+			TxnIsolation: r.uint(IPROTO_TXN_ISOLATION, false, 0),
+		}
+	case IPROTO_COMMIT:
+		req = &CommitRequest{}
+	case IPROTO_ROLLBACK:
+		req = &RollbackRequest{}
+	case IPROTO_WATCH, IPROTO_UNWATCH:
+		req = &WatchRequest{
+			Unwatch: requestType == IPROTO_UNWATCH,
+			Key:     r.str(IPROTO_EVENT_KEY, true),
+		}
+	case IPROTO_JOIN:
+		req = &JoinRequest{
+			InstanceUUID: r.str(IPROTO_INSTANCE_UUID, true),
+			Version:      r.uint(IPROTO_SERVER_VERSION, false, 0),
+		}
+	case IPROTO_FETCH_SNAPSHOT:
+		req = &FetchSnapshotRequest{Version: r.uint(IPROTO_SERVER_VERSION, false, 0)}
+	case IPROTO_REGISTER:
+		req = &RegisterRequest{
+			InstanceUUID: r.str(IPROTO_INSTANCE_UUID, true),
+			Vclock:       r.vclock(IPROTO_VCLOCK, true),
+		}
+	case IPROTO_SUBSCRIBE:
+		req = r.subscribe()
+	case IPROTO_VOTE, IPROTO_VOTE_DEPRECATED:
+		req = &VoteRequest{}
+	case IPROTO_RAFT_PROMOTE, IPROTO_RAFT_DEMOTE:
+		req = &PromoteRequest{
+			Demote: requestType == IPROTO_RAFT_DEMOTE,
+			Term:   r.uint(IPROTO_TERM, false, 0),
+		}
+	default:
+		req = &RawRequest{Body: r.decoded()}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return req, nil
+}
+
+func (r *bodyReader) id() *IDRequest {
+	req := &IDRequest{
+		Version:  r.uint(IPROTO_VERSION, false, 0),
+		AuthType: r.str(IPROTO_AUTH_TYPE, false),
+	}
+	for _, f := range r.array(IPROTO_FEATURES, false) {
+		if n, ok := f.(uint64); ok {
+			req.Features = append(req.Features, n)
+		} else {
+			r.invalid()
+		}
+	}
+	return req
+}
+
+func (r *bodyReader) auth() *AuthRequest {
+	req := &AuthRequest{
+		Username: r.str(IPROTO_USER_NAME, true),
+	}
+	tuple := r.array(IPROTO_TUPLE, false)
+	if len(tuple) == 0 {
+		return req // guest
+	}
+	req.Method, _ = tuple[0].(string)
+	if len(tuple) > 1 {
+		switch s := tuple[1].(type) {
+		case string:
+			req.Scramble = []byte(s)
+		case []byte:
+			req.Scramble = s
+		}
+	}
+	return req
+}
+
+func (r *bodyReader) selectRequest() *SelectRequest {
+	req := &SelectRequest{
+		SpaceID:  r.uint(IPROTO_SPACE_ID, true, 0),
+		IndexID:  r.uint(IPROTO_INDEX_ID, false, 0),
+		Limit:    r.uint(IPROTO_LIMIT, true, math.MaxUint32),
+		Offset:   r.uint(IPROTO_OFFSET, false, 0),
+		Iterator: r.uint(IPROTO_ITERATOR, false, ITER_EQ),
+		Key:      r.array(IPROTO_KEY, true),
+	}
+	if v, ok := r.value(IPROTO_FETCH_POSITION); ok {
+		req.FetchPosition, ok = v.(bool)
+		if !ok {
+			r.invalid()
+		}
+	}
+	if v, ok := r.value(IPROTO_AFTER_POSITION); ok {
+		switch p := v.(type) {
+		case string:
+			req.AfterPosition = []byte(p)
+		case []byte:
+			req.AfterPosition = p
+		default:
+			r.invalid()
+		}
+	}
+	req.AfterTuple = r.array(IPROTO_AFTER_TUPLE, false)
+	if req.Iterator > ITER_NEIGHBOR {
+		r.fail(ErrIteratorType(iteratorName(req.Iterator)))
+	}
+	return req
+}
+
+func (r *bodyReader) subscribe() *SubscribeRequest {
+	req := &SubscribeRequest{
+		InstanceUUID:   r.str(IPROTO_INSTANCE_UUID, true),
+		ReplicasetUUID: r.str(IPROTO_REPLICASET_UUID, false),
+		Vclock:         r.vclock(IPROTO_VCLOCK, true),
+		Version:        r.uint(IPROTO_SERVER_VERSION, false, 0),
+	}
+	if v, ok := r.value(IPROTO_REPLICA_ANON); ok {
+		req.Anon, ok = v.(bool)
+		if !ok {
+			r.invalid()
+		}
+	}
+	for _, id := range r.array(IPROTO_ID_FILTER, false) {
+		if n, ok := id.(uint64); ok {
+			req.IDFilter = append(req.IDFilter, n)
+		} else {
+			r.invalid()
+		}
+	}
+	return req
+}
+
+func (r *bodyReader) execute(prepare bool) *ExecuteRequest {
+	req := &ExecuteRequest{
+		Prepare: prepare,
+		SQLText: r.str(IPROTO_SQL_TEXT, false),
+		StmtID:  r.uint(IPROTO_STMT_ID, false, 0),
+		Bind:    r.array(IPROTO_SQL_BIND, false),
+		Options: r.array(IPROTO_OPTIONS, false),
+	}
+	if req.SQLText == "" && req.StmtID == 0 && r.err == nil {
+		r.fail(ClientError(ER_MISSING_REQUEST_FIELD, "SQL text or prepared statement id"))
+	}
+	return req
+}
+
+// value returns the value of the key decoding only it
+func (r *bodyReader) value(key uint64) (any, bool) {
+	if r.raw == nil {
+		v, ok := r.m[key]
+		return v, ok
+	}
+	d := &mpDecoder{buf: r.raw}
+	found, err := d.lookup(key)
+	if err != nil {
+		r.invalid()
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+	v, err := d.decodeAny()
+	if err != nil {
+		r.invalid()
+		return nil, false
+	}
+	return v, true
+}
+
+// decoded returns the whole decoded map
+func (r *bodyReader) decoded() map[any]any {
+	if r.raw == nil {
+		return r.m
+	}
+	return decodeRawMap(r.raw)
+}
+
+// invalid fails with ER_INVALID_MSGPACK
+func (r *bodyReader) invalid() {
+	r.fail(ErrInvalidMsgpack(r.part))
+}
+
+// fail remembers the first error
+func (r *bodyReader) fail(e *BoxError) {
+	if r.err == nil {
+		r.err = e
+	}
+}
+
+// uint returns unsigned value of the key, negative values are invalid
+func (r *bodyReader) uint(key uint64, required bool, def uint64) uint64 {
+	n, found, ok := rawUint(r.raw, r.m, key)
+	if !found {
+		if required {
+			r.fail(ErrMissingRequestField(key))
+		}
+		return def
+	}
+	if !ok {
+		r.invalid()
+	}
+	return n
+}
+
+func (r *bodyReader) str(key uint64, required bool) string {
+	v, ok := r.value(key)
+	if !ok {
+		if required {
+			r.fail(ErrMissingRequestField(key))
+		}
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		r.invalid()
+	}
+	return s
+}
+
+// vclock returns the vclock encoded as a map {replica id: lsn}
+func (r *bodyReader) vclock(key uint64, required bool) Vclock {
+	v, ok := r.value(key)
+	if !ok {
+		if required {
+			r.fail(ErrMissingRequestField(key))
+		}
+		return Vclock{}
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		r.invalid()
+		return Vclock{}
+	}
+	vc := make(Vclock, len(m))
+	for id, lsn := range m {
+		i, okID := id.(uint64)
+		n, okLSN := lsn.(uint64)
+		if !okID || !okLSN {
+			r.invalid()
+			return Vclock{}
+		}
+		vc[i] = n
+	}
+	return vc
+}
+
+func (r *bodyReader) array(key uint64, required bool) []any {
+	v, ok := r.value(key)
+	if !ok {
+		if required {
+			r.fail(ErrMissingRequestField(key))
+		}
+		return nil
+	}
+	a, ok := v.([]any)
+	if !ok {
+		r.invalid()
+	}
+	return a
+}
+
+func (r *bodyReader) float(key uint64) float64 {
+	v, ok := r.value(key)
+	if !ok {
+		return 0
+	}
+	switch f := v.(type) {
+	case float64:
+		return f
+	case float32:
+		return float64(f)
+	case uint64:
+		return float64(f)
+	default:
+		r.invalid()
+		return 0
+	}
+}
+
+// iteratorName returns the name of the iterator like box.index.EQ
+func iteratorName(iterator uint64) string {
+	names := []string{"EQ", "REQ", "ALL", "LT", "LE", "GE", "GT",
+		"BITS_ALL_SET", "BITS_ANY_SET", "BITS_ALL_NOT_SET", "OVERLAPS", "NEIGHBOR"}
+	if iterator < uint64(len(names)) {
+		return names[iterator]
+	}
+	return strconv.FormatUint(iterator, 10)
+}
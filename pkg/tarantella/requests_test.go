@@ -0,0 +1,52 @@
+package tarantella
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	decode := func(requestType uint64, body map[any]any) (any, *BoxError) {
+		pack := &Package{}
+		pack.SetHeader(IPROTO_REQUEST_TYPE, requestType)
+		pack.body = body
+		req, err := DecodeRequest(pack, requestType)
+		be, _ := AsBoxError(err)
+		return req, be
+	}
+
+	req, be := decode(IPROTO_SELECT, map[any]any{
+		IPROTO_SPACE_ID: uint64(512), IPROTO_LIMIT: uint64(10), IPROTO_KEY: []any{uint64(1)},
+	})
+	require.Nil(t, be)
+	require.Equal(t, &SelectRequest{SpaceID: 512, Limit: 10, Iterator: ITER_EQ, Key: []any{uint64(1)}}, req)
+
+	// ID without features must not panic
+	req, be = decode(IPROTO_ID, map[any]any{})
+	require.Nil(t, be)
+	require.Equal(t, &IDRequest{}, req)
+
+	_, be = decode(IPROTO_SELECT, map[any]any{IPROTO_SPACE_ID: uint64(512), IPROTO_KEY: []any{}})
+	require.Equal(t, ER_MISSING_REQUEST_FIELD, be.Code)
+	require.Equal(t, "Missing mandatory field 'limit' in request", be.Message)
+
+	// negative fixint space id
+	_, be = decode(IPROTO_INSERT, map[any]any{IPROTO_SPACE_ID: int64(-1), IPROTO_TUPLE: []any{}})
+	require.Equal(t, ER_INVALID_MSGPACK, be.Code)
+	require.Equal(t, "Invalid MsgPack - packet body", be.Message)
+
+	_, be = decode(IPROTO_CALL, map[any]any{IPROTO_TUPLE: []any{}})
+	require.Equal(t, "Missing mandatory field 'function_name' in request", be.Message)
+
+	_, be = decode(IPROTO_SELECT, map[any]any{
+		IPROTO_SPACE_ID: uint64(512), IPROTO_LIMIT: uint64(10), IPROTO_KEY: []any{}, IPROTO_ITERATOR: uint64(42),
+	})
+	require.Equal(t, ER_ITERATOR_TYPE, be.Code)
+
+	pack := &Package{}
+	pack.SetHeader(IPROTO_SYNC, "sync")
+	_, err := DecodeHeader(pack)
+	be, _ = AsBoxError(err)
+	require.Equal(t, "Invalid MsgPack - packet header", be.Message)
+}
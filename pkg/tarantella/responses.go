@@ -0,0 +1,37 @@
+package tarantella
+
+// NewResponse creates a successful response for the request
+func NewResponse(h RequestHeader) *Package {
+	res := &Package{}
+	res.SetHeader(IPROTO_SYNC, h.Sync)
+	res.SetHeader(IPROTO_REQUEST_TYPE, IPROTO_OK)
+	return res
+}
+
+// SetSchemaVersion sets IPROTO_SCHEMA_VERSION
+func (pack *Package) SetSchemaVersion(version uint64) {
+	pack.SetHeader(IPROTO_SCHEMA_VERSION, version)
+}
+
+// SetData sets IPROTO_DATA, for DML and SELECT it is an array of tuples,
+// for CALL it is an array of returned values
+func (pack *Package) SetData(data []any) {
+	if data == nil {
+		data = []any{}
+	}
+	pack.SetBody(IPROTO_DATA, data)
+}
+
+// SetPosition sets IPROTO_POSITION of the last selected tuple
+func (pack *Package) SetPosition(position []byte) {
+	pack.SetBody(IPROTO_POSITION, position)
+}
+
+// SetID sets the body of IPROTO_ID response
+func (pack *Package) SetID(version uint64, features []uint64, authType string) {
+	pack.SetBody(IPROTO_VERSION, version)
+	pack.SetBody(IPROTO_FEATURES, features)
+	if authType != "" {
+		pack.SetBody(IPROTO_AUTH_TYPE, authType)
+	}
+}
@@ -0,0 +1,183 @@
+package tarantella
+
+import (
+	"math"
+	"sort"
+)
+
+// rtree indexes keep boxes of array fields: dimension coordinates of a point or 2*dimension ones of a box,
+// the lower corner first; entries are sorted by the primary key and iterators check each of them
+
+const rtreeMaxDimension = 20
+
+// box is a rectangle or a point of the rtree
+type box struct {
+	lo, hi []float64
+}
+
+// dimension returns the dimension option of the rtree, 2 by default
+func (idx *Index) dimension() int {
+	if dim, ok := intValue(idx.Opts["dimension"]); ok {
+		return int(dim)
+	}
+	return 2
+}
+
+// checkRtreeOpts checks dimension and distance options
+func (idx *Index) checkRtreeOpts() error {
+	if dim := idx.dimension(); dim < 1 || dim > rtreeMaxDimension {
+		return ClientError(ER_WRONG_INDEX_OPTIONS, "dimension must belong to range [1, 20]")
+	}
+	switch distance := idx.Opts["distance"].(type) {
+	case nil:
+	case string:
+		if distance != "euclid" && distance != "manhattan" {
+			return ClientError(ER_UNKNOWN_RTREE_INDEX_DISTANCE_TYPE, distance)
+		}
+	default:
+		return ClientError(ER_WRONG_INDEX_OPTIONS, "distance must be a string")
+	}
+	return nil
+}
+
+// rect parses coordinates of a point or a box, what names the value in the error
+func (idx *Index) rect(v any, what string) (box, error) {
+	dim := idx.dimension()
+	coords, _ := v.([]any)
+	if len(coords) != dim && len(coords) != 2*dim {
+		return box{}, ClientError(ER_RTREE_RECT, what, dim, 2*dim)
+	}
+	values := make([]float64, len(coords))
+	for i, c := range coords {
+		f, ok := coordinate(c)
+		if !ok {
+			return box{}, ClientError(ER_RTREE_RECT, what, dim, 2*dim)
+		}
+		values[i] = f
+	}
+	if len(values) == dim {
+		return box{lo: values, hi: values}, nil
+	}
+	b := box{lo: values[:dim], hi: values[dim:]}
+	for d := 0; d < dim; d++ {
+		if b.lo[d] > b.hi[d] {
+			b.lo[d], b.hi[d] = b.hi[d], b.lo[d]
+		}
+	}
+	return b, nil
+}
+
+// coordinate converts the number into float64
+func coordinate(v any) (float64, bool) {
+	if classOf(v) != mpClassNumber {
+		return 0, false
+	}
+	switch f := v.(type) {
+	case float64:
+		return f, true
+	case float32:
+		return float64(f), true
+	}
+	f, _ := numberRat(v).Float64()
+	return f, true
+}
+
+// matches checks the box against the key by the iterator like spatial_search_op of tarantool
+func (b box) matches(iterator uint64, key box) bool {
+	for d := range b.lo {
+		var ok bool
+		switch iterator {
+		case ITER_EQ:
+			ok = b.lo[d] == key.lo[d] && b.hi[d] == key.hi[d]
+		case ITER_GT: // strictly contains the key
+			ok = b.lo[d] < key.lo[d] && b.hi[d] > key.hi[d]
+		case ITER_GE: // contains the key
+			ok = b.lo[d] <= key.lo[d] && b.hi[d] >= key.hi[d]
+		case ITER_LT: // strictly belongs to the key
+			ok = b.lo[d] > key.lo[d] && b.hi[d] < key.hi[d]
+		case ITER_LE: // belongs to the key
+			ok = b.lo[d] >= key.lo[d] && b.hi[d] <= key.hi[d]
+		case ITER_OVERLAPS:
+			ok = b.lo[d] <= key.hi[d] && key.lo[d] <= b.hi[d]
+		default:
+			ok = true
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// distance returns the distance from the point to the nearest point of the box
+func (b box) distance(point []float64, manhattan bool) float64 {
+	var sum float64
+	for d, p := range point {
+		var delta float64
+		switch {
+		case p < b.lo[d]:
+			delta = b.lo[d] - p
+		case p > b.hi[d]:
+			delta = p - b.hi[d]
+		}
+		if manhattan {
+			sum += delta
+		} else {
+			sum += delta * delta
+		}
+	}
+	if manhattan {
+		return sum
+	}
+	return math.Sqrt(sum)
+}
+
+// selectRtree selects tuples by the spatial iterator, the key is a box or its coordinates
+func (idx *Index) selectRtree(iterator uint64, key []any, offset, limit uint64) ([]any, error) {
+	switch iterator {
+	case ITER_ALL, ITER_EQ, ITER_GT, ITER_GE, ITER_LT, ITER_LE, ITER_OVERLAPS, ITER_NEIGHBOR:
+	default:
+		return nil, idx.unsupported("requested iterator type")
+	}
+
+	var k box
+	if len(key) == 0 {
+		iterator = ITER_ALL
+	} else {
+		coords := any(key)
+		if array, ok := key[0].([]any); ok && len(key) == 1 {
+			coords = array
+		}
+		var err error
+		if k, err = idx.rect(coords, "Key"); err != nil {
+			return nil, err
+		}
+	}
+
+	type found struct {
+		tuple    []any
+		distance float64
+	}
+	var matched []found
+	manhattan := idx.Opts["distance"] == "manhattan"
+	for _, t := range idx.tuples {
+		b, err := idx.rect(idx.Parts[0].value(t), "Field")
+		if err != nil {
+			return nil, err
+		}
+		if iterator == ITER_NEIGHBOR {
+			matched = append(matched, found{tuple: t, distance: b.distance(k.lo, manhattan)})
+		} else if iterator == ITER_ALL || b.matches(iterator, k) {
+			matched = append(matched, found{tuple: t})
+		}
+	}
+	if iterator == ITER_NEIGHBOR {
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].distance < matched[j].distance })
+	}
+
+	data := []any{}
+	for i := offset; i < uint64(len(matched)) && uint64(len(data)) < limit; i++ {
+		data = append(data, matched[i].tuple)
+	}
+	return data, nil
+}
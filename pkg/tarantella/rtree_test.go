@@ -0,0 +1,56 @@
+package tarantella
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRtree(t *testing.T) {
+	inst, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	s := inst.storage
+
+	sp, err := s.createSpace("zones", map[any]any{}, []any{},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}},
+		[]any{1, "area", "rtree", map[any]any{"unique": false}, []any{[]any{1, "array"}}},
+		[]any{2, "spot", "rtree", map[any]any{"unique": false, "distance": "manhattan"}, []any{[]any{2, "array"}}},
+	)
+	require.NoError(t, err)
+	for _, tuple := range [][]any{
+		{uint64(1), []any{0.0, 0.0, 10.0, 10.0}, []any{uint64(1), uint64(1)}},
+		{uint64(2), []any{5, 5, 15, 15}, []any{uint64(4), uint64(0)}},
+		{uint64(3), []any{20, 20, 30, 30}, []any{uint64(2), uint64(3)}},
+		{uint64(4), []any{2, 2}, []any{uint64(0), uint64(3)}},
+	} {
+		_, err = s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: tuple})
+		require.NoError(t, err)
+	}
+	ids := func(index, iterator uint64, key ...any) []any {
+		data, err := s.Select(&SelectRequest{SpaceID: sp.ID, IndexID: index, Iterator: iterator, Key: key, Limit: 10})
+		require.NoError(t, err)
+		var ids []any
+		for _, t := range data {
+			ids = append(ids, t.([]any)[0])
+		}
+		return ids
+	}
+
+	require.Equal(t, []any{uint64(1), uint64(2)}, ids(1, ITER_OVERLAPS, []any{9, 9, 12, 12}))
+	require.Equal(t, []any{uint64(1), uint64(4)}, ids(1, ITER_GE, 2, 2))
+	require.Equal(t, []any{uint64(1)}, ids(1, ITER_GT, []any{1, 1, 3, 3}))
+	require.Equal(t, []any{uint64(1), uint64(4)}, ids(1, ITER_LE, []any{-1, -1, 11, 11}))
+	require.Equal(t, []any{uint64(4)}, ids(1, ITER_EQ, 2, 2))
+	require.Equal(t, []any{uint64(3), uint64(2), uint64(1), uint64(4)}, ids(1, ITER_NEIGHBOR, 25, 40))
+	// manhattan distances from (0, 0) are 2, 4, 5 and 3, euclid ones would place 3 before 2
+	require.Equal(t, []any{uint64(1), uint64(4), uint64(2), uint64(3)}, ids(2, ITER_NEIGHBOR, 0, 0))
+
+	_, err = s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{uint64(5), []any{1, 2, 3}, []any{0, 0}}})
+	require.EqualError(t, err, "RTree: Field must be an array with 2 (point) or 4 (rectangle/box) numeric coordinates")
+	_, err = s.Select(&SelectRequest{SpaceID: sp.ID, IndexID: 1, Iterator: ITER_GE, Key: []any{1}, Limit: 1})
+	require.EqualError(t, err, "RTree: Key must be an array with 2 (point) or 4 (rectangle/box) numeric coordinates")
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{sp.ID, uint64(3), "cube", "rtree",
+		map[any]any{"unique": false, "dimension": uint64(21)}, []any{[]any{uint64(1), "array"}}}})
+	require.Equal(t, ER_WRONG_INDEX_OPTIONS, err.(*BoxError).Code)
+}
@@ -0,0 +1,329 @@
+package tarantella
+
+import (
+	"math"
+	"strings"
+)
+
+// Sequences are kept like in tarantool: definitions in _sequence, current values in _sequence_data,
+// _space_sequence attaches a sequence to a field of the primary key. Insert, replace or upsert with nil
+// in the field gets the next value, a greater explicit value moves the sequence forward, either way
+// _sequence_data is changed by the same transaction
+
+type (
+	// Sequence is a sequence with its definition from _sequence
+	Sequence struct {
+		ID    uint64
+		Owner uint64
+		Name  string
+		Step  int64
+		Min   int64
+		Max   int64
+		Start int64
+		Cache int64
+		Cycle bool
+	}
+)
+
+func sequenceFromTuple(t []any) (*Sequence, error) {
+	seq := &Sequence{ID: tupleUint(t, 0), Owner: tupleUint(t, 1)}
+	seq.Name, _ = tupleField(t, 2).(string)
+	ints := []*int64{&seq.Step, &seq.Min, &seq.Max, &seq.Start, &seq.Cache}
+	for i, p := range ints {
+		v, ok := intValue(tupleField(t, uint64(i)+3))
+		if !ok {
+			return nil, ClientError(ER_CREATE_SEQUENCE, seq.Name, "invalid sequence definition")
+		}
+		*p = v
+	}
+	seq.Cycle, _ = tupleField(t, 8).(bool)
+	switch {
+	case seq.Step == 0:
+		return nil, ClientError(ER_CREATE_SEQUENCE, seq.Name, "step option must be non-zero")
+	case seq.Min >= seq.Max:
+		return nil, ClientError(ER_CREATE_SEQUENCE, seq.Name, "max must be greater than min")
+	case seq.Start < seq.Min || seq.Start > seq.Max:
+		return nil, ClientError(ER_CREATE_SEQUENCE, seq.Name, "start must be between min and max")
+	}
+	return seq, nil
+}
+
+// tuple returns _sequence tuple of the sequence
+func (seq *Sequence) tuple() []any {
+	return []any{seq.ID, seq.Owner, seq.Name, intTuple(seq.Step), intTuple(seq.Min), intTuple(seq.Max),
+		intTuple(seq.Start), intTuple(seq.Cache), seq.Cycle}
+}
+
+// next returns the value after the current one like sequence:next() does
+func (seq *Sequence) next(current int64, started bool) (int64, error) {
+	if !started {
+		return seq.Start, nil
+	}
+	if seq.Step > 0 && current > seq.Max-seq.Step || seq.Step < 0 && current < seq.Min-seq.Step {
+		if !seq.Cycle {
+			return 0, ClientError(ER_SEQUENCE_OVERFLOW, seq.Name)
+		}
+		if seq.Step > 0 {
+			return seq.Min, nil
+		}
+		return seq.Max, nil
+	}
+	return current + seq.Step, nil
+}
+
+// CreateSequence creates the sequence like box.schema.sequence.create(name, opts) does: step, min, max,
+// start, cache, cycle and if_not_exists options are supported
+func (s *Storage) CreateSequence(name string, opts map[any]any) (*Sequence, error) {
+	s.mu.RLock()
+	t, _ := s.spaces[BOX_SEQUENCE_ID].get(2, []any{name})
+	var id uint64
+	for _, t := range s.spaces[BOX_SEQUENCE_ID].Tuples() {
+		if tupleUint(t, 0) > id {
+			id = tupleUint(t, 0)
+		}
+	}
+	s.mu.RUnlock()
+	if t != nil {
+		if exists, _ := opts["if_not_exists"].(bool); exists {
+			return sequenceFromTuple(t)
+		}
+		return nil, ClientError(ER_SEQUENCE_EXISTS, name)
+	}
+
+	seq := &Sequence{ID: id + 1, Owner: 1, Name: name, Step: 1, Min: 1, Max: math.MaxInt64}
+	if step, ok := intValue(opts["step"]); ok {
+		seq.Step = step
+	}
+	if seq.Step < 0 {
+		seq.Min, seq.Max = math.MinInt64, -1
+	}
+	for key, p := range map[string]*int64{"min": &seq.Min, "max": &seq.Max, "cache": &seq.Cache} {
+		if v, ok := intValue(opts[key]); ok {
+			*p = v
+		}
+	}
+	seq.Start = seq.Min
+	if seq.Step < 0 {
+		seq.Start = seq.Max
+	}
+	if start, ok := intValue(opts["start"]); ok {
+		seq.Start = start
+	}
+	seq.Cycle, _ = opts["cycle"].(bool)
+	if _, err := s.Execute(&InsertRequest{SpaceID: BOX_SEQUENCE_ID, Tuple: seq.tuple()}); err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
+
+// sequenceByName returns the sequence by name
+func (s *Storage) sequenceByName(name string) (*Sequence, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, _ := s.spaces[BOX_SEQUENCE_ID].get(2, []any{name})
+	if t == nil {
+		return nil, ClientError(ER_NO_SUCH_SEQUENCE, name)
+	}
+	return sequenceFromTuple(t)
+}
+
+// sequence returns the sequence by id
+func (s *Storage) sequence(id uint64) (*Sequence, error) {
+	t, _ := s.spaces[BOX_SEQUENCE_ID].get(0, []any{id})
+	if t == nil {
+		return nil, ClientError(ER_NO_SUCH_SEQUENCE, id)
+	}
+	return sequenceFromTuple(t)
+}
+
+// sequenceValue returns the current value of the sequence, false if it's not started
+func (s *Storage) sequenceValue(id uint64) (int64, bool) {
+	t, _ := s.spaces[BOX_SEQUENCE_DATA_ID].get(0, []any{id})
+	if t == nil {
+		return 0, false
+	}
+	return intValue(tupleField(t, 1))
+}
+
+// SequenceNext returns the next value of the sequence, it's written into _sequence_data
+func (s *Storage) SequenceNext(id uint64) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	if s.readOnly {
+		return 0, ErrReadonly()
+	}
+	seq, err := s.sequence(id)
+	if err != nil {
+		return 0, err
+	}
+	value, err := seq.next(s.sequenceValue(id))
+	if err != nil {
+		return 0, err
+	}
+	_, err = s.execute(&InsertRequest{Replace: true, SpaceID: BOX_SEQUENCE_DATA_ID, Tuple: []any{id, intTuple(value)}}, true)
+	return value, err
+}
+
+// generate fills the field of the tuple attached to the sequence if it's nil, it returns the tuple and
+// the change of _sequence_data, nil if the sequence stays the same
+func (s *Storage) generate(sp *Space, tuple []any) ([]any, *change, error) {
+	links, ok := s.spaces[BOX_SPACE_SEQUENCE_ID]
+	if !ok || len(links.Indexes) == 0 {
+		// the catalog is being bootstrapped
+		return tuple, nil, nil
+	}
+	link, _ := links.get(0, []any{sp.ID})
+	if link == nil {
+		return tuple, nil, nil
+	}
+	seq, err := s.sequence(tupleUint(link, 1))
+	if err != nil {
+		return nil, nil, err
+	}
+	field := tupleUint(link, 3)
+	current, started := s.sequenceValue(seq.ID)
+
+	if v := tupleField(tuple, field); v != nil {
+		// like sequence_update() of tarantool
+		value, ok := intValue(v)
+		if !ok || value < seq.Min || value > seq.Max ||
+			started && (seq.Step > 0 && value <= current || seq.Step < 0 && value >= current) {
+			return tuple, nil, nil
+		}
+		ch, err := s.prepare(&InsertRequest{Replace: true, SpaceID: BOX_SEQUENCE_DATA_ID, Tuple: []any{seq.ID, v}})
+		return tuple, ch, err
+	}
+	value, err := seq.next(current, started)
+	if err != nil {
+		return nil, nil, err
+	}
+	tuple = append([]any{}, tuple...)
+	for uint64(len(tuple)) <= field {
+		tuple = append(tuple, nil)
+	}
+	tuple[field] = intTuple(value)
+	ch, err := s.prepare(&InsertRequest{Replace: true, SpaceID: BOX_SEQUENCE_DATA_ID, Tuple: []any{seq.ID, intTuple(value)}})
+	return tuple, ch, err
+}
+
+// prepareSequence checks the change of _sequence, _sequence_data or _space_sequence
+func (s *Storage) prepareSequence(ch *change) error {
+	switch ch.space.ID {
+	case BOX_SEQUENCE_ID:
+		if ch.new != nil {
+			_, err := sequenceFromTuple(ch.new)
+			return err
+		}
+		id, name := tupleUint(ch.old, 0), tupleField(ch.old, 2)
+		if t, _ := s.spaces[BOX_SEQUENCE_DATA_ID].get(0, []any{id}); t != nil {
+			return ClientError(ER_DROP_SEQUENCE, name, "the sequence has data")
+		}
+		if t, _ := s.spaces[BOX_SPACE_SEQUENCE_ID].selectTuplesOf(1, id); len(t) > 0 {
+			return ClientError(ER_DROP_SEQUENCE, name, "the sequence is in use")
+		}
+	case BOX_SEQUENCE_DATA_ID:
+		if ch.new != nil {
+			if _, err := s.sequence(tupleUint(ch.new, 0)); err != nil {
+				return err
+			}
+		}
+	case BOX_SPACE_SEQUENCE_ID:
+		if ch.new != nil {
+			if _, err := s.space(tupleUint(ch.new, 0)); err != nil {
+				return err
+			}
+			if _, err := s.sequence(tupleUint(ch.new, 1)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// selectTuplesOf returns tuples of the index equal to the key
+func (sp *Space) selectTuplesOf(indexID uint64, key ...any) ([]any, error) {
+	idx, err := sp.index(indexID)
+	if err != nil {
+		return nil, err
+	}
+	return idx.selectTuples(ITER_EQ, key, 0, math.MaxUint32)
+}
+
+// sequenceFunction returns methods of box.sequence like box.sequence.name:next: next, current, set,
+// reset and drop
+func (inst *Instance) sequenceFunction(name string) (Function, bool) {
+	seqName, method, ok := strings.Cut(strings.TrimPrefix(name, "box.sequence."), ":")
+	if !ok || !strings.HasPrefix(name, "box.sequence.") {
+		return nil, false
+	}
+	s := inst.storage
+	seq, err := s.sequenceByName(seqName)
+	if err != nil {
+		return nil, false
+	}
+	dataRow := func(value int64) *InsertRequest {
+		return &InsertRequest{Replace: true, SpaceID: BOX_SEQUENCE_DATA_ID, Tuple: []any{seq.ID, intTuple(value)}}
+	}
+	switch method {
+	case "next":
+		return func(ctx *CallContext, args []any) ([]any, error) {
+			value, err := s.SequenceNext(seq.ID)
+			if err != nil {
+				return nil, err
+			}
+			return []any{intTuple(value)}, nil
+		}, true
+	case "current":
+		return func(ctx *CallContext, args []any) ([]any, error) {
+			s.mu.RLock()
+			value, started := s.sequenceValue(seq.ID)
+			s.mu.RUnlock()
+			if !started {
+				return nil, ClientError(ER_SEQUENCE_NOT_STARTED, seq.Name)
+			}
+			return []any{intTuple(value)}, nil
+		}, true
+	case "set":
+		return func(ctx *CallContext, args []any) ([]any, error) {
+			value, ok := intValue(arg(args, 0))
+			if !ok {
+				return nil, ErrIllegalParams("Usage: sequence:set(value)")
+			}
+			_, err := s.Execute(dataRow(value))
+			return nil, err
+		}, true
+	case "reset":
+		return func(ctx *CallContext, args []any) ([]any, error) {
+			_, err := s.Execute(&DeleteRequest{SpaceID: BOX_SEQUENCE_DATA_ID, Key: []any{seq.ID}})
+			return nil, err
+		}, true
+	case "drop":
+		return func(ctx *CallContext, args []any) ([]any, error) {
+			if _, err := s.Execute(&DeleteRequest{SpaceID: BOX_SEQUENCE_DATA_ID, Key: []any{seq.ID}}); err != nil {
+				return nil, err
+			}
+			_, err := s.Execute(&DeleteRequest{SpaceID: BOX_SEQUENCE_ID, Key: []any{seq.ID}})
+			return nil, err
+		}, true
+	}
+	return nil, false
+}
+
+// intValue returns the integer value of a tuple field
+func intValue(v any) (int64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+// intTuple returns the integer like msgpack decodes it: non-negative values are unsigned
+func intTuple(n int64) any {
+	if n >= 0 {
+		return uint64(n)
+	}
+	return n
+}
@@ -0,0 +1,71 @@
+package tarantella
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	inst, err := NewInstance(&Config{DataDir: dir})
+	require.NoError(t, err)
+	sp, err := inst.storage.createSpace("orders", map[any]any{}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "item", "type": "string"},
+	},
+		[]any{0, "pk", "tree", map[any]any{"unique": true, "sequence": true}, []any{[]any{0, "unsigned"}}},
+	)
+	require.NoError(t, err)
+	insert := func(tuple ...any) []any {
+		ret, err := inst.Execute(ctx, &InsertRequest{SpaceID: sp.ID, Tuple: tuple})
+		require.NoError(t, err)
+		return ret
+	}
+	call := func(name string, args ...any) []any {
+		ret, err := inst.Call(ctx, name, args)
+		require.NoError(t, err)
+		return ret
+	}
+
+	// nil gets the next value, a greater explicit one moves the sequence
+	require.Equal(t, []any{uint64(1), "pen"}, insert(nil, "pen"))
+	require.Equal(t, []any{uint64(10), "ink"}, insert(uint64(10), "ink"))
+	require.Equal(t, []any{uint64(11), "paper"}, insert(nil, "paper"))
+	insert(uint64(5), "clip")
+	require.Equal(t, []any{uint64(11)}, call("box.sequence.orders_seq:current"))
+	require.Equal(t, []any{uint64(12)}, call("box.sequence.orders_seq:next"))
+
+	links, err := inst.storage.Select(&SelectRequest{SpaceID: BOX_VSPACE_SEQUENCE_ID, Key: []any{sp.ID}, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, []any{[]any{sp.ID, uint64(1), true, uint64(0), ""}}, links)
+	_, err = inst.storage.Execute(&DeleteRequest{SpaceID: BOX_SEQUENCE_ID, Key: []any{uint64(1)}})
+	require.Equal(t, ER_DROP_SEQUENCE, err.(*BoxError).Code)
+
+	// descending sequences cycle or overflow
+	seq := call("box.schema.sequence.create", "countdown", map[any]any{"step": int64(-2), "min": uint64(0), "max": uint64(3)})
+	require.Equal(t, uint64(3), seq[0].(map[any]any)["start"])
+	for _, want := range []uint64{3, 1} {
+		require.Equal(t, []any{want}, call("box.sequence.countdown:next"))
+	}
+	_, err = inst.Call(ctx, "box.sequence.countdown:next", nil)
+	require.Equal(t, ER_SEQUENCE_OVERFLOW, err.(*BoxError).Code)
+	_, err = inst.Call(ctx, "box.schema.sequence.create", []any{"countdown"})
+	require.Equal(t, ER_SEQUENCE_EXISTS, err.(*BoxError).Code)
+	call("box.sequence.countdown:reset")
+	_, err = inst.Call(ctx, "box.sequence.countdown:current", nil)
+	require.Equal(t, ER_SEQUENCE_NOT_STARTED, err.(*BoxError).Code)
+	call("box.sequence.countdown:drop")
+	_, err = inst.Call(ctx, "box.sequence.countdown:next", nil)
+	require.Equal(t, ER_NO_SUCH_PROC, err.(*BoxError).Code)
+
+	// the sequence is recovered from the log
+	require.NoError(t, inst.Close())
+	inst, err = NewInstance(&Config{DataDir: dir})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	require.Equal(t, []any{uint64(13), "stapler"}, insert(nil, "stapler"))
+}
@@ -3,21 +3,67 @@ package tarantella
 import (
 	"context"
 	"net"
+	"path/filepath"
+	"strconv"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 )
 
-// StartServer starts the tarantool emulator
-func StartServer(ctx context.Context, listenOn, dataDir string) error {
-	log.Debug().Msgf("Launching server on %s...", listenOn)
-
-	lc := &net.ListenConfig{}
-	ln, err := lc.Listen(ctx, "tcp", listenOn)
+// StartServer starts the tarantool emulator, instances of Replicaset or vshard are started by one process
+func StartServer(ctx context.Context, cfg *Config) error {
+	if cfg.DiffWith != "" {
+		log.Info().Str("reference", cfg.DiffWith).Msg("Differential testing mode is on")
+	}
+	members, err := cfg.members()
 	if err != nil {
-		return errors.Wrapf(err, "unable to listen on %s", listenOn)
+		return err
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	var instances []*Instance
+	defer func() {
+		cancel()
+		for _, inst := range instances {
+			inst.Close() //nolint: errcheck
+		}
+	}()
+
+	// the leader is started first, replicas join it
+	errs := make(chan error, len(members))
+	rs := &replicaset{ctx: ctx}
+	vs := NewVshard(len(cfg.VshardStorages), cfg.VshardBucketCount)
+	for _, member := range members {
+		log.Debug().Msgf("Launching server on %s...", member.ListenOn)
+		inst, err := NewInstance(member)
+		if err != nil {
+			return errors.Wrapf(err, "unable to start instance %s", member.ListenOn)
+		}
+		instances = append(instances, inst)
+		switch {
+		case member.vshardRole == vshardStorage:
+			if err := vs.AddStorage(inst); err != nil {
+				return err
+			}
+		case member.vshardRole == vshardRouter:
+			vs.AddRouter(inst)
+		case len(members) > 1:
+			rs.add(inst)
+		}
+		go inst.Run(ctx)
+
+		lc := &net.ListenConfig{}
+		ln, err := lc.Listen(ctx, "tcp", member.ListenOn)
+		if err != nil {
+			return errors.Wrapf(err, "unable to listen on %s", member.ListenOn)
+		}
+		go func() { errs <- serve(ctx, ln, inst) }()
+	}
+	return <-errs
+}
+
+// serve accepts connections of clients till the context is done
+func serve(ctx context.Context, ln net.Listener, inst *Instance) error {
 	log.Info().Msgf("Server started on %s...", ln.Addr().String())
 
 	go func() {
@@ -31,6 +77,65 @@ func StartServer(ctx context.Context, listenOn, dataDir string) error {
 		if err != nil {
 			return errors.Wrapf(err, "unable to accept on %s", ln.Addr().String())
 		}
-		go processClient(ctx, conn, dataDir) //nolint: errcheck
+		go processClient(ctx, conn, inst) //nolint: errcheck
+	}
+}
+
+// members returns configs of instances started by the process: the leader goes first,
+// each instance of the replicaset keeps its data in DataDir/<number in the list>
+func (cfg *Config) members() ([]*Config, error) {
+	if len(cfg.VshardStorages) > 0 {
+		if len(cfg.Replicaset) > 0 {
+			return nil, errors.New("replicaset and vshard storages can't be started together")
+		}
+		return cfg.vshardMembers(), nil
+	}
+	if len(cfg.Replicaset) == 0 {
+		return []*Config{cfg}, nil
+	}
+	leader := cfg.ReplicasetLeader
+	if leader == "" {
+		leader = cfg.Replicaset[0]
+	}
+
+	var members []*Config
+	for i, addr := range cfg.Replicaset {
+		member := *cfg
+		member.ListenOn = addr
+		member.DataDir = filepath.Join(cfg.DataDir, strconv.Itoa(i+1))
+		member.Replicaset, member.ReplicasetLeader = nil, ""
+		if addr == leader {
+			members = append([]*Config{&member}, members...)
+			continue
+		}
+		member.ReplicationSource = leader
+		member.registered = true
+		members = append(members, &member)
+	}
+	if members[0].ListenOn != leader {
+		return nil, errors.Errorf("leader %s is not in the replicaset", leader)
+	}
+	return members, nil
+}
+
+// vshard roles of instances
+const (
+	vshardStorage = "storage"
+	vshardRouter  = "router"
+)
+
+// vshardMembers returns configs of vshard storages followed by the router
+func (cfg *Config) vshardMembers() []*Config {
+	var members []*Config
+	for i, addr := range cfg.VshardStorages {
+		member := *cfg
+		member.ListenOn = addr
+		member.DataDir = filepath.Join(cfg.DataDir, "storage-"+strconv.Itoa(i+1))
+		member.vshardRole = vshardStorage
+		members = append(members, &member)
 	}
+	router := *cfg
+	router.DataDir = filepath.Join(cfg.DataDir, "router")
+	router.vshardRole = vshardRouter
+	return append(members, &router)
 }
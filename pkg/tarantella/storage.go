@@ -0,0 +1,1212 @@
+package tarantella
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Storage keeps spaces of the instance in memory. Like in tarantool the catalog lives in
+// _space and _index system spaces: replacing their tuples creates, alters or drops spaces
+// and indexes, so snapshots and logs contain the schema as ordinary rows
+
+type (
+	// Storage is an in-memory engine of the instance
+	Storage struct {
+		mu      sync.RWMutex
+		spaces  map[uint64]*Space
+		names   map[string]*Space
+		journal journal // nil while recovering
+
+		readOnly bool // requests are refused, rows of the master are applied only
+
+		callFunction func(name string, args []any) ([]any, error) // calls functions of functional indexes
+		txns         map[*Txn]struct{}                            // active transactions
+		triggers     map[uint64][]*trigger                        // triggers of spaces by id
+		triggerSeq   uint64                                       // numbers names of triggers
+		fired        []func()                                     // on_replace triggers called on unlock
+		fks          []*fkConstraint                              // foreign keys of _fk_constraint
+		cks          map[uint64][]*ckConstraint                   // check constraints of spaces by id
+		replaying    bool                                         // rows of logs or the master are applied
+		deferFKs     bool                                         // deferred foreign keys are checked by the commit
+	}
+
+	// Space is a space with its definition from _space
+	Space struct {
+		ID         uint64
+		Owner      uint64
+		Name       string
+		Engine     string
+		FieldCount uint64
+		Flags      map[any]any
+		Format     []FieldDef
+		Indexes    []*Index // ordered by id
+	}
+
+	// FieldDef describes a field of the space format
+	FieldDef struct {
+		Name       string
+		Type       string
+		IsNullable bool
+		Collation  uint64 // id in _collation, 0 if none
+	}
+
+	// Index is an index with its definition from _index, tuples are kept sorted by the key
+	Index struct {
+		ID      uint64
+		Name    string
+		Type    string // TREE or HASH
+		Unique  bool
+		Opts    map[any]any
+		Parts   []IndexPart
+		space   *Space
+		cmp     []IndexPart // parts of non-unique index are extended with primary key parts
+		tuples  [][]any     // tuples of entries sorted by keys
+		entries [][]any     // comparison keys of entries, a tuple has several ones in multikey and functional indexes
+
+		multikey bool                               // a part has [*] in the path
+		keyFunc  func(tuple []any) ([][]any, error) // returns keys of the functional index
+	}
+
+	// IndexPart is a key part of the index
+	IndexPart struct {
+		Field      uint64 // 0-based field number
+		Type       string
+		IsNullable bool
+		Collation  uint64 // id in _collation, 0 if none
+		Path       string // JSON path in the field like .user.id or .tags[*]
+		coll       *Collation
+		path       []pathToken
+	}
+
+	// change is a prepared modification of one space, nothing is modified till apply
+	change struct {
+		space     *Space
+		old, new  []any
+		row       *Row
+		catalog   func()  // applies the modification of the catalog, if any
+		uncatalog func()  // reverts the modification of the catalog
+		seq       *change // the change of _sequence_data made by the same transaction, if any
+	}
+
+	// journal writes changes before they are applied
+	journal interface {
+		write(rows []*Row) error
+	}
+)
+
+// engines of spaces
+const (
+	engineMemtx     = "memtx"
+	engineVinyl     = "vinyl"
+	engineSysview   = "sysview"
+	engineBlackhole = "blackhole"
+	engineService   = "service"
+)
+
+// sysviews are read-only views of system spaces
+var sysviews = map[uint64]uint64{
+	BOX_VCOLLATION_ID: BOX_COLLATION_ID,
+	BOX_VSPACE_ID:     BOX_SPACE_ID,
+	BOX_VSEQUENCE_ID:  BOX_SEQUENCE_ID,
+	BOX_VINDEX_ID:     BOX_INDEX_ID,
+	BOX_VFUNC_ID:      BOX_FUNC_ID,
+	BOX_VUSER_ID:      BOX_USER_ID,
+	BOX_VPRIV_ID:      BOX_PRIV_ID,
+
+	BOX_VSPACE_SEQUENCE_ID: BOX_SPACE_SEQUENCE_ID,
+}
+
+// NewStorage creates the storage with system spaces only
+func NewStorage() *Storage {
+	s := &Storage{
+		spaces: make(map[uint64]*Space),
+		names:  make(map[string]*Space),
+	}
+
+	// _space and _index have to exist before their rows are applied
+	for _, t := range bootstrapSpaces() {
+		if id := tupleUint(t, 0); id == BOX_SPACE_ID || id == BOX_INDEX_ID {
+			sp, err := spaceFromTuple(t)
+			if err != nil {
+				panic(err)
+			}
+			s.installSpace(sp)
+		}
+	}
+	for _, t := range bootstrapIndexes() {
+		if id := tupleUint(t, 0); id == BOX_SPACE_ID || id == BOX_INDEX_ID {
+			sp := s.spaces[id]
+			idx, err := indexFromTuple(t, sp)
+			if err != nil {
+				panic(err)
+			}
+			sp.installIndex(idx)
+		}
+	}
+	s.bootstrap(func(id uint64) bool { return id <= BOX_SYSTEM_ID_MAX })
+	return s
+}
+
+// bootstrapUserSpaces creates user spaces of the built-in catalog, it's done
+// only if there is no snapshot
+func (s *Storage) bootstrapUserSpaces() {
+	s.bootstrap(func(id uint64) bool { return id > BOX_SYSTEM_ID_MAX })
+}
+
+// bootstrapSystemData fills system spaces like the bootstrap of tarantool does, so the snapshot
+// of a new instance may be loaded by tarantool
+func (s *Storage) bootstrapSystemData(instanceUUID, replicasetUUID string) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	maxID := BOX_SYSTEM_ID_MAX
+	for id := range s.spaces {
+		if id > maxID {
+			maxID = id
+		}
+	}
+	const all, read, write, execute, session, usage = math.MaxUint32, 1, 2, 4, 8, 16
+	for _, row := range []struct {
+		space uint64
+		tuple []any
+	}{
+		{BOX_SCHEMA_ID, []any{"cluster", replicasetUUID}},
+		{BOX_SCHEMA_ID, []any{"max_id", maxID}},
+		{BOX_SCHEMA_ID, []any{"version", versionMajor, versionMinor, versionPatch}},
+		// the password of guest is empty
+		{BOX_USER_ID, []any{0, 1, "guest", "user", map[any]any{"chap-sha1": "vhvewKp0tNyweZQ+cFKAlsyphfg="}}},
+		{BOX_USER_ID, []any{1, 1, "admin", "user", map[any]any{}}},
+		{BOX_USER_ID, []any{2, 1, "public", "role", map[any]any{}}},
+		{BOX_USER_ID, []any{3, 1, "replication", "role", map[any]any{}}},
+		{BOX_USER_ID, []any{31, 1, "super", "role", map[any]any{}}},
+		{BOX_PRIV_ID, []any{1, 0, "role", 2, execute}},
+		{BOX_PRIV_ID, []any{1, 0, "universe", 0, session | usage}},
+		{BOX_PRIV_ID, []any{1, 1, "universe", 0, all}},
+		{BOX_PRIV_ID, []any{1, 2, "space", BOX_VCOLLATION_ID, read}},
+		{BOX_PRIV_ID, []any{1, 2, "space", BOX_VSPACE_ID, read}},
+		{BOX_PRIV_ID, []any{1, 2, "space", BOX_VSEQUENCE_ID, read}},
+		{BOX_PRIV_ID, []any{1, 2, "space", BOX_VINDEX_ID, read}},
+		{BOX_PRIV_ID, []any{1, 2, "space", BOX_VFUNC_ID, read}},
+		{BOX_PRIV_ID, []any{1, 2, "space", BOX_VUSER_ID, read}},
+		{BOX_PRIV_ID, []any{1, 2, "space", BOX_VPRIV_ID, read}},
+		{BOX_PRIV_ID, []any{1, 3, "space", BOX_CLUSTER_ID, write}},
+		{BOX_PRIV_ID, []any{1, 3, "universe", 0, read}},
+		{BOX_PRIV_ID, []any{1, 31, "universe", 0, all}},
+		{BOX_CLUSTER_ID, []any{1, instanceUUID}},
+	} {
+		s.mustExecute(&InsertRequest{Replace: true, SpaceID: row.space, Tuple: normalizeTuples([]any{row.tuple})[0]})
+	}
+	for _, t := range normalizeTuples(builtinCollations()) {
+		s.mustExecute(&InsertRequest{Replace: true, SpaceID: BOX_COLLATION_ID, Tuple: t})
+	}
+}
+
+// replicaID returns id of the instance registered in _cluster
+func (s *Storage) replicaID(instanceUUID string) (uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp, ok := s.spaces[BOX_CLUSTER_ID]
+	if !ok {
+		return 0, false
+	}
+	for _, t := range sp.Tuples() {
+		if len(t) > 1 && t[1] == instanceUUID {
+			return tupleUint(t, 0), true
+		}
+	}
+	return 0, false
+}
+
+// replicas returns tuples of _cluster: {id, instance uuid}
+func (s *Storage) replicas() [][]any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp, ok := s.spaces[BOX_CLUSTER_ID]
+	if !ok {
+		return nil
+	}
+	return append([][]any(nil), sp.Tuples()...)
+}
+
+// replicasetUUID returns the replicaset UUID kept in _schema
+func (s *Storage) replicasetUUID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if sp, ok := s.spaces[BOX_SCHEMA_ID]; ok {
+		if t, err := sp.get(0, []any{"cluster"}); err == nil && len(t) > 1 {
+			uuid, _ := t[1].(string)
+			return uuid
+		}
+	}
+	return ""
+}
+
+func (s *Storage) bootstrap(filter func(id uint64) bool) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	for _, t := range bootstrapSpaces() {
+		if filter(tupleUint(t, 0)) {
+			s.mustExecute(&InsertRequest{Replace: true, SpaceID: BOX_SPACE_ID, Tuple: t})
+		}
+	}
+	for _, t := range bootstrapIndexes() {
+		if filter(tupleUint(t, 0)) {
+			s.mustExecute(&InsertRequest{Replace: true, SpaceID: BOX_INDEX_ID, Tuple: t})
+		}
+	}
+}
+
+func (s *Storage) mustExecute(req any) {
+	if _, err := s.execute(req, false); err != nil {
+		panic(err)
+	}
+}
+
+// bootstrapSpaces returns _space tuples of the built-in catalog with msgpack types
+func bootstrapSpaces() [][]any {
+	return normalizeTuples(dummySpaces)
+}
+
+// bootstrapIndexes returns _index tuples of the built-in catalog with msgpack types
+func bootstrapIndexes() [][]any {
+	return normalizeTuples(dummyIndexes)
+}
+
+// normalizeTuples turns values parsed from YAML into values decoded from msgpack
+func normalizeTuples(src []any) [][]any {
+	tuples := make([][]any, 0, len(src))
+	for _, t := range src {
+		raw, err := mpMarshal(t)
+		if err != nil {
+			panic(err)
+		}
+		v, err := mpUnmarshal(raw)
+		if err != nil {
+			panic(err)
+		}
+		tuples = append(tuples, v.([]any))
+	}
+	return tuples
+}
+
+// Space returns the space by id
+func (s *Storage) Space(id uint64) (*Space, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sp, ok := s.spaces[id]
+	return sp, ok
+}
+
+// SpaceByName returns the space by name
+func (s *Storage) SpaceByName(name string) (*Space, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sp, ok := s.names[name]
+	return sp, ok
+}
+
+// Spaces returns all spaces ordered by id
+func (s *Storage) Spaces() []*Space {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedSpaces()
+}
+
+func (s *Storage) sortedSpaces() []*Space {
+	spaces := make([]*Space, 0, len(s.spaces))
+	for _, sp := range s.spaces {
+		spaces = append(spaces, sp)
+	}
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].ID < spaces[j].ID })
+	return spaces
+}
+
+// Select selects tuples from the space
+func (s *Storage) Select(r *SelectRequest) ([]any, error) {
+	data, _, err := s.SelectPage(r)
+	return data, err
+}
+
+// SelectPage selects tuples like Select does, tuples after IPROTO_AFTER_POSITION or IPROTO_AFTER_TUPLE
+// are selected if the request has it. The position of the last selected tuple is returned if the request
+// fetches it
+func (s *Storage) SelectPage(r *SelectRequest) ([]any, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp, err := s.space(r.SpaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if base, ok := sysviews[sp.ID]; ok && sp.Engine == engineSysview {
+		if sp, err = s.space(base); err != nil {
+			return nil, nil, err
+		}
+	}
+	idx, err := sp.index(r.IndexID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(r.AfterPosition) == 0 && len(r.AfterTuple) == 0 && !r.FetchPosition {
+		data, err := idx.selectTuples(r.Iterator, r.Key, r.Offset, r.Limit)
+		return data, nil, err
+	}
+	return idx.selectPage(r)
+}
+
+// Execute executes DML request (InsertRequest, UpdateRequest, DeleteRequest or UpsertRequest)
+// writing it into the journal, it returns the affected tuple or nil
+func (s *Storage) Execute(req any) ([]any, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	if s.readOnly {
+		return nil, ErrReadonly()
+	}
+	return s.execute(req, true)
+}
+
+func (s *Storage) isReadOnly() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readOnly
+}
+
+func (s *Storage) setReadOnly(readOnly bool) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.readOnly = readOnly
+}
+
+// Apply applies the row read from a snapshot, a log or a master, the row is not written to the journal
+func (s *Storage) Apply(row *Row) error {
+	req, err := row.Request()
+	if err != nil {
+		return err
+	}
+	if ins, ok := req.(*InsertRequest); ok && row.snapshot {
+		ins.Replace = true // system spaces may already contain the same rows
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	_, err = s.execute(req, false)
+	return err
+}
+
+// applyTx applies rows of the transaction received from the master and writes them into the journal
+// keeping their LSNs, nothing is applied or logged if any of them fails
+func (s *Storage) applyTx(rows []*Row) error {
+	reqs := make([]any, 0, len(rows))
+	for _, row := range rows {
+		if !row.isDML() {
+			continue
+		}
+		req, err := row.Request()
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, req)
+	}
+
+	s.mu.Lock()
+	defer s.unlock()
+	// constraints were checked by the master
+	s.replaying = true
+	defer func() { s.replaying = false }()
+
+	var changes []*change
+	undo := func() {
+		for i := len(changes) - 1; i >= 0; i-- {
+			changes[i].undo()
+		}
+	}
+	for _, req := range reqs {
+		ch, err := s.prepare(req)
+		if err != nil {
+			undo()
+			return err
+		}
+		if ch == nil {
+			continue
+		}
+		ch.apply()
+		changes = append(changes, ch)
+	}
+	if s.journal != nil {
+		if err := s.journal.write(rows); err != nil {
+			undo()
+			return err
+		}
+	}
+
+	for _, ch := range changes {
+		s.abortReaders(nil, ch)
+		s.fire(ch)
+	}
+	return nil
+}
+
+func (s *Storage) execute(req any, logged bool) ([]any, error) {
+	if !logged {
+		// constraints were checked when the row was written
+		s.replaying = true
+		defer func() { s.replaying = false }()
+	}
+	ch, err := s.prepare(req)
+	if err != nil || ch == nil {
+		return nil, err
+	}
+	if logged && s.journal != nil {
+		if err := s.journal.write(ch.rows()); err != nil {
+			return nil, err
+		}
+	}
+	ch.apply()
+	s.abortReaders(nil, ch)
+	s.fire(ch)
+	return ch.result(), nil
+}
+
+func (s *Storage) space(id uint64) (*Space, error) {
+	if sp, ok := s.spaces[id]; ok {
+		return sp, nil
+	}
+	return nil, ErrNoSuchSpace(id)
+}
+
+// writableSpace returns the space which may be modified
+func (s *Storage) writableSpace(id uint64) (*Space, error) {
+	sp, err := s.space(id)
+	if err != nil {
+		return nil, err
+	}
+	if sp.Engine == engineSysview {
+		return nil, ClientError(ER_VIEW_IS_RO, sp.Name)
+	}
+	if _, err := sp.index(0); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// prepare checks the request and calculates old and new tuples, it returns nil if nothing changes
+func (s *Storage) prepare(req any) (*change, error) { //nolint: cyclop
+	var (
+		ch  = &change{}
+		err error
+	)
+
+	switch r := req.(type) {
+	case *InsertRequest:
+		if ch.space, err = s.writableSpace(r.SpaceID); err != nil {
+			return nil, err
+		}
+		if ch.new, ch.seq, err = s.generate(ch.space, r.Tuple); err != nil {
+			return nil, err
+		}
+		if ch.old, err = ch.space.primary().find(ch.new, true); err != nil {
+			return nil, err
+		}
+		if ch.old != nil && !r.Replace {
+			return nil, ErrTupleFound(ch.space.primary().Name, ch.space.Name, ch.old, ch.new)
+		}
+	case *DeleteRequest:
+		if ch.space, err = s.writableSpace(r.SpaceID); err != nil {
+			return nil, err
+		}
+		if ch.old, err = ch.space.get(r.IndexID, r.Key); err != nil || ch.old == nil {
+			return nil, err
+		}
+	case *UpdateRequest:
+		if ch.space, err = s.writableSpace(r.SpaceID); err != nil {
+			return nil, err
+		}
+		if ch.old, err = ch.space.get(r.IndexID, r.Key); err != nil || ch.old == nil {
+			return nil, err
+		}
+		if ch.new, err = applyUpdate(ch.space, ch.old, r.Ops, r.IndexBase); err != nil {
+			return nil, err
+		}
+		pk := ch.space.primary()
+		if pk.compareKeys(ch.old, ch.new) != 0 {
+			return nil, ClientError(ER_CANT_UPDATE_PRIMARY_KEY, ch.space.Name)
+		}
+	case *UpsertRequest:
+		if ch.space, err = s.writableSpace(r.SpaceID); err != nil {
+			return nil, err
+		}
+		tuple, seq, err := s.generate(ch.space, r.Tuple)
+		if err != nil {
+			return nil, err
+		}
+		if ch.old, err = ch.space.primary().find(tuple, true); err != nil {
+			return nil, err
+		}
+		if ch.old == nil {
+			ch.new, ch.seq = tuple, seq
+			break
+		}
+		// like tarantool, errors of upsert operations are ignored
+		if ch.new, err = applyUpdate(ch.space, ch.old, r.Ops, r.IndexBase); err != nil {
+			ch.new = ch.old
+		}
+		if ch.space.primary().compareKeys(ch.old, ch.new) != 0 {
+			ch.new = ch.old
+		}
+		if ch.space.Engine == engineVinyl {
+			// vinyl applies upserts when the key is read, so a wrong result is skipped instead of failing the request
+			err := ch.space.checkTuple(ch.new)
+			if err == nil {
+				err = ch.space.checkUnique(ch.old, ch.new)
+			}
+			if err != nil {
+				log.Error().Err(err).Str("space", ch.space.Name).Msg("UPSERT operation failed")
+				ch.new = ch.old
+			}
+		}
+	case *txnWrite:
+		if err = s.prepareWrite(ch, r); err != nil {
+			return nil, err
+		}
+		if ch.old == nil && ch.new == nil {
+			return nil, nil
+		}
+	default:
+		return nil, ErrIllegalParams("unsupported request %T", req)
+	}
+
+	// statements of transactions called the triggers already, the tuples they returned are committed
+	if _, committed := req.(*txnWrite); !committed && len(s.triggers[ch.space.ID]) > 0 {
+		if ch, err = s.beforeReplace(ch); err != nil || ch == nil {
+			return nil, err
+		}
+	}
+	if ch.new != nil {
+		if err := ch.space.checkTuple(ch.new); err != nil {
+			return nil, err
+		}
+		if err := ch.space.checkUnique(ch.old, ch.new); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkConstraints(ch); err != nil {
+		return nil, err
+	}
+	if err := s.prepareCatalog(ch); err != nil {
+		return nil, err
+	}
+	ch.row = ch.toRow()
+	return ch, nil
+}
+
+// toRow makes the row to log: INSERT, REPLACE with the new tuple or DELETE with the primary key
+func (ch *change) toRow() *Row {
+	row := &Row{Body: map[any]any{IPROTO_SPACE_ID: ch.space.ID}}
+	switch {
+	case ch.new == nil:
+		row.Type = IPROTO_DELETE
+		row.Body[IPROTO_KEY] = ch.space.primary().extractKey(ch.old)
+	case ch.old == nil:
+		row.Type = IPROTO_INSERT
+		row.Body[IPROTO_TUPLE] = ch.new
+	default:
+		row.Type = IPROTO_REPLACE
+		row.Body[IPROTO_TUPLE] = ch.new
+	}
+	return row
+}
+
+// result returns the new tuple or the deleted one
+func (ch *change) result() []any {
+	if ch.new != nil {
+		return ch.new
+	}
+	return ch.old
+}
+
+// rows returns rows of the transaction: the change of the sequence goes first
+func (ch *change) rows() []*Row {
+	if ch.seq != nil {
+		return []*Row{ch.seq.row, ch.row}
+	}
+	return []*Row{ch.row}
+}
+
+// apply modifies indexes and the catalog
+func (ch *change) apply() {
+	if ch.seq != nil {
+		ch.seq.apply()
+	}
+	for _, idx := range ch.space.Indexes {
+		if ch.old != nil {
+			idx.remove(ch.old)
+		}
+		if ch.new != nil {
+			idx.insert(ch.new)
+		}
+	}
+	if ch.catalog != nil {
+		ch.catalog()
+	}
+}
+
+func (s *Storage) installSpace(sp *Space) {
+	if old, ok := s.spaces[sp.ID]; ok {
+		delete(s.names, old.Name)
+	}
+	s.spaces[sp.ID] = sp
+	s.names[sp.Name] = sp
+}
+
+// Len returns the number of tuples in the space
+func (sp *Space) Len() int {
+	if pk := sp.primary(); pk != nil {
+		return len(pk.tuples)
+	}
+	return 0
+}
+
+// Tuples returns tuples of the space in the primary key order
+func (sp *Space) Tuples() [][]any {
+	if pk := sp.primary(); pk != nil {
+		return pk.tuples
+	}
+	return nil
+}
+
+// persistent is true if tuples of the space are kept by snapshots and sent to replicas
+func (sp *Space) persistent() bool {
+	if sp.ID == BOX_TRIGGER_ID {
+		return false // triggers are set by the process
+	}
+	if sp.Engine == engineSysview || sp.Engine == engineBlackhole || sp.Engine == engineService {
+		return false
+	}
+	temporary, _ := sp.Flags["temporary"].(bool)
+	return !temporary
+}
+
+func (sp *Space) primary() *Index {
+	if len(sp.Indexes) > 0 && sp.Indexes[0].ID == 0 {
+		return sp.Indexes[0]
+	}
+	return nil
+}
+
+func (sp *Space) index(id uint64) (*Index, error) {
+	for _, idx := range sp.Indexes {
+		if idx.ID == id {
+			return idx, nil
+		}
+	}
+	return nil, ErrNoSuchIndexID(id, sp.Name)
+}
+
+// IndexByName returns the index by name
+func (sp *Space) IndexByName(name string) (*Index, bool) {
+	for _, idx := range sp.Indexes {
+		if idx.Name == name {
+			return idx, true
+		}
+	}
+	return nil, false
+}
+
+// get finds the tuple by the full key of the unique index
+func (sp *Space) get(indexID uint64, key []any) ([]any, error) {
+	idx, err := sp.index(indexID)
+	if err != nil {
+		return nil, err
+	}
+	if !idx.Unique {
+		return nil, ClientError(ER_MORE_THAN_ONE_TUPLE)
+	}
+	if len(key) != len(idx.Parts) {
+		return nil, ErrExactMatch(len(idx.Parts), len(key))
+	}
+	if err := idx.checkKey(key); err != nil {
+		return nil, err
+	}
+	lo, hi := idx.keyRange(key)
+	if lo == hi {
+		return nil, nil
+	}
+	return idx.tuples[lo], nil
+}
+
+// fieldNo returns 0-based field number by the name from the space format
+func (sp *Space) fieldNo(name string) (uint64, bool) {
+	for i, f := range sp.Format {
+		if f.Name == name {
+			return uint64(i), true
+		}
+	}
+	return 0, false
+}
+
+// checkUnique checks the new tuple doesn't duplicate other tuples in unique indexes
+func (sp *Space) checkUnique(old, tuple []any) error {
+	for _, idx := range sp.Indexes {
+		if !idx.Unique || idx.ID == 0 {
+			continue
+		}
+		dups, err := idx.duplicates(tuple)
+		if err != nil {
+			return err
+		}
+		for _, dup := range dups {
+			if old == nil || sp.primary().compareKeys(dup, old) != 0 {
+				return ErrTupleFound(idx.Name, sp.Name, dup, tuple)
+			}
+		}
+	}
+	return nil
+}
+
+func (sp *Space) installIndex(idx *Index) {
+	idx.space = sp
+	for i, old := range sp.Indexes {
+		if old.ID == idx.ID {
+			sp.Indexes[i] = idx
+			sp.refreshIndexes()
+			return
+		}
+	}
+	sp.Indexes = append(sp.Indexes, idx)
+	sort.Slice(sp.Indexes, func(i, j int) bool { return sp.Indexes[i].ID < sp.Indexes[j].ID })
+	sp.refreshIndexes()
+}
+
+func (sp *Space) dropIndex(id uint64) {
+	for i, idx := range sp.Indexes {
+		if idx.ID == id {
+			sp.Indexes = append(sp.Indexes[:i], sp.Indexes[i+1:]...)
+			break
+		}
+	}
+	sp.refreshIndexes()
+}
+
+// refreshIndexes recalculates comparison parts of secondary non-unique indexes, their entries are
+// sorted again
+func (sp *Space) refreshIndexes() {
+	pk := sp.primary()
+	for _, idx := range sp.Indexes {
+		idx.cmp = idx.comparisonParts(pk)
+		if !idx.Unique && pk != nil && idx != pk {
+			idx.tuples, idx.entries = nil, nil
+			for _, t := range pk.tuples {
+				idx.insert(t)
+			}
+		}
+	}
+}
+
+// comparisonParts returns parts entries are sorted by: parts of non-unique indexes are extended with primary
+// key parts, RTREE and BITSET entries are sorted by the primary key only
+func (idx *Index) comparisonParts(pk *Index) []IndexPart {
+	switch {
+	case idx.Unique || pk == nil || idx == pk || idx.ID == 0:
+		return idx.Parts
+	case !idx.ordered():
+		return pk.Parts
+	}
+	return append(append([]IndexPart{}, idx.Parts...), pk.Parts...)
+}
+
+// ordered is true if values of the index are ordered by its parts
+func (idx *Index) ordered() bool {
+	return idx.Type != "RTREE" && idx.Type != "BITSET"
+}
+
+// extractKey returns key parts of the tuple
+func (idx *Index) extractKey(tuple []any) []any {
+	key := make([]any, len(idx.Parts))
+	for i := range idx.Parts {
+		key[i] = idx.Parts[i].value(tuple)
+	}
+	return key
+}
+
+// compareTuples compares tuples by comparison parts
+func (idx *Index) compareTuples(a, b []any) int {
+	for i := range idx.cmp {
+		p := &idx.cmp[i]
+		if c := p.compare(p.value(a), p.value(b)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareKeys compares tuples by the index key only
+func (idx *Index) compareKeys(a, b []any) int {
+	for i := range idx.Parts {
+		p := &idx.Parts[i]
+		if c := p.compare(p.value(a), p.value(b)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareWithKey compares the comparison key of an entry with the (partial) key
+func (idx *Index) compareWithKey(entry, key []any) int {
+	for i, v := range key {
+		if c := idx.cmp[i].compare(entry[i], v); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compare compares values of the part, strings are compared by the collation of the part if any
+func (p *IndexPart) compare(a, b any) int {
+	if p.coll != nil {
+		if sa, ok := a.(string); ok {
+			if sb, ok := b.(string); ok {
+				return p.coll.compare(sa, sb)
+			}
+		}
+	}
+	return CompareValues(a, b)
+}
+
+func tupleField(tuple []any, no uint64) any {
+	if no < uint64(len(tuple)) {
+		return tuple[no]
+	}
+	return nil
+}
+
+// find returns the tuple with the same key as the tuple has, nullable keys with nulls are never found
+func (idx *Index) find(tuple []any, check bool) ([]any, error) {
+	if check {
+		if err := idx.space.checkTuple(tuple); err != nil {
+			return nil, err
+		}
+	}
+	dups, err := idx.duplicates(tuple)
+	if err != nil || len(dups) == 0 {
+		return nil, err
+	}
+	return dups[0], nil
+}
+
+// duplicates returns tuples with the same keys as the tuple has, keys with nulls in nullable parts are skipped
+func (idx *Index) duplicates(tuple []any) ([][]any, error) {
+	keys, err := idx.keys(tuple)
+	if err != nil {
+		return nil, err
+	}
+	var dups [][]any
+next:
+	for _, key := range keys {
+		key = key[:len(idx.Parts)]
+		for i, p := range idx.Parts {
+			if p.IsNullable && key[i] == nil {
+				continue next
+			}
+		}
+		lo, hi := idx.keyRange(key)
+		dups = append(dups, idx.tuples[lo:hi]...)
+	}
+	return dups, nil
+}
+
+// keyRange returns the range of entries equal to the key
+func (idx *Index) keyRange(key []any) (int, int) {
+	lo := sort.Search(len(idx.entries), func(i int) bool {
+		return idx.compareWithKey(idx.entries[i], key) >= 0
+	})
+	hi := sort.Search(len(idx.entries), func(i int) bool {
+		return idx.compareWithKey(idx.entries[i], key) > 0
+	})
+	return lo, hi
+}
+
+// insert adds entries of the tuple, the tuple is checked already
+func (idx *Index) insert(tuple []any) {
+	keys, _ := idx.keys(tuple)
+	for _, key := range keys {
+		i := sort.Search(len(idx.entries), func(i int) bool {
+			return idx.compareWithKey(idx.entries[i], key) >= 0
+		})
+		idx.tuples = append(idx.tuples, nil)
+		copy(idx.tuples[i+1:], idx.tuples[i:])
+		idx.tuples[i] = tuple
+		idx.entries = append(idx.entries, nil)
+		copy(idx.entries[i+1:], idx.entries[i:])
+		idx.entries[i] = key
+	}
+}
+
+// remove removes entries of the tuple
+func (idx *Index) remove(tuple []any) {
+	keys, _ := idx.keys(tuple)
+	for _, key := range keys {
+		i := sort.Search(len(idx.entries), func(i int) bool {
+			return idx.compareWithKey(idx.entries[i], key) >= 0
+		})
+		if i < len(idx.entries) && idx.compareWithKey(idx.entries[i], key) == 0 {
+			idx.tuples = append(idx.tuples[:i], idx.tuples[i+1:]...)
+			idx.entries = append(idx.entries[:i], idx.entries[i+1:]...)
+		}
+	}
+}
+
+// checkKey checks count and types of key parts
+func (idx *Index) checkKey(key []any) error {
+	if len(key) > len(idx.Parts) {
+		return ErrKeyPartCount(len(idx.Parts), len(key))
+	}
+	for i, v := range key {
+		p := idx.Parts[i]
+		if !fieldTypeMatches(p.Type, v) && !(v == nil && p.IsNullable) {
+			return ErrKeyPartType(i, p.Type)
+		}
+	}
+	return nil
+}
+
+// selectTuples selects tuples by the iterator
+func (idx *Index) selectTuples(iterator uint64, key []any, offset, limit uint64) ([]any, error) {
+	switch idx.Type {
+	case "RTREE":
+		return idx.selectRtree(iterator, key, offset, limit)
+	case "BITSET":
+		return idx.selectBits(iterator, key, offset, limit)
+	}
+	data, _, err := idx.selectRange(iterator, key, nil, offset, limit)
+	return data, err
+}
+
+// selectPage selects tuples after the position of the request, it returns the position of the last selected
+// tuple if the request fetches it. The position is the comparison key of the tuple packed into MsgPack array
+func (idx *Index) selectPage(r *SelectRequest) ([]any, []byte, error) {
+	if !idx.ordered() || idx.multikey || idx.keyFunc != nil {
+		return nil, nil, idx.unsupported("pagination")
+	}
+	var after []any
+	switch {
+	case len(r.AfterPosition) > 0 && len(r.AfterTuple) > 0:
+		return nil, nil, ClientError(ER_ITERATOR_POSITION)
+	case len(r.AfterPosition) > 0:
+		v, err := mpUnmarshal(r.AfterPosition)
+		if after, _ = v.([]any); err != nil || !idx.isPosition(after) {
+			return nil, nil, ClientError(ER_ITERATOR_POSITION)
+		}
+	case len(r.AfterTuple) > 0:
+		keys, err := idx.keys(r.AfterTuple)
+		if err != nil || len(keys) != 1 || !idx.isPosition(keys[0]) {
+			return nil, nil, ClientError(ER_ITERATOR_POSITION)
+		}
+		after = keys[0]
+	}
+	data, last, err := idx.selectRange(r.Iterator, r.Key, after, r.Offset, r.Limit)
+	if err != nil || !r.FetchPosition || last == nil {
+		return data, nil, err
+	}
+	position, err := mpMarshal(last)
+	return data, position, err
+}
+
+// isPosition checks the comparison key may be the position in the index
+func (idx *Index) isPosition(key []any) bool {
+	if len(key) != len(idx.cmp) {
+		return false
+	}
+	for i, v := range key {
+		p := idx.cmp[i]
+		if !fieldTypeMatches(p.Type, v) && !(v == nil && p.IsNullable) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectRange selects tuples of the ordered index by the iterator after the comparison key if it's set,
+// it returns the comparison key of the last selected tuple too
+func (idx *Index) selectRange(iterator uint64, key, after []any, offset, limit uint64) ([]any, []any, error) { //nolint: cyclop
+	if err := idx.checkKey(key); err != nil {
+		return nil, nil, err
+	}
+
+	if idx.Type == "HASH" {
+		switch {
+		case iterator == ITER_ALL || (iterator == ITER_EQ && len(key) == 0):
+			iterator, key = ITER_ALL, nil
+		case iterator == ITER_EQ || iterator == ITER_GT:
+			if len(key) != len(idx.Parts) {
+				return nil, nil, ErrExactMatch(len(idx.Parts), len(key))
+			}
+		default:
+			return nil, nil, idx.unsupported("requested iterator type")
+		}
+	}
+
+	var (
+		lo, hi  = 0, len(idx.tuples)
+		reverse bool
+	)
+	if len(key) > 0 {
+		klo, khi := idx.keyRange(key)
+		switch iterator {
+		case ITER_EQ:
+			lo, hi = klo, khi
+		case ITER_REQ:
+			lo, hi, reverse = klo, khi, true
+		case ITER_ALL, ITER_GE:
+			lo = klo
+		case ITER_GT:
+			lo = khi
+		case ITER_LT:
+			hi, reverse = klo, true
+		case ITER_LE:
+			hi, reverse = khi, true
+		default:
+			return nil, nil, idx.unsupported("requested iterator type")
+		}
+	} else {
+		switch iterator {
+		case ITER_EQ, ITER_ALL, ITER_GE, ITER_GT:
+		case ITER_REQ, ITER_LT, ITER_LE:
+			reverse = true
+		default:
+			return nil, nil, idx.unsupported("requested iterator type")
+		}
+	}
+
+	if after != nil {
+		// the first entry after the position in the order of the iterator
+		pos := sort.Search(len(idx.entries), func(i int) bool {
+			c := idx.compareWithKey(idx.entries[i], after)
+			return c > 0 || reverse && c == 0
+		})
+		switch {
+		case reverse && pos < hi:
+			hi = pos
+		case !reverse && pos > lo:
+			lo = pos
+		}
+		if hi < lo {
+			hi = lo
+		}
+	}
+
+	var (
+		data = []any{}
+		last []any
+	)
+	for i := 0; i < hi-lo && uint64(len(data)) < limit; i++ {
+		if uint64(i) < offset {
+			continue
+		}
+		j := lo + i
+		if reverse {
+			j = hi - 1 - i
+		}
+		data = append(data, idx.tuples[j])
+		last = idx.entries[j]
+	}
+	return data, last, nil
+}
+
+// unsupported is ER_UNSUPPORTED_INDEX_FEATURE of the index
+func (idx *Index) unsupported(feature string) *BoxError {
+	return ClientError(ER_UNSUPPORTED_INDEX_FEATURE, idx.Name, idx.Type, idx.space.Name, idx.space.Engine, feature)
+}
+
+// fieldTypeMatches checks the value may be stored in the field of the type
+func fieldTypeMatches(typ string, v any) bool { //nolint: cyclop
+	switch typ {
+	case "", "any", "*":
+		return true
+	case "scalar":
+		c := classOf(v)
+		return c != mpClassArray && c != mpClassMap && c != mpClassNil
+	}
+
+	switch vv := v.(type) {
+	case uint64, uint, uint32, uint16, uint8:
+		return typ == "unsigned" || typ == "integer" || typ == "number" || typ == "num"
+	case int64, int, int32, int16, int8:
+		if compareNumbers(vv, 0) >= 0 {
+			return typ == "unsigned" || typ == "integer" || typ == "number" || typ == "num"
+		}
+		return typ == "integer" || typ == "number"
+	case float32, float64:
+		return typ == "double" || typ == "number"
+	case Decimal:
+		return typ == "decimal" || typ == "number"
+	case string:
+		return typ == "string" || typ == "str"
+	case []byte:
+		return typ == "varbinary"
+	case bool:
+		return typ == "boolean"
+	case []any:
+		return typ == "array"
+	case map[any]any:
+		return typ == "map"
+	}
+	return strings.EqualFold(typ, mpTypeName(v))
+}
+
+// mpTypeName returns the type name of the value like tarantool does in error messages
+func mpTypeName(v any) string { //nolint: cyclop
+	switch vv := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case uint64, uint, uint32, uint16, uint8:
+		return "unsigned"
+	case int64, int, int32, int16, int8:
+		if compareNumbers(vv, 0) >= 0 {
+			return "unsigned"
+		}
+		return "integer"
+	case float32:
+		return "float"
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case []byte:
+		return "varbinary"
+	case []any:
+		return "array"
+	case map[any]any:
+		return "map"
+	}
+
+	switch classOf(v) { //nolint: exhaustive
+	case mpClassNumber:
+		return "decimal"
+	case mpClassUUID:
+		return "uuid"
+	case mpClassDatetime:
+		return "datetime"
+	case mpClassInterval:
+		return "interval"
+	}
+	return "extension"
+}
+
+// tupleUint returns unsigned field of the tuple or 0
+func tupleUint(tuple []any, no int) uint64 {
+	if no < len(tuple) {
+		if n, ok := tuple[no].(uint64); ok {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,287 @@
+package tarantella
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testerSpaceID uint64 = 512
+
+func TestStorage(t *testing.T) {
+	s := NewStorage()
+	s.bootstrapUserSpaces()
+
+	sp, ok := s.SpaceByName("tester")
+	require.True(t, ok)
+	require.Equal(t, testerSpaceID, sp.ID)
+	require.Len(t, sp.Indexes, 2)
+
+	for _, tuple := range [][]any{
+		{uint64(1), "Roxette", uint64(1986)},
+		{uint64(2), "Scorpions", uint64(2015)},
+		{uint64(3), "Ace of Base", uint64(1993)},
+	} {
+		_, err := s.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: tuple})
+		require.NoError(t, err)
+	}
+
+	_, err := s.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{uint64(1), "ABBA", uint64(1972)}})
+	require.Equal(t, `Duplicate key exists in unique index "primary" in space "tester" with old tuple - [1, "Roxette", 1986] and new tuple - [1, "ABBA", 1972]`,
+		err.Error())
+
+	_, err = s.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{uint64(4), "Roxette", uint64(1972)}})
+	require.Equal(t, `Duplicate key exists in unique index "secondary" in space "tester" with old tuple - [1, "Roxette", 1986] and new tuple - [4, "Roxette", 1972]`,
+		err.Error())
+
+	_, err = s.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{"assd", "ABBA", uint64(1972)}})
+	require.Equal(t, "Tuple field 1 (id) type does not match one required by operation: expected unsigned, got string", err.Error())
+
+	data, err := s.Select(&SelectRequest{SpaceID: testerSpaceID, IndexID: 1, Limit: 10, Key: []any{"Scorpions"}})
+	require.NoError(t, err)
+	require.Equal(t, []any{[]any{uint64(2), "Scorpions", uint64(2015)}}, data)
+
+	_, err = s.Select(&SelectRequest{SpaceID: testerSpaceID, Limit: 10, Iterator: ITER_LT, Key: []any{uint64(2)}})
+	require.Equal(t, "Index 'primary' (HASH) of space 'tester' (memtx) does not support requested iterator type", err.Error())
+
+	tuple, err := s.Execute(&UpdateRequest{SpaceID: testerSpaceID, Key: []any{uint64(2)},
+		Ops: []any{[]any{"+", uint64(2), uint64(5)}, []any{"=", int64(-2), "Scorpions!"}}})
+	require.NoError(t, err)
+	require.Equal(t, []any{uint64(2), "Scorpions!", uint64(2020)}, tuple)
+
+	_, err = s.Execute(&UpdateRequest{SpaceID: testerSpaceID, Key: []any{uint64(2)},
+		Ops: []any{[]any{"=", uint64(0), uint64(7)}}})
+	require.Equal(t, "Attempt to modify a tuple field which is part of primary index in space 'tester'", err.Error())
+
+	tuple, err = s.Execute(&DeleteRequest{SpaceID: testerSpaceID, Key: []any{uint64(3)}})
+	require.NoError(t, err)
+	require.Equal(t, []any{uint64(3), "Ace of Base", uint64(1993)}, tuple)
+
+	// catalog is served from _space through _vspace
+	data, err = s.Select(&SelectRequest{SpaceID: BOX_VSPACE_ID, IndexID: 2, Limit: 1, Key: []any{"tester"}})
+	require.NoError(t, err)
+	require.Equal(t, testerSpaceID, data[0].([]any)[0])
+
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_VSPACE_ID, Tuple: []any{uint64(600)}})
+	require.Equal(t, "View '_vspace' is read-only", err.Error())
+
+	// a space and its index are created by rows of _space and _index
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_SPACE_ID, Tuple: []any{
+		uint64(600), uint64(1), "bands", "memtx", uint64(0), map[any]any{}, []any{},
+	}})
+	require.NoError(t, err)
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{
+		uint64(600), uint64(0), "pk", "tree", map[any]any{"unique": true}, []any{[]any{uint64(0), "string"}},
+	}})
+	require.NoError(t, err)
+	for _, name := range []string{"b", "a", "c"} {
+		_, err = s.Execute(&InsertRequest{SpaceID: 600, Tuple: []any{name}})
+		require.NoError(t, err)
+	}
+	data, err = s.Select(&SelectRequest{SpaceID: 600, Limit: 10, Iterator: ITER_LE, Key: []any{"b"}})
+	require.NoError(t, err)
+	require.Equal(t, []any{[]any{"b"}, []any{"a"}}, data)
+}
+
+func TestRecovery(t *testing.T) {
+	cfg := &Config{DataDir: t.TempDir(), WalMode: WalModeFsync}
+
+	inst, err := NewInstance(cfg)
+	require.NoError(t, err)
+	_, err = inst.storage.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{uint64(1), "Roxette", uint64(1986)}})
+	require.NoError(t, err)
+	require.NoError(t, inst.Snapshot())
+	_, err = inst.storage.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{uint64(2), "Scorpions", uint64(2015)}})
+	require.NoError(t, err)
+	_, err = inst.storage.Execute(&DeleteRequest{SpaceID: testerSpaceID, Key: []any{uint64(1)}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), inst.LSN())
+	require.NoError(t, inst.Close())
+	instanceUUID := inst.UUID
+
+	// the initial snapshot, the snapshot after the first row and the log after it
+	for _, name := range []string{"00000000000000000000.snap", "00000000000000000001.snap", "00000000000000000001.xlog"} {
+		require.FileExists(t, filepath.Join(cfg.DataDir, name))
+	}
+
+	inst, err = NewInstance(cfg)
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	require.Equal(t, uint64(3), inst.LSN())
+	require.Equal(t, instanceUUID, inst.UUID)
+	require.Equal(t, uint64(1), inst.ID)
+
+	data, err := inst.storage.Select(&SelectRequest{SpaceID: testerSpaceID, Limit: 10, Iterator: ITER_ALL})
+	require.NoError(t, err)
+	require.Equal(t, []any{[]any{uint64(2), "Scorpions", uint64(2015)}}, data)
+
+	info, err := inst.Call(context.Background(), "box.info", nil)
+	require.NoError(t, err)
+	require.Equal(t, map[any]any{uint64(1): uint64(3)}, info[0].(map[any]any)["vclock"])
+}
+
+func TestFormat(t *testing.T) {
+	s := NewStorage()
+	sp, err := s.createSpace("people", map[any]any{}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "name", "type": "string"},
+		map[any]any{"name": "score", "type": "number", "is_nullable": true},
+		map[any]any{"name": "tags", "type": "array", "is_nullable": true},
+	},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}},
+		[]any{1, "score", "tree", map[any]any{"unique": false}, []any{map[any]any{"field": uint64(2), "type": "integer", "is_nullable": true}}},
+	)
+	require.NoError(t, err)
+	insert := func(tuple ...any) error {
+		_, err := s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: tuple})
+		return err
+	}
+
+	require.NoError(t, insert(uint64(1), "Ann", nil, []any{"a"}, "any extra field"))
+	require.NoError(t, insert(uint64(2), "Bob", int64(-5)))
+	require.EqualError(t, insert(uint64(3)), "Tuple field 2 (name) required by space format is missing")
+	require.EqualError(t, insert(uint64(3), nil), "Tuple field 2 (name) type does not match one required by operation: expected string, got nil")
+	// the index narrows number down to integer
+	require.EqualError(t, insert(uint64(3), "Cid", 1.5), "Tuple field 3 (score) type does not match one required by operation: expected integer, got double")
+	require.EqualError(t, insert(uint64(3), "Cid", nil, map[any]any{}), "Tuple field 4 (tags) type does not match one required by operation: expected array, got map")
+
+	// index parts and the format have to be compatible
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{sp.ID, uint64(2), "name", "tree",
+		map[any]any{"unique": false}, []any{[]any{uint64(1), "unsigned"}}}})
+	require.EqualError(t, err, "Field 2 (name) has type 'string' in space format, but type 'unsigned' in index definition")
+
+	// the new format has to fit the data
+	def, err := s.Select(&SelectRequest{SpaceID: BOX_SPACE_ID, Key: []any{sp.ID}, Limit: 1})
+	require.NoError(t, err)
+	tuple := append([]any{}, def[0].([]any)...)
+	tuple[6] = append(append([]any{}, tuple[6].([]any)...), map[any]any{"name": "email", "type": "unsigned"})
+	_, err = s.Execute(&InsertRequest{Replace: true, SpaceID: BOX_SPACE_ID, Tuple: tuple})
+	require.EqualError(t, err, "Tuple field 5 (email) type does not match one required by operation: expected unsigned, got string")
+}
+
+func TestCreateSpaceConcurrently(t *testing.T) {
+	s := NewStorage()
+	pk := []any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}}
+	ids := make(chan uint64, 50)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(ids); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sp, err := s.createSpace(fmt.Sprintf("space%d", i), map[any]any{}, []any{}, pk)
+			require.NoError(t, err)
+			ids <- sp.ID
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+
+	unique := make(map[uint64]bool)
+	for id := range ids {
+		unique[id] = true
+	}
+	require.Len(t, unique, cap(ids))
+	spaces, err := s.Select(&SelectRequest{SpaceID: BOX_SPACE_ID, Iterator: ITER_GT, Key: []any{BOX_SYSTEM_ID_MAX}, Limit: 100})
+	require.NoError(t, err)
+	require.Len(t, spaces, cap(ids))
+}
+
+func TestApplyTxUndo(t *testing.T) {
+	s := NewStorage()
+	s.bootstrapUserSpaces()
+	row := func(requestType, spaceID uint64, tuple []any) *Row {
+		return &Row{Type: requestType, Body: map[any]any{IPROTO_SPACE_ID: spaceID, IPROTO_TUPLE: tuple}}
+	}
+	_, err := s.Execute(&InsertRequest{SpaceID: testerSpaceID, Tuple: []any{uint64(1), "Roxette", uint64(1986)}})
+	require.NoError(t, err)
+	duplicate := row(IPROTO_INSERT, testerSpaceID, []any{uint64(1), "Europe", uint64(1979)})
+
+	// the space, its index and the changed index are reverted with the data
+	err = s.applyTx([]*Row{
+		row(IPROTO_INSERT, BOX_SPACE_ID, []any{uint64(600), uint64(1), "bands", "memtx", uint64(0), map[any]any{}, []any{}}),
+		row(IPROTO_INSERT, BOX_INDEX_ID, []any{uint64(600), uint64(0), "pk", "tree", map[any]any{"unique": true},
+			[]any{[]any{uint64(0), "unsigned"}}}),
+		row(IPROTO_INSERT, 600, []any{uint64(1)}),
+		row(IPROTO_REPLACE, BOX_INDEX_ID, []any{testerSpaceID, uint64(1), "secondary", "tree", map[any]any{"unique": false},
+			[]any{[]any{uint64(1), "string"}}}),
+		row(IPROTO_INSERT, testerSpaceID, []any{uint64(2), "Scorpions", uint64(2015)}),
+		duplicate,
+	})
+	require.Equal(t, ER_TUPLE_FOUND, err.(*BoxError).Code)
+	_, ok := s.Space(600)
+	require.False(t, ok)
+	_, ok = s.SpaceByName("bands")
+	require.False(t, ok)
+	sp, _ := s.Space(testerSpaceID)
+	require.Equal(t, 1, sp.Len())
+	idx, _ := sp.IndexByName("secondary")
+	require.True(t, idx.Unique)
+	data, err := s.Select(&SelectRequest{SpaceID: testerSpaceID, IndexID: 1, Key: []any{"Roxette"}, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, data, 1)
+}
+
+func TestSelectPage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inst, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	s := inst.storage
+
+	sp, err := s.createSpace("albums", map[any]any{}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "year", "type": "unsigned"},
+	},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}},
+		[]any{1, "year", "tree", map[any]any{"unique": false}, []any{[]any{1, "unsigned"}}},
+	)
+	require.NoError(t, err)
+	for _, tuple := range [][2]uint64{{1, 1986}, {2, 1965}, {3, 1986}, {4, 1979}, {5, 1986}} {
+		_, err = s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{tuple[0], tuple[1]}})
+		require.NoError(t, err)
+	}
+	page := func(r *SelectRequest) ([]any, []byte) {
+		data, position, err := s.SelectPage(r)
+		require.NoError(t, err)
+		return data, position
+	}
+
+	// pages of the non-unique index go on after the last tuple
+	r := &SelectRequest{SpaceID: sp.ID, IndexID: 1, Key: []any{uint64(1986)}, Limit: 2, FetchPosition: true}
+	data, position := page(r)
+	require.Equal(t, []any{[]any{uint64(1), uint64(1986)}, []any{uint64(3), uint64(1986)}}, data)
+	r.AfterPosition = position
+	data, position = page(r)
+	require.Equal(t, []any{[]any{uint64(5), uint64(1986)}}, data)
+	r.AfterPosition = position
+	data, position = page(r)
+	require.Empty(t, data)
+	require.Nil(t, position)
+
+	// reverse iterators go on before the tuple
+	data, _ = page(&SelectRequest{SpaceID: sp.ID, Iterator: ITER_LT, Key: []any{uint64(5)}, Limit: 10,
+		AfterTuple: []any{uint64(3), uint64(1986)}})
+	require.Equal(t, []any{[]any{uint64(2), uint64(1965)}, []any{uint64(1), uint64(1986)}}, data)
+
+	_, _, err = s.SelectPage(&SelectRequest{SpaceID: sp.ID, Limit: 10, AfterPosition: []byte{0x91, 0xa1, 'x'}})
+	require.Equal(t, ER_ITERATOR_POSITION, err.(*BoxError).Code)
+
+	// the server supports pagination and sends positions
+	rc := connectReplica(t, ctx, inst)
+	rc.send(IPROTO_ID, map[any]any{IPROTO_VERSION: uint64(4), IPROTO_FEATURES: []any{IPROTO_FEATURE_PAGINATION, uint64(100)}})
+	_, body := rc.read()
+	require.Equal(t, []any{uint64(0), uint64(1), uint64(2), uint64(3), uint64(4)}, body[IPROTO_FEATURES])
+	rc.send(IPROTO_SELECT, map[any]any{IPROTO_SPACE_ID: sp.ID, IPROTO_INDEX_ID: uint64(0), IPROTO_LIMIT: uint64(1),
+		IPROTO_ITERATOR: ITER_GE, IPROTO_KEY: []any{}, IPROTO_FETCH_POSITION: true})
+	_, body = rc.read()
+	require.Equal(t, []any{[]any{uint64(1), uint64(1986)}}, body[IPROTO_DATA])
+	rc.send(IPROTO_SELECT, map[any]any{IPROTO_SPACE_ID: sp.ID, IPROTO_INDEX_ID: uint64(0), IPROTO_LIMIT: uint64(1),
+		IPROTO_ITERATOR: ITER_GE, IPROTO_KEY: []any{}, IPROTO_AFTER_POSITION: body[IPROTO_POSITION]})
+	_, body = rc.read()
+	require.Equal(t, []any{[]any{uint64(2), uint64(1965)}}, body[IPROTO_DATA])
+}
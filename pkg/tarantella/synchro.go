@@ -0,0 +1,203 @@
+package tarantella
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Changes of synchronous spaces (is_sync) are committed by the quorum of replicas. The quorum is
+// emulated: the commit waits for the quorum delay, if it's not shorter than replication_synchro_timeout
+// the transaction fails with ER_SYNC_QUORUM_TIMEOUT and nothing is written. A committed transaction is
+// logged with IPROTO_FLAG_WAIT_SYNC and confirmed by RAFT_CONFIRM row, so tarantool replicas commit it.
+// Like in the limbo of tarantool, other writes wait for the synchronous transaction before them
+
+// defaultSynchroTimeout is replication_synchro_timeout of tarantool
+const defaultSynchroTimeout = 5 * time.Second
+
+type (
+	// limbo orders writes after synchronous transactions
+	limbo struct {
+		mu          sync.Mutex
+		quorumDelay atomic.Int64 // time.Duration
+		timeout     atomic.Int64 // time.Duration
+	}
+)
+
+// SetSynchroQuorumDelay sets how long the quorum of a synchronous transaction is collected
+func (inst *Instance) SetSynchroQuorumDelay(delay time.Duration) {
+	inst.limbo.quorumDelay.Store(int64(delay))
+}
+
+// SetSynchroTimeout sets how long the quorum is waited for like replication_synchro_timeout
+func (inst *Instance) SetSynchroTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultSynchroTimeout
+	}
+	inst.limbo.timeout.Store(int64(timeout))
+}
+
+// quorum waits for the quorum delay, it returns false after the timeout if the delay is longer
+func (l *limbo) quorum(ctx context.Context) (bool, error) {
+	delay, timeout := time.Duration(l.quorumDelay.Load()), time.Duration(l.timeout.Load())
+	wait, ok := delay, true
+	if delay >= timeout {
+		wait, ok = timeout, false
+	}
+	if wait <= 0 {
+		return ok, nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-t.C:
+		return ok, nil
+	}
+}
+
+// Execute executes the DML request like Storage.Execute does, a change of a synchronous space
+// waits for the quorum
+func (inst *Instance) Execute(ctx context.Context, req any) ([]any, error) {
+	inst.limbo.mu.Lock()
+	if !inst.storage.isSync(req) {
+		// the write waits for synchronous transactions before it only, so on_replace triggers may write too
+		inst.limbo.mu.Unlock()
+		return inst.storage.Execute(req)
+	}
+	defer inst.limbo.mu.Unlock()
+
+	if err := inst.waitQuorum(ctx, func() error { return inst.storage.check(req) }); err != nil {
+		return nil, err
+	}
+	return inst.storage.executeSync(req, inst.ID)
+}
+
+// Commit commits the transaction like Txn.Commit does, a transaction changing a synchronous space
+// waits for the quorum
+func (inst *Instance) Commit(ctx context.Context, tx *Txn) error {
+	inst.limbo.mu.Lock()
+	if !tx.isSync() {
+		inst.limbo.mu.Unlock()
+		return tx.Commit()
+	}
+	defer inst.limbo.mu.Unlock()
+
+	err := inst.waitQuorum(ctx, tx.checkCommit)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.commit(inst.ID)
+}
+
+// waitQuorum checks the synchronous write may be done and waits for the quorum, the lock of the limbo is held
+func (inst *Instance) waitQuorum(ctx context.Context, check func() error) error {
+	if owner := inst.raft.queueOwner(); owner != 0 && owner != inst.ID {
+		return ClientError(ER_SYNC_QUEUE_FOREIGN, owner)
+	}
+	// a wrong write fails at once
+	if err := check(); err != nil {
+		return err
+	}
+	ok, err := inst.limbo.quorum(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ClientError(ER_SYNC_QUORUM_TIMEOUT)
+	}
+	return nil
+}
+
+// isSync is true if the request changes a synchronous space
+func (s *Storage) isSync(req any) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sp, ok := s.spaces[requestSpaceID(req)]
+	return ok && sp.isSync()
+}
+
+// check checks the request may be executed, nothing is changed
+func (s *Storage) check(req any) error {
+	s.mu.Lock()
+	defer s.unlock()
+	if s.readOnly {
+		return ErrReadonly()
+	}
+	_, err := s.prepare(req)
+	return err
+}
+
+// executeSync executes the request of a synchronous space confirming it by RAFT_CONFIRM row
+func (s *Storage) executeSync(req any, replicaID uint64) ([]any, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	if s.readOnly {
+		return nil, ErrReadonly()
+	}
+	ch, err := s.prepare(req)
+	if err != nil || ch == nil {
+		return nil, err
+	}
+	ch.row.Flags |= IPROTO_FLAG_WAIT_SYNC
+	if s.journal != nil {
+		if err := s.journal.write(ch.rows()); err != nil {
+			return nil, err
+		}
+		confirm := &Row{Type: IPROTO_RAFT_CONFIRM, Body: map[any]any{IPROTO_REPLICA_ID: replicaID, IPROTO_LSN: ch.row.LSN}}
+		if err := s.journal.write([]*Row{confirm}); err != nil {
+			return nil, err
+		}
+	}
+	ch.apply()
+	s.abortReaders(nil, ch)
+	s.fire(ch)
+	return ch.result(), nil
+}
+
+func (sp *Space) isSync() bool {
+	sync, _ := sp.Flags["is_sync"].(bool)
+	return sync
+}
+
+// synchroTx keeps synchronous transactions of the master till they are confirmed or rolled back
+type synchroTx [][]*Row
+
+// add keeps the transaction if it waits for the confirmation
+func (p *synchroTx) add(tx []*Row) bool {
+	if tx[len(tx)-1].Flags&IPROTO_FLAG_WAIT_SYNC == 0 {
+		return false
+	}
+	*p = append(*p, tx)
+	return true
+}
+
+// resolve returns transactions confirmed by RAFT_CONFIRM, RAFT_PROMOTE or RAFT_DEMOTE row,
+// transactions after the LSN of RAFT_ROLLBACK, RAFT_PROMOTE or RAFT_DEMOTE are dropped
+func (p *synchroTx) resolve(row *Row) [][]*Row {
+	origin, _ := row.Body[IPROTO_REPLICA_ID].(uint64)
+	lsn, _ := row.Body[IPROTO_LSN].(uint64)
+
+	var confirmed [][]*Row
+	rest := (*p)[:0]
+	for _, tx := range *p {
+		last := tx[len(tx)-1]
+		switch {
+		case last.ReplicaID != origin:
+			rest = append(rest, tx)
+		case row.Type == IPROTO_RAFT_ROLLBACK:
+			if tx[0].LSN < lsn {
+				rest = append(rest, tx)
+			}
+		case last.LSN <= lsn:
+			confirmed = append(confirmed, tx)
+		case row.Type == IPROTO_RAFT_CONFIRM:
+			rest = append(rest, tx)
+		}
+	}
+	*p = rest
+	return confirmed
+}
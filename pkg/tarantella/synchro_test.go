@@ -0,0 +1,161 @@
+package tarantella
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSynchro(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := &Config{DataDir: t.TempDir(), SynchroTimeout: 100 * time.Millisecond}
+	inst, err := NewInstance(cfg)
+	require.NoError(t, err)
+
+	_, err = inst.Execute(ctx, &InsertRequest{SpaceID: BOX_SPACE_ID, Tuple: []any{
+		uint64(600), uint64(1), "bands", "memtx", uint64(0), map[any]any{"is_sync": true}, []any{},
+	}})
+	require.NoError(t, err)
+	_, err = inst.Execute(ctx, &InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{
+		uint64(600), uint64(0), "pk", "tree", map[any]any{}, []any{[]any{uint64(0), "string"}},
+	}})
+	require.NoError(t, err)
+
+	// the transaction is confirmed by the next row
+	lsn := inst.LSN()
+	_, err = inst.Execute(ctx, &InsertRequest{SpaceID: 600, Tuple: []any{"Roxette"}})
+	require.NoError(t, err)
+	require.Equal(t, lsn+2, inst.LSN())
+
+	inst.SetSynchroQuorumDelay(time.Second)
+	_, err = inst.Execute(ctx, &InsertRequest{SpaceID: 600, Tuple: []any{"Scorpions"}})
+	require.Equal(t, ER_SYNC_QUORUM_TIMEOUT, err.(*BoxError).Code)
+	require.Equal(t, lsn+2, inst.LSN())
+	inst.SetSynchroQuorumDelay(0)
+
+	rc := connectReplica(t, ctx, inst)
+	rc.send(IPROTO_CALL, map[any]any{IPROTO_FUNCTION_NAME: "box.ctl.promote", IPROTO_TUPLE: []any{}})
+	h, _ := rc.read()
+	require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE])
+	rc.send(IPROTO_RAFT_PROMOTE, map[any]any{IPROTO_TERM: uint64(1)})
+	h, _ = rc.read()
+	require.Equal(t, IPROTO_TYPE_ERROR|uint64(ER_SPLIT_BRAIN), h[IPROTO_REQUEST_TYPE])
+
+	// the election state is watched
+	rc.send(IPROTO_WATCH, map[any]any{IPROTO_EVENT_KEY: eventBoxElection})
+	_, body := rc.read()
+	require.Equal(t, map[any]any{"term": uint64(2), "role": raftLeader, "is_ro": false, "leader": uint64(1)},
+		body[IPROTO_EVENT_DATA])
+
+	// the queue is kept by the snapshot
+	require.NoError(t, inst.Snapshot())
+	require.NoError(t, inst.Close())
+	inst, err = NewInstance(cfg)
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	info := inst.Info()
+	require.Equal(t, map[any]any{"state": raftLeader, "term": uint64(2), "vote": uint64(0), "leader": uint64(1)},
+		withoutKey(info["election"].(map[any]any), "leader_idle"))
+	require.Equal(t, uint64(1), info["synchro"].(map[any]any)["queue"].(map[any]any)["owner"])
+	data, err := inst.storage.Select(&SelectRequest{SpaceID: 600, Limit: 10, Iterator: ITER_ALL})
+	require.NoError(t, err)
+	require.Equal(t, []any{[]any{"Roxette"}}, data)
+
+	require.NoError(t, inst.Demote(ctx))
+	require.Equal(t, map[any]any{"state": raftFollower, "term": uint64(3), "vote": uint64(0), "leader": uint64(0)},
+		inst.raft.info())
+}
+
+func TestSynchroStream(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	inst, err := NewInstance(&Config{DataDir: dir, SynchroTimeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	_, err = inst.Execute(ctx, &InsertRequest{SpaceID: BOX_SPACE_ID, Tuple: []any{
+		uint64(600), uint64(1), "bands", "memtx", uint64(0), map[any]any{"is_sync": true}, []any{},
+	}})
+	require.NoError(t, err)
+	_, err = inst.Execute(ctx, &InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{
+		uint64(600), uint64(0), "pk", "tree", map[any]any{}, []any{[]any{uint64(0), "string"}},
+	}})
+	require.NoError(t, err)
+	insert := func(names ...string) uint32 {
+		tx := inst.storage.Begin(0)
+		for _, name := range names {
+			_, err := tx.Execute(&InsertRequest{SpaceID: 600, Tuple: []any{name}})
+			require.NoError(t, err)
+		}
+		if err := inst.Commit(ctx, tx); err != nil {
+			return err.(*BoxError).Code
+		}
+		return 0
+	}
+
+	// the transaction is confirmed by the next row
+	lsn := inst.LSN()
+	require.Zero(t, insert("Roxette", "Europe"))
+	require.Equal(t, lsn+3, inst.LSN())
+
+	inst.SetSynchroQuorumDelay(time.Second)
+	require.Equal(t, ER_SYNC_QUORUM_TIMEOUT, insert("Scorpions"))
+	inst.SetSynchroQuorumDelay(0)
+	inst.raft.mu.Lock()
+	inst.raft.owner = 2
+	inst.raft.mu.Unlock()
+	require.Equal(t, ER_SYNC_QUEUE_FOREIGN, insert("Queen"))
+	require.Equal(t, lsn+3, inst.LSN())
+	require.NoError(t, inst.Close())
+
+	// the last row of the transaction waits for the confirmation
+	files, err := filepath.Glob(filepath.Join(dir, "*.xlog"))
+	require.NoError(t, err)
+	var rows []*Row
+	for _, path := range files {
+		x, err := openXlog(path, "XLOG")
+		require.NoError(t, err)
+		for {
+			row, err := x.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			if row.LSN > lsn {
+				rows = append(rows, row)
+			}
+		}
+		x.close()
+	}
+	require.Len(t, rows, 3)
+	require.Zero(t, rows[0].Flags&IPROTO_FLAG_WAIT_SYNC)
+	require.NotZero(t, rows[1].Flags&IPROTO_FLAG_WAIT_SYNC)
+	require.Equal(t, IPROTO_RAFT_CONFIRM, rows[2].Type)
+	require.Equal(t, rows[1].LSN, rows[2].Body[IPROTO_LSN])
+}
+
+func TestSynchroTx(t *testing.T) {
+	tx := func(lsn uint64) []*Row {
+		return []*Row{{Type: IPROTO_INSERT, ReplicaID: 1, LSN: lsn, Flags: IPROTO_FLAG_WAIT_SYNC | IPROTO_FLAG_COMMIT}}
+	}
+	var pending synchroTx
+	require.False(t, pending.add([]*Row{{Type: IPROTO_INSERT, ReplicaID: 1, LSN: 1}}))
+	for _, lsn := range []uint64{2, 3, 4, 5} {
+		require.True(t, pending.add(tx(lsn)))
+	}
+
+	confirm := &Row{Type: IPROTO_RAFT_CONFIRM, Body: map[any]any{IPROTO_REPLICA_ID: uint64(1), IPROTO_LSN: uint64(3)}}
+	require.Equal(t, [][]*Row{tx(2), tx(3)}, pending.resolve(confirm))
+	rollback := &Row{Type: IPROTO_RAFT_ROLLBACK, Body: map[any]any{IPROTO_REPLICA_ID: uint64(1), IPROTO_LSN: uint64(5)}}
+	require.Empty(t, pending.resolve(rollback))
+	require.Equal(t, synchroTx{tx(4)}, pending)
+}
+
+func withoutKey(m map[any]any, key any) map[any]any {
+	delete(m, key)
+	return m
+}
@@ -9,7 +9,11 @@ src_file = open(f'{dir_path}/../iproto-constants.go')
 tgt_file = open(f'{dir_path}/../iproto-constants-names.go', mode = 'w')
 
 
-tgt_file.write('package tarantella\n')
+src_lines = src_file.readlines()
+
+tgt_file.write('package tarantella\n\n')
+if any('math.' in l for l in src_lines):
+    tgt_file.write('import "math"\n\n')
 tgt_file.write(f'// generated by {os.path.basename(__file__)}\n')
 
 current_enum = None
@@ -17,11 +21,11 @@ current_enum = None
 enum_re = r'^//\s*enum\s+(\S+)\s*'
 constant_re = r'^\s*(?P<name>\S+)\s+(?P<type>\S+) = (?P<value>\S+)\s*$'
 
-for l in src_file.readlines():
+for l in src_lines:
 
     if re.match(enum_re, l):
         if current_enum is not None:
-            tgt_file.write('}\n')
+            tgt_file.write('}\n\n')
         current_enum = re.match(enum_re, l).group(1)
         tgt_file.write('var '+current_enum+' = map[any]string{\n')
 
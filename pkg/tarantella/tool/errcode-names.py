@@ -0,0 +1,48 @@
+#!/usr/bin/python3
+
+import re
+import os
+
+dir_path = os.path.dirname(os.path.realpath(__file__))
+
+src_file = open(f'{dir_path}/../errcode-constants.go')
+tgt_file = open(f'{dir_path}/../errcode-names.go', mode = 'w')
+
+constant_re = r'^\s*(?P<name>ER_\S+)\s+(?P<type>\S+) = (?P<value>\S+)\s*//\s*(?P<message>".*")\s*$'
+
+# C printf directives are translated into the Go ones
+c_format_re = r'%(\.\*|ll|l|z)?([udsc])'
+
+
+def go_format(message):
+    def repl(m):
+        if m.group(2) in 'ud':
+            return '%d'
+        if m.group(2) == 'c':
+            return '%c'
+        return '%s'
+    return re.sub(c_format_re, repl, message)
+
+
+codes = []
+for l in src_file.readlines():
+    m = re.match(constant_re, l)
+    if m:
+        codes.append((m.group('name'), m.group('type'), m.group('value'), go_format(m.group('message'))))
+
+tgt_file.write('package tarantella\n\n')
+tgt_file.write(f'// generated by {os.path.basename(__file__)}\n')
+
+tgt_file.write('var box_error_code = map[uint32]string{\n')
+for name, type, value, _ in codes:
+    tgt_file.write(type+'('+value+'): "'+name+'",\n')
+tgt_file.write('}\n\n')
+
+tgt_file.write('// message templates in Go format\n')
+tgt_file.write('var box_error_message = map[uint32]string{\n')
+for name, type, value, message in codes:
+    tgt_file.write(name+': '+message+',\n')
+tgt_file.write('}\n')
+
+src_file.close()
+tgt_file.close()
@@ -0,0 +1,157 @@
+#!/usr/bin/python3
+
+# Writes testdata/tarantool/*.snap and *.xlog byte by byte like tarantool 2.x does, independently of xlog.go:
+# meta from xlog_meta_format, fixheaders from xlog_tx_write_plain and rows from xrow_header_encode
+# and xrow_encode_dml of
+# https://github.com/tarantool/tarantool/blob/2.10/src/box/xlog.c
+# https://github.com/tarantool/tarantool/blob/2.10/src/box/xrow.c
+
+import os
+import struct
+
+dir_path = os.path.dirname(os.path.realpath(__file__))
+out_dir = f'{dir_path}/../testdata/tarantool'
+
+VERSION = '2.10.4-0-g816000e'
+INSTANCE = 'a8cc7b28-fb85-4f2a-9cd4-ee4a5cc1ec3f'
+REPLICASET = '0d5bd431-7f3e-4695-a5c2-82de0a9cbc95'
+TIMESTAMP = 1700000000.25
+
+ROW_MARKER = b'\xd5\xba\x0b\xab'
+EOF_MARKER = b'\xd5\x10\xad\xed'
+FIXHEADER_SIZE = 19
+
+INSERT, REPLACE, UPDATE, DELETE, UPSERT = 2, 3, 4, 5, 9
+REQUEST_TYPE, REPLICA_ID, LSN, TIMESTAMP_KEY, TSN, FLAGS = 0x00, 0x02, 0x03, 0x04, 0x08, 0x09
+SPACE_ID, INDEX_ID, INDEX_BASE, KEY, TUPLE, OPS = 0x10, 0x11, 0x15, 0x20, 0x21, 0x28
+FLAG_COMMIT = 0x01
+
+
+def mp(v):
+    if v is None:
+        return b'\xc0'
+    if isinstance(v, bool):
+        return b'\xc3' if v else b'\xc2'
+    if isinstance(v, int):
+        if v < 0:
+            if v >= -32:
+                return struct.pack('b', v)
+            return b'\xd3' + struct.pack('>q', v)
+        if v <= 0x7f:
+            return bytes([v])
+        if v <= 0xff:
+            return b'\xcc' + struct.pack('>B', v)
+        if v <= 0xffff:
+            return b'\xcd' + struct.pack('>H', v)
+        if v <= 0xffffffff:
+            return b'\xce' + struct.pack('>I', v)
+        return b'\xcf' + struct.pack('>Q', v)
+    if isinstance(v, float):
+        return b'\xcb' + struct.pack('>d', v)
+    if isinstance(v, str):
+        b = v.encode()
+        if len(b) <= 31:
+            return bytes([0xa0 | len(b)]) + b
+        return b'\xd9' + bytes([len(b)]) + b
+    if isinstance(v, list):
+        assert len(v) <= 15
+        return bytes([0x90 | len(v)]) + b''.join(mp(item) for item in v)
+    if isinstance(v, tuple):
+        # an ordered map given by pairs
+        assert len(v) <= 15
+        return bytes([0x80 | len(v)]) + b''.join(mp(k) + mp(item) for k, item in v)
+    raise TypeError(v)
+
+
+def crc32c(data):
+    # tarantool starts with 0 and doesn't invert the result
+    crc = 0
+    for b in data:
+        crc ^= b
+        for _ in range(8):
+            crc = (crc >> 1) ^ (0x82f63b78 if crc & 1 else 0)
+    return crc
+
+
+def header(type, lsn, replica_id=0, tm=0.0, tsn=None, commit=True):
+    tsn = lsn if tsn is None else tsn
+    h = [(REQUEST_TYPE, type)]
+    if replica_id:
+        h.append((REPLICA_ID, replica_id))
+    if lsn:
+        h.append((LSN, lsn))
+    if tm:
+        h.append((TIMESTAMP_KEY, tm))
+    if tsn != lsn or not commit:
+        h.append((TSN, tsn))
+    if commit and tsn != lsn:
+        h.append((FLAGS, FLAG_COMMIT))
+    return mp(tuple(h))
+
+
+def dml(space_id, index_base=0, key=None, ops=None, tuple_=None):
+    body = [(SPACE_ID, space_id)]
+    if index_base:
+        body.append((INDEX_BASE, index_base))
+    if key is not None:
+        body.append((KEY, key))
+    if ops is not None:
+        body.append((OPS, ops))
+    if tuple_ is not None:
+        body.append((TUPLE, tuple_))
+    return mp(tuple(body))
+
+
+def block(rows):
+    data = b''.join(rows)
+    fh = ROW_MARKER + mp(len(data)) + mp(0) + mp(crc32c(data))
+    padding = FIXHEADER_SIZE - len(fh)
+    if padding > 0:
+        fh += bytes([0xa0 | (padding - 1)]) + bytes(padding - 1)
+    return fh + data
+
+
+def meta(filetype, vclock, prev_vclock=None):
+    lines = [filetype, '0.13', f'Version: {VERSION}', f'Instance: {INSTANCE}', f'VClock: {vclock}']
+    if prev_vclock is not None:
+        lines.append(f'PrevVClock: {prev_vclock}')
+    return ('\n'.join(lines) + '\n\n').encode()
+
+
+def ordered(*pairs):
+    return tuple(pairs)
+
+
+snapshot_tuples = [
+    (272, ['cluster', REPLICASET]),
+    (272, ['max_id', 512]),
+    (272, ['version', 2, 10, 4]),
+    (280, [512, 1, 'tester', 'memtx', 0, ordered(), [
+        ordered(('name', 'id'), ('type', 'unsigned')),
+        ordered(('name', 'band'), ('type', 'string')),
+        ordered(('name', 'year'), ('type', 'unsigned')),
+    ]]),
+    (288, [512, 0, 'primary', 'tree', ordered(('unique', True)), [[0, 'unsigned']]]),
+    (288, [512, 1, 'band', 'tree', ordered(('unique', False)), [ordered(('field', 1), ('type', 'string'))]]),
+    (320, [1, INSTANCE]),
+    (512, [1, 'Roxette', 1986]),
+    (512, [2, 'Scorpions', 2015]),
+    (512, [3, 'Ace of Base', 1993]),
+]
+snap_rows = [header(INSERT, i + 1) + dml(space_id, tuple_=t) for i, (space_id, t) in enumerate(snapshot_tuples)]
+
+xlog_txs = [
+    [header(INSERT, 4, 1, TIMESTAMP) + dml(512, tuple_=[4, 'Europe', 1979])],
+    [
+        header(REPLACE, 5, 1, TIMESTAMP, tsn=5, commit=False) + dml(512, tuple_=[1, 'Roxette', 1988]),
+        header(DELETE, 6, 1, TIMESTAMP, tsn=5) + dml(512, key=[2]),
+    ],
+    [header(UPDATE, 7, 1, TIMESTAMP) + dml(512, index_base=1, key=[3], tuple_=[['=', 3, 1994]])],
+    [header(UPSERT, 8, 1, TIMESTAMP) + dml(512, index_base=1, ops=[['+', 3, 1]], tuple_=[5, 'Queen', 1970])],
+]
+
+os.makedirs(out_dir, exist_ok=True)
+with open(f'{out_dir}/00000000000000000003.snap', mode='wb') as f:
+    f.write(meta('SNAP', '{1: 3}') + block(snap_rows) + EOF_MARKER)
+with open(f'{out_dir}/00000000000000000003.xlog', mode='wb') as f:
+    f.write(meta('XLOG', '{1: 3}', '{}') + b''.join(block(rows) for rows in xlog_txs) + EOF_MARKER)
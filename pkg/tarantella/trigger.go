@@ -0,0 +1,140 @@
+package tarantella
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// triggers of spaces are set by Go code like space:before_replace and space:on_replace of Lua, they are listed
+// in _trigger while the process runs; _trigger is not persisted as SQL triggers aren't executed by tarantella
+
+type (
+	// BeforeReplaceTrigger is called before the tuple of the space is changed, old or new is nil for
+	// insertion or deletion. The returned tuple is written instead of the new one: nil deletes the old
+	// tuple, the old one skips the change. The trigger is called under the lock of the storage, so it must
+	// not access the storage
+	BeforeReplaceTrigger func(old, new []any) ([]any, error)
+
+	// OnReplaceTrigger is called after the tuple of the space is changed, it may access the storage
+	OnReplaceTrigger func(old, new []any)
+
+	// trigger is a trigger of the space
+	trigger struct {
+		name   string
+		before BeforeReplaceTrigger
+		on     OnReplaceTrigger
+	}
+)
+
+// BeforeReplace sets the trigger called before tuples of the space are changed, it returns the function
+// removing the trigger
+func (s *Storage) BeforeReplace(space string, fn BeforeReplaceTrigger) (func(), error) {
+	return s.addTrigger(space, "before_replace", &trigger{before: fn})
+}
+
+// OnReplace sets the trigger called after tuples of the space are changed, it returns the function
+// removing the trigger
+func (s *Storage) OnReplace(space string, fn OnReplaceTrigger) (func(), error) {
+	return s.addTrigger(space, "on_replace", &trigger{on: fn})
+}
+
+// BeforeReplace sets the before_replace trigger of the space, see Storage.BeforeReplace
+func (inst *Instance) BeforeReplace(space string, fn BeforeReplaceTrigger) (func(), error) {
+	return inst.storage.BeforeReplace(space, fn)
+}
+
+// OnReplace sets the on_replace trigger of the space, see Storage.OnReplace
+func (inst *Instance) OnReplace(space string, fn OnReplaceTrigger) (func(), error) {
+	return inst.storage.OnReplace(space, fn)
+}
+
+func (s *Storage) addTrigger(space, kind string, t *trigger) (func(), error) {
+	s.mu.Lock()
+	defer s.unlock()
+	sp, ok := s.names[space]
+	if !ok {
+		return nil, ErrNoSuchSpace(space)
+	}
+	if s.triggers == nil {
+		s.triggers = make(map[uint64][]*trigger)
+	}
+	s.triggerSeq++
+	t.name = fmt.Sprintf("%s.%s.%d", sp.Name, kind, s.triggerSeq)
+	s.triggers[sp.ID] = append(s.triggers[sp.ID], t)
+	s.mustExecute(&InsertRequest{SpaceID: BOX_TRIGGER_ID, Tuple: []any{t.name, sp.ID, map[any]any{"type": kind}}})
+
+	return func() {
+		s.mu.Lock()
+		defer s.unlock()
+		for i, other := range s.triggers[sp.ID] {
+			if other == t {
+				s.triggers[sp.ID] = append(s.triggers[sp.ID][:i:i], s.triggers[sp.ID][i+1:]...)
+				s.mustExecute(&DeleteRequest{SpaceID: BOX_TRIGGER_ID, Key: []any{t.name}})
+				return
+			}
+		}
+	}, nil
+}
+
+// dropTriggers removes triggers of the dropped space
+func (s *Storage) dropTriggers(id uint64) {
+	for _, t := range s.triggers[id] {
+		s.mustExecute(&DeleteRequest{SpaceID: BOX_TRIGGER_ID, Key: []any{t.name}})
+	}
+	delete(s.triggers, id)
+}
+
+// beforeReplace calls before_replace triggers of the change, the change is nil if it's skipped
+func (s *Storage) beforeReplace(ch *change) (*change, error) {
+	for _, t := range s.triggers[ch.space.ID] {
+		if t.before == nil {
+			continue
+		}
+		tuple, err := t.before(ch.old, ch.new)
+		if err != nil {
+			if be, ok := AsBoxError(err); ok {
+				return nil, be
+			}
+			return nil, ClientError(ER_PROC_C, err.Error())
+		}
+		switch {
+		case tuple == nil:
+			ch.new = nil
+		case ch.old != nil && reflect.DeepEqual(tuple, ch.old):
+			return nil, nil
+		default:
+			orig := ch.new
+			if orig == nil {
+				orig = ch.old
+			}
+			if ch.space.primary().compareKeys(tuple, orig) != 0 {
+				return nil, ClientError(ER_CANT_UPDATE_PRIMARY_KEY, ch.space.Name)
+			}
+			ch.new = tuple
+		}
+		if ch.old == nil && ch.new == nil {
+			return nil, nil
+		}
+	}
+	return ch, nil
+}
+
+// fire queues on_replace triggers of the applied change, they are called when the storage is unlocked
+func (s *Storage) fire(ch *change) {
+	for _, t := range s.triggers[ch.space.ID] {
+		if t.on != nil {
+			on, old, new := t.on, ch.old, ch.new
+			s.fired = append(s.fired, func() { on(old, new) })
+		}
+	}
+}
+
+// unlock unlocks the storage and calls queued on_replace triggers
+func (s *Storage) unlock() {
+	fired := s.fired
+	s.fired = nil
+	s.mu.Unlock()
+	for _, fn := range fired {
+		fn()
+	}
+}
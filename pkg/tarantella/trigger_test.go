@@ -0,0 +1,89 @@
+package tarantella
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriggers(t *testing.T) {
+	ctx := context.Background()
+	inst, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	s := inst.storage
+
+	users, err := s.createSpace("users", map[any]any{}, []any{},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}})
+	require.NoError(t, err)
+	audit, err := s.createSpace("audit", map[any]any{}, []any{},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}})
+	require.NoError(t, err)
+
+	// the denormalized field is kept by before_replace, locked users are never deleted
+	_, err = inst.BeforeReplace("users", func(old, new []any) ([]any, error) {
+		switch {
+		case new == nil && tupleField(old, 2) == "locked":
+			return old, nil
+		case new == nil:
+			return nil, nil
+		}
+		name, _ := tupleField(new, 1).(string)
+		return []any{new[0], name, tupleField(new, 2), strings.ToLower(name)}, nil
+	})
+	require.NoError(t, err)
+	// changes are logged into audit by on_replace
+	removeAudit, err := inst.OnReplace("users", func(old, new []any) {
+		_, err := inst.Execute(ctx, &InsertRequest{SpaceID: audit.ID, Tuple: []any{uint64(audit.Len() + 1), new}})
+		require.NoError(t, err)
+	})
+	require.NoError(t, err)
+
+	tuple, err := inst.Execute(ctx, &InsertRequest{SpaceID: users.ID, Tuple: []any{uint64(1), "Alice", "active"}})
+	require.NoError(t, err)
+	require.Equal(t, []any{uint64(1), "Alice", "active", "alice"}, tuple)
+	_, err = inst.Execute(ctx, &InsertRequest{SpaceID: users.ID, Tuple: []any{uint64(2), "Bob", "locked"}})
+	require.NoError(t, err)
+	_, err = inst.Execute(ctx, &DeleteRequest{SpaceID: users.ID, Key: []any{uint64(2)}})
+	require.NoError(t, err)
+	require.Equal(t, 2, users.Len())
+	require.Equal(t, 2, audit.Len())
+	require.Equal(t, []any{uint64(1), []any{uint64(1), "Alice", "active", "alice"}}, audit.Tuples()[0])
+
+	triggers, err := s.Select(&SelectRequest{SpaceID: BOX_TRIGGER_ID, IndexID: 1, Key: []any{users.ID}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, triggers, 2)
+	require.Equal(t, map[any]any{"type": "before_replace"}, triggers[0].([]any)[2])
+	removeAudit()
+	_, err = inst.Execute(ctx, &DeleteRequest{SpaceID: users.ID, Key: []any{uint64(1)}})
+	require.NoError(t, err)
+	require.Equal(t, 2, audit.Len())
+
+	// the primary key can't be changed by the trigger
+	_, err = inst.BeforeReplace("audit", func(old, new []any) ([]any, error) {
+		return []any{uint64(100)}, nil
+	})
+	require.NoError(t, err)
+	_, err = inst.Execute(ctx, &InsertRequest{SpaceID: audit.ID, Tuple: []any{uint64(3)}})
+	require.Equal(t, ER_CANT_UPDATE_PRIMARY_KEY, err.(*BoxError).Code)
+
+	// a statement of the stream transaction calls the trigger once, the tuple it returned is committed
+	logins, err := s.createSpace("logins", map[any]any{}, []any{},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}})
+	require.NoError(t, err)
+	calls := 0
+	_, err = inst.BeforeReplace("logins", func(old, new []any) ([]any, error) {
+		calls++
+		return append(append([]any{}, new...), uint64(calls)), nil
+	})
+	require.NoError(t, err)
+	tx := s.Begin(0)
+	tuple, err = tx.Execute(&InsertRequest{SpaceID: logins.ID, Tuple: []any{uint64(1)}})
+	require.NoError(t, err)
+	require.Equal(t, []any{uint64(1), uint64(1)}, tuple)
+	require.NoError(t, inst.Commit(ctx, tx))
+	require.Equal(t, 1, calls)
+	require.Equal(t, [][]any{{uint64(1), uint64(1)}}, s.spaces[logins.ID].Tuples())
+}
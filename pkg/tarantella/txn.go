@@ -0,0 +1,441 @@
+package tarantella
+
+import (
+	"reflect"
+	"time"
+)
+
+// interactive transactions of streams: statements of a transaction are applied to private copies of the spaces
+// they change, the tuples they wrote are committed as one transaction of the journal if the tuples they replaced
+// are still there, so the results told to the client are what is stored. Like vinyl, keys read by transactions
+// are tracked in vinyl spaces, a commit changing them aborts the readers by conflict
+
+type (
+	// Txn is an interactive transaction started by IPROTO_BEGIN or Storage.Begin
+	Txn struct {
+		s      *Storage
+		view   *Storage            // the catalog with private copies of changed spaces
+		own    map[uint64]struct{} // ids of the copied spaces
+		writes []any               // *txnWrite of statements to commit
+		reads  txnReads            // reads of vinyl spaces
+		timer  *time.Timer         // rolls back the transaction after the timeout
+
+		conflicted bool // a committed transaction changed what the transaction read
+		done       bool
+		timedOut   bool
+	}
+
+	// txnRead is a read of a vinyl space by the index
+	txnRead struct {
+		space    uint64
+		index    uint64
+		iterator uint64
+		key      []any
+	}
+	txnReads []txnRead
+
+	// txnWrite is the change of the tuple made by a statement of the transaction
+	txnWrite struct {
+		SpaceID  uint64
+		Old, New []any
+		Blind    bool      // the new tuple doesn't depend on the old one, like REPLACE
+		Seq      *txnWrite // the change of _sequence_data made by the statement, if any
+	}
+)
+
+// Begin starts the transaction, it's rolled back after the timeout if it's positive
+func (s *Storage) Begin(timeout time.Duration) *Txn {
+	s.mu.Lock()
+	defer s.unlock()
+	tx := &Txn{
+		s:    s,
+		view: &Storage{spaces: make(map[uint64]*Space, len(s.spaces)), names: make(map[string]*Space, len(s.names))},
+		own:  make(map[uint64]struct{}),
+	}
+	for id, sp := range s.spaces {
+		tx.view.spaces[id] = sp
+	}
+	for name, sp := range s.names {
+		tx.view.names[name] = sp
+	}
+	tx.view.callFunction, tx.view.triggers = s.callFunction, s.triggers
+	tx.view.fks, tx.view.cks, tx.view.deferFKs = s.fks, s.cks, true
+	if s.txns == nil {
+		s.txns = make(map[*Txn]struct{})
+	}
+	s.txns[tx] = struct{}{}
+	if timeout > 0 {
+		tx.timer = time.AfterFunc(timeout, func() {
+			s.mu.Lock()
+			defer s.unlock()
+			if !tx.done {
+				tx.timedOut = true
+				tx.finish()
+			}
+		})
+	}
+	return tx
+}
+
+// Execute executes DML request in the transaction, the change is visible to the transaction only
+func (tx *Txn) Execute(req any) ([]any, error) {
+	tx.s.mu.Lock()
+	defer tx.s.unlock()
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+
+	id := requestSpaceID(req)
+	sp, err := tx.view.space(id)
+	if err != nil {
+		return nil, err
+	}
+	if id < BOX_SYSTEM_ID_MAX {
+		return nil, ErrUnsupported("tarantella", "DDL in transactions")
+	}
+	tx.copySpace(id)
+	tx.copySpace(BOX_SEQUENCE_DATA_ID) // generated values are private too
+
+	ch, err := tx.view.prepare(req)
+	if err != nil || ch == nil {
+		return nil, err
+	}
+	ch.apply()
+	ins, blind := req.(*InsertRequest)
+	tx.writes = append(tx.writes, ch.write(blind && ins.Replace))
+
+	// replace and upsert are blind writes in vinyl, other statements read the key
+	if sp.Engine == engineVinyl {
+		switch r := req.(type) {
+		case *InsertRequest:
+			if !r.Replace {
+				tx.reads = append(tx.reads, txnRead{space: id, iterator: ITER_EQ, key: sp.primary().extractKey(ch.new)})
+			}
+		case *UpdateRequest, *DeleteRequest:
+			tx.reads = append(tx.reads, txnRead{space: id, iterator: ITER_EQ, key: sp.primary().extractKey(ch.old)})
+		}
+	}
+	return ch.result(), nil
+}
+
+// Select selects tuples seen by the transaction
+func (tx *Txn) Select(r *SelectRequest) ([]any, error) {
+	data, _, err := tx.SelectPage(r)
+	return data, err
+}
+
+// SelectPage selects tuples seen by the transaction like Storage.SelectPage does
+func (tx *Txn) SelectPage(r *SelectRequest) ([]any, []byte, error) {
+	tx.s.mu.Lock()
+	defer tx.s.unlock()
+	if err := tx.check(); err != nil {
+		return nil, nil, err
+	}
+	if sp, ok := tx.view.spaces[r.SpaceID]; ok && sp.Engine == engineVinyl {
+		tx.reads = append(tx.reads, txnRead{space: r.SpaceID, index: r.IndexID, iterator: r.Iterator, key: r.Key})
+	}
+	return tx.view.SelectPage(r)
+}
+
+// Commit writes tuples of the transaction into the journal as one transaction
+func (tx *Txn) Commit() error {
+	return tx.commit(0)
+}
+
+// commit commits the transaction, it's synchronous and confirmed by the instance if replicaID isn't 0
+func (tx *Txn) commit(replicaID uint64) error {
+	s := tx.s
+	s.mu.Lock()
+	defer s.unlock()
+	if err := tx.check(); err != nil {
+		tx.finish()
+		return err
+	}
+	defer tx.finish()
+	return s.commit(tx, tx.writes, replicaID)
+}
+
+// checkCommit checks the transaction may be committed, nothing is changed
+func (tx *Txn) checkCommit() error {
+	s := tx.s
+	s.mu.Lock()
+	defer s.unlock()
+	if err := tx.check(); err != nil {
+		return err
+	}
+	if s.readOnly {
+		return ErrReadonly()
+	}
+	changes, err := s.applyAll(tx.writes)
+	undoAll(changes)
+	return err
+}
+
+// isSync is true if the transaction changes a synchronous space
+func (tx *Txn) isSync() bool {
+	tx.s.mu.RLock()
+	defer tx.s.mu.RUnlock()
+	for _, w := range tx.writes {
+		if sp, ok := tx.s.spaces[requestSpaceID(w)]; ok && sp.isSync() {
+			return true
+		}
+	}
+	return false
+}
+
+// commit executes requests as one transaction of the journal, nothing is changed if any of them fails.
+// The transaction is synchronous if replicaID of the confirming instance isn't 0. The lock of the storage is held
+func (s *Storage) commit(tx *Txn, reqs []any, replicaID uint64) error {
+	if s.readOnly && len(reqs) > 0 {
+		return ErrReadonly()
+	}
+	changes, err := s.applyAll(reqs)
+	if err != nil {
+		return err
+	}
+	var rows []*Row
+	for _, ch := range changes {
+		rows = append(rows, ch.rows()...)
+	}
+	if s.journal != nil && len(rows) > 0 {
+		last := rows[len(rows)-1]
+		if replicaID != 0 {
+			last.Flags |= IPROTO_FLAG_WAIT_SYNC
+		}
+		if err := s.journal.write(rows); err != nil {
+			undoAll(changes)
+			return err
+		}
+		if replicaID != 0 {
+			confirm := &Row{Type: IPROTO_RAFT_CONFIRM, Body: map[any]any{IPROTO_REPLICA_ID: replicaID, IPROTO_LSN: last.LSN}}
+			if err := s.journal.write([]*Row{confirm}); err != nil {
+				undoAll(changes)
+				return err
+			}
+		}
+	}
+
+	for _, ch := range changes {
+		s.abortReaders(tx, ch)
+		s.fire(ch)
+	}
+	return nil
+}
+
+// applyAll prepares and applies requests checking deferred foreign keys, nothing is changed if any of them fails
+func (s *Storage) applyAll(reqs []any) ([]*change, error) {
+	s.deferFKs = true
+	defer func() { s.deferFKs = false }()
+	var changes []*change
+	for _, req := range reqs {
+		ch, err := s.prepare(req)
+		if err != nil {
+			undoAll(changes)
+			return nil, err
+		}
+		if ch == nil {
+			continue
+		}
+		ch.apply()
+		changes = append(changes, ch)
+	}
+	if err := s.checkDeferred(changes); err != nil {
+		undoAll(changes)
+		return nil, err
+	}
+	return changes, nil
+}
+
+// undoAll reverts applied changes in the reverse order
+func undoAll(changes []*change) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		changes[i].undo()
+	}
+}
+
+// abortReaders aborts transactions which read keys of the change except the committed one
+func (s *Storage) abortReaders(committed *Txn, ch *change) {
+	for tx := range s.txns {
+		if tx != committed && tx.reads.touch(ch) {
+			tx.conflicted = true
+		}
+	}
+}
+
+// Rollback discards the transaction
+func (tx *Txn) Rollback() {
+	tx.s.mu.Lock()
+	defer tx.s.unlock()
+	tx.finish()
+}
+
+// check returns the error if the transaction can't go on
+func (tx *Txn) check() error {
+	switch {
+	case tx.timedOut:
+		return ClientError(ER_TRANSACTION_TIMEOUT)
+	case tx.done:
+		return ClientError(ER_NO_TRANSACTION)
+	case tx.conflicted:
+		return ClientError(ER_TRANSACTION_CONFLICT)
+	}
+	return nil
+}
+
+// finish forgets the transaction, the lock of the storage is held
+func (tx *Txn) finish() {
+	tx.done = true
+	tx.view = nil
+	if tx.timer != nil {
+		tx.timer.Stop()
+	}
+	delete(tx.s.txns, tx)
+}
+
+// copySpace makes the private copy of the space before the transaction changes it
+func (tx *Txn) copySpace(id uint64) {
+	sp, ok := tx.view.spaces[id]
+	if _, copied := tx.own[id]; copied || !ok {
+		return
+	}
+	c := *sp
+	c.Indexes = make([]*Index, len(sp.Indexes))
+	for i, idx := range sp.Indexes {
+		ci := *idx
+		ci.space = &c
+		ci.tuples = append([][]any(nil), idx.tuples...)
+		ci.entries = append([][]any(nil), idx.entries...)
+		c.Indexes[i] = &ci
+	}
+	tx.view.installSpace(&c)
+	tx.own[id] = struct{}{}
+}
+
+// touch is true if the change affects any of the reads
+func (reads txnReads) touch(ch *change) bool {
+	for _, r := range reads {
+		if r.space != ch.space.ID || ch.space.Engine != engineVinyl {
+			continue
+		}
+		for _, t := range [][]any{ch.old, ch.new} {
+			if t != nil && r.matches(ch.space, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches is true if the read would see the tuple
+func (r txnRead) matches(sp *Space, tuple []any) bool {
+	idx, err := sp.index(r.index)
+	if err != nil || !idx.ordered() || len(r.key) == 0 {
+		return true
+	}
+	keys, err := idx.keys(tuple)
+	if err != nil {
+		return true
+	}
+	for _, k := range keys {
+		c := idx.compareWithKey(k, r.key)
+		switch r.iterator {
+		case ITER_EQ, ITER_REQ:
+			if c == 0 {
+				return true
+			}
+		case ITER_GE:
+			if c >= 0 {
+				return true
+			}
+		case ITER_GT:
+			if c > 0 {
+				return true
+			}
+		case ITER_LE:
+			if c <= 0 {
+				return true
+			}
+		case ITER_LT:
+			if c < 0 {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// undo reverts the applied change of tuples
+func (ch *change) undo() {
+	if ch.uncatalog != nil {
+		ch.uncatalog()
+	}
+	for _, idx := range ch.space.Indexes {
+		if ch.new != nil {
+			idx.remove(ch.new)
+		}
+		if ch.old != nil {
+			idx.insert(ch.old)
+		}
+	}
+	if ch.seq != nil {
+		ch.seq.undo()
+	}
+}
+
+// write returns the change as the write to commit
+func (ch *change) write(blind bool) *txnWrite {
+	w := &txnWrite{SpaceID: ch.space.ID, Old: ch.old, New: ch.new, Blind: blind}
+	if ch.seq != nil {
+		w.Seq = ch.seq.write(false)
+	}
+	return w
+}
+
+// prepareWrite makes the change of the committed write, it fails if the tuple replaced by the statement
+// was changed by others meanwhile
+func (s *Storage) prepareWrite(ch *change, w *txnWrite) (err error) {
+	if ch.space, err = s.writableSpace(w.SpaceID); err != nil {
+		return err
+	}
+	if w.Seq != nil {
+		if ch.seq, err = s.prepare(w.Seq); err != nil {
+			return err
+		}
+	}
+	tuple := w.New
+	if tuple == nil {
+		tuple = w.Old
+	}
+	if ch.old, err = ch.space.primary().find(tuple, true); err != nil {
+		return err
+	}
+	switch {
+	case w.Blind || reflect.DeepEqual(ch.old, w.Old):
+	case w.Old == nil && w.SpaceID != BOX_SEQUENCE_DATA_ID:
+		// the key inserted by the statement was taken, values of sequences conflict
+		return ErrTupleFound(ch.space.primary().Name, ch.space.Name, ch.old, w.New)
+	default:
+		return ClientError(ER_TRANSACTION_CONFLICT)
+	}
+	ch.new = w.New
+	return nil
+}
+
+// requestSpaceID returns the space changed by DML request
+func requestSpaceID(req any) uint64 {
+	switch r := req.(type) {
+	case *InsertRequest:
+		return r.SpaceID
+	case *UpdateRequest:
+		return r.SpaceID
+	case *DeleteRequest:
+		return r.SpaceID
+	case *UpsertRequest:
+		return r.SpaceID
+	case *txnWrite:
+		return r.SpaceID
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+package tarantella
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVinylTxn(t *testing.T) {
+	inst, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	s := inst.storage
+
+	sp, err := s.createSpace("accounts", map[any]any{"engine": "vinyl"}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "balance", "type": "unsigned"},
+	},
+		[]any{0, "pk", "tree", map[any]any{"unique": true, "bloom_fpr": 0.05, "page_size": 8192, "range_size": 1 << 30},
+			[]any{[]any{0, "unsigned"}}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, engineVinyl, sp.Engine)
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{sp.ID, uint64(1), "hash", "hash",
+		map[any]any{"unique": true}, []any{[]any{uint64(1), "unsigned"}}}})
+	require.Equal(t, ER_INDEX_TYPE, err.(*BoxError).Code)
+	_, err = s.Execute(&InsertRequest{SpaceID: BOX_INDEX_ID, Tuple: []any{sp.ID, uint64(1), "balance", "tree",
+		map[any]any{"unique": false, "bloom_fpr": 2.0}, []any{[]any{uint64(1), "unsigned"}}}})
+	require.Equal(t, ER_WRONG_INDEX_OPTIONS, err.(*BoxError).Code)
+
+	// a wrong result of the upsert is skipped when it's applied
+	_, err = s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{uint64(1), uint64(100)}})
+	require.NoError(t, err)
+	_, err = s.Execute(&UpsertRequest{SpaceID: sp.ID, Tuple: []any{uint64(1), uint64(0)},
+		Ops: []any{[]any{"=", uint64(1), "lots"}}})
+	require.NoError(t, err)
+	get := func(tx *Txn, id uint64) []any {
+		req := &SelectRequest{SpaceID: sp.ID, Key: []any{id}, Limit: 1}
+		data, err := s.Select(req)
+		if tx != nil {
+			data, err = tx.Select(req)
+		}
+		require.NoError(t, err)
+		return data
+	}
+	require.Equal(t, []any{[]any{uint64(1), uint64(100)}}, get(nil, 1))
+
+	// changes are seen by the transaction only until it's committed
+	tx := s.Begin(0)
+	_, err = tx.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{uint64(2), uint64(50)}})
+	require.NoError(t, err)
+	require.Len(t, get(tx, 2), 1)
+	require.Empty(t, get(nil, 2))
+	require.NoError(t, tx.Commit())
+	require.Len(t, get(nil, 2), 1)
+
+	// the reader of a key changed by another commit is aborted, blind writers are not
+	reader, writer, blind := s.Begin(0), s.Begin(0), s.Begin(0)
+	require.Len(t, get(reader, 1), 1)
+	_, err = blind.Execute(&InsertRequest{Replace: true, SpaceID: sp.ID, Tuple: []any{uint64(1), uint64(70)}})
+	require.NoError(t, err)
+	_, err = writer.Execute(&UpdateRequest{SpaceID: sp.ID, Key: []any{uint64(1)}, Ops: []any{[]any{"-", uint64(1), uint64(10)}}})
+	require.NoError(t, err)
+	require.NoError(t, writer.Commit())
+	_, err = reader.Execute(&InsertRequest{Replace: true, SpaceID: sp.ID, Tuple: []any{uint64(1), uint64(0)}})
+	require.Equal(t, ER_TRANSACTION_CONFLICT, err.(*BoxError).Code)
+	require.Equal(t, ER_TRANSACTION_CONFLICT, reader.Commit().(*BoxError).Code)
+	require.NoError(t, blind.Commit())
+	require.Equal(t, []any{[]any{uint64(1), uint64(70)}}, get(nil, 1))
+
+	// an autocommit write aborts readers too
+	tx = s.Begin(0)
+	_, err = tx.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{uint64(3), uint64(1)}})
+	require.NoError(t, err)
+	_, err = s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{uint64(3), uint64(2)}})
+	require.NoError(t, err)
+	require.Equal(t, ER_TRANSACTION_CONFLICT, tx.Commit().(*BoxError).Code)
+
+	// memtx transactions aren't tracked, a failed statement of the commit reverts the transaction
+	plain, err := s.createSpace("plain", map[any]any{}, []any{},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}})
+	require.NoError(t, err)
+	tx = s.Begin(0)
+	for _, req := range []any{
+		&DeleteRequest{SpaceID: sp.ID, Key: []any{uint64(2)}},
+		&InsertRequest{SpaceID: plain.ID, Tuple: []any{uint64(1)}},
+	} {
+		_, err = tx.Execute(req)
+		require.NoError(t, err)
+	}
+	_, err = s.Execute(&InsertRequest{SpaceID: plain.ID, Tuple: []any{uint64(1)}})
+	require.NoError(t, err)
+	require.Equal(t, ER_TUPLE_FOUND, tx.Commit().(*BoxError).Code)
+	require.Len(t, get(nil, 2), 1)
+}
+
+func TestTxnResults(t *testing.T) {
+	inst, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	s := inst.storage
+
+	sp, err := s.createSpace("orders", map[any]any{}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "item", "type": "string"},
+	},
+		[]any{0, "pk", "tree", map[any]any{"unique": true, "sequence": true}, []any{[]any{0, "unsigned"}}},
+	)
+	require.NoError(t, err)
+	all := func() []any {
+		data, err := s.Select(&SelectRequest{SpaceID: sp.ID, Iterator: ITER_ALL, Limit: 10})
+		require.NoError(t, err)
+		return data
+	}
+
+	// both transactions are told the same generated id, the second one can't store it
+	first, second := s.Begin(0), s.Begin(0)
+	for _, tx := range []*Txn{first, second} {
+		tuple, err := tx.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{nil, "pen"}})
+		require.NoError(t, err)
+		require.Equal(t, []any{uint64(1), "pen"}, tuple)
+	}
+	require.NoError(t, first.Commit())
+	require.Equal(t, ER_TRANSACTION_CONFLICT, second.Commit().(*BoxError).Code)
+	require.Equal(t, []any{[]any{uint64(1), "pen"}}, all())
+
+	// the result of the update is stored or the commit fails
+	update := &UpdateRequest{SpaceID: sp.ID, Key: []any{uint64(1)}, Ops: []any{[]any{"=", uint64(1), "ink"}}}
+	tx := s.Begin(0)
+	tuple, err := tx.Execute(update)
+	require.NoError(t, err)
+	require.Equal(t, []any{uint64(1), "ink"}, tuple)
+	_, err = s.Execute(&InsertRequest{Replace: true, SpaceID: sp.ID, Tuple: []any{uint64(1), "paper"}})
+	require.NoError(t, err)
+	require.Equal(t, ER_TRANSACTION_CONFLICT, tx.Commit().(*BoxError).Code)
+	require.Equal(t, []any{[]any{uint64(1), "paper"}}, all())
+
+	// statements of the transaction build on each other
+	tx = s.Begin(0)
+	for _, req := range []any{
+		&InsertRequest{SpaceID: sp.ID, Tuple: []any{nil, "clip"}},
+		&UpdateRequest{SpaceID: sp.ID, Key: []any{uint64(2)}, Ops: []any{[]any{"=", uint64(1), "pin"}}},
+		&InsertRequest{Replace: true, SpaceID: sp.ID, Tuple: []any{uint64(1), "pencil"}},
+	} {
+		_, err = tx.Execute(req)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	require.Equal(t, []any{[]any{uint64(1), "pencil"}, []any{uint64(2), "pin"}}, all())
+}
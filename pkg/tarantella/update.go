@@ -0,0 +1,240 @@
+package tarantella
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// see https://www.tarantool.io/en/doc/latest/reference/reference_lua/box_space/update/
+
+// applyUpdate applies update operations [[op, field, args...], ...] to the copy of the tuple,
+// field numbers are counted from indexBase, negative ones from the end, strings are field names
+func applyUpdate(sp *Space, tuple, ops []any, indexBase uint64) ([]any, error) {
+	res := append([]any{}, tuple...)
+	for i, o := range ops {
+		op, ok := o.([]any)
+		if !ok || len(op) < 2 {
+			return nil, ErrIllegalParams("update operation must be an array {op,..}")
+		}
+		name, ok := op[0].(string)
+		if !ok || len(name) != 1 {
+			return nil, ClientError(ER_UNKNOWN_UPDATE_OP, i+1, "expected a string with one character")
+		}
+		var err error
+		if res, err = applyUpdateOp(sp, res, name[0], op, indexBase); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func applyUpdateOp(sp *Space, tuple []any, op byte, args []any, indexBase uint64) ([]any, error) { //nolint: cyclop
+	argCount := map[byte]int{'=': 3, '+': 3, '-': 3, '&': 3, '|': 3, '^': 3, '!': 3, '#': 3, ':': 5}
+	n, ok := argCount[op]
+	if !ok {
+		return nil, ClientError(ER_UNKNOWN_UPDATE_OP, 1, fmt.Sprintf("unknown operation '%c'", op))
+	}
+	if len(args) != n {
+		return nil, ClientError(ER_UNKNOWN_UPDATE_OP, 1, "wrong number of arguments, expected "+fmt.Sprint(n))
+	}
+
+	// '!' and '=' may address the field right after the last one
+	extra := 0
+	if op == '!' || op == '=' {
+		extra = 1
+	}
+	no, ref, err := updateFieldNo(sp, tuple, args[1], indexBase, extra)
+	if err != nil {
+		return nil, err
+	}
+	if op == '!' {
+		if no < 0 {
+			no = len(tuple) // -1 means the end of the tuple
+		}
+		res := append([]any{}, tuple[:no]...)
+		res = append(res, args[2])
+		return append(res, tuple[no:]...), nil
+	}
+	if no == len(tuple) && op == '=' {
+		return append(tuple, args[2]), nil
+	}
+
+	switch op {
+	case '=':
+		tuple[no] = args[2]
+	case '#':
+		count, ok := args[2].(uint64)
+		if !ok || count == 0 {
+			return nil, ClientError(ER_UPDATE_FIELD, ref, "cannot delete 0 fields")
+		}
+		end := no + int(math.Min(float64(count), float64(len(tuple)-no)))
+		tuple = append(tuple[:no], tuple[end:]...)
+	case '+', '-':
+		v, err := arithmetic(op, tuple[no], args[2], ref)
+		if err != nil {
+			return nil, err
+		}
+		tuple[no] = v
+	case '&', '|', '^':
+		a, okA := tuple[no].(uint64)
+		b, okB := args[2].(uint64)
+		if !okA || !okB {
+			return nil, ClientError(ER_UPDATE_ARG_TYPE, rune(op), ref, "a positive integer")
+		}
+		switch op {
+		case '&':
+			tuple[no] = a & b
+		case '|':
+			tuple[no] = a | b
+		default:
+			tuple[no] = a ^ b
+		}
+	case ':':
+		v, err := splice(tuple[no], args[2], args[3], args[4], ref)
+		if err != nil {
+			return nil, err
+		}
+		tuple[no] = v
+	}
+	return tuple, nil
+}
+
+// updateFieldNo returns 0-based field number and its reference for error messages
+func updateFieldNo(sp *Space, tuple []any, field any, indexBase uint64, extra int) (int, string, error) {
+	switch f := field.(type) {
+	case uint64:
+		if f < indexBase {
+			return 0, "", ClientError(ER_NO_SUCH_FIELD_NO, int64(f))
+		}
+		no := f - indexBase
+		if no >= uint64(len(tuple)+extra) {
+			return 0, "", ClientError(ER_NO_SUCH_FIELD_NO, int64(f))
+		}
+		return int(no), fmt.Sprint(f + 1 - indexBase), nil
+	case int64:
+		no := int64(len(tuple)) + f
+		if extra > 0 && f == -1 {
+			return -1, fmt.Sprint(f), nil
+		}
+		if no < 0 {
+			return 0, "", ClientError(ER_NO_SUCH_FIELD_NO, f)
+		}
+		return int(no), fmt.Sprint(no + 1), nil
+	case string:
+		if sp != nil {
+			if no, ok := sp.fieldNo(f); ok && no < uint64(len(tuple)+extra) {
+				return int(no), "'" + f + "'", nil
+			}
+		}
+		return 0, "", ClientError(ER_NO_SUCH_FIELD_NAME, f)
+	}
+	return 0, "", ErrIllegalParams("field id must be a number or a string")
+}
+
+// arithmetic makes + or - on numbers keeping integer types while it's possible
+func arithmetic(op byte, a, b any, ref string) (any, error) {
+	ca, cb := classOf(a), classOf(b)
+	if ca != mpClassNumber || cb != mpClassNumber {
+		return nil, ClientError(ER_UPDATE_ARG_TYPE, rune(op), ref, "a number")
+	}
+
+	_, isDecA := a.(Decimal)
+	_, isDecB := b.(Decimal)
+	ka, _, _, _ := normalizeNumber(a)
+	kb, _, _, _ := normalizeNumber(b)
+
+	switch {
+	case isDecA || isDecB:
+		ra, rb := numberRat(a), numberRat(b)
+		if op == '-' {
+			rb.Neg(rb)
+		}
+		d, err := ParseDecimal(ra.Add(ra, rb).FloatString(decimalScale(a, b)))
+		if err != nil {
+			return nil, ClientError(ER_UPDATE_DECIMAL_OVERFLOW, rune(op), ref)
+		}
+		return d, nil
+	case ka == numberFloat || kb == numberFloat:
+		fa, _ := numberRat(a).Float64()
+		fb, _ := numberRat(b).Float64()
+		if op == '-' {
+			fb = -fb
+		}
+		if _, ok := a.(float32); ok {
+			if _, ok := b.(float32); ok {
+				return float32(fa + fb), nil
+			}
+		}
+		return fa + fb, nil
+	}
+
+	ra, rb := numberRat(a), numberRat(b)
+	if op == '-' {
+		rb.Neg(rb)
+	}
+	sum := ra.Add(ra, rb).Num()
+	switch {
+	case sum.Sign() >= 0 && sum.IsUint64():
+		return sum.Uint64(), nil
+	case sum.IsInt64():
+		return sum.Int64(), nil
+	}
+	return nil, ClientError(ER_UPDATE_INTEGER_OVERFLOW, rune(op), ref)
+}
+
+// decimalScale returns the scale of the result of decimal operation
+func decimalScale(a, b any) int {
+	scale := 0
+	for _, v := range []any{a, b} {
+		if d, ok := v.(Decimal); ok && int(d.Scale) > scale {
+			scale = int(d.Scale)
+		}
+	}
+	return scale
+}
+
+// splice replaces length characters from the position (1-based, negative from the end) by the string
+func splice(v, pos, length, str any, ref string) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, ClientError(ER_UPDATE_ARG_TYPE, ':', ref, "a string")
+	}
+	insert, ok := str.(string)
+	if !ok {
+		return nil, ClientError(ER_UPDATE_ARG_TYPE, ':', ref, "a string")
+	}
+	p := new(big.Int)
+	switch n := pos.(type) {
+	case uint64:
+		p.SetUint64(n)
+	case int64:
+		p.SetInt64(n)
+	default:
+		return nil, ClientError(ER_UPDATE_SPLICE, ref, "invalid offset")
+	}
+	offset := int(p.Int64())
+	switch {
+	case offset > 0:
+		offset--
+		if offset > len(s) {
+			offset = len(s)
+		}
+	case offset < 0:
+		offset += len(s) + 1
+		if offset < 0 {
+			return nil, ClientError(ER_UPDATE_SPLICE, ref, "offset is out of bound")
+		}
+	default:
+		return nil, ClientError(ER_UPDATE_SPLICE, ref, "offset is out of bound")
+	}
+	cut, ok := length.(uint64)
+	if !ok {
+		return nil, ClientError(ER_UPDATE_SPLICE, ref, "invalid length")
+	}
+	end := offset + int(cut)
+	if end > len(s) {
+		end = len(s)
+	}
+	return s[:offset] + insert + s[end:], nil
+}
@@ -0,0 +1,121 @@
+package tarantella
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Vclock is the vector clock: LSN of the last row of each replica by replica id
+type Vclock map[uint64]uint64
+
+// vclockMax limits replica ids: they are 1..vclockMax-1
+const vclockMax = 32
+
+// Signature is the sum of all components, files of logs and snapshots are named by it
+func (vc Vclock) Signature() uint64 {
+	var sum uint64
+	for _, lsn := range vc {
+		sum += lsn
+	}
+	return sum
+}
+
+// Copy returns an independent copy of the clock
+func (vc Vclock) Copy() Vclock {
+	res := make(Vclock, len(vc))
+	for id, lsn := range vc {
+		res[id] = lsn
+	}
+	return res
+}
+
+// Follow moves the component of the replica forward
+func (vc Vclock) Follow(replicaID, lsn uint64) {
+	if lsn > vc[replicaID] {
+		vc[replicaID] = lsn
+	}
+}
+
+// Reached checks that each component of the other clock is not ahead of this one
+func (vc Vclock) Reached(other Vclock) bool {
+	for id, lsn := range other {
+		if vc[id] < lsn {
+			return false
+		}
+	}
+	return true
+}
+
+// ids returns replica ids in ascending order
+func (vc Vclock) ids() []uint64 {
+	ids := make([]uint64, 0, len(vc))
+	for id := range vc {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// String formats the clock like tarantool does: {1: 10, 2: 5}, zero components are omitted
+func (vc Vclock) String() string {
+	var b strings.Builder
+	b.WriteByte('{')
+	first := true
+	for _, id := range vc.ids() {
+		if vc[id] == 0 {
+			continue
+		}
+		if !first {
+			b.WriteString(", ")
+		}
+		first = false
+		b.WriteString(strconv.FormatUint(id, 10))
+		b.WriteString(": ")
+		b.WriteString(strconv.FormatUint(vc[id], 10))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// toMap returns the clock as a msgpack map
+func (vc Vclock) toMap() map[any]any {
+	m := make(map[any]any, len(vc))
+	for id, lsn := range vc {
+		if lsn != 0 {
+			m[id] = lsn
+		}
+	}
+	return m
+}
+
+// parseVclock parses the clock formatted by String
+func parseVclock(s string) (Vclock, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, errors.Errorf("invalid vclock '%s'", s)
+	}
+	vc := Vclock{}
+	body := strings.TrimSpace(s[1 : len(s)-1])
+	if body == "" {
+		return vc, nil
+	}
+	for _, c := range strings.Split(body, ",") {
+		id, lsn, ok := strings.Cut(c, ":")
+		if !ok {
+			return nil, errors.Errorf("invalid vclock '%s'", s)
+		}
+		i, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("invalid vclock '%s'", s)
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(lsn), 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid vclock '%s'", s)
+		}
+		vc[i] = n
+	}
+	return vc, nil
+}
@@ -0,0 +1,515 @@
+package tarantella
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// The process may emulate a cluster sharded by vshard. Storages keep their buckets in _bucket like
+// vshard.storage does, the buckets are distributed evenly on the first start. The router finds the
+// storage of a bucket by _bucket and calls the function there by vshard.storage.call. There is no Lua,
+// so functions of storages are registered by Vshard.RegisterFunction
+
+// defaultBucketCount is bucket_count of vshard
+const defaultBucketCount = 3000
+
+// bucket statuses of _bucket
+const bucketActive = "active"
+
+// codes of vshard errors, see vshard/error.lua
+const (
+	vshardWrongBucket     = 1
+	vshardNonMaster       = 2
+	vshardNoRouteToBucket = 9
+)
+
+var vshardErrorNames = map[uint64]string{
+	vshardWrongBucket:     "WRONG_BUCKET",
+	vshardNonMaster:       "NON_MASTER",
+	vshardNoRouteToBucket: "NO_ROUTE_TO_BUCKET",
+}
+
+type (
+	// Vshard is a sharded cluster of instances of one process
+	Vshard struct {
+		mu           sync.Mutex
+		storages     []*Instance
+		storageCount int
+		bucketCount  uint64
+	}
+)
+
+// NewVshard makes the cluster of storageCount storages, bucketCount is 3000 if it's 0
+func NewVshard(storageCount int, bucketCount uint64) *Vshard {
+	if bucketCount == 0 {
+		bucketCount = defaultBucketCount
+	}
+	return &Vshard{storageCount: storageCount, bucketCount: bucketCount}
+}
+
+// AddStorage makes the instance the next storage, a new storage gets its share of buckets
+func (v *Vshard) AddStorage(inst *Instance) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.storages) == v.storageCount {
+		return errors.Errorf("vshard has %d storages already", v.storageCount)
+	}
+
+	if _, ok := inst.storage.SpaceByName("_bucket"); !ok {
+		// like vshard.router.bootstrap(): the first storages get one bucket more
+		n, i := uint64(v.storageCount), uint64(len(v.storages))
+		count := v.bucketCount / n
+		first := i*count + i + 1
+		if extra := v.bucketCount % n; i < extra {
+			count++
+		} else {
+			first -= i - extra
+		}
+		if err := createBuckets(inst.storage, first, count); err != nil {
+			return errors.Wrapf(err, "unable to create buckets of storage %s", inst.cfg.ListenOn)
+		}
+		log.Info().Str("storage", inst.cfg.ListenOn).Uint64("first", first).Uint64("count", count).Msg("Buckets are created")
+	}
+	v.storages = append(v.storages, inst)
+	v.registerStorage(inst)
+	return nil
+}
+
+// AddRouter makes vshard.router available on the instance, crud functions of the router
+// work with the storages
+func (v *Vshard) AddRouter(inst *Instance) {
+	v.registerRouter(inst)
+	registerCrud(inst, &crud{storages: v.storageList, route: v.route, bucketCount: v.bucketCount})
+}
+
+// storageList returns the storages added so far
+func (v *Vshard) storageList() []*Instance {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.storages
+}
+
+// RegisterFunction registers the function on all storages
+func (v *Vshard) RegisterFunction(name string, fn Function) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, inst := range v.storages {
+		inst.RegisterFunction(name, fn)
+	}
+}
+
+// createBuckets creates _bucket like vshard.storage.cfg does and fills it with active buckets
+func createBuckets(s *Storage, first, count uint64) error {
+	sp, err := s.createSpace("_bucket", map[any]any{}, []any{
+		map[any]any{"name": "id", "type": "unsigned"},
+		map[any]any{"name": "status", "type": "string"},
+		map[any]any{"name": "destination", "type": "string", "is_nullable": true},
+	},
+		[]any{0, "pk", "tree", map[any]any{"unique": true}, []any{[]any{0, "unsigned"}}},
+		[]any{1, "status", "tree", map[any]any{"unique": false}, []any{[]any{1, "string"}}},
+	)
+	if err != nil {
+		return err
+	}
+	for id := first; id < first+count; id++ {
+		if _, err := s.Execute(&InsertRequest{SpaceID: sp.ID, Tuple: []any{id, bucketActive}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buckets returns _bucket tuples of the storage, all of them if id is 0
+func buckets(inst *Instance, id uint64) [][]any {
+	sp, ok := inst.storage.SpaceByName("_bucket")
+	if !ok {
+		return nil
+	}
+	req := &SelectRequest{SpaceID: sp.ID, Limit: math.MaxUint32, Iterator: ITER_ALL}
+	if id != 0 {
+		req.Iterator, req.Key = ITER_EQ, []any{id}
+	}
+	data, _ := inst.storage.Select(req)
+	tuples := make([][]any, 0, len(data))
+	for _, t := range data {
+		tuples = append(tuples, t.([]any))
+	}
+	return tuples
+}
+
+// bucketStatus returns the status of the bucket on the storage, it's empty if there is no such bucket
+func bucketStatus(inst *Instance, id uint64) string {
+	for _, t := range buckets(inst, id) {
+		status, _ := t[1].(string)
+		return status
+	}
+	return ""
+}
+
+func (v *Vshard) registerStorage(inst *Instance) {
+	inst.RegisterFunction("vshard.storage.call", func(ctx *CallContext, args []any) ([]any, error) {
+		id, ok := uintArg(args, 0)
+		name, _ := arg(args, 2).(string)
+		if !ok || name == "" {
+			return nil, ErrProcLua("Usage: vshard.storage.call(bucket_id, mode, function_name, args)")
+		}
+		mode := callMode(arg(args, 1))
+		if bucketStatus(ctx.Instance, id) != bucketActive {
+			return []any{nil, vshardError(vshardWrongBucket, id, "Cannot perform action with bucket %d, reason: %s",
+				id, "Not found").m}, nil
+		}
+		if mode == "write" && ctx.Instance.storage.isReadOnly() {
+			return []any{nil, vshardError(vshardNonMaster, id, "Replica %s is not a master for replicaset %s anymore",
+				ctx.Instance.UUID, ctx.Instance.storage.replicasetUUID()).m}, nil
+		}
+		fnArgs, _ := arg(args, 3).([]any)
+		ret, err := ctx.Instance.Call(ctx, name, fnArgs)
+		if err != nil {
+			return nil, err
+		}
+		return append([]any{true}, ret...), nil
+	})
+	inst.RegisterFunction("vshard.storage.buckets_info", func(ctx *CallContext, args []any) ([]any, error) {
+		id, _ := uintArg(args, 0)
+		info := make(map[any]any)
+		for _, t := range buckets(ctx.Instance, id) {
+			info[t[0]] = map[any]any{"id": t[0], "status": t[1]}
+		}
+		return []any{info}, nil
+	})
+	inst.RegisterFunction("vshard.storage.bucket_stat", func(ctx *CallContext, args []any) ([]any, error) {
+		id, ok := uintArg(args, 0)
+		if !ok {
+			return nil, ErrProcLua("Usage: vshard.storage.bucket_stat(bucket_id)")
+		}
+		status := bucketStatus(ctx.Instance, id)
+		if status == "" {
+			return []any{nil, vshardError(vshardWrongBucket, id, "Cannot perform action with bucket %d, reason: %s",
+				id, "Not found").m}, nil
+		}
+		return []any{map[any]any{"id": id, "status": status}}, nil
+	})
+	inst.RegisterFunction("vshard.storage.buckets_count", func(ctx *CallContext, args []any) ([]any, error) {
+		return []any{uint64(len(buckets(ctx.Instance, 0)))}, nil
+	})
+	inst.RegisterFunction("vshard.storage.info", func(ctx *CallContext, args []any) ([]any, error) {
+		return []any{v.storageInfo(ctx.Instance)}, nil
+	})
+}
+
+// storageInfo describes the storage like vshard.storage.info()
+func (v *Vshard) storageInfo(inst *Instance) map[any]any {
+	counts := map[any]any{"active": uint64(0), "garbage": uint64(0), "pinned": uint64(0),
+		"receiving": uint64(0), "sending": uint64(0), "total": uint64(0)}
+	for _, t := range buckets(inst, 0) {
+		status, _ := t[1].(string)
+		if n, ok := counts[status].(uint64); ok {
+			counts[status] = n + 1
+		}
+		counts["total"] = counts["total"].(uint64) + 1
+	}
+	uuid := inst.storage.replicasetUUID()
+	return map[any]any{
+		"status":      uint64(0),
+		"alerts":      []any{},
+		"bucket":      counts,
+		"replicasets": map[any]any{uuid: v.replicasetInfo(inst)},
+	}
+}
+
+// replicasetInfo describes the replicaset of the storage like vshard.router.route() does
+func (v *Vshard) replicasetInfo(inst *Instance) map[any]any {
+	return map[any]any{
+		"uuid": inst.storage.replicasetUUID(),
+		"master": map[any]any{
+			"uri":    inst.cfg.ListenOn,
+			"uuid":   inst.UUID,
+			"status": "available",
+		},
+	}
+}
+
+// route returns the storage of the bucket
+func (v *Vshard) route(id uint64) (*Instance, error) {
+	if id == 0 || id > v.bucketCount {
+		return nil, ErrProcLua("Bucket is unreachable: bucket id is out of range")
+	}
+	v.mu.Lock()
+	storages := v.storages
+	v.mu.Unlock()
+	for _, inst := range storages {
+		if bucketStatus(inst, id) == bucketActive {
+			return inst, nil
+		}
+	}
+	return nil, vshardError(vshardNoRouteToBucket, id, "Bucket %d cannot be found. Is rebalancing in progress?", id)
+}
+
+// call calls the function on the storage of the bucket, errors of routing and of the function
+// are returned like vshard does: nil, error
+func (v *Vshard) call(ctx context.Context, id uint64, mode, name string, args []any) ([]any, error) {
+	inst, err := v.route(id)
+	if err != nil {
+		if ve, ok := err.(*vshardErr); ok {
+			return []any{nil, ve.m}, nil
+		}
+		return nil, err
+	}
+	ret, err := inst.Call(ctx, "vshard.storage.call", []any{id, mode, name, args})
+	if err != nil {
+		return []any{nil, errorMap(err)}, nil
+	}
+	if len(ret) > 0 && ret[0] == nil {
+		return ret, nil
+	}
+	return ret[1:], nil
+}
+
+func (v *Vshard) registerRouter(inst *Instance) {
+	callrw := func(mode string) Function {
+		return func(ctx *CallContext, args []any) ([]any, error) {
+			id, ok := uintArg(args, 0)
+			name, _ := arg(args, 1).(string)
+			if !ok || name == "" {
+				return nil, ErrProcLua("Usage: call(bucket_id, function_name, args, opts)")
+			}
+			fnArgs, _ := arg(args, 2).([]any)
+			return v.call(ctx, id, mode, name, fnArgs)
+		}
+	}
+	inst.RegisterFunction("vshard.router.callrw", callrw("write"))
+	for _, name := range []string{"callro", "callbro", "callre", "callbre"} {
+		inst.RegisterFunction("vshard.router."+name, callrw("read"))
+	}
+	inst.RegisterFunction("vshard.router.call", func(ctx *CallContext, args []any) ([]any, error) {
+		if len(args) < 2 {
+			return nil, ErrProcLua("Usage: vshard.router.call(bucket_id, mode, function_name, args, opts)")
+		}
+		mode := callMode(args[1])
+		if mode != "read" && mode != "write" {
+			return nil, ErrProcLua("Unknown mode %v", args[1])
+		}
+		return callrw(mode)(ctx, append([]any{args[0]}, args[2:]...))
+	})
+
+	inst.RegisterFunction("vshard.router.route", func(ctx *CallContext, args []any) ([]any, error) {
+		id, ok := uintArg(args, 0)
+		if !ok {
+			return nil, ErrProcLua("Usage: vshard.router.route(bucket_id)")
+		}
+		storage, err := v.route(id)
+		if err != nil {
+			if ve, ok := err.(*vshardErr); ok {
+				return []any{nil, ve.m}, nil
+			}
+			return nil, err
+		}
+		return []any{v.replicasetInfo(storage)}, nil
+	})
+	inst.RegisterFunction("vshard.router.routeall", func(ctx *CallContext, args []any) ([]any, error) {
+		all := make(map[any]any)
+		v.mu.Lock()
+		for _, storage := range v.storages {
+			all[storage.storage.replicasetUUID()] = v.replicasetInfo(storage)
+		}
+		v.mu.Unlock()
+		return []any{all}, nil
+	})
+	inst.RegisterFunction("vshard.router.bucket_count", func(ctx *CallContext, args []any) ([]any, error) {
+		return []any{v.bucketCount}, nil
+	})
+	strcrc32 := func(ctx *CallContext, args []any) ([]any, error) {
+		if len(args) == 0 {
+			return nil, ErrProcLua("Usage: vshard.router.bucket_id_strcrc32(key)")
+		}
+		return []any{bucketID(args[0], v.bucketCount, luaString)}, nil
+	}
+	inst.RegisterFunction("vshard.router.bucket_id_strcrc32", strcrc32)
+	inst.RegisterFunction("vshard.router.bucket_id", strcrc32)
+	inst.RegisterFunction("vshard.router.bucket_id_mpcrc32", func(ctx *CallContext, args []any) ([]any, error) {
+		if len(args) == 0 {
+			return nil, ErrProcLua("Usage: vshard.router.bucket_id_mpcrc32(key)")
+		}
+		return []any{bucketID(args[0], v.bucketCount, luaMsgpack)}, nil
+	})
+	inst.RegisterFunction("vshard.router.info", func(ctx *CallContext, args []any) ([]any, error) {
+		return []any{v.routerInfo()}, nil
+	})
+}
+
+// routerInfo describes the cluster like vshard.router.info()
+func (v *Vshard) routerInfo() map[any]any {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	replicasets := make(map[any]any)
+	var available uint64
+	for _, inst := range v.storages {
+		info := v.replicasetInfo(inst)
+		n := uint64(0)
+		for _, t := range buckets(inst, 0) {
+			if t[1] == bucketActive {
+				n++
+			}
+		}
+		info["bucket"] = map[any]any{"available_rw": n}
+		replicasets[inst.storage.replicasetUUID()] = info
+		available += n
+	}
+	return map[any]any{
+		"status":      uint64(0),
+		"alerts":      []any{},
+		"replicasets": replicasets,
+		"bucket": map[any]any{
+			"available_ro": uint64(0),
+			"available_rw": available,
+			"unreachable":  uint64(0),
+			"unknown":      v.bucketCount - available,
+		},
+	}
+}
+
+// bucketID calculates bucket_id of the key like vshard.router.bucket_id_strcrc32 or _mpcrc32 do:
+// digest.crc32 of each part of the key
+func bucketID(key any, bucketCount uint64, encode func(any) []byte) uint64 {
+	crc := ^uint32(0)
+	parts, ok := key.([]any)
+	if !ok {
+		parts = []any{key}
+	}
+	for _, part := range parts {
+		crc = ^crc32.Update(^crc, crc32cTable, encode(part))
+	}
+	return uint64(crc)%bucketCount + 1
+}
+
+// luaString formats the value like tostring() of Lua does
+func luaString(v any) []byte {
+	const maxExact = 1 << 53 // bigger integers are cdata
+	var s string
+	switch vv := v.(type) {
+	case nil:
+		s = "nil"
+	case string:
+		s = vv
+	case bool:
+		s = strconv.FormatBool(vv)
+	case uint64:
+		if vv < maxExact {
+			s = luaNumber(float64(vv))
+		} else {
+			s = strconv.FormatUint(vv, 10) + "ULL"
+		}
+	case int64:
+		if vv > -maxExact {
+			s = luaNumber(float64(vv))
+		} else {
+			s = strconv.FormatInt(vv, 10) + "LL"
+		}
+	case float32:
+		s = luaNumber(float64(vv))
+	case float64:
+		s = luaNumber(vv)
+	default:
+		s = fmt.Sprint(vv)
+	}
+	return []byte(s)
+}
+
+// luaNumber formats the number by %.14g like Lua does
+func luaNumber(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', 14, 64)
+}
+
+// luaMsgpack encodes the value like msgpack.encode() of Lua does: integral numbers are integers
+func luaMsgpack(v any) []byte {
+	switch vv := v.(type) {
+	case float32:
+		v = float64(vv)
+	}
+	if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		if f >= 0 {
+			v = uint64(f)
+		} else {
+			v = int64(f)
+		}
+	}
+	e := &mpEncoder{}
+	e.encodeAny(v) //nolint: errcheck
+	return e.buf
+}
+
+// vshardErr is an error of vshard, it's returned to clients as a map
+type vshardErr struct {
+	m map[any]any
+}
+
+func (e *vshardErr) Error() string {
+	msg, _ := e.m["message"].(string)
+	return msg
+}
+
+// vshardError makes ShardingError of vshard
+func vshardError(code, bucketID uint64, format string, args ...any) *vshardErr {
+	return &vshardErr{m: map[any]any{
+		"type":      "ShardingError",
+		"code":      code,
+		"name":      vshardErrorNames[code],
+		"bucket_id": bucketID,
+		"message":   fmt.Sprintf(format, args...),
+	}}
+}
+
+// errorMap describes the error of the storage function like lerror.make() of vshard does
+func errorMap(err error) map[any]any {
+	be, ok := AsBoxError(err)
+	if !ok {
+		be = ErrProcLua("%s", err.Error())
+	}
+	return map[any]any{"type": be.Type, "code": uint64(be.Code), "message": be.Message}
+}
+
+// callMode returns the mode of vshard.router.call: 'read', 'write' or {mode = ...}
+func callMode(v any) string {
+	if m, ok := v.(map[any]any); ok {
+		v = m["mode"]
+	}
+	mode, _ := v.(string)
+	return strings.ToLower(mode)
+}
+
+// arg returns the argument of the call, nil if there is no such one
+func arg(args []any, i int) any {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// uintArg returns the argument of the call which is a non-negative integer
+func uintArg(args []any, i int) (uint64, bool) {
+	switch v := arg(args, i).(type) {
+	case uint64:
+		return v, true
+	case int64:
+		return uint64(v), v >= 0
+	case float64:
+		return uint64(v), v >= 0 && v == math.Trunc(v)
+	}
+	return 0, false
+}
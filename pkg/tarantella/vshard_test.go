@@ -0,0 +1,111 @@
+package tarantella
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVshard(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vs := NewVshard(2, 11)
+	var storages []*Instance
+	for _, addr := range []string{"storage-1:3303", "storage-2:3304"} {
+		inst, err := NewInstance(&Config{DataDir: t.TempDir(), ListenOn: addr})
+		require.NoError(t, err)
+		defer inst.Close() //nolint: errcheck
+		require.NoError(t, vs.AddStorage(inst))
+		storages = append(storages, inst)
+	}
+	router, err := NewInstance(&Config{DataDir: t.TempDir()})
+	require.NoError(t, err)
+	defer router.Close() //nolint: errcheck
+	vs.AddRouter(router)
+	vs.RegisterFunction("bands.put", func(ctx *CallContext, args []any) ([]any, error) {
+		tuple, err := ctx.Instance.Execute(ctx, &InsertRequest{SpaceID: testerSpaceID, Tuple: args})
+		return []any{tuple}, err
+	})
+
+	// the first storage gets one bucket more
+	count, err := storages[0].Call(ctx, "vshard.storage.buckets_count", nil)
+	require.NoError(t, err)
+	require.Equal(t, []any{uint64(6)}, count)
+	stat, err := storages[1].Call(ctx, "vshard.storage.bucket_stat", []any{uint64(7)})
+	require.NoError(t, err)
+	require.Equal(t, []any{map[any]any{"id": uint64(7), "status": bucketActive}}, stat)
+
+	rc := connectReplica(t, ctx, router)
+	call := func(name string, args ...any) []any {
+		rc.send(IPROTO_CALL, map[any]any{IPROTO_FUNCTION_NAME: name, IPROTO_TUPLE: args})
+		h, body := rc.read()
+		require.Equal(t, IPROTO_OK, h[IPROTO_REQUEST_TYPE], body)
+		return body[IPROTO_DATA].([]any)
+	}
+
+	tuple := []any{uint64(1), "Roxette", uint64(1986)}
+	require.Equal(t, []any{tuple}, call("vshard.router.callrw", uint64(7), "bands.put", tuple))
+	data, err := storages[1].storage.Select(&SelectRequest{SpaceID: testerSpaceID, Limit: 10, Iterator: ITER_ALL})
+	require.NoError(t, err)
+	require.Equal(t, []any{tuple}, data)
+
+	// errors are returned as values
+	ret := call("vshard.router.callrw", uint64(7), "bands.put", tuple)
+	require.Nil(t, ret[0])
+	require.Equal(t, uint64(ER_TUPLE_FOUND), ret[1].(map[any]any)["code"])
+	ret = call("vshard.router.callro", uint64(2), "no.such.function", []any{})
+	require.Equal(t, uint64(ER_NO_SUCH_PROC), ret[1].(map[any]any)["code"])
+
+	info := call("vshard.router.call", uint64(1), map[any]any{"mode": "read"}, "box.info")[0].(map[any]any)
+	require.Equal(t, storages[0].UUID, info["uuid"])
+	route := call("vshard.router.route", uint64(11))[0].(map[any]any)
+	require.Equal(t, "storage-2:3304", route["master"].(map[any]any)["uri"])
+
+	bucket, _ := storages[0].storage.SpaceByName("_bucket")
+	_, err = storages[0].Execute(ctx, &DeleteRequest{SpaceID: bucket.ID, Key: []any{uint64(3)}})
+	require.NoError(t, err)
+	ret = call("vshard.router.callrw", uint64(3), "box.info")
+	require.Equal(t, "NO_ROUTE_TO_BUCKET", ret[1].(map[any]any)["name"])
+	routerInfo := call("vshard.router.info")[0].(map[any]any)
+	require.Equal(t, uint64(10), routerInfo["bucket"].(map[any]any)["available_rw"])
+
+	rc.send(IPROTO_CALL, map[any]any{IPROTO_FUNCTION_NAME: "vshard.router.callrw", IPROTO_TUPLE: []any{uint64(12), "box.info"}})
+	h, _ := rc.read()
+	require.Equal(t, IPROTO_TYPE_ERROR|uint64(ER_PROC_LUA), h[IPROTO_REQUEST_TYPE])
+
+	// crud of the router goes to the storage of the bucket, select collects all storages
+	id2 := bucketID([]any{uint64(2)}, 11, luaString)
+	ret = call("crud.insert", "tester", []any{uint64(2), "Scorpions", uint64(1965)})
+	require.Nil(t, ret[1])
+	storage, _ := vs.route(id2)
+	data, err = storage.storage.Select(&SelectRequest{SpaceID: testerSpaceID, Key: []any{uint64(2)}, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, data, 1)
+	ret = call("crud.select", "tester", nil)
+	require.Equal(t, []any{tuple, []any{uint64(2), "Scorpions", uint64(1965)}}, ret[0].(map[any]any)["rows"])
+
+	// bucket id of a key is crc32 of its parts
+	id := call("vshard.router.bucket_id_strcrc32", "abc")[0]
+	require.Equal(t, id, call("vshard.router.bucket_id_strcrc32", []any{"abc"})[0])
+	require.Equal(t, uint64(crc32cDigest("abc")%11+1), id)
+	require.Equal(t, call("vshard.router.bucket_id_strcrc32", "12")[0], call("vshard.router.bucket_id_strcrc32", uint64(12))[0])
+	require.Equal(t, call("vshard.router.bucket_id_strcrc32", "1.5")[0], call("vshard.router.bucket_id_strcrc32", 1.5)[0])
+}
+
+// crc32cDigest is digest.crc32 of tarantool
+func crc32cDigest(s string) uint32 {
+	crc := ^uint32(0)
+	for i := 0; i < len(s); i++ {
+		crc ^= uint32(s[i])
+		for k := 0; k < 8; k++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x82f63b78
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,187 @@
+package tarantella
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// WAL modes like box.cfg.wal_mode
+const (
+	WalModeNone  = "none"  // nothing is written
+	WalModeWrite = "write" // rows are written, but not synced
+	WalModeFsync = "fsync" // each commit is synced
+)
+
+const (
+	walSuffix  = ".xlog"
+	snapSuffix = ".snap"
+
+	// checkpointCount is how many snapshots are kept
+	checkpointCount = 2
+)
+
+type (
+	// wal writes rows into the current log file, LSN of each row is assigned by wal
+	wal struct {
+		mu        sync.Mutex
+		mode      string
+		dir       string
+		instance  string // instance UUID for meta of files
+		replicaID uint64
+		vclock    Vclock
+		x         *xlogWriter   // the current file, it's created by the first write after rotation
+		written   chan struct{} // closed and replaced after each write, relays wait for it
+	}
+)
+
+// fileName returns the name of the log or snapshot file starting after the vclock with the signature
+func fileName(dir string, signature uint64, suffix string) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", signature, suffix))
+}
+
+// listFiles returns signatures of files with the suffix in ascending order
+func listFiles(dir, suffix string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var signatures []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		if signature, err := strconv.ParseUint(strings.TrimSuffix(name, suffix), 10, 64); err == nil {
+			signatures = append(signatures, signature)
+		}
+	}
+	sort.Slice(signatures, func(i, j int) bool { return signatures[i] < signatures[j] })
+	return signatures, nil
+}
+
+// openWal prepares writing of logs after the vclock
+func openWal(dir, mode, instance string, replicaID uint64, vclock Vclock) *wal {
+	return &wal{
+		mode:      mode,
+		dir:       dir,
+		instance:  instance,
+		replicaID: replicaID,
+		vclock:    vclock.Copy(),
+		written:   make(chan struct{}),
+	}
+}
+
+// rotate closes the current log file, the next write starts the new one
+func (w *wal) rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+func (w *wal) closeFile() error {
+	if w.x == nil {
+		return nil
+	}
+	err := w.x.close()
+	w.x = nil
+	return err
+}
+
+// write assigns LSNs to rows of the transaction and writes them in one block. Rows received
+// from a master already have LSNs, they are written as they are
+func (w *wal) write(rows []*Row) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := float64(time.Now().UnixNano()) / 1e9
+	lsn := w.vclock[w.replicaID]
+	if rows[0].LSN == 0 {
+		for i, row := range rows {
+			row.LSN = lsn + uint64(i) + 1
+			row.ReplicaID = w.replicaID
+			row.Timestamp = now
+			row.TSN = lsn + 1
+			if i == len(rows)-1 {
+				row.Flags |= IPROTO_FLAG_COMMIT
+			}
+		}
+	}
+	if w.mode != WalModeNone {
+		if err := w.writeRows(rows); err != nil {
+			return w.ioError(err)
+		}
+	}
+	for _, row := range rows {
+		w.vclock.Follow(row.ReplicaID, row.LSN)
+	}
+	close(w.written)
+	w.written = make(chan struct{})
+	return nil
+}
+
+// changed returns the channel which is closed by the next write
+func (w *wal) changed() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+func (w *wal) writeRows(rows []*Row) error {
+	if w.x == nil {
+		meta := &xlogMeta{Filetype: xlogFiletype, Version: versionString(), Instance: w.instance, Vclock: w.vclock}
+		x, err := createXlog(fileName(w.dir, w.vclock.Signature(), walSuffix), meta)
+		if err != nil {
+			return err
+		}
+		w.x = x
+	}
+	err := w.x.writeTx(rows)
+	if err == nil {
+		err = w.x.flush(w.mode == WalModeFsync)
+	}
+	if err != nil {
+		// the block may be on disk partially or even fully, it's cut off, so its LSNs are taken
+		// by the next transaction which starts the new file
+		if derr := w.x.discard(); derr != nil {
+			log.Error().Err(derr).Msg("Unable to discard the failed block")
+		}
+		w.x = nil
+	}
+	return err
+}
+
+func (w *wal) ioError(err error) error {
+	log.Error().Err(err).Str("dir", w.dir).Msg("Unable to write log")
+	return newClientError(3, ER_WAL_IO).WithPrev(newSystemError(err, "%s", err.Error()))
+}
+
+// LSN returns LSN of the last row written by the instance
+func (w *wal) LSN() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.vclock[w.replicaID]
+}
+
+// Vclock returns the copy of the vclock of written rows
+func (w *wal) Vclock() Vclock {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.vclock.Copy()
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
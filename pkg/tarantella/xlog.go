@@ -0,0 +1,523 @@
+package tarantella
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Files of logs and snapshots have the format of tarantool, see
+// https://www.tarantool.io/en/doc/latest/dev_guide/internals/file_formats/
+//
+//	XLOG                        filetype, SNAP for snapshots
+//	0.13                        version of the format
+//	Version: 2.10.4             meta as "Key: value" lines
+//	Instance: <uuid>
+//	VClock: {1: 10}
+//	                            empty line ends meta
+//	<fixheader><rows>...        blocks of rows, a block is written at once
+//	<eof marker>                the file is closed properly
+//
+// The fixheader is 19 bytes: the marker and msgpack of the length of rows, the unused
+// previous CRC and CRC32C of rows, it's padded by a msgpack string. Rows are msgpack
+// maps of the header and the body one by one.
+
+const (
+	xlogFiletype = "XLOG"
+	snapFiletype = "SNAP"
+	xlogVersion  = "0.13"
+
+	rowMarker     uint32 = 0xd5ba0bab // starts a block of rows
+	zrowMarker    uint32 = 0xd5ba0bba // starts a zstd compressed block
+	eofMarker     uint32 = 0xd510aded // ends the file
+	fixheaderSize        = 19
+
+	// xlogBlockThreshold is the size of rows after which the block is written, tarantool uses the same
+	xlogBlockThreshold = 128 * 1024
+)
+
+// crc32c is CRC32 with Castagnoli polynomial, tarantool computes it without the final inversion
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func crc32c(data []byte) uint32 {
+	return ^crc32.Update(^uint32(0), crc32cTable, data)
+}
+
+type (
+	// Row is a record of a log or a snapshot, it's a DML request with LSN
+	Row struct {
+		Type      uint64
+		ReplicaID uint64
+		LSN       uint64
+		TSN       uint64 // LSN of the first row of the transaction, it's 0 for single-row transactions
+		Timestamp float64
+		Flags     uint64
+		Body      map[any]any
+
+		snapshot bool // row is read from a snapshot
+	}
+
+	// xlogMeta is the text header of a file
+	xlogMeta struct {
+		Filetype   string
+		Version    string // version of tarantool which wrote the file
+		Instance   string // instance UUID
+		Vclock     Vclock // vclock before the first row of the file
+		PrevVclock Vclock // vclock of the previous log, it may be absent
+	}
+
+	// xlogWriter appends blocks of rows to the file
+	xlogWriter struct {
+		f    *os.File
+		w    *bufio.Writer
+		path string
+		tx   mpEncoder // rows of the block which is not written yet
+		size int64     // size of the file with flushed blocks
+	}
+
+	// xlogReader reads rows of the file block by block
+	xlogReader struct {
+		f    *os.File
+		r    *bufio.Reader
+		path string
+		meta *xlogMeta
+		rows []*Row // rest of rows of the current block
+		eof  bool   // the EOF marker is read, the file was closed properly
+		pos  int64  // offset after the last complete block
+	}
+)
+
+// Request returns typed DML request of the row
+func (row *Row) Request() (any, error) {
+	switch row.Type {
+	case IPROTO_INSERT, IPROTO_REPLACE, IPROTO_UPDATE, IPROTO_DELETE, IPROTO_UPSERT:
+		return requestFromMap(row.Type, row.Body)
+	}
+	return nil, ErrUnknownRequestType(row.Type)
+}
+
+// isDML is true if the row changes data of spaces
+func (row *Row) isDML() bool {
+	switch row.Type {
+	case IPROTO_INSERT, IPROTO_REPLACE, IPROTO_UPDATE, IPROTO_DELETE, IPROTO_UPSERT:
+		return true
+	}
+	return false
+}
+
+// isCommit is true if the row is the last one of its transaction
+func (row *Row) isCommit() bool {
+	return row.TSN == 0 || row.Flags&IPROTO_FLAG_COMMIT != 0
+}
+
+// header returns the header of the row,
+// TSN and the commit flag are written for multi-row transactions only
+func (row *Row) header() map[any]any {
+	h := map[any]any{IPROTO_REQUEST_TYPE: row.Type}
+	if row.ReplicaID != 0 {
+		h[IPROTO_REPLICA_ID] = row.ReplicaID
+	}
+	if row.LSN != 0 {
+		h[IPROTO_LSN] = row.LSN
+	}
+	if row.Timestamp != 0 {
+		h[IPROTO_TIMESTAMP] = row.Timestamp
+	}
+	if row.TSN != 0 {
+		commit := row.Flags&IPROTO_FLAG_COMMIT != 0
+		if row.TSN != row.LSN || !commit {
+			h[IPROTO_TSN] = row.TSN
+		}
+		flags := row.Flags &^ IPROTO_FLAG_COMMIT
+		if commit && row.TSN != row.LSN {
+			flags |= IPROTO_FLAG_COMMIT
+		}
+		if flags != 0 {
+			h[IPROTO_FLAGS] = flags
+		}
+	}
+	return h
+}
+
+// encode appends header and body of the row to the encoder
+func (row *Row) encode(e *mpEncoder) error {
+	if err := encodeRowMap(e, row.header()); err != nil {
+		return err
+	}
+	if row.Body == nil {
+		return nil
+	}
+	return encodeRowMap(e, row.Body)
+}
+
+// encodeRowMap encodes the header or the body of the row with keys in the order tarantool writes them,
+// so blocks are the same: keys are ascending except operations of UPSERT going before the tuple
+func encodeRowMap(e *mpEncoder, m map[any]any) error {
+	rank := func(k any) uint64 {
+		if k == IPROTO_OPS {
+			return 2*IPROTO_TUPLE - 1
+		}
+		n, _ := k.(uint64)
+		return 2 * n
+	}
+	keys := make([]any, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ri, rj := rank(keys[i]), rank(keys[j]); ri != rj {
+			return ri < rj
+		}
+		return CompareValues(keys[i], keys[j]) < 0
+	})
+
+	e.encodeMapLen(len(m))
+	for _, k := range keys {
+		if err := e.encodeAny(k); err != nil {
+			return err
+		}
+		if err := e.encodeAny(m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeRow decodes the next row, NOP rows have no body
+func decodeRow(d *mpDecoder) (*Row, error) {
+	v, err := d.decodeAny()
+	if err != nil {
+		return nil, err
+	}
+	h, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("row header is not a map")
+	}
+	row := &Row{}
+	row.Type, _ = h[IPROTO_REQUEST_TYPE].(uint64)
+	row.LSN, _ = h[IPROTO_LSN].(uint64)
+	row.ReplicaID, _ = h[IPROTO_REPLICA_ID].(uint64)
+	row.Timestamp, _ = h[IPROTO_TIMESTAMP].(float64)
+	row.Flags, _ = h[IPROTO_FLAGS].(uint64)
+	if tsn, ok := h[IPROTO_TSN].(uint64); ok {
+		row.TSN = tsn
+	} else if row.Flags&IPROTO_FLAG_COMMIT == 0 {
+		// a single-row transaction
+		row.TSN = row.LSN
+		row.Flags |= IPROTO_FLAG_COMMIT
+	}
+	if d.eof() || row.Type == IPROTO_NOP {
+		return row, nil
+	}
+	v, err = d.decodeAny()
+	if err != nil {
+		return nil, err
+	}
+	if row.Body, ok = v.(map[any]any); !ok {
+		return nil, errors.New("row body is not a map")
+	}
+	return row, nil
+}
+
+// String formats meta like tarantool does
+func (m *xlogMeta) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s\n", m.Filetype, xlogVersion)
+	fmt.Fprintf(&b, "Version: %s\n", m.Version)
+	fmt.Fprintf(&b, "Instance: %s\n", m.Instance)
+	fmt.Fprintf(&b, "VClock: %s\n", m.Vclock)
+	if m.PrevVclock != nil {
+		fmt.Fprintf(&b, "PrevVClock: %s\n", m.PrevVclock)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// readXlogMeta reads the text header of the file, it returns the size of the header
+func readXlogMeta(r *bufio.Reader) (*xlogMeta, int64, error) {
+	var size int64
+	line := func() (string, error) {
+		s, err := r.ReadString('\n')
+		if err != nil {
+			return "", errors.Wrap(err, "unable to read meta")
+		}
+		size += int64(len(s))
+		return strings.TrimRight(s, "\r\n"), nil
+	}
+
+	m := &xlogMeta{Vclock: Vclock{}}
+	var err error
+	if m.Filetype, err = line(); err != nil {
+		return nil, 0, err
+	}
+	version, err := line()
+	if err != nil {
+		return nil, 0, err
+	}
+	if version != "0.12" && version != xlogVersion {
+		return nil, 0, errors.Errorf("unsupported file format version '%s'", version)
+	}
+	for {
+		s, err := line()
+		if err != nil {
+			return nil, 0, err
+		}
+		if s == "" {
+			return m, size, nil
+		}
+		key, value, ok := strings.Cut(s, ":")
+		if !ok {
+			return nil, 0, errors.Errorf("invalid meta line '%s'", s)
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Version":
+			m.Version = value
+		case "Instance", "Server":
+			m.Instance = value
+		case "VClock":
+			if m.Vclock, err = parseVclock(value); err != nil {
+				return nil, 0, err
+			}
+		case "PrevVClock":
+			if m.PrevVclock, err = parseVclock(value); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+}
+
+// createXlog creates the file and writes its meta, the existing file is truncated
+func createXlog(path string, meta *xlogMeta) (*xlogWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create file")
+	}
+	x := &xlogWriter{f: f, w: bufio.NewWriterSize(f, connBufferSize), path: path}
+	n, err := x.w.WriteString(meta.String())
+	if err == nil {
+		err = x.w.Flush()
+	}
+	if err != nil {
+		f.Close() //nolint: errcheck
+		return nil, errors.Wrap(err, "unable to write meta")
+	}
+	x.size = int64(n)
+	return x, nil
+}
+
+// add appends the row to the current block
+func (x *xlogWriter) add(row *Row) error {
+	return row.encode(&x.tx)
+}
+
+// pending returns the size of rows of the current block
+func (x *xlogWriter) pending() int {
+	return len(x.tx.buf)
+}
+
+// commit writes the current block into the buffer, it's written into the file by flush
+func (x *xlogWriter) commit() error {
+	if len(x.tx.buf) == 0 {
+		return nil
+	}
+	var fh [fixheaderSize]byte
+	binary.BigEndian.PutUint32(fh[:], rowMarker)
+	e := &mpEncoder{buf: fh[:4:4]}
+	e.encodeUint(uint64(len(x.tx.buf)))
+	e.encodeUint(0) // previous CRC is not used
+	e.encodeUint(uint64(crc32c(x.tx.buf)))
+	if padding := fixheaderSize - len(e.buf); padding > 0 {
+		e.encodeStr(string(make([]byte, padding-1)))
+	}
+	if _, err := x.w.Write(e.buf); err != nil {
+		return err
+	}
+	_, err := x.w.Write(x.tx.buf)
+	x.tx.buf = x.tx.buf[:0]
+	return err
+}
+
+// writeTx writes rows of the transaction in one block
+func (x *xlogWriter) writeTx(rows []*Row) error {
+	for _, row := range rows {
+		if err := x.add(row); err != nil {
+			x.tx.buf = x.tx.buf[:0]
+			return errors.Wrap(err, "unable to encode row")
+		}
+	}
+	return x.commit()
+}
+
+// flush writes buffered blocks into the file, sync makes them durable
+func (x *xlogWriter) flush(sync bool) error {
+	size := x.size + int64(x.w.Buffered())
+	if err := x.w.Flush(); err != nil {
+		return err
+	}
+	if sync {
+		if err := x.f.Sync(); err != nil {
+			return err
+		}
+	}
+	x.size = size
+	return nil
+}
+
+// discard drops blocks which are not flushed truncating the file after the last flushed block
+// and closes it, the writer can't be used after that
+func (x *xlogWriter) discard() error {
+	x.tx.buf = x.tx.buf[:0]
+	x.f.Close() //nolint: errcheck
+	return errors.Wrapf(os.Truncate(x.path, x.size), "unable to truncate %s", x.path)
+}
+
+// close writes the current block and the EOF marker and closes the file
+func (x *xlogWriter) close() error {
+	err := x.commit()
+	if err == nil {
+		err = binary.Write(x.w, binary.BigEndian, eofMarker)
+	}
+	if err == nil {
+		err = x.flush(true)
+	}
+	if cerr := x.f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Wrapf(err, "unable to close %s", x.path)
+}
+
+// openXlog opens the file and reads its meta, the filetype must match
+func openXlog(path, filetype string) (*xlogReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open file")
+	}
+	x := &xlogReader{f: f, r: bufio.NewReaderSize(f, connBufferSize), path: path}
+	if x.meta, x.pos, err = readXlogMeta(x.r); err != nil {
+		f.Close() //nolint: errcheck
+		return nil, errors.Wrap(err, path)
+	}
+	if x.meta.Filetype != filetype {
+		f.Close() //nolint: errcheck
+		return nil, errors.Errorf("%s: expected filetype %s, got %s", path, filetype, x.meta.Filetype)
+	}
+	return x, nil
+}
+
+// next returns the next row, io.EOF is returned at the end, io.ErrUnexpectedEOF for a torn block
+func (x *xlogReader) next() (*Row, error) {
+	for len(x.rows) == 0 {
+		if err := x.readBlock(); err != nil {
+			return nil, err
+		}
+	}
+	row := x.rows[0]
+	x.rows = x.rows[1:]
+	return row, nil
+}
+
+// readBlock reads and checks the next block
+func (x *xlogReader) readBlock() error {
+	var fh [fixheaderSize]byte
+	if _, err := io.ReadFull(x.r, fh[:4]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.EOF // the file is not closed yet
+		}
+		return io.ErrUnexpectedEOF
+	}
+	marker := binary.BigEndian.Uint32(fh[:])
+	switch marker {
+	case eofMarker:
+		x.eof = true
+		x.pos += 4
+		return io.EOF
+	case rowMarker, zrowMarker:
+	default:
+		return errors.Errorf("invalid block marker %#x", marker)
+	}
+	if _, err := io.ReadFull(x.r, fh[4:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	d := &mpDecoder{buf: fh[4:]}
+	var values [3]uint64
+	for i := range values {
+		v, ok, err := d.readUint()
+		if err != nil || !ok {
+			return errors.New("invalid fixheader")
+		}
+		values[i] = v
+	}
+	if !d.eof() {
+		if err := d.skip(); err != nil || !d.eof() {
+			return errors.New("invalid fixheader padding")
+		}
+	}
+	length, crc := values[0], uint32(values[2])
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(x.r, data); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if crc32c(data) != crc {
+		return errors.New("block checksum mismatch")
+	}
+	if marker == zrowMarker {
+		return errors.New("zstd compressed blocks are not supported")
+	}
+
+	d = &mpDecoder{buf: data}
+	for !d.eof() {
+		row, err := decodeRow(d)
+		if err != nil {
+			x.rows = nil
+			return errors.Wrap(err, "unable to decode row")
+		}
+		x.rows = append(x.rows, row)
+	}
+	x.pos += fixheaderSize + int64(length)
+	return nil
+}
+
+// rewind moves back to the end of the last complete block, so the block which is being
+// written may be read again later
+func (x *xlogReader) rewind() error {
+	if _, err := x.f.Seek(x.pos, io.SeekStart); err != nil {
+		return err
+	}
+	x.r.Reset(x.f)
+	return nil
+}
+
+// each calls fn for each row, a torn block at the end of the file is ignored
+func (x *xlogReader) each(fn func(row *Row) error) error {
+	for {
+		row, err := x.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Warn().Str("file", x.path).Msg("Torn block at the end of the file is skipped")
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to read %s", x.path)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+func (x *xlogReader) close() {
+	x.f.Close() //nolint: errcheck
+}
@@ -0,0 +1,220 @@
+package tarantella
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestXlog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "00000000000000000005.xlog")
+	meta := &xlogMeta{
+		Filetype: xlogFiletype,
+		Version:  "2.10.4-0-tarantella",
+		Instance: "a8cc7b28-fb85-4f2a-9cd4-ee4a5cc1ec3f",
+		Vclock:   Vclock{1: 3, 2: 2},
+	}
+
+	x, err := createXlog(path, meta)
+	require.NoError(t, err)
+	rows := []*Row{
+		{Type: IPROTO_INSERT, ReplicaID: 1, LSN: 4, TSN: 4, Timestamp: 1.5,
+			Body: map[any]any{IPROTO_SPACE_ID: uint64(512), IPROTO_TUPLE: []any{uint64(1), "Roxette"}}},
+		{Type: IPROTO_DELETE, ReplicaID: 1, LSN: 5, TSN: 4, Timestamp: 1.5, Flags: IPROTO_FLAG_COMMIT,
+			Body: map[any]any{IPROTO_SPACE_ID: uint64(512), IPROTO_KEY: []any{uint64(2)}}},
+	}
+	require.NoError(t, x.writeTx(rows))
+	single := &Row{Type: IPROTO_NOP, ReplicaID: 2, LSN: 3, TSN: 3, Flags: IPROTO_FLAG_COMMIT}
+	require.NoError(t, x.writeTx([]*Row{single}))
+	require.NoError(t, x.close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	header := "XLOG\n0.13\nVersion: 2.10.4-0-tarantella\nInstance: a8cc7b28-fb85-4f2a-9cd4-ee4a5cc1ec3f\n" +
+		"VClock: {1: 3, 2: 2}\n\n"
+	require.True(t, bytes.HasPrefix(data, []byte(header)))
+	block := data[len(header):]
+	require.Equal(t, rowMarker, binary.BigEndian.Uint32(block))
+	length, ok, err := (&mpDecoder{buf: block[4:fixheaderSize]}).readUint()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, rowMarker, binary.BigEndian.Uint32(block[fixheaderSize+length:]))
+	require.Equal(t, eofMarker, binary.BigEndian.Uint32(data[len(data)-4:]))
+
+	r, err := openXlog(path, xlogFiletype)
+	require.NoError(t, err)
+	require.Equal(t, meta, r.meta)
+	var got []*Row
+	require.NoError(t, r.each(func(row *Row) error {
+		got = append(got, row)
+		return nil
+	}))
+	r.close()
+	require.True(t, r.eof)
+	require.Equal(t, append(rows, single), got)
+	require.False(t, got[0].isCommit())
+	require.True(t, got[1].isCommit())
+
+	_, err = openXlog(path, snapFiletype)
+	require.ErrorContains(t, err, "expected filetype SNAP, got XLOG")
+
+	// the torn block at the end is skipped, the file has no EOF marker
+	require.NoError(t, os.WriteFile(path, data[:len(data)-6], 0o644))
+	r, err = openXlog(path, xlogFiletype)
+	require.NoError(t, err)
+	got = nil
+	require.NoError(t, r.each(func(row *Row) error {
+		got = append(got, row)
+		return nil
+	}))
+	r.close()
+	require.False(t, r.eof)
+	require.Equal(t, rows, got)
+
+	// broken data is detected
+	broken := append([]byte{}, data...)
+	broken[len(header)+fixheaderSize+3] ^= 0xff
+	require.NoError(t, os.WriteFile(path, broken, 0o644))
+	r, err = openXlog(path, xlogFiletype)
+	require.NoError(t, err)
+	require.ErrorContains(t, r.each(func(row *Row) error { return nil }), "block checksum mismatch")
+	r.close()
+}
+
+// files of testdata/tarantool are written like tarantool 2.10 writes them by tool/xlog-fixtures.py
+func TestTarantoolFiles(t *testing.T) {
+	dir := t.TempDir()
+	files, err := filepath.Glob(filepath.Join("testdata", "tarantool", "*"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, filepath.Base(path)), data, 0o644))
+	}
+
+	// the space and its rows are restored from the snapshot, UPDATE and UPSERT of the log are applied
+	inst, err := NewInstance(&Config{DataDir: dir})
+	require.NoError(t, err)
+	defer inst.Close() //nolint: errcheck
+	require.Equal(t, "a8cc7b28-fb85-4f2a-9cd4-ee4a5cc1ec3f", inst.UUID)
+	require.Equal(t, uint64(1), inst.ID)
+	require.Equal(t, Vclock{1: 8}, inst.wal.Vclock())
+	sp, ok := inst.storage.SpaceByName("tester")
+	require.True(t, ok)
+	data, err := inst.storage.Select(&SelectRequest{SpaceID: sp.ID, Limit: 10, Iterator: ITER_ALL})
+	require.NoError(t, err)
+	require.Equal(t, []any{
+		[]any{uint64(1), "Roxette", uint64(1988)},
+		[]any{uint64(3), "Ace of Base", uint64(1994)},
+		[]any{uint64(4), "Europe", uint64(1979)},
+		[]any{uint64(5), "Queen", uint64(1970)},
+	}, data)
+	data, err = inst.storage.Select(&SelectRequest{SpaceID: sp.ID, IndexID: 1, Key: []any{"Queen"}, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, data, 1)
+
+	// the same rows are written into the same blocks
+	for _, path := range files {
+		filetype := xlogFiletype
+		if filepath.Ext(path) == snapSuffix {
+			filetype = snapFiletype
+		}
+		r, err := openXlog(path, filetype)
+		require.NoError(t, err)
+		copied := filepath.Join(t.TempDir(), filepath.Base(path))
+		x, err := createXlog(copied, r.meta)
+		require.NoError(t, err)
+		for {
+			err := r.readBlock()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			require.NoError(t, x.writeTx(r.rows))
+			r.rows = nil
+		}
+		r.close()
+		require.NoError(t, x.close())
+
+		expected, err := os.ReadFile(path)
+		require.NoError(t, err)
+		actual, err := os.ReadFile(copied)
+		require.NoError(t, err)
+		if filetype == xlogFiletype {
+			require.Equal(t, expected, actual, path)
+		} else {
+			// maps of tuples aren't ordered, so only the size is the same
+			require.Len(t, actual, len(expected), path)
+		}
+	}
+}
+
+func TestWalWriteError(t *testing.T) {
+	dir := t.TempDir()
+	w := openWal(dir, WalModeFsync, "a8cc7b28-fb85-4f2a-9cd4-ee4a5cc1ec3f", 1, Vclock{})
+	insert := func(id uint64) []*Row {
+		return []*Row{{Type: IPROTO_INSERT, Body: map[any]any{IPROTO_SPACE_ID: uint64(512), IPROTO_TUPLE: []any{id}}}}
+	}
+	require.NoError(t, w.write(insert(1)))
+
+	// a part of the failed block reaches the disk, the file can't be written anymore
+	path := fileName(dir, 0, walSuffix)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xd5, 0xba, 0x0b, 0xab, 0x10})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	broken, err := os.Open(path)
+	require.NoError(t, err)
+	require.NoError(t, w.x.f.Close())
+	w.x.f = broken
+	w.x.w.Reset(broken)
+
+	err = w.write(insert(2))
+	require.Equal(t, ER_WAL_IO, err.(*BoxError).Code)
+	require.Equal(t, uint64(1), w.LSN())
+
+	// the next transaction takes LSNs of the failed one and starts the new file
+	require.NoError(t, w.write(insert(3)))
+	require.NoError(t, w.close())
+	var got []*Row
+	signatures, err := listFiles(dir, walSuffix)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 1}, signatures)
+	for _, signature := range signatures {
+		r, err := openXlog(fileName(dir, signature, walSuffix), xlogFiletype)
+		require.NoError(t, err)
+		require.NoError(t, r.each(func(row *Row) error {
+			got = append(got, row)
+			return nil
+		}))
+		r.close()
+	}
+	require.Len(t, got, 2)
+	require.Equal(t, uint64(2), got[1].LSN)
+	require.Equal(t, []any{uint64(3)}, got[1].Body[IPROTO_TUPLE])
+}
+
+func TestVclock(t *testing.T) {
+	vc := Vclock{2: 5, 1: 10, 3: 0}
+	require.Equal(t, "{1: 10, 2: 5}", vc.String())
+	require.Equal(t, uint64(15), vc.Signature())
+
+	parsed, err := parseVclock("{1: 10, 2: 5}")
+	require.NoError(t, err)
+	require.Equal(t, Vclock{1: 10, 2: 5}, parsed)
+
+	parsed, err = parseVclock("{}")
+	require.NoError(t, err)
+	require.Equal(t, Vclock{}, parsed)
+
+	_, err = parseVclock("{1 10}")
+	require.Error(t, err)
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -17,6 +20,23 @@ var (
 	cfgLevel   = os.Getenv("LEVEL")
 	cfgListen  = os.Getenv("LISTEN")
 	cfgDataDir = os.Getenv("DATA_DIR")
+
+	cfgWalMode            = os.Getenv("WAL_MODE")
+	cfgCheckpointInterval = os.Getenv("CHECKPOINT_INTERVAL")
+	cfgReplicationTimeout = os.Getenv("REPLICATION_TIMEOUT")
+	cfgReplicationSource  = os.Getenv("REPLICATION_SOURCE")
+	cfgReplicaset         = os.Getenv("REPLICASET")
+	cfgReplicasetLeader   = os.Getenv("REPLICASET_LEADER")
+	cfgSynchroQuorumDelay = os.Getenv("SYNCHRO_QUORUM_DELAY")
+	cfgSynchroTimeout     = os.Getenv("SYNCHRO_TIMEOUT")
+	cfgVshardStorages     = os.Getenv("VSHARD_STORAGES")
+	cfgVshardBucketCount  = os.Getenv("VSHARD_BUCKET_COUNT")
+	cfgQueueTubes         = os.Getenv("QUEUE_TUBES")
+
+	cfgDiffWith     = os.Getenv("DIFF_WITH")
+	cfgDiffUser     = os.Getenv("DIFF_USER")
+	cfgDiffPassword = os.Getenv("DIFF_PASSWORD")
+	cfgDiffReport   = os.Getenv("DIFF_REPORT")
 )
 
 func main() {
@@ -26,18 +46,49 @@ func main() {
 	if cfgDataDir == "" {
 		cfgDataDir = os.TempDir() + "/tarantella"
 	}
+	checkpointInterval := parseDuration("checkpoint interval", cfgCheckpointInterval, time.Hour)
+	replicationTimeout := parseDuration("replication timeout", cfgReplicationTimeout, 0)
+	synchroQuorumDelay := parseDuration("synchro quorum delay", cfgSynchroQuorumDelay, 0)
+	synchroTimeout := parseDuration("synchro timeout", cfgSynchroTimeout, 0)
+	var bucketCount uint64
+	if cfgVshardBucketCount != "" {
+		var err error
+		if bucketCount, err = strconv.ParseUint(cfgVshardBucketCount, 10, 64); err != nil {
+			exitf("unable to parse bucket count %s: %v", cfgVshardBucketCount, err)
+		}
+	}
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 	log.Logger = log.With().Stack().Logger()
 
-	if level, e := zerolog.ParseLevel(cfgLevel); e == nil {
-		zerolog.SetGlobalLevel(level)
-	} else {
-		fmt.Fprintf(os.Stderr, "unable to parse level %s", cfgLevel)
+	level, err := zerolog.ParseLevel(cfgLevel)
+	if err != nil {
+		exitf("unable to parse level %s: %v", cfgLevel, err)
 	}
+	zerolog.SetGlobalLevel(level)
 
 	doMain(func(ctx context.Context, cancel context.CancelFunc) error {
 		defer cancel()
-		return tarantella.StartServer(ctx, cfgListen, cfgDataDir)
+		return tarantella.StartServer(ctx, &tarantella.Config{
+			ListenOn: cfgListen,
+			DataDir:  cfgDataDir,
+
+			WalMode:            cfgWalMode,
+			CheckpointInterval: checkpointInterval,
+			ReplicationTimeout: replicationTimeout,
+			ReplicationSource:  cfgReplicationSource,
+			Replicaset:         splitList(cfgReplicaset),
+			ReplicasetLeader:   cfgReplicasetLeader,
+			SynchroQuorumDelay: synchroQuorumDelay,
+			SynchroTimeout:     synchroTimeout,
+			VshardStorages:     splitList(cfgVshardStorages),
+			VshardBucketCount:  bucketCount,
+			QueueTubes:         splitList(cfgQueueTubes),
+
+			DiffWith:     cfgDiffWith,
+			DiffUser:     cfgDiffUser,
+			DiffPassword: cfgDiffPassword,
+			DiffReport:   cfgDiffReport,
+		})
 	})
 }
 
@@ -72,3 +123,32 @@ func doMain(runFunc func(ctx context.Context, cancel context.CancelFunc) error)
 		log.Info().Err(e).Msg("Exiting.")
 	}
 }
+
+// parseDuration parses the duration of the setting, def is taken if it's not set
+func parseDuration(name, value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		exitf("unable to parse %s %s: %v", name, value, err)
+	}
+	return d
+}
+
+// exitf reports the wrong setting and exits, the server doesn't start with a setting it can't parse
+func exitf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+// splitList splits the comma-separated list like addresses or tubes
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}